@@ -10,7 +10,40 @@ require (
 	gorm.io/driver/postgres v1.5.11
 )
 
-require github.com/google/uuid v1.0.0 // indirect
+require (
+	github.com/coreos/go-oidc/v3 v3.14.1
+	github.com/google/uuid v1.6.0
+	golang.org/x/oauth2 v0.28.0
+)
+
+require github.com/go-jose/go-jose/v4 v4.0.5
+
+require github.com/skip2/go-qrcode v0.0.0-20200617195104-da1b6568686e
+
+require golang.org/x/net v0.38.0
+
+require (
+	github.com/andybalholm/cascadia v1.3.3
+	github.com/emersion/go-imap v1.2.1
+	github.com/emersion/go-smtp v0.24.0
+)
+
+require (
+	github.com/emersion/go-message v0.15.0 // indirect
+	github.com/emersion/go-sasl v0.0.0-20241020182733-b788ff22d5a6 // indirect
+	github.com/emersion/go-textwrapper v0.0.0-20200911093747-65d896831594 // indirect
+)
+
+require (
+	github.com/fxamacker/cbor/v2 v2.8.0 // indirect
+	github.com/go-webauthn/webauthn v0.12.3
+	github.com/go-webauthn/x v0.1.20 // indirect
+	github.com/golang-jwt/jwt/v5 v5.2.2 // indirect
+	github.com/google/go-tpm v0.9.3 // indirect
+	github.com/mitchellh/mapstructure v1.5.0 // indirect
+	github.com/x448/float16 v0.8.4 // indirect
+	golang.org/x/sys v0.31.0 // indirect
+)
 
 require (
 	github.com/gorilla/securecookie v1.1.2
@@ -22,7 +55,6 @@ require (
 	github.com/jinzhu/inflection v1.0.0 // indirect
 	github.com/jinzhu/now v1.1.5 // indirect
 	github.com/matoous/go-nanoid v1.5.1
-	github.com/pborman/uuid v1.2.1
 	github.com/rs/xid v1.6.0
 	golang.org/x/crypto v0.36.0
 	golang.org/x/sync v0.12.0 // indirect
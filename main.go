@@ -14,8 +14,30 @@ import (
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
 	"github.com/go-chi/cors"
+	"github.com/gorilla/securecookie"
+	"github.com/gorilla/sessions"
 	"github.com/swartzfoundation/feedr/frontend"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/api"
+	"github.com/swartzfoundation/feedr/pkg/auth"
 	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/digest"
+	"github.com/swartzfoundation/feedr/pkg/fever"
+	"github.com/swartzfoundation/feedr/pkg/greader"
+	"github.com/swartzfoundation/feedr/pkg/ingest"
+	"github.com/swartzfoundation/feedr/pkg/mailer"
+	"github.com/swartzfoundation/feedr/pkg/newsletter"
+	"github.com/swartzfoundation/feedr/pkg/poller"
+	"github.com/swartzfoundation/feedr/pkg/proxy"
+	"github.com/swartzfoundation/feedr/pkg/publish"
+	"github.com/swartzfoundation/feedr/pkg/rag"
+	"github.com/swartzfoundation/feedr/pkg/rules"
+	"github.com/swartzfoundation/feedr/pkg/scraper"
+	"github.com/swartzfoundation/feedr/pkg/secret"
+	"github.com/swartzfoundation/feedr/pkg/sentiment"
+	"github.com/swartzfoundation/feedr/pkg/summary"
+	"github.com/swartzfoundation/feedr/pkg/tagger"
+	"github.com/swartzfoundation/feedr/pkg/websub"
 )
 
 var BuildTime string // seconds since 1970-01-01 00:00:00 UTC
@@ -29,6 +51,95 @@ func main() {
 		slog.SetLogLoggerLevel(slog.LevelDebug)
 	}
 
+	model.ConnectDatabase(cfg.DB)
+	defer model.CloseDatabase()
+	if err := model.MigrateDatabase(); err != nil {
+		os.Exit(1)
+	}
+
+	sessionKey := []byte(cfg.Session.SessionKey)
+	if len(sessionKey) == 0 {
+		slog.Warn("SESSION_KEY is not set, sessions will not survive a restart")
+		sessionKey = securecookie.GenerateRandomKey(32)
+	}
+	sessionStore := model.NewSessionStore(&sessions.Options{
+		Domain:   cfg.Session.SessionCookieDomain,
+		Path:     "/",
+		SameSite: http.SameSiteLaxMode,
+	}, sessionKey)
+	quit := make(chan struct{})
+	defer close(quit)
+	go sessionStore.PeriodicCleanup(time.Hour, quit)
+
+	auth.ConfigureOIDC(cfg.OIDC, cfg.BASE_URL)
+	if err := auth.ConfigurePasskeys("feedr", cfg.BASE_URL); err != nil {
+		slog.Error("configuring passkeys", "error", err)
+	}
+
+	if err := secret.Configure(cfg.ENCRYPTION_KEY); err != nil {
+		slog.Error("configuring encryption", "error", err)
+		os.Exit(1)
+	}
+	if !secret.Enabled() {
+		slog.Warn("ENCRYPTION_KEY is not set, IMAP accounts cannot be added")
+	}
+
+	if err := scraper.Default.Load(context.Background()); err != nil {
+		slog.Error("loading scraper rules", "error", err)
+	}
+	pipeline := &ingest.Pipeline{}
+	pipeline.Use(ingest.LinkRewriter{}, ingest.Sanitizer{})
+	hub := websub.NewHub(cfg.WebSub, cfg.BASE_URL)
+	publisher := publish.New(hub)
+	ruleEngine := rules.NewEngine()
+	pipeline.OnStored(ruleEngine, tagger.Tagger{}, publisher)
+	pollCtx, stopPolling := context.WithCancel(context.Background())
+	defer stopPolling()
+	feedPoller := poller.New(pipeline)
+	var hubSubscriber *websub.Subscriber
+	if cfg.WebSub.Enabled {
+		hubSubscriber = websub.New(cfg.WebSub, cfg.BASE_URL, pipeline)
+		feedPoller.WebSub = hubSubscriber
+		go hubSubscriber.Run(pollCtx)
+	}
+	go feedPoller.Run(pollCtx)
+	go ruleEngine.Run(pollCtx)
+	go ingest.NewExtractor().Run(pollCtx)
+	go tagger.NewTrainer().Run(pollCtx)
+	go hub.Run(pollCtx)
+	go func() {
+		if err := ingest.Resanitize(pollCtx); err != nil {
+			slog.Error("resanitizing entries", "error", err)
+		}
+	}()
+
+	var inbound *newsletter.Server
+	if cfg.Inbound.ListenAddr != "" {
+		inbound = newsletter.New(cfg.Inbound, pipeline)
+		go func() {
+			if err := inbound.ListenAndServe(); err != nil {
+				slog.Error("newsletter smtp server", "error", err)
+			}
+		}()
+	}
+
+	summary.Configure(cfg.OpenAI)
+	rag.Configure(cfg.OpenAI)
+	if rag.Enabled() {
+		go rag.NewIndexer().Run(pollCtx)
+	}
+	go sentiment.NewWorker(sentiment.New(cfg.OpenAI)).Run(pollCtx)
+	if m := mailer.New(cfg.Email); m != nil {
+		go digest.New(m, cfg.BASE_URL).Run(pollCtx)
+	} else {
+		slog.Warn("SMTP_HOST or FROM_ADDRESS is not set, daily digests will not be sent")
+	}
+
+	if err := proxy.Configure(cfg.Proxy, cfg.BASE_URL); err != nil {
+		slog.Error("configuring image proxy", "error", err)
+		os.Exit(1)
+	}
+
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Use(middleware.RequestID)
@@ -40,16 +151,22 @@ func main() {
 	corz := cors.Options{
 		AllowedOrigins:   cfg.ALLOWED_ORIGINS,
 		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "HEAD", "OPTIONS"},
-		AllowedHeaders:   []string{"Origin", "Content-Length", "Content-Type"},
+		AllowedHeaders:   []string{"Origin", "Content-Length", "Content-Type", "Authorization"},
 		ExposedHeaders:   []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           int(maxAge),
 	}
 	r.Use(cors.Handler(corz))
 
-	r.Get("/api/v1", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte("welcome"))
-	})
+	api.Mount(r)
+	greader.Mount(r)
+	fever.Mount(r)
+	proxy.Mount(r)
+	hub.Mount(r)
+	publisher.Mount(r)
+	if hubSubscriber != nil {
+		hubSubscriber.Mount(r)
+	}
 
 	r.Get("/*", frontend.HandlerFn())
 	slog.Info("Build", "Time", BuildTime)
@@ -68,6 +185,9 @@ func main() {
 		<-sigint
 
 		// We received an interrupt signal, shut down.
+		if inbound != nil {
+			inbound.Close()
+		}
 		if err := srv.Shutdown(context.Background()); err != nil {
 			// Error from closing listeners, or context timeout:
 			slog.Error("HTTP server Shutdown", "error", err)
@@ -0,0 +1,50 @@
+package model
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAPITokenScopes(t *testing.T) {
+	token := &APIToken{Scopes: "feeds:read,entries:write"}
+	if !token.HasScope(ScopeFeedsRead) || !token.HasScope(ScopeEntriesWrite) {
+		t.Errorf("expected token to hold its scopes")
+	}
+	if token.HasScope(ScopeFeedsWrite) {
+		t.Errorf("expected token not to hold feeds:write")
+	}
+	admin := &APIToken{Scopes: ScopeAdmin}
+	if !admin.HasScope(ScopeFeedsWrite) {
+		t.Errorf("expected admin scope to grant feeds:write")
+	}
+}
+
+func TestAPITokenExpiry(t *testing.T) {
+	if (&APIToken{}).IsExpired() {
+		t.Errorf("expected token without expiry not to expire")
+	}
+	if !(&APIToken{ExpiresAt: time.Now().Add(-time.Minute).Unix()}).IsExpired() {
+		t.Errorf("expected past expiry to be expired")
+	}
+}
+
+func TestValidateScopes(t *testing.T) {
+	user := &User{IsActive: true}
+	got, err := ValidateScopes(user, []string{"feeds:read", " feeds:read", "entries:read"})
+	if err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if want := []string{"feeds:read", "entries:read"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v expected %v", got, want)
+	}
+	if _, err := ValidateScopes(user, []string{"admin"}); err == nil {
+		t.Errorf("expected admin scope to be refused to non admin users")
+	}
+	if _, err := ValidateScopes(user, []string{"feeds:delete"}); err == nil {
+		t.Errorf("expected unknown scope to be refused")
+	}
+	if _, err := ValidateScopes(&User{IsActive: true, IsAdmin: true}, []string{"admin"}); err != nil {
+		t.Errorf("expected admin scope for admin user, got %v", err)
+	}
+}
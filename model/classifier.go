@@ -0,0 +1,273 @@
+package model
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/swartzfoundation/feedr/pkg/bayes"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	ClassifierTableName      = "classifiers"
+	TrainingExampleTableName = "training_examples"
+	EntryPredictionTableName = "entry_predictions"
+)
+
+// Classifier is a user's local text classifier, trained from their tags and
+// from the entries they read or skip.
+type Classifier struct {
+	UserID string `json:"-" gorm:"primaryKey"`
+
+	// Tags predicts the user's tags of an entry.
+	// required: true
+	Tags bayes.Model `json:"-" gorm:"serializer:json; type:text"`
+
+	// Interest predicts whether the user reads an entry rather than skip
+	// it, with the InterestLabel label.
+	// required: true
+	Interest bayes.Model `json:"-" gorm:"serializer:json; type:text"`
+
+	// UpdatedAt is the unix timestamp of the last training.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (c *Classifier) TableName() string {
+	return ClassifierTableName
+}
+
+// InterestLabel is the label of the entries the user read in the interest
+// model.
+const InterestLabel = "read"
+
+// GetClassifier returns the user's classifier, empty when it was never
+// trained.
+func GetClassifier(ctx context.Context, userID string) (*Classifier, error) {
+	var c Classifier
+	if err := db.WithContext(ctx).First(&c, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &Classifier{UserID: userID}, nil
+		}
+		return nil, err
+	}
+	return &c, nil
+}
+
+// ListClassifiers returns the classifiers of the users who have one, by
+// user ID.
+func ListClassifiers(ctx context.Context, userIDs []string) (map[string]*Classifier, error) {
+	classifiers := map[string]*Classifier{}
+	if len(userIDs) == 0 {
+		return classifiers, nil
+	}
+	var rows []*Classifier
+	if err := db.WithContext(ctx).Where("user_id IN ?", userIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, c := range rows {
+		classifiers[c.UserID] = c
+	}
+	return classifiers, nil
+}
+
+// TrainingExample is an entry the user tagged, read or skipped, queued for
+// training their classifier when it changes.
+type TrainingExample struct {
+	UserID  string `json:"-" gorm:"primaryKey"`
+	EntryID int64  `json:"entry_id" gorm:"primaryKey"`
+
+	// Tags are the tags the classifier was trained with.
+	// required: true
+	Tags []string `json:"tags" gorm:"serializer:json; type:text"`
+
+	// Terms are the distinct terms the classifier was trained with, so the
+	// example can be untrained after the entry text changes or is deleted.
+	// required: false
+	Terms []string `json:"-" gorm:"serializer:json; type:text"`
+
+	// Interest is 1 when the classifier was trained with the entry read, -1
+	// skipped and 0 neither.
+	// required: true
+	Interest int `json:"interest" gorm:"not null; default:0"`
+
+	// Trained reports whether the classifier counts the entry.
+	// required: true
+	Trained bool `json:"trained" gorm:"not null; default:false"`
+
+	// Pending marks the examples to train again.
+	// required: true
+	Pending bool `json:"pending" gorm:"index; not null; default:false"`
+
+	// Version is incremented each time the example is queued.
+	// required: true
+	Version int64 `json:"version" gorm:"not null; default:0"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (e *TrainingExample) TableName() string {
+	return TrainingExampleTableName
+}
+
+// QueueTraining queues the user's entries for training their classifier.
+func QueueTraining(ctx context.Context, userID string, entryIDs []int64) error {
+	if len(entryIDs) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	rows := make([]TrainingExample, len(entryIDs))
+	for i, id := range entryIDs {
+		rows[i] = TrainingExample{UserID: userID, EntryID: id, Tags: []string{}, Pending: true, Version: 1, UpdatedAt: now}
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "user_id"}, {Name: "entry_id"}},
+		DoUpdates: clause.Assignments(map[string]any{
+			"pending":    true,
+			"version":    gorm.Expr(TrainingExampleTableName + ".version + 1"),
+			"updated_at": now,
+		}),
+	}).CreateInBatches(&rows, 500).Error
+}
+
+// ListPendingTraining returns queued examples, grouped by user.
+func ListPendingTraining(ctx context.Context, limit int) ([]TrainingExample, error) {
+	var examples []TrainingExample
+	result := db.WithContext(ctx).
+		Where("pending").
+		Order("user_id, entry_id").
+		Limit(limit).
+		Find(&examples)
+	return examples, result.Error
+}
+
+// TrainingEntry is an entry with the user's state, from which the labels of
+// a training example are derived.
+type TrainingEntry struct {
+	Entry
+	IsRead    bool
+	IsStarred bool
+	IsSkipped bool
+	IsDeleted bool
+}
+
+// ListTrainingEntries returns the entries with the user's state, by ID.
+func ListTrainingEntries(ctx context.Context, userID string, ids []int64) (map[int64]*TrainingEntry, error) {
+	var rows []*TrainingEntry
+	result := db.WithContext(ctx).Model(&Entry{}).
+		Select(EntryTableName+".*, "+
+			"COALESCE(s.is_read, false) AS is_read, COALESCE(s.is_starred, false) AS is_starred, "+
+			"COALESCE(s.is_skipped, false) AS is_skipped, COALESCE(s.is_deleted, false) AS is_deleted").
+		Joins("LEFT JOIN "+EntryStateTableName+" s ON s.entry_id = "+EntryTableName+".id AND s.user_id = ?", userID).
+		Where(EntryTableName+".id IN ?", ids).
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	entries := make(map[int64]*TrainingEntry, len(rows))
+	for _, e := range rows {
+		entries[e.ID] = e
+	}
+	return entries, nil
+}
+
+// SaveTraining stores the classifier and the labels it was trained with.
+// Examples queued again since they were listed stay pending.
+func SaveTraining(ctx context.Context, c *Classifier, examples []TrainingExample) error {
+	c.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Clauses(clause.OnConflict{UpdateAll: true}).Create(c).Error; err != nil {
+			return err
+		}
+		for i := range examples {
+			ex := &examples[i]
+			// Maps bypass the serializer of the field.
+			tags, err := json.Marshal(ex.Tags)
+			if err != nil {
+				return err
+			}
+			terms, err := json.Marshal(ex.Terms)
+			if err != nil {
+				return err
+			}
+			err = tx.Model(&TrainingExample{}).
+				Where("user_id = ? AND entry_id = ?", ex.UserID, ex.EntryID).
+				Updates(map[string]any{
+					"tags":       string(tags),
+					"terms":      string(terms),
+					"interest":   ex.Interest,
+					"trained":    ex.Trained,
+					"pending":    gorm.Expr("version <> ?", ex.Version),
+					"updated_at": c.UpdatedAt,
+				}).Error
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// PredictedTag is a tag the user's classifier predicts for an entry.
+type PredictedTag struct {
+	Tag         string  `json:"tag"`
+	Probability float64 `json:"probability"`
+}
+
+// EntryPrediction holds the predictions of a user's classifier for a new
+// entry.
+type EntryPrediction struct {
+	UserID  string `json:"-" gorm:"primaryKey"`
+	EntryID int64  `json:"entry_id" gorm:"primaryKey"`
+
+	// Tags are the predicted tags, most probable first.
+	// required: true
+	Tags []PredictedTag `json:"tags" gorm:"serializer:json; type:text"`
+
+	// Interest is the probability that the user reads the entry, unset
+	// while the classifier has too few examples.
+	// required: false
+	Interest *float64 `json:"interest"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at"`
+}
+
+func (p *EntryPrediction) TableName() string {
+	return EntryPredictionTableName
+}
+
+// SaveEntryPredictions stores predictions, replacing earlier ones.
+func SaveEntryPredictions(ctx context.Context, predictions []EntryPrediction) error {
+	if len(predictions) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	for i := range predictions {
+		predictions[i].CreatedAt = now
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).CreateInBatches(&predictions, 500).Error
+}
+
+// ListEntryPredictions returns the user's predictions of the entries by
+// entry ID.
+func ListEntryPredictions(ctx context.Context, userID string, entryIDs []int64) (map[int64]EntryPrediction, error) {
+	predictions := map[int64]EntryPrediction{}
+	if len(entryIDs) == 0 {
+		return predictions, nil
+	}
+	var rows []EntryPrediction
+	if err := db.WithContext(ctx).Where("user_id = ? AND entry_id IN ?", userID, entryIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, p := range rows {
+		predictions[p.EntryID] = p
+	}
+	return predictions, nil
+}
@@ -0,0 +1,147 @@
+package model
+
+import (
+	"context"
+
+	"gorm.io/gorm"
+)
+
+// DuplicateCandidate is a stored entry new entries are compared with.
+type DuplicateCandidate struct {
+	ID           int64
+	FeedID       int64
+	ClusterID    int64
+	Title        string
+	CanonicalURL string
+	SimHash      int64
+}
+
+// ListDuplicateCandidates returns the entries linking to one of the
+// canonical URLs, and the entries created since the given unix timestamp
+// sharing a band with one of the fingerprints, as split by
+// dedup.SplitBands.
+func ListDuplicateCandidates(ctx context.Context, canonicalURLs []string, bands [][4]int32, since int64) ([]DuplicateCandidate, error) {
+	var columns [4][]int32
+	for _, b := range bands {
+		if b[0] == 0 {
+			continue
+		}
+		for i, v := range b {
+			columns[i] = append(columns[i], v)
+		}
+	}
+
+	var cond *gorm.DB
+	if len(canonicalURLs) > 0 {
+		cond = db.Where("canonical_url IN ?", canonicalURLs)
+	}
+	if len(columns[0]) > 0 {
+		similar := db.Where("created_at >= ?", since).Where(
+			db.Where("sim_band0 IN ?", columns[0]).
+				Or("sim_band1 IN ?", columns[1]).
+				Or("sim_band2 IN ?", columns[2]).
+				Or("sim_band3 IN ?", columns[3]))
+		if cond == nil {
+			cond = similar
+		} else {
+			cond = cond.Or(similar)
+		}
+	}
+	if cond == nil {
+		return nil, nil
+	}
+
+	var candidates []DuplicateCandidate
+	result := db.WithContext(ctx).Model(&Entry{}).
+		Select("id, feed_id, cluster_id, title, canonical_url, sim_hash").
+		Where(cond).
+		Order("id").
+		Find(&candidates)
+	return candidates, result.Error
+}
+
+// StartClusters makes the given entries the first of their own cluster,
+// unless they already belong to one.
+func StartClusters(ctx context.Context, ids []int64) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Model(&Entry{}).
+		Where("id IN ? AND cluster_id = 0", ids).
+		Update("cluster_id", gorm.Expr("id")).Error
+}
+
+// ClusterMember is an entry of a cluster as shown next to another one.
+type ClusterMember struct {
+	EntryID   int64  `json:"entry_id"`
+	FeedID    int64  `json:"feed_id"`
+	FeedTitle string `json:"feed_title"`
+	URL       string `json:"url"`
+	IsRead    bool   `json:"is_read"`
+	ClusterID int64  `json:"-"`
+}
+
+// ListClusterMembers returns the entries of the clusters visible to the
+// user, by cluster ID, titled with the user's name for their feed.
+func ListClusterMembers(ctx context.Context, userID string, clusterIDs []int64) (map[int64][]ClusterMember, error) {
+	members := map[int64][]ClusterMember{}
+	if len(clusterIDs) == 0 {
+		return members, nil
+	}
+	var rows []ClusterMember
+	result := db.WithContext(ctx).Table(EntryTableName).
+		Select(`entries.id AS entry_id, entries.feed_id, entries.url, entries.cluster_id,
+			COALESCE(NULLIF(subscriptions.title, ''), feeds.title) AS feed_title,
+			COALESCE(entry_states.is_read, false) AS is_read`).
+		Joins("JOIN subscriptions ON subscriptions.feed_id = entries.feed_id AND subscriptions.user_id = ?", userID).
+		Joins("JOIN feeds ON feeds.id = entries.feed_id").
+		Joins("LEFT JOIN entry_states ON entry_states.entry_id = entries.id AND entry_states.user_id = ?", userID).
+		Where("entries.cluster_id IN ? AND COALESCE(entry_states.is_deleted, false) = false", clusterIDs).
+		Order("entries.id").
+		Scan(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, m := range rows {
+		members[m.ClusterID] = append(members[m.ClusterID], m)
+	}
+	return members, nil
+}
+
+// AddAlsoIn fills the AlsoIn field of the clustered entries.
+func AddAlsoIn(ctx context.Context, userID string, entries []UserEntry) error {
+	var clusterIDs []int64
+	for _, e := range entries {
+		if e.ClusterID != 0 {
+			clusterIDs = append(clusterIDs, e.ClusterID)
+		}
+	}
+	members, err := ListClusterMembers(ctx, userID, clusterIDs)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		e := &entries[i]
+		for _, m := range members[e.ClusterID] {
+			if e.ClusterID != 0 && m.EntryID != e.ID {
+				e.AlsoIn = append(e.AlsoIn, m)
+			}
+		}
+	}
+	return nil
+}
+
+// ExpandClusters returns ids along with the IDs of the entries the user
+// can see that share a cluster with them.
+func ExpandClusters(ctx context.Context, userID string, ids []int64) ([]int64, error) {
+	if len(ids) == 0 {
+		return ids, nil
+	}
+	var expanded []int64
+	result := db.WithContext(ctx).Table(EntryTableName).
+		Joins("JOIN subscriptions ON subscriptions.feed_id = entries.feed_id AND subscriptions.user_id = ?", userID).
+		Where("entries.id IN ? OR entries.cluster_id IN (?)", ids,
+			db.Model(&Entry{}).Select("cluster_id").Where("id IN ? AND cluster_id <> 0", ids)).
+		Pluck("entries.id", &expanded)
+	return expanded, result.Error
+}
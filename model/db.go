@@ -1,6 +1,7 @@
 package model
 
 import (
+	"errors"
 	"log/slog"
 	"os"
 	"time"
@@ -13,6 +14,10 @@ import (
 
 var db *gorm.DB
 
+// ErrNotFound is returned when a record does not exist or is not owned by
+// the requesting user.
+var ErrNotFound = errors.New("not found")
+
 // GetDB returns the database connection
 func GetDB() *gorm.DB {
 	if db == nil {
@@ -68,6 +73,42 @@ func PingDatabase() error {
 var tables = []interface{}{
 	&User{},
 	&Session{},
+	&Feed{},
+	&Folder{},
+	&Subscription{},
+	&Entry{},
+	&EntryState{},
+	&EntrySource{},
+	&ReaderToken{},
+	&FeverCredential{},
+	&FeedIcon{},
+	&APIToken{},
+	&UserIdentity{},
+	&TwoFactor{},
+	&RecoveryCode{},
+	&Passkey{},
+	&ScraperRule{},
+	&InboundAddress{},
+	&IMAPAccount{},
+	&Enclosure{},
+	&PlaybackPosition{},
+	&WebSubSubscription{},
+	&HubSubscription{},
+	&HubDelivery{},
+	&Rule{},
+	&EntryTag{},
+	&Notification{},
+	&TagSuggestion{},
+	&TagFeedback{},
+	&TagKeywords{},
+	&TermCount{},
+	&Classifier{},
+	&TrainingExample{},
+	&EntryPrediction{},
+	&Summary{},
+	&SummaryUsage{},
+	&DigestSettings{},
+	&EntryChunk{},
 }
 
 func Tables() []interface{} {
@@ -81,6 +122,7 @@ func MigrateDatabase() error {
 		slog.Error("db: migrating database", "error", err.Error())
 		return err
 	}
+	enableVectorSearch()
 
 	slog.Warn("db migration complete")
 	return nil
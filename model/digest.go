@@ -0,0 +1,94 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const DigestSettingsTableName = "digest_settings"
+
+// DefaultDigestEntries is the number of entries of a digest by default.
+const DefaultDigestEntries = 10
+
+// DigestSettings configures the daily digest email of a user.
+type DigestSettings struct {
+	UserID string `json:"-" gorm:"primaryKey"`
+
+	// Enabled is true if the user receives the digest.
+	// required: true
+	Enabled bool `json:"enabled" gorm:"not null; default:false"`
+
+	// Hour and Minute are the local time the digest is sent at.
+	// required: true
+	Hour   int `json:"hour" gorm:"not null; default:7"`
+	Minute int `json:"minute" gorm:"not null; default:0"`
+
+	// TimeZone is the IANA time zone of the user, such as Europe/Paris.
+	// required: true
+	TimeZone string `json:"time_zone" gorm:"not null; default:'UTC'"`
+
+	// MaxEntries is the number of entries of the digest.
+	// required: true
+	MaxEntries int `json:"max_entries" gorm:"not null; default:10"`
+
+	// LastSentAt is the unix timestamp of the last digest.
+	// required: false
+	LastSentAt int64 `json:"last_sent_at,omitempty"`
+
+	// NextSendAt is the unix timestamp the next digest is due at.
+	// required: false
+	NextSendAt int64 `json:"next_send_at,omitempty" gorm:"index"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (s *DigestSettings) TableName() string {
+	return DigestSettingsTableName
+}
+
+// GetDigestSettings returns the user's digest settings, the defaults when
+// they never set them.
+func GetDigestSettings(ctx context.Context, userID string) (*DigestSettings, error) {
+	var s DigestSettings
+	if err := db.WithContext(ctx).First(&s, "user_id = ?", userID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &DigestSettings{UserID: userID, Hour: 7, TimeZone: "UTC", MaxEntries: DefaultDigestEntries}, nil
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveDigestSettings stores the user's digest settings.
+func SaveDigestSettings(ctx context.Context, s *DigestSettings) error {
+	s.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(s).Error
+}
+
+// ListDueDigests returns the enabled digests due at now of active users.
+func ListDueDigests(ctx context.Context, now int64, limit int) ([]DigestSettings, error) {
+	var due []DigestSettings
+	result := db.WithContext(ctx).
+		Joins("JOIN "+UserTableName+" u ON u.id = "+DigestSettingsTableName+".user_id").
+		Where(DigestSettingsTableName+".enabled AND "+DigestSettingsTableName+".next_send_at <= ?", now).
+		Where("u.is_active").
+		Order(DigestSettingsTableName + ".next_send_at").
+		Limit(limit).
+		Find(&due)
+	return due, result.Error
+}
+
+// UpdateDigestSchedule records when the digest was sent and when the next
+// one is due.
+func UpdateDigestSchedule(ctx context.Context, s *DigestSettings) error {
+	return db.WithContext(ctx).Model(s).Updates(map[string]any{
+		"last_sent_at": s.LastSentAt,
+		"next_send_at": s.NextSendAt,
+	}).Error
+}
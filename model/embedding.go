@@ -0,0 +1,203 @@
+package model
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const EntryChunkTableName = "entry_chunks"
+
+// Vector is an embedding. It is stored in the text format of pgvector,
+// "[1,2,3]", so that the column can be cast to the vector type when the
+// extension is installed.
+type Vector []float32
+
+func (v Vector) Value() (driver.Value, error) {
+	var b strings.Builder
+	b.WriteByte('[')
+	for i, x := range v {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(strconv.FormatFloat(float64(x), 'g', -1, 32))
+	}
+	b.WriteByte(']')
+	return b.String(), nil
+}
+
+func (v *Vector) Scan(src any) error {
+	var s string
+	switch src := src.(type) {
+	case string:
+		s = src
+	case []byte:
+		s = string(src)
+	case nil:
+		*v = nil
+		return nil
+	default:
+		return fmt.Errorf("model: cannot scan %T into a vector", src)
+	}
+	s = strings.TrimSpace(s)
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	if s == "" {
+		*v = Vector{}
+		return nil
+	}
+	parts := strings.Split(s, ",")
+	out := make(Vector, len(parts))
+	for i, p := range parts {
+		x, err := strconv.ParseFloat(strings.TrimSpace(p), 32)
+		if err != nil {
+			return fmt.Errorf("model: invalid vector: %w", err)
+		}
+		out[i] = float32(x)
+	}
+	*v = out
+	return nil
+}
+
+// EntryChunk is a passage of an entry with its embedding, retrieved to
+// answer questions.
+type EntryChunk struct {
+	ID      int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+	EntryID int64 `json:"entry_id" gorm:"index; not null"`
+
+	// Position is the index of the chunk in the entry.
+	// required: true
+	Position int `json:"position"`
+
+	// Text is the plain text of the passage.
+	// required: true
+	Text string `json:"text" gorm:"type:text"`
+
+	// Model and Dims identify the embedding space; embeddings of other
+	// models are not compared.
+	// required: true
+	Model string `json:"model" gorm:"index:idx_entry_chunks_model"`
+	Dims  int    `json:"dims" gorm:"index:idx_entry_chunks_model"`
+
+	// Embedding is the embedding of the passage.
+	// required: true
+	Embedding Vector `json:"-" gorm:"type:text"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at"`
+}
+
+func (c *EntryChunk) TableName() string {
+	return EntryChunkTableName
+}
+
+// vectorSearch reports whether the pgvector extension is installed.
+var vectorSearch bool
+
+// VectorSearch reports whether chunks are searched by the database with
+// pgvector, rather than compared in memory.
+func VectorSearch() bool {
+	return vectorSearch
+}
+
+// enableVectorSearch installs the pgvector extension when possible.
+func enableVectorSearch() {
+	if err := db.Exec("CREATE EXTENSION IF NOT EXISTS vector").Error; err != nil {
+		// The extension may be installed by an administrator while the
+		// database user cannot create it.
+		var n int64
+		db.Raw("SELECT COUNT(*) FROM pg_extension WHERE extname = 'vector'").Scan(&n)
+		vectorSearch = n > 0
+	} else {
+		vectorSearch = true
+	}
+	if !vectorSearch {
+		slog.Info("db: pgvector is not available, questions are answered by comparing embeddings in memory")
+	}
+}
+
+// ListEntriesToIndex returns up to limit entries of subscribed feeds
+// published after publishedAfter that were never split into chunks, newest
+// first.
+func ListEntriesToIndex(ctx context.Context, publishedAfter int64, limit int) ([]Entry, error) {
+	var entries []Entry
+	result := db.WithContext(ctx).
+		Where("indexed_at = 0 AND published_at > ?", publishedAfter).
+		Where("EXISTS (SELECT 1 FROM " + SubscriptionTableName + " s WHERE s.feed_id = entries.feed_id)").
+		Order("id DESC").
+		Limit(limit).
+		Find(&entries)
+	return entries, result.Error
+}
+
+// SaveEntryChunks replaces the chunks of an entry and marks it indexed.
+func SaveEntryChunks(ctx context.Context, entryID int64, chunks []EntryChunk) error {
+	now := time.Now().Unix()
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("entry_id = ?", entryID).Delete(&EntryChunk{}).Error; err != nil {
+			return err
+		}
+		if len(chunks) > 0 {
+			for i := range chunks {
+				chunks[i].EntryID = entryID
+				chunks[i].CreatedAt = now
+			}
+			if err := tx.Create(&chunks).Error; err != nil {
+				return err
+			}
+		}
+		return tx.Model(&Entry{}).Where("id = ?", entryID).Update("indexed_at", now).Error
+	})
+}
+
+// ChunkMatch is a chunk with its entry and its cosine distance to a query,
+// when computed by the database.
+type ChunkMatch struct {
+	EntryChunk
+	Title       string
+	URL         string
+	PublishedAt int64
+	Distance    float64
+}
+
+// chunks returns the chunks of the entries matching q embedded by the model
+// in dims dimensions.
+func (q *EntryQuery) chunks(ctx context.Context, model string, dims int) *gorm.DB {
+	visible := q.scope(db.WithContext(ctx)).Select("entries.id")
+	return db.WithContext(ctx).Table(EntryChunkTableName).
+		Joins("JOIN "+EntryTableName+" e ON e.id = "+EntryChunkTableName+".entry_id").
+		Where(EntryChunkTableName+".model = ? AND "+EntryChunkTableName+".dims = ?", model, dims).
+		Where(EntryChunkTableName+".entry_id IN (?)", visible)
+}
+
+const chunkMatchColumns = EntryChunkTableName + ".*, e.title AS title, e.url AS url, e.published_at AS published_at"
+
+// NearestChunks returns the limit chunks of the entries matching q closest
+// to v, with pgvector.
+func NearestChunks(ctx context.Context, q EntryQuery, model string, v Vector, limit int) ([]ChunkMatch, error) {
+	var matches []ChunkMatch
+	result := q.chunks(ctx, model, len(v)).
+		Select(chunkMatchColumns+", "+EntryChunkTableName+".embedding::vector <=> ?::vector AS distance", v).
+		Order("distance").
+		Limit(limit).
+		Scan(&matches)
+	return matches, result.Error
+}
+
+// ListRecentChunks returns the chunks of the newest entries matching q, up
+// to limit, for comparing them in memory.
+func ListRecentChunks(ctx context.Context, q EntryQuery, model string, dims, limit int) ([]ChunkMatch, error) {
+	var matches []ChunkMatch
+	result := q.chunks(ctx, model, dims).
+		Select(chunkMatchColumns).
+		Order("e.published_at DESC, " + EntryChunkTableName + ".id").
+		Limit(limit).
+		Scan(&matches)
+	return matches, result.Error
+}
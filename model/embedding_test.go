@@ -0,0 +1,21 @@
+package model
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestVector(t *testing.T) {
+	v := Vector{1, -0.5, 3.25}
+	s, err := v.Value()
+	if err != nil || s != "[1,-0.5,3.25]" {
+		t.Fatalf("Value = %v, %v", s, err)
+	}
+	var got Vector
+	if err := got.Scan([]byte(s.(string))); err != nil || !slices.Equal(got, v) {
+		t.Errorf("Scan = %v, %v, want %v", got, err, v)
+	}
+	if err := got.Scan("[1,x]"); err == nil {
+		t.Error("Scan of an invalid vector succeeded")
+	}
+}
@@ -0,0 +1,619 @@
+package model
+
+import (
+	"context"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const EntryTableName = "entries"
+const EntryStateTableName = "entry_states"
+const EntrySourceTableName = "entry_sources"
+
+// Entry is a single item published by a feed.
+type Entry struct {
+	// ID is the unique ID for the entry.
+	// required: true
+	ID int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+
+	// FeedID is the ID of the feed the entry belongs to.
+	// required: true
+	FeedID int64 `json:"feed_id" gorm:"uniqueIndex:idx_entries_feed_guid; not null;"`
+
+	// GUID is the identifier the feed uses for the entry.
+	// required: true
+	GUID string `json:"guid" gorm:"uniqueIndex:idx_entries_feed_guid; not null;"`
+
+	// URL is the link to the entry on the publisher's website.
+	// required: false
+	URL string `json:"url"`
+
+	// Title is the title of the entry.
+	// required: false
+	Title string `json:"title"`
+
+	// Author is the author of the entry.
+	// required: false
+	Author string `json:"author,omitempty"`
+
+	// Content is the HTML content of the entry provided by the feed, cleaned
+	// by the sanitizer.
+	// required: false
+	Content string `json:"content" gorm:"type:text"`
+
+	// ExtractedContent is the readable article fetched from URL, for feeds
+	// that only ship summaries, cleaned by the sanitizer.
+	// required: false
+	ExtractedContent string `json:"extracted_content,omitempty" gorm:"type:text"`
+
+	// ExtractedAt is the unix timestamp the article was extracted at.
+	// required: false
+	ExtractedAt int64 `json:"extracted_at,omitempty"`
+
+	// Categories are the categories the feed filed the entry under.
+	// required: false
+	Categories []string `json:"categories,omitempty" gorm:"serializer:json; type:text"`
+
+	// ImageURL is the lead image of the entry.
+	// required: false
+	ImageURL string `json:"image_url,omitempty"`
+
+	// Enclosures are the media files attached to the entry, such as
+	// podcast episodes.
+	// required: false
+	Enclosures []Enclosure `json:"enclosures,omitempty" gorm:"foreignKey:EntryID"`
+
+	// Episode and Season number podcast episodes.
+	// required: false
+	Episode int `json:"episode,omitempty"`
+	Season  int `json:"season,omitempty"`
+
+	// ChaptersURL links to the Podcasting 2.0 chapters of the episode.
+	// required: false
+	ChaptersURL string `json:"chapters_url,omitempty"`
+
+	// ChaptersType is the MIME type of the chapters.
+	// required: false
+	ChaptersType string `json:"chapters_type,omitempty"`
+
+	// Transcripts of the episode.
+	// required: false
+	Transcripts []Transcript `json:"transcripts,omitempty" gorm:"serializer:json; type:text"`
+
+	// CanonicalURL is URL normalized to recognize the same story linked
+	// with different tracking parameters.
+	// required: false
+	CanonicalURL string `json:"-" gorm:"index"`
+
+	// SimHash is the fingerprint of the title and content, 0 for texts too
+	// short to be compared. It holds the bits of an unsigned value.
+	SimHash int64 `json:"-" gorm:"default:0"`
+
+	// SimBand0 to SimBand3 are the bands of SimHash, indexed to look up
+	// near duplicates. They are 0 when SimHash is.
+	// required: false
+	SimBand0 int32 `json:"-" gorm:"index; default:0"`
+	SimBand1 int32 `json:"-" gorm:"index; default:0"`
+	SimBand2 int32 `json:"-" gorm:"index; default:0"`
+	SimBand3 int32 `json:"-" gorm:"index; default:0"`
+
+	// ClusterID is the ID of the first entry of the group of entries from
+	// different feeds telling the same story, or 0.
+	// required: false
+	ClusterID int64 `json:"cluster_id,omitempty" gorm:"index; default:0"`
+
+	// SanitizerVersion is the version of the sanitizer rules Content and
+	// ExtractedContent were last cleaned with.
+	SanitizerVersion int `json:"-" gorm:"index; default:0"`
+
+	// Source is the HTML of the entry before sanitizing, when loaded.
+	Source *EntrySource `json:"-" gorm:"-"`
+
+	// IndexedAt is the unix timestamp the entry was split into embedded
+	// chunks at, 0 while it is not.
+	IndexedAt int64 `json:"-" gorm:"index; default:0"`
+
+	// Sentiment is the tone of the entry, positive, negative or neutral,
+	// empty while it is not analyzed.
+	// required: false
+	Sentiment string `json:"sentiment,omitempty" gorm:"index; default:''"`
+
+	// SentimentScore is the tone of the entry from -1, negative, to 1,
+	// positive.
+	// required: false
+	SentimentScore *float64 `json:"sentiment_score,omitempty"`
+
+	// PublishedAt is the unix timestamp the entry was published at.
+	// required: true
+	PublishedAt int64 `json:"published_at" gorm:"index"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (e *Entry) TableName() string {
+	return EntryTableName
+}
+
+// Body returns the HTML of the entry: the extracted article when there is
+// one, the content of the feed otherwise.
+func (e *Entry) Body() string {
+	if e.ExtractedContent != "" {
+		return e.ExtractedContent
+	}
+	return e.Content
+}
+
+// EntryState holds the per-user read and starred flags of an entry. Entries
+// without a state row are unread and not starred.
+type EntryState struct {
+	UserID    string `json:"-" gorm:"primaryKey"`
+	EntryID   int64  `json:"entry_id" gorm:"primaryKey"`
+	IsRead    bool   `json:"is_read" gorm:"index"`
+	IsStarred bool   `json:"is_starred" gorm:"index"`
+	// IsDeleted hides the entry from the user, such as when a filter rule
+	// deletes it; entries are shared between subscribers.
+	IsDeleted bool `json:"-" gorm:"default:false"`
+	// IsSkipped marks entries read without being opened, in bulk or by a
+	// filter rule.
+	IsSkipped bool  `json:"-" gorm:"default:false"`
+	ReadAt    int64 `json:"read_at,omitempty"`
+	StarredAt int64 `json:"starred_at,omitempty"`
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (s *EntryState) TableName() string {
+	return EntryStateTableName
+}
+
+// EntrySource keeps the HTML of an entry as received, so that it can be
+// cleaned again when the sanitizer rules change. It is stored apart from
+// the entry, which is read far more often.
+type EntrySource struct {
+	EntryID          int64  `gorm:"primaryKey"`
+	Content          string `gorm:"type:text"`
+	ExtractedContent string `gorm:"type:text"`
+}
+
+func (s *EntrySource) TableName() string {
+	return EntrySourceTableName
+}
+
+// UserEntry is an entry as seen by a given user.
+type UserEntry struct {
+	Entry
+	IsRead    bool `json:"is_read"`
+	IsStarred bool `json:"is_starred"`
+	// AlsoIn lists the other entries of the cluster the user can see.
+	AlsoIn []ClusterMember `json:"also_in,omitempty" gorm:"-"`
+	// Tags are the user's tags of the entry.
+	Tags []string `json:"tags" gorm:"-"`
+	// SuggestedTags are the pending suggestions of the automatic tagger.
+	SuggestedTags []TagSuggestion `json:"suggested_tags,omitempty" gorm:"-"`
+	// PredictedTags are the tags the user's classifier predicts, except
+	// those the entry has.
+	PredictedTags []PredictedTag `json:"predicted_tags,omitempty" gorm:"-"`
+	// PredictedInterest is the probability that the user reads the entry,
+	// according to their classifier.
+	PredictedInterest *float64 `json:"predicted_interest,omitempty" gorm:"-"`
+}
+
+// EntryQuery selects the entries visible to a user through their
+// subscriptions. Zero values are ignored.
+type EntryQuery struct {
+	UserID   string
+	FeedID   int64
+	FolderID int64
+	EntryIDs []int64
+
+	Read    *bool
+	Starred *bool
+
+	// PublishedAfter and PublishedBefore bound published_at, exclusive.
+	PublishedAfter  int64
+	PublishedBefore int64
+
+	// SinceID and MaxID bound the entry ID; SinceID is exclusive and MaxID
+	// inclusive.
+	SinceID int64
+	MaxID   int64
+
+	// Tag selects the entries the user tagged with it.
+	Tag string
+
+	// Sentiment selects the entries of a tone, SentimentPositive,
+	// SentimentNegative or SentimentNeutral.
+	Sentiment string
+
+	// Collapse keeps only the first entry of each cluster visible to the
+	// user.
+	Collapse bool
+
+	// OrderBySentiment sorts by sentiment score, most positive first unless
+	// Ascending, then by publication date. Entries not analyzed come last.
+	OrderBySentiment bool
+
+	// OrderByID sorts by entry ID instead of publication date.
+	OrderByID bool
+	Ascending bool
+	Limit     int
+	Offset    int
+}
+
+func (q *EntryQuery) scope(tx *gorm.DB) *gorm.DB {
+	tx = tx.Table(EntryTableName).
+		Joins("JOIN subscriptions ON subscriptions.feed_id = entries.feed_id AND subscriptions.user_id = ?", q.UserID).
+		Joins("LEFT JOIN entry_states ON entry_states.entry_id = entries.id AND entry_states.user_id = ?", q.UserID).
+		Where("COALESCE(entry_states.is_deleted, false) = false")
+	if q.FeedID != 0 {
+		tx = tx.Where("entries.feed_id = ?", q.FeedID)
+	}
+	if q.FolderID != 0 {
+		tx = tx.Where("subscriptions.folder_id = ?", q.FolderID)
+	}
+	if len(q.EntryIDs) > 0 {
+		tx = tx.Where("entries.id IN ?", q.EntryIDs)
+	}
+	if q.Tag != "" {
+		tx = tx.Where("EXISTS (SELECT 1 FROM entry_tags WHERE entry_tags.entry_id = entries.id AND entry_tags.user_id = ? AND entry_tags.tag = ?)", q.UserID, q.Tag)
+	}
+	if q.Sentiment != "" {
+		tx = tx.Where("entries.sentiment = ?", q.Sentiment)
+	}
+	if q.Read != nil {
+		tx = tx.Where("COALESCE(entry_states.is_read, false) = ?", *q.Read)
+	}
+	if q.Starred != nil {
+		tx = tx.Where("COALESCE(entry_states.is_starred, false) = ?", *q.Starred)
+	}
+	if q.PublishedAfter != 0 {
+		tx = tx.Where("entries.published_at > ?", q.PublishedAfter)
+	}
+	if q.PublishedBefore != 0 {
+		tx = tx.Where("entries.published_at < ?", q.PublishedBefore)
+	}
+	if q.SinceID != 0 {
+		tx = tx.Where("entries.id > ?", q.SinceID)
+	}
+	if q.MaxID != 0 {
+		tx = tx.Where("entries.id <= ?", q.MaxID)
+	}
+	if q.Collapse {
+		// The first entry of the cluster matching the read filter stands for
+		// it, so a cluster stays listed while any of its entries is unread.
+		first := db.Table(EntryTableName+" c").Select("MIN(c.id)").
+			Joins("JOIN subscriptions cs ON cs.feed_id = c.feed_id AND cs.user_id = ?", q.UserID).
+			Where("c.cluster_id = entries.cluster_id")
+		if q.Read != nil {
+			first = first.
+				Joins("LEFT JOIN entry_states cst ON cst.entry_id = c.id AND cst.user_id = ?", q.UserID).
+				Where("COALESCE(cst.is_read, false) = ?", *q.Read)
+		}
+		tx = tx.Where("entries.cluster_id = 0 OR entries.id = (?)", first)
+	}
+	return tx
+}
+
+func (q *EntryQuery) page(tx *gorm.DB) *gorm.DB {
+	switch {
+	case q.OrderBySentiment && q.Ascending:
+		tx = tx.Order("entries.sentiment_score ASC NULLS LAST, entries.published_at DESC, entries.id DESC")
+	case q.OrderBySentiment:
+		tx = tx.Order("entries.sentiment_score DESC NULLS LAST, entries.published_at DESC, entries.id DESC")
+	case q.OrderByID && q.Ascending:
+		tx = tx.Order("entries.id ASC")
+	case q.OrderByID:
+		tx = tx.Order("entries.id DESC")
+	case q.Ascending:
+		tx = tx.Order("entries.published_at ASC, entries.id ASC")
+	default:
+		tx = tx.Order("entries.published_at DESC, entries.id DESC")
+	}
+	if q.Limit > 0 {
+		tx = tx.Limit(q.Limit)
+	}
+	if q.Offset > 0 {
+		tx = tx.Offset(q.Offset)
+	}
+	return tx
+}
+
+// ListEntries returns the entries matching q along with the user's state.
+func ListEntries(ctx context.Context, q EntryQuery) ([]UserEntry, error) {
+	var entries []UserEntry
+	tx := q.scope(db.WithContext(ctx)).
+		Select("entries.*, COALESCE(entry_states.is_read, false) AS is_read, COALESCE(entry_states.is_starred, false) AS is_starred")
+	result := q.page(tx).Find(&entries)
+	return entries, result.Error
+}
+
+// ListEntryIDs returns the IDs of the entries matching q.
+func ListEntryIDs(ctx context.Context, q EntryQuery) ([]int64, error) {
+	var ids []int64
+	tx := q.scope(db.WithContext(ctx)).Select("entries.id")
+	result := q.page(tx).Pluck("entries.id", &ids)
+	return ids, result.Error
+}
+
+// CountEntries returns the number of entries matching q.
+func CountEntries(ctx context.Context, q EntryQuery) (int64, error) {
+	var n int64
+	result := q.scope(db.WithContext(ctx)).Count(&n)
+	return n, result.Error
+}
+
+// GetUserEntry returns an entry visible to the user.
+func GetUserEntry(ctx context.Context, userID string, id int64) (*UserEntry, error) {
+	entries, err := ListEntries(ctx, EntryQuery{UserID: userID, EntryIDs: []int64{id}, Limit: 1})
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, ErrNotFound
+	}
+	enclosures, err := ListEnclosures(ctx, []int64{id})
+	if err != nil {
+		return nil, err
+	}
+	entries[0].Enclosures = enclosures[id]
+	return &entries[0], nil
+}
+
+// ExistingEntryGUIDs returns which of guids are already stored for the feed.
+func ExistingEntryGUIDs(ctx context.Context, feedID int64, guids []string) (map[string]bool, error) {
+	existing := make(map[string]bool, len(guids))
+	if len(guids) == 0 {
+		return existing, nil
+	}
+	var found []string
+	result := db.WithContext(ctx).Model(&Entry{}).
+		Where("feed_id = ? AND guid IN ?", feedID, guids).
+		Pluck("guid", &found)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, g := range found {
+		existing[g] = true
+	}
+	return existing, nil
+}
+
+// CreateEntries stores new entries along with their enclosures and sources,
+// skipping those whose GUID is already stored for their feed, which keep a
+// zero ID. Entries are inserted one at a time: when a poll and a push store
+// the same item at once, a batch would return fewer IDs than rows and assign
+// them to the wrong entries.
+func CreateEntries(ctx context.Context, entries []*Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var enclosures []Enclosure
+		var sources []*EntrySource
+		for _, e := range entries {
+			result := tx.Omit(clause.Associations).Clauses(clause.OnConflict{DoNothing: true}).Create(e)
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				e.ID = 0
+				continue
+			}
+			for i := range e.Enclosures {
+				e.Enclosures[i].EntryID = e.ID
+			}
+			enclosures = append(enclosures, e.Enclosures...)
+			if e.Source != nil {
+				e.Source.EntryID = e.ID
+				sources = append(sources, e.Source)
+			}
+		}
+		if len(enclosures) > 0 {
+			if err := tx.CreateInBatches(enclosures, 100).Error; err != nil {
+				return err
+			}
+		}
+		if len(sources) > 0 {
+			return tx.CreateInBatches(sources, 100).Error
+		}
+		return nil
+	})
+}
+
+// ListEntriesToExtract returns up to limit entries with a link published
+// after publishedAfter whose article was never extracted, of feeds with a
+// subscriber that enabled extraction, newest first. At most perFeed entries
+// of each feed are returned.
+func ListEntriesToExtract(ctx context.Context, publishedAfter int64, perFeed, limit int) ([]Entry, error) {
+	ranked := db.WithContext(ctx).Model(&Entry{}).
+		Select("entries.*, ROW_NUMBER() OVER (PARTITION BY feed_id ORDER BY id DESC) AS feed_rank").
+		Where("extracted_at = 0 AND url <> '' AND published_at > ?", publishedAfter).
+		Where("EXISTS (SELECT 1 FROM " + SubscriptionTableName + " s WHERE s.feed_id = entries.feed_id AND s.extract_content)")
+	var entries []Entry
+	result := db.WithContext(ctx).
+		Table("(?) AS entries", ranked).
+		Where("feed_rank <= ?", perFeed).
+		Order("id DESC").
+		Limit(limit).
+		Find(&entries)
+	return entries, result.Error
+}
+
+// SetEntryExtraction stores the article extracted for an entry, cleaned and
+// as received, unless it has one already.
+func SetEntryExtraction(ctx context.Context, id int64, raw, content, imageURL string) error {
+	updates := map[string]any{
+		"extracted_content": content,
+		"extracted_at":      time.Now().Unix(),
+	}
+	if imageURL != "" {
+		updates["image_url"] = imageURL
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Entry{}).Where("id = ? AND extracted_content = ''", id).Updates(updates)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		return tx.Clauses(clause.OnConflict{
+			Columns:   []clause.Column{{Name: "entry_id"}},
+			DoUpdates: clause.AssignmentColumns([]string{"extracted_content"}),
+		}).Create(&EntrySource{EntryID: id, ExtractedContent: raw}).Error
+	})
+}
+
+// SkipEntryExtraction marks an entry whose article could not be extracted,
+// so that it is not fetched again. The entry's UpdatedAt is left alone, as
+// its content did not change.
+func SkipEntryExtraction(ctx context.Context, id int64) error {
+	return db.WithContext(ctx).Model(&Entry{}).Where("id = ?", id).UpdateColumn("extracted_at", time.Now().Unix()).Error
+}
+
+// ListEntriesToSanitize returns up to limit entries with an ID above afterID
+// that were sanitized with rules older than version.
+func ListEntriesToSanitize(ctx context.Context, version int, afterID int64, limit int) ([]Entry, error) {
+	var entries []Entry
+	result := db.WithContext(ctx).
+		Where("sanitizer_version < ? AND id > ?", version, afterID).
+		Order("id").
+		Limit(limit).
+		Find(&entries)
+	return entries, result.Error
+}
+
+// LoadEntrySources sets the Source of the entries that have one.
+func LoadEntrySources(ctx context.Context, entries []Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	ids := make([]int64, len(entries))
+	for i := range entries {
+		ids[i] = entries[i].ID
+	}
+	var sources []*EntrySource
+	if err := db.WithContext(ctx).Where("entry_id IN ?", ids).Find(&sources).Error; err != nil {
+		return err
+	}
+	byID := make(map[int64]*EntrySource, len(sources))
+	for _, s := range sources {
+		byID[s.EntryID] = s
+	}
+	for i := range entries {
+		entries[i].Source = byID[entries[i].ID]
+	}
+	return nil
+}
+
+// SaveEntrySanitized stores the content of e cleaned by the sanitizer.
+func SaveEntrySanitized(ctx context.Context, e *Entry) error {
+	return db.WithContext(ctx).Model(e).Updates(map[string]any{
+		"title":             e.Title,
+		"author":            e.Author,
+		"url":               e.URL,
+		"image_url":         e.ImageURL,
+		"content":           e.Content,
+		"extracted_content": e.ExtractedContent,
+		"sanitizer_version": e.SanitizerVersion,
+	}).Error
+}
+
+// SetEntriesRead marks the given entries read or unread for the user. IDs of
+// entries the user cannot see are ignored.
+func SetEntriesRead(ctx context.Context, userID string, ids []int64, read bool) error {
+	values := flagValues("is_read", "read_at", read)
+	values["is_skipped"] = false
+	return setEntryStates(ctx, userID, ids, values)
+}
+
+// SkipEntries marks the given entries read without the user opening them.
+// IDs of entries the user cannot see are ignored.
+func SkipEntries(ctx context.Context, userID string, ids []int64) error {
+	return setEntryStates(ctx, userID, ids, skipValues())
+}
+
+// DeleteEntries hides the given entries from the user.
+func DeleteEntries(ctx context.Context, userID string, ids []int64) error {
+	return upsertEntryStates(ctx, userID, ids, map[string]any{"is_deleted": true})
+}
+
+// SetEntriesStarred stars or unstars the given entries for the user. IDs of
+// entries the user cannot see are ignored.
+func SetEntriesStarred(ctx context.Context, userID string, ids []int64, starred bool) error {
+	return setEntryStates(ctx, userID, ids, flagValues("is_starred", "starred_at", starred))
+}
+
+// MarkEntriesRead marks every unread entry matching q as read. The entries
+// count as skipped.
+func MarkEntriesRead(ctx context.Context, q EntryQuery) error {
+	unread := false
+	q.Read = &unread
+	q.Limit, q.Offset = 0, 0
+	ids, err := ListEntryIDs(ctx, q)
+	if err != nil {
+		return err
+	}
+	return upsertEntryStates(ctx, q.UserID, ids, skipValues())
+}
+
+// flagValues sets a flag and the time it was set at, or clears both.
+func flagValues(column, timeColumn string, value bool) map[string]any {
+	var at int64
+	if value {
+		at = time.Now().Unix()
+	}
+	return map[string]any{column: value, timeColumn: at}
+}
+
+func skipValues() map[string]any {
+	values := flagValues("is_read", "read_at", true)
+	values["is_skipped"] = true
+	return values
+}
+
+func setEntryStates(ctx context.Context, userID string, ids []int64, values map[string]any) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	visible, err := ListEntryIDs(ctx, EntryQuery{UserID: userID, EntryIDs: ids})
+	if err != nil {
+		return err
+	}
+	return upsertEntryStates(ctx, userID, visible, values)
+}
+
+// upsertEntryStates sets the columns of the user's states of the entries
+// and queues the entries for training the user's classifier.
+func upsertEntryStates(ctx context.Context, userID string, ids []int64, values map[string]any) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	updated := []string{"updated_at"}
+	for column := range values {
+		updated = append(updated, column)
+	}
+	sort.Strings(updated)
+	rows := make([]map[string]any, len(ids))
+	for i, id := range ids {
+		row := map[string]any{"user_id": userID, "entry_id": id, "updated_at": now}
+		for column, v := range values {
+			row[column] = v
+		}
+		rows[i] = row
+	}
+	err := db.WithContext(ctx).Model(&EntryState{}).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "entry_id"}},
+		DoUpdates: clause.AssignmentColumns(updated),
+	}).CreateInBatches(rows, 500).Error
+	if err != nil {
+		return err
+	}
+	return QueueTraining(ctx, userID, ids)
+}
@@ -0,0 +1,499 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/swartzfoundation/feedr/pkg/feed"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const FeedTableName = "feeds"
+const SubscriptionTableName = "subscriptions"
+const FolderTableName = "folders"
+
+var (
+	ErrAlreadySubscribed = errors.New("already subscribed to this feed")
+	ErrFolderExists      = errors.New("a folder with this name already exists")
+)
+
+// FeedKindNewsletter marks feeds grouping the emails of a newsletter sender.
+// They are filled by the inbound mail server rather than polled.
+const FeedKindNewsletter = "newsletter"
+
+// Feed is a remote feed shared by every user subscribed to it.
+type Feed struct {
+	// ID is the unique ID for the feed.
+	// required: true
+	ID int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+
+	// URL is the address the feed is fetched from.
+	// required: true
+	URL string `json:"url" gorm:"uniqueIndex:idx_feeds_url; not null; default:null;"`
+
+	// SiteURL is the address of the website the feed belongs to.
+	// required: false
+	SiteURL string `json:"site_url"`
+
+	// Title is the title advertised by the feed.
+	// required: false
+	Title string `json:"title"`
+
+	// Description is the description advertised by the feed.
+	// required: false
+	Description string `json:"description,omitempty"`
+
+	// ImageURL is the feed artwork, such as a podcast cover.
+	// required: false
+	ImageURL string `json:"image_url,omitempty"`
+
+	// Kind is empty for polled feeds, or the source of the feed's entries
+	// otherwise, such as FeedKindNewsletter.
+	// required: false
+	Kind string `json:"kind,omitempty" gorm:"index; default:''"`
+
+	// Unsubscribe is the List-Unsubscribe header of the last newsletter
+	// received, holding the URLs that unsubscribe from it.
+	// required: false
+	Unsubscribe string `json:"unsubscribe,omitempty"`
+
+	// UnsubscribeOneClick is true when the sender supports one-click
+	// unsubscription (RFC 8058).
+	// required: false
+	UnsubscribeOneClick bool `json:"unsubscribe_one_click,omitempty" gorm:"default:false"`
+
+	// Scrape holds the selectors of a feed generated from an HTML page that
+	// has no feed of its own.
+	// required: false
+	Scrape *feed.ScrapeConfig `json:"scrape,omitempty" gorm:"serializer:json; type:text"`
+
+	// ETag is the ETag header returned by the last fetch.
+	ETag string `json:"-"`
+
+	// LastModified is the Last-Modified header returned by the last fetch.
+	LastModified string `json:"-"`
+
+	// LastFetchedAt is the unix timestamp of the last fetch.
+	// required: false
+	LastFetchedAt int64 `json:"last_fetched_at,omitempty"`
+
+	// NextFetchAt is the unix timestamp the feed is due to be fetched at.
+	// required: false
+	NextFetchAt int64 `json:"next_fetch_at,omitempty" gorm:"index"`
+
+	// FetchError is the error returned by the last fetch, if any.
+	// required: false
+	FetchError string `json:"fetch_error,omitempty"`
+
+	// ErrorCount is the number of consecutive failed fetches.
+	// required: false
+	ErrorCount int `json:"error_count,omitempty" gorm:"default:0"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (f *Feed) TableName() string {
+	return FeedTableName
+}
+
+// Folder groups a user's subscriptions.
+type Folder struct {
+	// ID is the unique ID for the folder.
+	// required: true
+	ID int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+
+	// UserID is the ID of the user owning the folder.
+	// required: true
+	UserID string `json:"-" gorm:"uniqueIndex:idx_folders_user_name; not null;"`
+
+	// Name is the display name of the folder.
+	// required: true
+	Name string `json:"name" gorm:"uniqueIndex:idx_folders_user_name; not null;"`
+
+	// PublishToken identifies the public feed of the folder's entries. The
+	// folder is not published when nil.
+	// required: false
+	PublishToken *string `json:"publish_token,omitempty" gorm:"uniqueIndex"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (f *Folder) TableName() string {
+	return FolderTableName
+}
+
+// Subscription links a user to a feed.
+type Subscription struct {
+	// ID is the unique ID for the subscription.
+	// required: true
+	ID int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+
+	// UserID is the ID of the subscribed user.
+	// required: true
+	UserID string `json:"-" gorm:"uniqueIndex:idx_subscriptions_user_feed; not null;"`
+
+	// FeedID is the ID of the subscribed feed.
+	// required: true
+	FeedID int64 `json:"feed_id" gorm:"uniqueIndex:idx_subscriptions_user_feed; index; not null;"`
+
+	// FolderID is the ID of the folder the subscription is filed under.
+	// required: false
+	FolderID *int64 `json:"folder_id,omitempty" gorm:"index"`
+
+	// Title overrides the feed title for this user.
+	// required: false
+	Title string `json:"title,omitempty"`
+
+	// ExtractContent fetches the full article for entries of the feed,
+	// for feeds that only ship summaries.
+	// required: false
+	ExtractContent bool `json:"extract_content" gorm:"default:false"`
+
+	Feed   Feed    `json:"feed" gorm:"foreignKey:FeedID"`
+	Folder *Folder `json:"folder,omitempty" gorm:"foreignKey:FolderID"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (s *Subscription) TableName() string {
+	return SubscriptionTableName
+}
+
+// DisplayTitle returns the user's title for the subscription, falling back
+// to the feed title and then the feed URL.
+func (s *Subscription) DisplayTitle() string {
+	if s.Title != "" {
+		return s.Title
+	}
+	if s.Feed.Title != "" {
+		return s.Feed.Title
+	}
+	return s.Feed.URL
+}
+
+func GetFeedByID(ctx context.Context, id int64) (*Feed, error) {
+	var f Feed
+	if result := db.WithContext(ctx).First(&f, "id = ?", id); result.Error != nil {
+		return nil, result.Error
+	}
+	return &f, nil
+}
+
+// ListSubscriptions returns the user's subscriptions with their feed and
+// folder loaded.
+func ListSubscriptions(ctx context.Context, userID string) ([]Subscription, error) {
+	var subs []Subscription
+	result := db.WithContext(ctx).
+		Preload("Feed").
+		Preload("Folder").
+		Where("user_id = ?", userID).
+		Order("id").
+		Find(&subs)
+	return subs, result.Error
+}
+
+// ListFeedSubscriptions returns the subscriptions to the feed with their
+// feed and folder loaded.
+func ListFeedSubscriptions(ctx context.Context, feedID int64) ([]Subscription, error) {
+	var subs []Subscription
+	result := db.WithContext(ctx).
+		Preload("Feed").
+		Preload("Folder").
+		Where("feed_id = ?", feedID).
+		Find(&subs)
+	return subs, result.Error
+}
+
+// ListFolders returns the user's folders ordered by name.
+func ListFolders(ctx context.Context, userID string) ([]Folder, error) {
+	var folders []Folder
+	result := db.WithContext(ctx).Where("user_id = ?", userID).Order("name").Find(&folders)
+	return folders, result.Error
+}
+
+func GetFolderByName(ctx context.Context, userID, name string) (*Folder, error) {
+	var f Folder
+	if result := db.WithContext(ctx).First(&f, "user_id = ? AND name = ?", userID, name); result.Error != nil {
+		return nil, result.Error
+	}
+	return &f, nil
+}
+
+// GetFolder returns one of the user's folders.
+func GetFolder(ctx context.Context, userID string, id int64) (*Folder, error) {
+	var f Folder
+	if result := db.WithContext(ctx).First(&f, "id = ? AND user_id = ?", id, userID); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, result.Error
+	}
+	return &f, nil
+}
+
+// CreateFolder creates a folder for the user.
+func CreateFolder(ctx context.Context, f *Folder) error {
+	if err := checkFolderName(ctx, f); err != nil {
+		return err
+	}
+	f.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Create(f).Error
+}
+
+// RenameFolder stores the name of f.
+func RenameFolder(ctx context.Context, f *Folder) error {
+	if err := checkFolderName(ctx, f); err != nil {
+		return err
+	}
+	f.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Model(f).Updates(map[string]any{
+		"name":       f.Name,
+		"updated_at": f.UpdatedAt,
+	}).Error
+}
+
+// SetFolderPublishToken publishes f under f.PublishToken, or stops
+// publishing it when nil.
+func SetFolderPublishToken(ctx context.Context, f *Folder) error {
+	f.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Model(f).Updates(map[string]any{
+		"publish_token": f.PublishToken,
+		"updated_at":    f.UpdatedAt,
+	}).Error
+}
+
+// GetPublishedFolder returns the folder published under token.
+func GetPublishedFolder(ctx context.Context, token string) (*Folder, error) {
+	var f Folder
+	if result := db.WithContext(ctx).First(&f, "publish_token = ?", token); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, result.Error
+	}
+	return &f, nil
+}
+
+// ListFeedPublishTokens returns the tokens of the published folders feedID
+// is filed under.
+func ListFeedPublishTokens(ctx context.Context, feedID int64) ([]string, error) {
+	var tokens []string
+	result := db.WithContext(ctx).Model(&Folder{}).
+		Joins("JOIN subscriptions ON subscriptions.folder_id = folders.id").
+		Where("subscriptions.feed_id = ? AND folders.publish_token IS NOT NULL", feedID).
+		Distinct().
+		Pluck("folders.publish_token", &tokens)
+	return tokens, result.Error
+}
+
+func checkFolderName(ctx context.Context, f *Folder) error {
+	var n int64
+	result := db.WithContext(ctx).Model(&Folder{}).
+		Where("user_id = ? AND name = ? AND id <> ?", f.UserID, f.Name, f.ID).
+		Count(&n)
+	if result.Error != nil {
+		return result.Error
+	}
+	if n > 0 {
+		return ErrFolderExists
+	}
+	return nil
+}
+
+// DeleteFolder deletes one of the user's folders. Its subscriptions are
+// kept outside any folder, and newsletters are no longer filed into it.
+func DeleteFolder(ctx context.Context, userID string, id int64) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, m := range []any{&Subscription{}, &InboundAddress{}, &IMAPAccount{}} {
+			err := tx.Model(m).Where("user_id = ? AND folder_id = ?", userID, id).Update("folder_id", nil).Error
+			if err != nil {
+				return err
+			}
+		}
+		result := tx.Where("id = ? AND user_id = ?", id, userID).Delete(&Folder{})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		return nil
+	})
+}
+
+// GetOrCreateFeed returns the feed fetched from url, creating it when no user
+// subscribed to it yet.
+func GetOrCreateFeed(ctx context.Context, url string) (*Feed, error) {
+	return getOrCreateFeed(ctx, &Feed{URL: strings.TrimSpace(url)})
+}
+
+// ScrapedFeedURL returns the URL identifying the feed scraped from pageURL
+// with cfg. The configuration is keyed in the fragment, which is not sent
+// when fetching, so users scraping the same page alike share a feed.
+func ScrapedFeedURL(pageURL string, cfg feed.ScrapeConfig) string {
+	pageURL, _, _ = strings.Cut(strings.TrimSpace(pageURL), "#")
+	return pageURL + "#feedr-scrape-" + cfg.Key()
+}
+
+// GetOrCreateNewsletterFeed returns the feed of url, creating it along with
+// a subscription for the user when it does not exist. created reports
+// whether the feed was created.
+func GetOrCreateNewsletterFeed(ctx context.Context, template *Feed, sub *Subscription) (f *Feed, created bool, err error) {
+	err = db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		template.Kind = FeedKindNewsletter
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(template)
+		if result.Error != nil {
+			return result.Error
+		}
+		created = result.RowsAffected > 0
+		f = template
+		if !created {
+			f = &Feed{}
+			return tx.First(f, "url = ?", template.URL).Error
+		}
+		sub.FeedID = f.ID
+		return tx.Omit("Feed", "Folder").Create(sub).Error
+	})
+	return f, created, err
+}
+
+// UpdateFeedUnsubscribe stores the List-Unsubscribe header of a newsletter.
+func UpdateFeedUnsubscribe(ctx context.Context, f *Feed) error {
+	return db.WithContext(ctx).Model(f).Updates(map[string]any{
+		"unsubscribe":           f.Unsubscribe,
+		"unsubscribe_one_click": f.UnsubscribeOneClick,
+		"updated_at":            time.Now().Unix(),
+	}).Error
+}
+
+// IsSubscribed reports whether the user is subscribed to the feed.
+func IsSubscribed(ctx context.Context, userID string, feedID int64) (bool, error) {
+	var n int64
+	result := db.WithContext(ctx).Model(&Subscription{}).Where("user_id = ? AND feed_id = ?", userID, feedID).Count(&n)
+	return n > 0, result.Error
+}
+
+func getOrCreateFeed(ctx context.Context, f *Feed) (*Feed, error) {
+	err := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(f).Error
+	if err != nil {
+		return nil, err
+	}
+	if result := db.WithContext(ctx).First(f, "url = ?", f.URL); result.Error != nil {
+		return nil, result.Error
+	}
+	return f, nil
+}
+
+// ListDueFeeds returns up to limit subscribed polled feeds whose next fetch
+// is due.
+func ListDueFeeds(ctx context.Context, now int64, limit int) ([]Feed, error) {
+	var feeds []Feed
+	result := db.WithContext(ctx).
+		Where("next_fetch_at <= ? AND kind = ''", now).
+		Where("EXISTS (SELECT 1 FROM subscriptions WHERE subscriptions.feed_id = feeds.id)").
+		Order("next_fetch_at").
+		Limit(limit).
+		Find(&feeds)
+	return feeds, result.Error
+}
+
+// UpdateFeedFetch stores the outcome of a fetch.
+func UpdateFeedFetch(ctx context.Context, f *Feed) error {
+	return db.WithContext(ctx).Model(f).Select(
+		"title", "site_url", "description", "image_url", "e_tag", "last_modified",
+		"last_fetched_at", "next_fetch_at", "fetch_error", "error_count",
+	).Updates(f).Error
+}
+
+// ScheduleFeedFetch makes the poller fetch the feed on its next tick.
+func ScheduleFeedFetch(ctx context.Context, feedID int64) error {
+	return db.WithContext(ctx).Model(&Feed{}).Where("id = ?", feedID).Update("next_fetch_at", 0).Error
+}
+
+// GetSubscription returns one of the user's subscriptions.
+func GetSubscription(ctx context.Context, userID string, id int64) (*Subscription, error) {
+	var s Subscription
+	result := db.WithContext(ctx).Preload("Feed").Preload("Folder").First(&s, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, result.Error
+	}
+	return &s, nil
+}
+
+// CreateSubscription subscribes the user to the feed at url.
+func CreateSubscription(ctx context.Context, s *Subscription, url string) error {
+	return createSubscription(ctx, s, &Feed{URL: strings.TrimSpace(url)})
+}
+
+// CreateScrapedSubscription subscribes the user to a feed generated from the
+// HTML page at pageURL.
+func CreateScrapedSubscription(ctx context.Context, s *Subscription, pageURL string, cfg feed.ScrapeConfig) error {
+	return createSubscription(ctx, s, &Feed{
+		URL:     ScrapedFeedURL(pageURL, cfg),
+		SiteURL: strings.TrimSpace(pageURL),
+		Scrape:  &cfg,
+	})
+}
+
+func createSubscription(ctx context.Context, s *Subscription, template *Feed) error {
+	f, err := getOrCreateFeed(ctx, template)
+	if err != nil {
+		return err
+	}
+	var n int64
+	if err := db.WithContext(ctx).Model(&Subscription{}).Where("user_id = ? AND feed_id = ?", s.UserID, f.ID).Count(&n).Error; err != nil {
+		return err
+	}
+	if n > 0 {
+		return ErrAlreadySubscribed
+	}
+	s.FeedID = f.ID
+	s.Feed = *f
+	return db.WithContext(ctx).Omit("Feed", "Folder").Create(s).Error
+}
+
+// SaveSubscription stores the user editable fields of s.
+func SaveSubscription(ctx context.Context, s *Subscription) error {
+	return db.WithContext(ctx).Model(s).Updates(map[string]any{
+		"title":           s.Title,
+		"folder_id":       s.FolderID,
+		"extract_content": s.ExtractContent,
+		"updated_at":      time.Now().Unix(),
+	}).Error
+}
+
+// DeleteSubscription unsubscribes the user from a feed.
+func DeleteSubscription(ctx context.Context, userID string, id int64) error {
+	result := db.WithContext(ctx).Delete(&Subscription{}, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
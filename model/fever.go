@@ -0,0 +1,73 @@
+package model
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/hex"
+
+	"gorm.io/gorm/clause"
+)
+
+const FeverCredentialTableName = "fever_credentials"
+
+// FeverCredential holds the Fever API key of a user. Fever clients send
+// md5("email:password") as the key; it is kept apart from PasswordHash so the
+// Fever password can be changed or revoked without touching the login
+// password. Only a SHA-256 of the key is stored.
+type FeverCredential struct {
+	// UserID is the ID of the user the key belongs to.
+	UserID string `json:"-" gorm:"primaryKey"`
+
+	// APIKeyHash is the SHA-256 of the Fever API key.
+	APIKeyHash string `json:"-" gorm:"uniqueIndex:idx_fever_credentials_api_key_hash; not null;"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (c *FeverCredential) TableName() string {
+	return FeverCredentialTableName
+}
+
+// FeverAPIKey returns the key a Fever client derives from email and password.
+func FeverAPIKey(email, password string) string {
+	sum := md5.Sum([]byte(email + ":" + password))
+	return hex.EncodeToString(sum[:])
+}
+
+// SetFeverPassword sets the password Fever clients use together with the
+// user's email.
+func SetFeverPassword(ctx context.Context, u *User, password string) error {
+	c := &FeverCredential{
+		UserID:     u.ID,
+		APIKeyHash: HashToken(FeverAPIKey(u.Email, password)),
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"api_key_hash", "updated_at"}),
+	}).Create(c).Error
+}
+
+// DeleteFeverPassword revokes Fever access for the user.
+func DeleteFeverPassword(ctx context.Context, userID string) error {
+	return db.WithContext(ctx).Delete(&FeverCredential{}, "user_id = ?", userID).Error
+}
+
+// GetUserByFeverAPIKey returns the active user owning the Fever API key.
+func GetUserByFeverAPIKey(ctx context.Context, apiKey string) (*User, error) {
+	var c FeverCredential
+	if result := db.WithContext(ctx).First(&c, "api_key_hash = ?", HashToken(apiKey)); result.Error != nil {
+		return nil, result.Error
+	}
+	u, err := GetUserByID(ctx, c.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive {
+		return nil, ErrUserInactive
+	}
+	return u, nil
+}
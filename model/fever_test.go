@@ -0,0 +1,11 @@
+package model
+
+import "testing"
+
+func TestFeverAPIKey(t *testing.T) {
+	// md5("user@example.com:secret")
+	want := "1c075c7ed3b9de227c7cec6e13e7f612"
+	if got := FeverAPIKey("user@example.com", "secret"); got != want {
+		t.Errorf("got %s expected %s", got, want)
+	}
+}
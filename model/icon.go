@@ -0,0 +1,64 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const FeedIconTableName = "feed_icons"
+
+// FeedIcon is the favicon of a feed's website.
+type FeedIcon struct {
+	// FeedID is the ID of the feed the icon belongs to.
+	FeedID int64 `json:"feed_id" gorm:"primaryKey"`
+
+	// MimeType is the content type of Data.
+	MimeType string `json:"mime_type"`
+
+	// Data is the raw icon image, empty when the website has no usable
+	// icon.
+	Data []byte `json:"-"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (i *FeedIcon) TableName() string {
+	return FeedIconTableName
+}
+
+// GetFeedIcon returns the icon of a feed.
+func GetFeedIcon(ctx context.Context, feedID int64) (*FeedIcon, error) {
+	var icon FeedIcon
+	if err := db.WithContext(ctx).First(&icon, "feed_id = ?", feedID).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &icon, nil
+}
+
+// SaveFeedIcon stores the icon of a feed, replacing the previous one.
+func SaveFeedIcon(ctx context.Context, icon *FeedIcon) error {
+	icon.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "feed_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"mime_type", "data", "updated_at"}),
+	}).Create(icon).Error
+}
+
+// ListFeedIcons returns the icons of the given feeds, except those of
+// websites without an icon.
+func ListFeedIcons(ctx context.Context, feedIDs []int64) ([]FeedIcon, error) {
+	var icons []FeedIcon
+	if len(feedIDs) == 0 {
+		return icons, nil
+	}
+	result := db.WithContext(ctx).Where("feed_id IN ? AND length(data) > 0", feedIDs).Find(&icons)
+	return icons, result.Error
+}
@@ -0,0 +1,152 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const UserIdentityTableName = "user_identities"
+
+// LoginTypeOIDC is the LoginType of users created through single sign-on.
+const LoginTypeOIDC = "oidc"
+
+var (
+	// ErrIdentityUnverified is returned when an identity cannot be linked or
+	// used to sign up because the provider did not verify its email.
+	ErrIdentityUnverified = errors.New("identity email is not verified")
+	// ErrSignupDisabled is returned when no user matches an identity and the
+	// provider does not allow creating one.
+	ErrSignupDisabled = errors.New("signup is disabled for this provider")
+)
+
+// UserIdentity links a user to an account at an external identity provider.
+type UserIdentity struct {
+	// ID is the unique ID for the identity.
+	// required: true
+	ID string `json:"id" gorm:"primaryKey"`
+
+	// UserID is the ID of the linked user.
+	// required: true
+	UserID string `json:"-" gorm:"index; not null;"`
+
+	// Provider is the name of the identity provider.
+	// required: true
+	Provider string `json:"provider" gorm:"uniqueIndex:idx_user_identities_provider_subject; not null;"`
+
+	// Subject is the user's ID at the provider.
+	// required: true
+	Subject string `json:"-" gorm:"uniqueIndex:idx_user_identities_provider_subject; not null;"`
+
+	// Email is the email reported by the provider.
+	// required: false
+	Email string `json:"email"`
+
+	// LastLoginAt is the unix timestamp of the last login with the identity.
+	// required: false
+	LastLoginAt int64 `json:"last_login_at"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (i *UserIdentity) TableName() string {
+	return UserIdentityTableName
+}
+
+// ExternalIdentity is the user information asserted by an identity provider.
+type ExternalIdentity struct {
+	Provider      string
+	Subject       string
+	Email         string
+	EmailVerified bool
+	FirstName     string
+	LastName      string
+	Username      string
+}
+
+// ResolveIdentity returns the user for an external identity. Known
+// identities log in directly; otherwise the identity is linked to the user
+// with the same verified email, or, when allowSignup is set, a new user is
+// created for it.
+func ResolveIdentity(ctx context.Context, ext ExternalIdentity, allowSignup bool) (*User, error) {
+	var u *User
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		now := time.Now().Unix()
+
+		var ident UserIdentity
+		result := tx.Limit(1).Find(&ident, "provider = ? AND subject = ?", ext.Provider, ext.Subject)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected > 0 {
+			u = &User{}
+			if err := tx.First(u, "id = ?", ident.UserID).Error; err != nil {
+				return err
+			}
+			return tx.Model(&ident).Updates(map[string]any{"email": ext.Email, "last_login_at": now}).Error
+		}
+
+		if !ext.EmailVerified || ext.Email == "" {
+			return ErrIdentityUnverified
+		}
+		existing := &User{}
+		result = tx.Limit(1).Find(existing, "email = ?", SanitizeUnicode(strings.ToLower(strings.TrimSpace(ext.Email))))
+		switch {
+		case result.Error != nil:
+			return result.Error
+		case result.RowsAffected > 0:
+			u = existing
+		case !allowSignup:
+			return ErrSignupDisabled
+		default:
+			u = &User{
+				FirstName:     ext.FirstName,
+				LastName:      ext.LastName,
+				Email:         ext.Email,
+				EmailVerified: true,
+				IsActive:      true,
+				LoginType:     LoginTypeOIDC,
+			}
+			if ext.Username != "" {
+				var n int64
+				if err := tx.Model(&User{}).Where("username = ?", ext.Username).Count(&n).Error; err != nil {
+					return err
+				}
+				if n == 0 {
+					u.Username = ext.Username
+				}
+			}
+			if err := tx.Create(u).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&UserIdentity{
+			ID:          NewID(),
+			UserID:      u.ID,
+			Provider:    ext.Provider,
+			Subject:     ext.Subject,
+			Email:       ext.Email,
+			LastLoginAt: now,
+		}).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive {
+		return nil, ErrUserInactive
+	}
+	return u, nil
+}
+
+// ListUserIdentities returns the identities linked to the user.
+func ListUserIdentities(ctx context.Context, userID string) ([]UserIdentity, error) {
+	var idents []UserIdentity
+	result := db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&idents)
+	return idents, result.Error
+}
@@ -0,0 +1,157 @@
+package model
+
+import (
+	"context"
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+const IMAPAccountTableName = "imap_accounts"
+
+// IMAP security modes.
+const (
+	IMAPSecurityTLS      = "tls"
+	IMAPSecuritySTARTTLS = "starttls"
+	IMAPSecurityNone     = "none"
+)
+
+// Actions applied to IMAP messages once ingested.
+const (
+	IMAPAfterFetchKeep = ""
+	IMAPAfterFetchRead = "read"
+	IMAPAfterFetchMove = "move"
+)
+
+// IMAPAccount is a mailbox polled for newsletters, as an alternative to
+// the inbound SMTP server.
+type IMAPAccount struct {
+	// ID is the unique ID of the account.
+	// required: true
+	ID int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+
+	// UserID is the ID of the user receiving the newsletters.
+	// required: true
+	UserID string `json:"-" gorm:"index; not null;"`
+
+	// Host is the IMAP server host name.
+	// required: true
+	Host string `json:"host" gorm:"not null;"`
+
+	// Port is the IMAP server port.
+	// required: true
+	Port int `json:"port" gorm:"not null;"`
+
+	// Security is one of "tls", "starttls" or "none".
+	// required: true
+	Security string `json:"security" gorm:"not null; default:'tls'"`
+
+	// Username is the login of the account.
+	// required: true
+	Username string `json:"username" gorm:"not null;"`
+
+	// Password is the password of the account, encrypted with pkg/secret.
+	Password string `json:"-" gorm:"not null;"`
+
+	// Mailbox is the folder polled for unseen messages.
+	// required: true
+	Mailbox string `json:"mailbox" gorm:"not null; default:'INBOX'"`
+
+	// AfterFetch is empty to leave messages untouched, "read" to mark them
+	// seen or "move" to move them to MoveTo.
+	// required: false
+	AfterFetch string `json:"after_fetch,omitempty"`
+
+	// MoveTo is the folder ingested messages are moved to.
+	// required: false
+	MoveTo string `json:"move_to,omitempty"`
+
+	// FolderID is the folder newsletter subscriptions are created in.
+	// required: false
+	FolderID *int64 `json:"folder_id,omitempty"`
+
+	// UIDValidity and LastUID remember the last message ingested, so
+	// messages left unseen are not fetched again.
+	UIDValidity uint32 `json:"-"`
+	LastUID     uint32 `json:"-"`
+
+	// LastFetchedAt is the unix timestamp of the last poll.
+	// required: false
+	LastFetchedAt int64 `json:"last_fetched_at,omitempty"`
+
+	// NextFetchAt is the unix timestamp of the next poll.
+	// required: false
+	NextFetchAt int64 `json:"next_fetch_at,omitempty" gorm:"index"`
+
+	// FetchError is the error of the last poll, if it failed.
+	// required: false
+	FetchError string `json:"fetch_error,omitempty"`
+
+	// ErrorCount is the number of consecutive failed polls.
+	// required: false
+	ErrorCount int `json:"error_count,omitempty"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (a *IMAPAccount) TableName() string {
+	return IMAPAccountTableName
+}
+
+func CreateIMAPAccount(ctx context.Context, a *IMAPAccount) error {
+	return db.WithContext(ctx).Create(a).Error
+}
+
+func ListIMAPAccounts(ctx context.Context, userID string) ([]IMAPAccount, error) {
+	var accounts []IMAPAccount
+	result := db.WithContext(ctx).Where("user_id = ?", userID).Order("id").Find(&accounts)
+	return accounts, result.Error
+}
+
+func GetIMAPAccount(ctx context.Context, userID string, id int64) (*IMAPAccount, error) {
+	var a IMAPAccount
+	result := db.WithContext(ctx).First(&a, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, result.Error
+	}
+	return &a, nil
+}
+
+func DeleteIMAPAccount(ctx context.Context, userID string, id int64) error {
+	result := db.WithContext(ctx).Delete(&IMAPAccount{}, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// ListDueIMAPAccounts returns up to limit accounts whose next poll is due.
+func ListDueIMAPAccounts(ctx context.Context, now int64, limit int) ([]IMAPAccount, error) {
+	var accounts []IMAPAccount
+	result := db.WithContext(ctx).
+		Where("next_fetch_at <= ?", now).
+		Order("next_fetch_at").
+		Limit(limit).
+		Find(&accounts)
+	return accounts, result.Error
+}
+
+// UpdateIMAPAccountFetch stores the outcome of a poll.
+func UpdateIMAPAccountFetch(ctx context.Context, a *IMAPAccount) error {
+	return db.WithContext(ctx).Model(a).Select(
+		"uid_validity", "last_uid", "last_fetched_at", "next_fetch_at",
+		"fetch_error", "error_count", "updated_at",
+	).Updates(a).Error
+}
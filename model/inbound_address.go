@@ -0,0 +1,80 @@
+package model
+
+import (
+	"context"
+)
+
+const InboundAddressTableName = "inbound_addresses"
+
+// InboundAddress is an email address newsletters can be sent to, delivering
+// them into the user's subscriptions.
+type InboundAddress struct {
+	// ID is the unique identifier of the address.
+	// required: true
+	ID string `json:"id" gorm:"primaryKey"`
+
+	// UserID is the ID of the user receiving the newsletters.
+	// required: true
+	UserID string `json:"-" gorm:"index; not null;"`
+
+	// Token is the local part of the address.
+	// required: true
+	Token string `json:"token" gorm:"uniqueIndex; not null;"`
+
+	// Name is a label chosen by the user, e.g. the service it was given to.
+	// required: false
+	Name string `json:"name,omitempty"`
+
+	// FolderID is the folder newsletter subscriptions are created in.
+	// required: false
+	FolderID *int64 `json:"folder_id,omitempty"`
+
+	// Address is the full email address, set when the domain is known.
+	// required: false
+	Address string `json:"address,omitempty" gorm:"-"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (a *InboundAddress) TableName() string {
+	return InboundAddressTableName
+}
+
+// CreateInboundAddress generates a new token for a and stores it.
+func CreateInboundAddress(ctx context.Context, a *InboundAddress) error {
+	a.ID = NewID()
+	a.Token = NewToken(8)
+	return db.WithContext(ctx).Create(a).Error
+}
+
+func ListInboundAddresses(ctx context.Context, userID string) ([]InboundAddress, error) {
+	var addrs []InboundAddress
+	result := db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&addrs)
+	return addrs, result.Error
+}
+
+// GetInboundAddressByToken returns the address with the given local part.
+func GetInboundAddressByToken(ctx context.Context, token string) (*InboundAddress, error) {
+	var a InboundAddress
+	result := db.WithContext(ctx).Where("token = ?", token).Limit(1).Find(&a)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrNotFound
+	}
+	return &a, nil
+}
+
+func DeleteInboundAddress(ctx context.Context, userID, id string) error {
+	result := db.WithContext(ctx).Delete(&InboundAddress{}, "user_id = ? AND id = ?", userID, id)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
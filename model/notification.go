@@ -0,0 +1,72 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+const NotificationTableName = "notifications"
+
+// Notification tells a user about an entry matching one of their rules.
+type Notification struct {
+	// ID is the unique ID of the notification.
+	// required: true
+	ID int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+
+	// UserID is the ID of the notified user.
+	// required: true
+	UserID string `json:"-" gorm:"index; not null;"`
+
+	// EntryID is the ID of the entry the notification is about.
+	// required: true
+	EntryID int64 `json:"entry_id" gorm:"not null;"`
+
+	// RuleID is the ID of the rule that matched the entry.
+	// required: false
+	RuleID int64 `json:"rule_id,omitempty"`
+
+	// Title is the title of the entry.
+	// required: true
+	Title string `json:"title"`
+
+	// ReadAt is the unix timestamp the user dismissed the notification at.
+	// required: false
+	ReadAt int64 `json:"read_at,omitempty" gorm:"index; default:0"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (n *Notification) TableName() string {
+	return NotificationTableName
+}
+
+func CreateNotifications(ctx context.Context, notifications []Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Create(&notifications).Error
+}
+
+// ListNotifications returns the user's newest notifications, only the
+// undismissed ones when unread is true.
+func ListNotifications(ctx context.Context, userID string, unread bool, limit int) ([]Notification, error) {
+	var notifications []Notification
+	tx := db.WithContext(ctx).Where("user_id = ?", userID)
+	if unread {
+		tx = tx.Where("read_at = 0")
+	}
+	result := tx.Order("id DESC").Limit(limit).Find(&notifications)
+	return notifications, result.Error
+}
+
+// DismissNotifications marks the user's notifications with the given IDs,
+// or all of them when ids is empty, as read.
+func DismissNotifications(ctx context.Context, userID string, ids []int64) error {
+	tx := db.WithContext(ctx).Model(&Notification{}).Where("user_id = ? AND read_at = 0", userID)
+	if len(ids) > 0 {
+		tx = tx.Where("id IN ?", ids)
+	}
+	return tx.Update("read_at", time.Now().Unix()).Error
+}
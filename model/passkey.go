@@ -0,0 +1,89 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+const PasskeyTableName = "passkeys"
+
+// Passkey is a WebAuthn credential registered by a user. A user may hold
+// several, one per authenticator.
+type Passkey struct {
+	// ID is the unique ID for the passkey.
+	// required: true
+	ID string `json:"id" gorm:"primaryKey"`
+
+	// UserID is the ID of the user owning the passkey.
+	// required: true
+	UserID string `json:"-" gorm:"index; not null;"`
+
+	// Name is the user's label for the authenticator.
+	// required: true
+	Name string `json:"name" gorm:"not null;"`
+
+	// CredentialID is the base64url encoded WebAuthn credential ID.
+	// required: true
+	CredentialID string `json:"-" gorm:"uniqueIndex:idx_passkeys_credential_id; not null;"`
+
+	// Data is the JSON encoded credential, including its public key and
+	// signature counter.
+	Data string `json:"-" gorm:"type:text; not null;"`
+
+	// LastUsedAt is the unix timestamp the passkey was last used at.
+	// required: false
+	LastUsedAt int64 `json:"last_used_at,omitempty"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (p *Passkey) TableName() string {
+	return PasskeyTableName
+}
+
+// ListPasskeys returns the user's passkeys, oldest first.
+func ListPasskeys(ctx context.Context, userID string) ([]Passkey, error) {
+	var keys []Passkey
+	result := db.WithContext(ctx).Where("user_id = ?", userID).Order("created_at").Find(&keys)
+	return keys, result.Error
+}
+
+func CreatePasskey(ctx context.Context, p *Passkey) error {
+	p.ID = NewID()
+	return db.WithContext(ctx).Create(p).Error
+}
+
+// RenamePasskey changes the label of one of the user's passkeys.
+func RenamePasskey(ctx context.Context, userID, id, name string) error {
+	result := db.WithContext(ctx).Model(&Passkey{}).Where("id = ? AND user_id = ?", id, userID).Update("name", name)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// DeletePasskey removes one of the user's passkeys.
+func DeletePasskey(ctx context.Context, userID, id string) error {
+	result := db.WithContext(ctx).Delete(&Passkey{}, "id = ? AND user_id = ?", id, userID)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TouchPasskey stores the credential data updated by a login, such as its
+// signature counter, and records the use.
+func TouchPasskey(ctx context.Context, credentialID, data string) error {
+	return db.WithContext(ctx).Model(&Passkey{}).Where("credential_id = ?", credentialID).Updates(map[string]any{
+		"data":         data,
+		"last_used_at": time.Now().Unix(),
+	}).Error
+}
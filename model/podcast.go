@@ -0,0 +1,145 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+const EnclosureTableName = "enclosures"
+const PlaybackPositionTableName = "playback_positions"
+
+// Enclosure is a media file attached to an entry.
+type Enclosure struct {
+	// ID is the unique ID of the enclosure.
+	// required: true
+	ID int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+
+	// EntryID is the ID of the entry the file is attached to.
+	// required: true
+	EntryID int64 `json:"entry_id" gorm:"index; not null;"`
+
+	// URL is the location of the file.
+	// required: true
+	URL string `json:"url" gorm:"not null;"`
+
+	// MimeType is the MIME type of the file, e.g. "audio/mpeg".
+	// required: false
+	MimeType string `json:"mime_type,omitempty"`
+
+	// Length is the size of the file in bytes, when the feed gives it.
+	// required: false
+	Length int64 `json:"length,omitempty"`
+
+	// Duration is the playing time in seconds, when the feed gives it.
+	// required: false
+	Duration int64 `json:"duration,omitempty"`
+}
+
+func (e *Enclosure) TableName() string {
+	return EnclosureTableName
+}
+
+// Transcript is a transcript of a podcast episode.
+type Transcript struct {
+	URL      string `json:"url"`
+	Type     string `json:"type"`
+	Language string `json:"language,omitempty"`
+	Rel      string `json:"rel,omitempty"`
+}
+
+// PlaybackPosition is how far a user got into an entry's media.
+type PlaybackPosition struct {
+	UserID  string `json:"-" gorm:"primaryKey"`
+	EntryID int64  `json:"entry_id" gorm:"primaryKey"`
+
+	// Position is the playback position in seconds.
+	// required: true
+	Position int64 `json:"position"`
+
+	// Completed is true once the user finished the episode.
+	// required: true
+	Completed bool `json:"completed"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (p *PlaybackPosition) TableName() string {
+	return PlaybackPositionTableName
+}
+
+// SavePlaybackPosition creates or replaces the user's position in an entry.
+func SavePlaybackPosition(ctx context.Context, p *PlaybackPosition) error {
+	p.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(p).Error
+}
+
+// ListEnclosures returns the enclosures of the entries by entry ID.
+func ListEnclosures(ctx context.Context, entryIDs []int64) (map[int64][]Enclosure, error) {
+	byEntry := make(map[int64][]Enclosure)
+	if len(entryIDs) == 0 {
+		return byEntry, nil
+	}
+	var enclosures []Enclosure
+	if err := db.WithContext(ctx).Where("entry_id IN ?", entryIDs).Order("id").Find(&enclosures).Error; err != nil {
+		return nil, err
+	}
+	for _, enc := range enclosures {
+		byEntry[enc.EntryID] = append(byEntry[enc.EntryID], enc)
+	}
+	return byEntry, nil
+}
+
+// Episode is an entry with media, as listed by podcast clients.
+type Episode struct {
+	UserEntry
+	FeedTitle    string            `json:"feed_title"`
+	FeedImageURL string            `json:"feed_image_url,omitempty"`
+	Playback     *PlaybackPosition `json:"playback,omitempty" gorm:"-"`
+}
+
+// ListEpisodes returns the entries matching q that have audio or video
+// enclosures, with their enclosures and the user's playback positions.
+// unplayed leaves out the episodes the user completed.
+func ListEpisodes(ctx context.Context, q EntryQuery, unplayed bool) ([]Episode, error) {
+	var episodes []Episode
+	tx := q.scope(db.WithContext(ctx)).
+		Joins("JOIN feeds ON feeds.id = entries.feed_id").
+		Where("EXISTS (SELECT 1 FROM enclosures WHERE enclosures.entry_id = entries.id AND (enclosures.mime_type LIKE 'audio/%' OR enclosures.mime_type LIKE 'video/%'))").
+		Select("entries.*, COALESCE(entry_states.is_read, false) AS is_read, COALESCE(entry_states.is_starred, false) AS is_starred, " +
+			"COALESCE(NULLIF(subscriptions.title, ''), feeds.title) AS feed_title, feeds.image_url AS feed_image_url")
+	if unplayed {
+		tx = tx.Where("NOT EXISTS (SELECT 1 FROM playback_positions WHERE playback_positions.entry_id = entries.id AND playback_positions.user_id = ? AND playback_positions.completed)", q.UserID)
+	}
+	if err := q.page(tx).Find(&episodes).Error; err != nil {
+		return nil, err
+	}
+	if len(episodes) == 0 {
+		return episodes, nil
+	}
+
+	ids := make([]int64, len(episodes))
+	byID := make(map[int64]*Episode, len(episodes))
+	for i := range episodes {
+		ids[i] = episodes[i].ID
+		byID[ids[i]] = &episodes[i]
+	}
+	enclosures, err := ListEnclosures(ctx, ids)
+	if err != nil {
+		return nil, err
+	}
+	for id, encs := range enclosures {
+		byID[id].Enclosures = encs
+	}
+	var positions []PlaybackPosition
+	if err := db.WithContext(ctx).Where("user_id = ? AND entry_id IN ?", q.UserID, ids).Find(&positions).Error; err != nil {
+		return nil, err
+	}
+	for i := range positions {
+		byID[positions[i].EntryID].Playback = &positions[i]
+	}
+	return episodes, nil
+}
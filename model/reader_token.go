@@ -0,0 +1,60 @@
+package model
+
+import (
+	"context"
+	"time"
+)
+
+const ReaderTokenTableName = "reader_tokens"
+
+// ReaderToken is an auth token issued to Google Reader API clients through
+// ClientLogin. Only the hash of the token is stored.
+type ReaderToken struct {
+	// TokenHash is the SHA-256 of the token handed to the client.
+	TokenHash string `json:"-" gorm:"primaryKey"`
+
+	// UserID is the ID of the user the token belongs to.
+	UserID string `json:"-" gorm:"index; not null;"`
+
+	// LastUsedAt is the unix timestamp the token was last used at.
+	LastUsedAt int64 `json:"last_used_at"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (t *ReaderToken) TableName() string {
+	return ReaderTokenTableName
+}
+
+// CreateReaderToken issues a new reader token for the user and returns the
+// plain token.
+func CreateReaderToken(ctx context.Context, userID string) (string, error) {
+	token := NewToken(32)
+	rt := &ReaderToken{
+		TokenHash: HashToken(token),
+		UserID:    userID,
+	}
+	if err := db.WithContext(ctx).Create(rt).Error; err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// GetUserByReaderToken returns the active user owning token and records the
+// token use.
+func GetUserByReaderToken(ctx context.Context, token string) (*User, error) {
+	var rt ReaderToken
+	if result := db.WithContext(ctx).First(&rt, "token_hash = ?", HashToken(token)); result.Error != nil {
+		return nil, result.Error
+	}
+	u, err := GetUserByID(ctx, rt.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if !u.IsActive {
+		return nil, ErrUserInactive
+	}
+	db.WithContext(ctx).Model(&rt).Update("last_used_at", time.Now().Unix())
+	return u, nil
+}
@@ -0,0 +1,132 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const RuleTableName = "rules"
+
+// Rule actions.
+const (
+	RuleActionRead    = "read"
+	RuleActionStar    = "star"
+	RuleActionTag     = "tag"
+	RuleActionDelete  = "delete"
+	RuleActionNotify  = "notify"
+	RuleActionWebhook = "webhook"
+)
+
+// RuleAction is applied to the entries matching a rule.
+type RuleAction struct {
+	// Type is one of read, star, tag, delete, notify or webhook.
+	// required: true
+	Type string `json:"type"`
+
+	// Tag is the tag added by tag actions.
+	// required: false
+	Tag string `json:"tag,omitempty"`
+
+	// URL is the endpoint webhook actions post the entry to.
+	// required: false
+	URL string `json:"url,omitempty"`
+}
+
+// Rule is a user's filter applied to new entries of their subscriptions.
+type Rule struct {
+	// ID is the unique ID of the rule.
+	// required: true
+	ID int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+
+	// UserID is the ID of the user owning the rule.
+	// required: true
+	UserID string `json:"-" gorm:"index; not null;"`
+
+	// Name describes the rule.
+	// required: true
+	Name string `json:"name" gorm:"not null;"`
+
+	// Condition is the expression entries are matched with.
+	// required: true
+	Condition string `json:"condition" gorm:"type:text; not null;"`
+
+	// Actions are applied in order to the matching entries.
+	// required: true
+	Actions []RuleAction `json:"actions" gorm:"serializer:json; type:text"`
+
+	// Position orders the evaluation of the user's rules, lowest first.
+	// required: true
+	Position int `json:"position" gorm:"not null; default:0"`
+
+	// Enabled is false for rules that are kept but not applied.
+	// required: true
+	Enabled bool `json:"enabled" gorm:"not null; default:true"`
+
+	// StopProcessing skips the following rules for entries matching this
+	// one.
+	// required: false
+	StopProcessing bool `json:"stop_processing" gorm:"not null; default:false"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (r *Rule) TableName() string {
+	return RuleTableName
+}
+
+// ListRules returns the user's rules in evaluation order.
+func ListRules(ctx context.Context, userID string) ([]Rule, error) {
+	var rules []Rule
+	result := db.WithContext(ctx).Where("user_id = ?", userID).Order("position, id").Find(&rules)
+	return rules, result.Error
+}
+
+// ListEnabledRules returns the enabled rules of the users in evaluation
+// order.
+func ListEnabledRules(ctx context.Context, userIDs []string) ([]Rule, error) {
+	var rules []Rule
+	if len(userIDs) == 0 {
+		return rules, nil
+	}
+	result := db.WithContext(ctx).Where("user_id IN ? AND enabled", userIDs).Order("position, id").Find(&rules)
+	return rules, result.Error
+}
+
+// GetRule returns one of the user's rules.
+func GetRule(ctx context.Context, userID string, id int64) (*Rule, error) {
+	var r Rule
+	if result := db.WithContext(ctx).First(&r, "id = ? AND user_id = ?", id, userID); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, result.Error
+	}
+	return &r, nil
+}
+
+// SaveRule creates or updates a rule.
+func SaveRule(ctx context.Context, r *Rule) error {
+	r.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Save(r).Error
+}
+
+// DeleteRule deletes one of the user's rules.
+func DeleteRule(ctx context.Context, userID string, id int64) error {
+	result := db.WithContext(ctx).Where("id = ? AND user_id = ?", id, userID).Delete(&Rule{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
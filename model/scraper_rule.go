@@ -0,0 +1,80 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm/clause"
+)
+
+const ScraperRuleTableName = "scraper_rules"
+
+// ScraperRule customizes how pages of a domain and its subdomains are
+// fetched and extracted, for sites the readability heuristics fail on.
+type ScraperRule struct {
+	// Domain is the host the rule applies to, without a leading "www.".
+	// required: true
+	Domain string `json:"domain" gorm:"primaryKey"`
+
+	// Include are CSS selectors matching the article content.
+	// required: false
+	Include []string `json:"include,omitempty" gorm:"serializer:json; type:text"`
+
+	// Exclude are CSS selectors matching elements removed before extraction.
+	// required: false
+	Exclude []string `json:"exclude,omitempty" gorm:"serializer:json; type:text"`
+
+	// Rewrites are applied in order to entry links of the domain.
+	// required: false
+	Rewrites []URLRewrite `json:"rewrites,omitempty" gorm:"serializer:json; type:text"`
+
+	// UserAgent overrides the User-Agent header sent to the domain.
+	// required: false
+	UserAgent string `json:"user_agent,omitempty"`
+
+	// Cookie is sent as the Cookie header to the domain.
+	// required: false
+	Cookie string `json:"cookie,omitempty"`
+
+	// Builtin is true for rules shipped with feedr rather than stored.
+	Builtin bool `json:"builtin" gorm:"-"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at,omitempty"`
+}
+
+func (r *ScraperRule) TableName() string {
+	return ScraperRuleTableName
+}
+
+// URLRewrite replaces links matching the regular expression Pattern with
+// Replace, which may refer to submatches as ${1}.
+type URLRewrite struct {
+	Pattern string `json:"pattern"`
+	Replace string `json:"replace"`
+}
+
+// ListScraperRules returns the stored rules ordered by domain.
+func ListScraperRules(ctx context.Context) ([]ScraperRule, error) {
+	var rules []ScraperRule
+	result := db.WithContext(ctx).Order("domain").Find(&rules)
+	return rules, result.Error
+}
+
+// SaveScraperRule creates or replaces the rule of r.Domain.
+func SaveScraperRule(ctx context.Context, r *ScraperRule) error {
+	r.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(r).Error
+}
+
+func DeleteScraperRule(ctx context.Context, domain string) error {
+	result := db.WithContext(ctx).Delete(&ScraperRule{}, "domain = ?", domain)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package model
+
+import "context"
+
+// Sentiments of entries.
+const (
+	SentimentPositive = "positive"
+	SentimentNegative = "negative"
+	SentimentNeutral  = "neutral"
+)
+
+// ValidSentiment reports whether s is a sentiment entries are labeled with.
+func ValidSentiment(s string) bool {
+	return s == SentimentPositive || s == SentimentNegative || s == SentimentNeutral
+}
+
+// ListEntriesWithoutSentiment returns up to limit entries of subscribed
+// feeds published after publishedAfter whose sentiment is not analyzed,
+// newest first.
+func ListEntriesWithoutSentiment(ctx context.Context, publishedAfter int64, limit int) ([]Entry, error) {
+	var entries []Entry
+	result := db.WithContext(ctx).
+		Where("sentiment = '' AND published_at > ?", publishedAfter).
+		Where("EXISTS (SELECT 1 FROM " + SubscriptionTableName + " s WHERE s.feed_id = entries.feed_id)").
+		Order("id DESC").
+		Limit(limit).
+		Find(&entries)
+	return entries, result.Error
+}
+
+// SaveEntrySentiment stores the sentiment of an entry. The entry's
+// UpdatedAt is left alone, as its content did not change.
+func SaveEntrySentiment(ctx context.Context, entryID int64, label string, score float64) error {
+	return db.WithContext(ctx).Model(&Entry{}).Where("id = ?", entryID).UpdateColumns(map[string]any{
+		"sentiment":       label,
+		"sentiment_score": score,
+	}).Error
+}
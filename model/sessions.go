@@ -129,6 +129,24 @@ func (ds *DatabaseStore) Save(
 		return nil
 	}
 
+	return ds.save(w, session, s)
+}
+
+// Renew saves the session under a new ID and deletes the row of the
+// previous one, so that an ID known before a login is useless after it.
+func (ds *DatabaseStore) Renew(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	if s := ds.getSessionFromCookie(r, session.Name()); s != nil {
+		if err := db.Delete(s).Error; err != nil {
+			return err
+		}
+	}
+	session.IsNew = true
+	return ds.save(w, session, nil)
+}
+
+// save stores the session in s, or in a new row with a new ID when s is nil,
+// and sets the cookie holding its ID.
+func (ds *DatabaseStore) save(w http.ResponseWriter, session *sessions.Session, s *Session) error {
 	data, err := securecookie.EncodeMulti(session.Name(), session.Values, ds.Codecs...)
 	if err != nil {
 		return err
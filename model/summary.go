@@ -0,0 +1,98 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	SummaryTableName      = "summaries"
+	SummaryUsageTableName = "summary_usage"
+)
+
+// Summary is the generated summary of an entry, shared by its readers.
+type Summary struct {
+	EntryID int64 `json:"entry_id" gorm:"primaryKey"`
+
+	// PromptVersion identifies the prompt the summary was generated with.
+	// required: true
+	PromptVersion int `json:"prompt_version" gorm:"primaryKey"`
+
+	// Model is the model that wrote the summary.
+	// required: true
+	Model string `json:"model"`
+
+	// Summary is the plain text summary.
+	// required: true
+	Summary string `json:"summary" gorm:"type:text"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at"`
+}
+
+func (s *Summary) TableName() string {
+	return SummaryTableName
+}
+
+// GetSummary returns the summary of an entry generated with the prompt
+// version.
+func GetSummary(ctx context.Context, entryID int64, promptVersion int) (*Summary, error) {
+	var s Summary
+	err := db.WithContext(ctx).First(&s, "entry_id = ? AND prompt_version = ?", entryID, promptVersion).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, err
+	}
+	return &s, nil
+}
+
+// SaveSummary stores a summary, replacing the one of the same version.
+func SaveSummary(ctx context.Context, s *Summary) error {
+	s.CreatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(s).Error
+}
+
+// SummaryUsage counts the summaries a user generated on a day.
+type SummaryUsage struct {
+	UserID string `gorm:"primaryKey"`
+	// Day is the unix timestamp of the start of the UTC day.
+	Day   int64 `gorm:"primaryKey"`
+	Count int   `gorm:"not null; default:0"`
+}
+
+func (u *SummaryUsage) TableName() string {
+	return SummaryUsageTableName
+}
+
+// ReserveSummaryUsage counts a summary the user is about to generate on the
+// day, unless they already generated quota summaries, in which case it
+// returns false. A quota of 0 is unlimited. Concurrent reservations cannot
+// exceed the quota.
+func ReserveSummaryUsage(ctx context.Context, userID string, day int64, quota int) (bool, error) {
+	onConflict := clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "day"}},
+		DoUpdates: clause.Assignments(map[string]any{"count": gorm.Expr(SummaryUsageTableName + ".count + 1")}),
+	}
+	if quota > 0 {
+		onConflict.Where = clause.Where{Exprs: []clause.Expression{
+			clause.Expr{SQL: SummaryUsageTableName + ".count < ?", Vars: []any{quota}},
+		}}
+	}
+	result := db.WithContext(ctx).Clauses(onConflict).Create(&SummaryUsage{UserID: userID, Day: day, Count: 1})
+	return result.RowsAffected > 0, result.Error
+}
+
+// ReleaseSummaryUsage gives back a summary reserved with
+// ReserveSummaryUsage that could not be generated.
+func ReleaseSummaryUsage(ctx context.Context, userID string, day int64) error {
+	return db.WithContext(ctx).Model(&SummaryUsage{}).
+		Where("user_id = ? AND day = ? AND count > 0", userID, day).
+		Update("count", gorm.Expr("count - 1")).Error
+}
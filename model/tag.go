@@ -0,0 +1,401 @@
+package model
+
+import (
+	"context"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	EntryTagTableName      = "entry_tags"
+	TagSuggestionTableName = "tag_suggestions"
+	TagFeedbackTableName   = "tag_feedback"
+	TagKeywordsTableName   = "tag_keywords"
+	TermCountTableName     = "term_counts"
+)
+
+// MaxTagLength bounds the length of tags.
+const MaxTagLength = 64
+
+// Sources of tag suggestions.
+const (
+	TagSourceCategory = "category"
+	TagSourceTerm     = "term"
+)
+
+// Suggestion states.
+const (
+	SuggestionPending  = "pending"
+	SuggestionAccepted = "accepted"
+	SuggestionRejected = "rejected"
+)
+
+// NormalizeTag lowercases a tag and collapses its spaces.
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.Join(strings.Fields(tag), " "))
+}
+
+// EntryTag is a label a user put on an entry.
+type EntryTag struct {
+	UserID  string `json:"-" gorm:"primaryKey"`
+	EntryID int64  `json:"entry_id" gorm:"primaryKey"`
+	// Tag is the label, lowercased.
+	Tag string `json:"tag" gorm:"primaryKey; index"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at"`
+}
+
+func (t *EntryTag) TableName() string {
+	return EntryTagTableName
+}
+
+// AddEntryTags tags the entries for the user, ignoring tags they already
+// have.
+func AddEntryTags(ctx context.Context, tags []EntryTag) error {
+	if len(tags) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	byUser := map[string][]int64{}
+	for i := range tags {
+		tags[i].CreatedAt = now
+		byUser[tags[i].UserID] = append(byUser[tags[i].UserID], tags[i].EntryID)
+	}
+	if err := db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).Create(&tags).Error; err != nil {
+		return err
+	}
+	for userID, ids := range byUser {
+		if err := QueueTraining(ctx, userID, ids); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ListEntryTags returns the user's tags of the entries by entry ID.
+func ListEntryTags(ctx context.Context, userID string, entryIDs []int64) (map[int64][]string, error) {
+	tags := map[int64][]string{}
+	if len(entryIDs) == 0 {
+		return tags, nil
+	}
+	var rows []EntryTag
+	result := db.WithContext(ctx).Where("user_id = ? AND entry_id IN ?", userID, entryIDs).Order("tag").Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, t := range rows {
+		tags[t.EntryID] = append(tags[t.EntryID], t.Tag)
+	}
+	return tags, nil
+}
+
+// SetEntryTags replaces the user's tags of an entry.
+func SetEntryTags(ctx context.Context, userID string, entryID int64, tags []string) error {
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND entry_id = ?", userID, entryID).Delete(&EntryTag{}).Error; err != nil {
+			return err
+		}
+		if len(tags) == 0 {
+			return nil
+		}
+		now := time.Now().Unix()
+		rows := make([]EntryTag, len(tags))
+		for i, t := range tags {
+			rows[i] = EntryTag{UserID: userID, EntryID: entryID, Tag: t, CreatedAt: now}
+		}
+		return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&rows).Error
+	})
+	if err != nil {
+		return err
+	}
+	return QueueTraining(ctx, userID, []int64{entryID})
+}
+
+// TagCount is a tag with the number of entries carrying it.
+type TagCount struct {
+	Tag   string `json:"tag"`
+	Count int64  `json:"count"`
+}
+
+// ListTags returns the user's tags, most used first.
+func ListTags(ctx context.Context, userID string) ([]TagCount, error) {
+	var tags []TagCount
+	result := db.WithContext(ctx).Model(&EntryTag{}).
+		Select("tag, COUNT(*) AS count").
+		Where("user_id = ?", userID).
+		Group("tag").
+		Order("count DESC, tag").
+		Scan(&tags)
+	return tags, result.Error
+}
+
+// TagSuggestion is a tag the automatic tagger proposes for an entry, until
+// the user accepts or rejects it.
+type TagSuggestion struct {
+	UserID  string `json:"-" gorm:"primaryKey"`
+	EntryID int64  `json:"entry_id" gorm:"primaryKey"`
+	Tag     string `json:"tag" gorm:"primaryKey"`
+
+	// Source is what the tag was derived from: the feed category or a term
+	// of the entry.
+	// required: true
+	Source string `json:"source"`
+
+	// Score is the confidence of the suggestion, between 0 and 1.
+	// required: true
+	Score float64 `json:"score"`
+
+	// Status is pending, accepted or rejected.
+	// required: true
+	Status string `json:"status" gorm:"not null; default:'pending'"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at"`
+}
+
+func (s *TagSuggestion) TableName() string {
+	return TagSuggestionTableName
+}
+
+// AddTagSuggestions stores pending suggestions, keeping those already
+// decided on.
+func AddTagSuggestions(ctx context.Context, suggestions []TagSuggestion) error {
+	if len(suggestions) == 0 {
+		return nil
+	}
+	now := time.Now().Unix()
+	for i := range suggestions {
+		suggestions[i].Status = SuggestionPending
+		suggestions[i].CreatedAt = now
+	}
+	return db.WithContext(ctx).Clauses(clause.OnConflict{DoNothing: true}).CreateInBatches(&suggestions, 500).Error
+}
+
+// ListTagSuggestions returns the user's pending suggestions of the entries
+// by entry ID, best first.
+func ListTagSuggestions(ctx context.Context, userID string, entryIDs []int64) (map[int64][]TagSuggestion, error) {
+	suggestions := map[int64][]TagSuggestion{}
+	if len(entryIDs) == 0 {
+		return suggestions, nil
+	}
+	var rows []TagSuggestion
+	result := db.WithContext(ctx).
+		Where("user_id = ? AND entry_id IN ? AND status = ?", userID, entryIDs, SuggestionPending).
+		Order("score DESC, tag").
+		Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, s := range rows {
+		suggestions[s.EntryID] = append(suggestions[s.EntryID], s)
+	}
+	return suggestions, nil
+}
+
+// DecideTagSuggestion records the user's decision on a pending suggestion,
+// tagging the entry when it is accepted, and counts it in the tag's
+// feedback.
+func DecideTagSuggestion(ctx context.Context, userID string, entryID int64, tag string, accept bool) error {
+	status, column := SuggestionRejected, "rejected"
+	if accept {
+		status, column = SuggestionAccepted, "accepted"
+	}
+	now := time.Now().Unix()
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&TagSuggestion{}).
+			Where("user_id = ? AND entry_id = ? AND tag = ? AND status = ?", userID, entryID, tag, SuggestionPending).
+			Update("status", status)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		if accept {
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+				Create(&EntryTag{UserID: userID, EntryID: entryID, Tag: tag, CreatedAt: now}).Error
+			if err != nil {
+				return err
+			}
+		}
+		feedback := map[string]any{"user_id": userID, "tag": tag, column: 1, "updated_at": now}
+		return tx.Model(&TagFeedback{}).Clauses(clause.OnConflict{
+			Columns: []clause.Column{{Name: "user_id"}, {Name: "tag"}},
+			DoUpdates: clause.Assignments(map[string]any{
+				column:       gorm.Expr(TagFeedbackTableName + "." + column + " + 1"),
+				"updated_at": now,
+			}),
+		}).Create(feedback).Error
+	})
+	if err != nil || !accept {
+		return err
+	}
+	return QueueTraining(ctx, userID, []int64{entryID})
+}
+
+// TagFeedback counts the user's decisions on the suggestions of a tag.
+type TagFeedback struct {
+	UserID    string `json:"-" gorm:"primaryKey"`
+	Tag       string `json:"tag" gorm:"primaryKey"`
+	Accepted  int    `json:"accepted" gorm:"not null; default:0"`
+	Rejected  int    `json:"rejected" gorm:"not null; default:0"`
+	UpdatedAt int64  `json:"updated_at"`
+}
+
+func (f *TagFeedback) TableName() string {
+	return TagFeedbackTableName
+}
+
+// ListTagFeedback returns the feedback of the users by user ID and tag.
+func ListTagFeedback(ctx context.Context, userIDs []string) (map[string]map[string]TagFeedback, error) {
+	feedback := map[string]map[string]TagFeedback{}
+	if len(userIDs) == 0 {
+		return feedback, nil
+	}
+	var rows []TagFeedback
+	if err := db.WithContext(ctx).Where("user_id IN ?", userIDs).Find(&rows).Error; err != nil {
+		return nil, err
+	}
+	for _, f := range rows {
+		if feedback[f.UserID] == nil {
+			feedback[f.UserID] = map[string]TagFeedback{}
+		}
+		feedback[f.UserID][f.Tag] = f
+	}
+	return feedback, nil
+}
+
+// TagKeywords is a user's dictionary of keywords tagging the entries that
+// mention them.
+type TagKeywords struct {
+	UserID string `json:"-" gorm:"primaryKey"`
+	Tag    string `json:"tag" gorm:"primaryKey"`
+
+	// Keywords are matched as whole words, ignoring case.
+	// required: true
+	Keywords []string `json:"keywords" gorm:"serializer:json; type:text"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (k *TagKeywords) TableName() string {
+	return TagKeywordsTableName
+}
+
+// ListTagKeywords returns the dictionaries of the users.
+func ListTagKeywords(ctx context.Context, userIDs []string) ([]TagKeywords, error) {
+	var dicts []TagKeywords
+	if len(userIDs) == 0 {
+		return dicts, nil
+	}
+	result := db.WithContext(ctx).Where("user_id IN ?", userIDs).Order("tag").Find(&dicts)
+	return dicts, result.Error
+}
+
+// SaveTagKeywords creates or replaces the dictionary of a tag.
+func SaveTagKeywords(ctx context.Context, k *TagKeywords) error {
+	k.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(k).Error
+}
+
+// DeleteTagKeywords deletes the dictionary of one of the user's tags.
+func DeleteTagKeywords(ctx context.Context, userID, tag string) error {
+	result := db.WithContext(ctx).Where("user_id = ? AND tag = ?", userID, tag).Delete(&TagKeywords{})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// TermCount is the number of entries a term appears in, across all feeds,
+// from which the automatic tagger weighs terms. The empty term counts the
+// entries.
+type TermCount struct {
+	Term  string `gorm:"primaryKey"`
+	Count int64  `gorm:"not null; default:0"`
+}
+
+func (t *TermCount) TableName() string {
+	return TermCountTableName
+}
+
+// AddTermCounts adds counts to the stored term counts.
+func AddTermCounts(ctx context.Context, counts map[string]int64) error {
+	if len(counts) == 0 {
+		return nil
+	}
+	rows := make([]TermCount, 0, len(counts))
+	for term, n := range counts {
+		rows = append(rows, TermCount{Term: term, Count: n})
+	}
+	// Concurrent batches lock the same rows in the same order.
+	sort.Slice(rows, func(i, j int) bool { return rows[i].Term < rows[j].Term })
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "term"}},
+		DoUpdates: clause.Assignments(map[string]any{"count": gorm.Expr(TermCountTableName + ".count + excluded.count")}),
+	}).CreateInBatches(rows, 500).Error
+}
+
+// GetTermCounts returns the counts of the terms, and of the empty term.
+func GetTermCounts(ctx context.Context, terms []string) (map[string]int64, error) {
+	counts := make(map[string]int64, len(terms)+1)
+	var rows []TermCount
+	result := db.WithContext(ctx).Where("term IN ?", append(terms, "")).Find(&rows)
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	for _, r := range rows {
+		counts[r.Term] = r.Count
+	}
+	return counts, nil
+}
+
+// AddTags fills the Tags, SuggestedTags, PredictedTags and
+// PredictedInterest fields of the entries.
+func AddTags(ctx context.Context, userID string, entries []UserEntry) error {
+	ids := make([]int64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	tags, err := ListEntryTags(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	suggestions, err := ListTagSuggestions(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	predictions, err := ListEntryPredictions(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	for i := range entries {
+		e := &entries[i]
+		e.Tags = tags[e.ID]
+		if e.Tags == nil {
+			e.Tags = []string{}
+		}
+		e.SuggestedTags = suggestions[e.ID]
+		p := predictions[e.ID]
+		for _, t := range p.Tags {
+			if !slices.Contains(e.Tags, t.Tag) {
+				e.PredictedTags = append(e.PredictedTags, t)
+			}
+		}
+		e.PredictedInterest = p.Interest
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const TwoFactorTableName = "two_factors"
+const RecoveryCodeTableName = "recovery_codes"
+
+// recoveryCodeCount is the number of recovery codes issued at a time.
+const recoveryCodeCount = 10
+
+// TwoFactor holds a user's TOTP enrollment. It is created unconfirmed and
+// only enforced at login once a first code has been verified.
+type TwoFactor struct {
+	// UserID is the ID of the enrolled user.
+	UserID string `json:"-" gorm:"primaryKey"`
+
+	// Secret is the base32 encoded TOTP secret.
+	Secret string `json:"-" gorm:"not null;"`
+
+	// Enabled is true once the enrollment has been confirmed.
+	Enabled bool `json:"enabled" gorm:"default:false"`
+
+	// LastUsedStep is the last accepted TOTP time step, refused on replay.
+	LastUsedStep int64 `json:"-"`
+
+	// ConfirmedAt is the unix timestamp the enrollment was confirmed at.
+	ConfirmedAt int64 `json:"confirmed_at,omitempty"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (t *TwoFactor) TableName() string {
+	return TwoFactorTableName
+}
+
+// RecoveryCode is a single-use code that replaces a TOTP code when the
+// authenticator is lost. Only the hash of the code is stored.
+type RecoveryCode struct {
+	ID       string `json:"-" gorm:"primaryKey"`
+	UserID   string `json:"-" gorm:"index; not null;"`
+	CodeHash string `json:"-" gorm:"not null;"`
+	UsedAt   int64  `json:"used_at,omitempty"`
+}
+
+func (c *RecoveryCode) TableName() string {
+	return RecoveryCodeTableName
+}
+
+// GetTwoFactor returns the user's TOTP enrollment.
+func GetTwoFactor(ctx context.Context, userID string) (*TwoFactor, error) {
+	var t TwoFactor
+	if result := db.WithContext(ctx).First(&t, "user_id = ?", userID); result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, result.Error
+	}
+	return &t, nil
+}
+
+// HasTwoFactor reports whether the user must pass a second factor at login.
+func HasTwoFactor(ctx context.Context, userID string) (bool, error) {
+	t, err := GetTwoFactor(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return t.Enabled, nil
+}
+
+// StartTwoFactor stores a new unconfirmed secret for the user, replacing any
+// pending enrollment. Confirmed enrollments must be disabled first.
+func StartTwoFactor(ctx context.Context, userID, secret string) error {
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "last_used_step", "updated_at"}),
+		Where:     clause.Where{Exprs: []clause.Expression{clause.Expr{SQL: "two_factors.enabled = false"}}},
+	}).Create(&TwoFactor{UserID: userID, Secret: secret}).Error
+}
+
+// ErrTwoFactorStepUsed is returned when a code of the time step, or of a
+// later one, was already accepted.
+var ErrTwoFactorStepUsed = errors.New("two factor: code already used")
+
+// UseTwoFactorStep records the accepted time step so the code cannot be
+// used again. Of concurrent requests with the same code, only one succeeds;
+// the others get ErrTwoFactorStepUsed.
+func UseTwoFactorStep(ctx context.Context, userID string, step int64) error {
+	result := db.WithContext(ctx).Model(&TwoFactor{}).
+		Where("user_id = ? AND last_used_step < ?", userID, step).
+		Update("last_used_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTwoFactorStepUsed
+	}
+	return nil
+}
+
+// ConfirmTwoFactor enables the user's enrollment and returns a fresh set of
+// recovery codes.
+func ConfirmTwoFactor(ctx context.Context, userID string, step int64) ([]string, error) {
+	var codes []string
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&TwoFactor{}).Where("user_id = ?", userID).Updates(map[string]any{
+			"enabled":        true,
+			"confirmed_at":   time.Now().Unix(),
+			"last_used_step": step,
+		})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrNotFound
+		}
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+// DisableTwoFactor removes the user's enrollment and recovery codes.
+func DisableTwoFactor(ctx context.Context, userID string) error {
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Delete(&RecoveryCode{}, "user_id = ?", userID).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&TwoFactor{}, "user_id = ?", userID).Error
+	})
+}
+
+// RegenerateRecoveryCodes invalidates the user's recovery codes and returns
+// a new set.
+func RegenerateRecoveryCodes(ctx context.Context, userID string) ([]string, error) {
+	var codes []string
+	err := db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		var err error
+		codes, err = replaceRecoveryCodes(tx, userID)
+		return err
+	})
+	return codes, err
+}
+
+func replaceRecoveryCodes(tx *gorm.DB, userID string) ([]string, error) {
+	if err := tx.Delete(&RecoveryCode{}, "user_id = ?", userID).Error; err != nil {
+		return nil, err
+	}
+	codes := make([]string, recoveryCodeCount)
+	rows := make([]RecoveryCode, recoveryCodeCount)
+	for i := range codes {
+		raw := NewToken(5)
+		codes[i] = raw[:5] + "-" + raw[5:]
+		rows[i] = RecoveryCode{ID: NewID(), UserID: userID, CodeHash: HashToken(raw)}
+	}
+	if err := tx.Create(&rows).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// UseRecoveryCode consumes one of the user's unused recovery codes and
+// reports whether code matched one.
+func UseRecoveryCode(ctx context.Context, userID, code string) (bool, error) {
+	code = strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	result := db.WithContext(ctx).Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at = 0", userID, HashToken(code)).
+		Update("used_at", time.Now().Unix())
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// CountRecoveryCodes returns the number of unused recovery codes.
+func CountRecoveryCodes(ctx context.Context, userID string) (int64, error) {
+	var n int64
+	result := db.WithContext(ctx).Model(&RecoveryCode{}).Where("user_id = ? AND used_at = 0", userID).Count(&n)
+	return n, result.Error
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"strings"
+	"time"
 
 	"gorm.io/gorm"
 )
@@ -12,6 +13,11 @@ import (
 const UserContextKey ContextKey = "user"
 const UserTableName = "users"
 
+var (
+	ErrUserInactive       = errors.New("user is not active")
+	ErrInvalidCredentials = errors.New("invalid credentials")
+)
+
 type User struct {
 	// ID is the unique ID for the user.
 	// required: true
@@ -189,10 +195,51 @@ func GetUserByEmail(ctx context.Context, email string) (*User, error) {
 	return &u, nil
 }
 
+// Authenticate returns the active user matching email and password.
+func Authenticate(ctx context.Context, email, password string) (*User, error) {
+	u, err := GetUserByEmail(ctx, strings.ToLower(strings.TrimSpace(email)))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidCredentials
+		}
+		return nil, err
+	}
+	if !u.CheckPassword(password) {
+		return nil, ErrInvalidCredentials
+	}
+	if !u.IsActive {
+		return nil, ErrUserInactive
+	}
+	return u, nil
+}
+
+// RecordLogin stores the time and IP address of a successful login.
+func RecordLogin(ctx context.Context, u *User, ip string) error {
+	now := time.Now().Unix()
+	u.LastLoginAt = now
+	u.LastLoginIP = ip
+	u.LastActivityAt = now
+	u.FailedAttempts = 0
+	return db.WithContext(ctx).Model(u).Updates(map[string]any{
+		"last_login_at":    now,
+		"last_login_ip":    ip,
+		"last_activity_at": now,
+		"failed_attempts":  0,
+	}).Error
+}
+
 func WithUserContext(ctx context.Context, u *User) context.Context {
 	return context.WithValue(ctx, UserContextKey, u)
 }
 
+// UserFromContext returns the user stored in ctx, or an anonymous user.
+func UserFromContext(ctx context.Context) *User {
+	if u, ok := ctx.Value(UserContextKey).(*User); ok && u != nil {
+		return u
+	}
+	return UserAnon()
+}
+
 func (up *UserPatch) Patch(user *User) *User {
 	if up.FirstName != nil {
 		user.FirstName = *up.FirstName
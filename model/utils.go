@@ -1,7 +1,10 @@
 package model
 
 import (
+	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base32"
+	"encoding/hex"
 	"strings"
 	"unicode"
 
@@ -45,6 +48,20 @@ func NewID() string {
 	return id
 }
 
+// NewToken returns a random hex encoded token built from n random bytes.
+func NewToken(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// HashToken returns the hex encoded SHA-256 of token. Tokens are stored
+// hashed so a database leak does not leak usable credentials.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
 func HashPassword(password string) (string, error) {
 	var passwordBytes = []byte(password)
 	// As of today go still uses 10 as default cost. Next versions might bump to 12 or higher
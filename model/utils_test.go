@@ -56,3 +56,19 @@ func TestPasswordCompare(t *testing.T) {
 		})
 	}
 }
+
+func TestHashToken(t *testing.T) {
+	token := NewToken(32)
+	if len(token) != 64 {
+		t.Errorf("NewToken length error expected %d, got %d", 64, len(token))
+	}
+	if token == NewToken(32) {
+		t.Errorf("NewToken returned the same token twice")
+	}
+	if HashToken(token) != HashToken(token) {
+		t.Errorf("HashToken is not deterministic")
+	}
+	if HashToken(token) == token {
+		t.Errorf("HashToken returned the token unchanged")
+	}
+}
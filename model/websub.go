@@ -0,0 +1,109 @@
+package model
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const WebSubSubscriptionTableName = "websub_subscriptions"
+
+// WebSub subscription states.
+const (
+	WebSubPending    = "pending"
+	WebSubSubscribed = "subscribed"
+	WebSubDenied     = "denied"
+	WebSubFailed     = "failed"
+)
+
+// WebSubSubscription is feedr's subscription to the WebSub hub of a feed,
+// through which new entries are pushed instead of polled.
+type WebSubSubscription struct {
+	// FeedID is the ID of the subscribed feed.
+	// required: true
+	FeedID int64 `json:"feed_id" gorm:"primaryKey"`
+
+	// HubURL is the hub the subscription was requested from.
+	// required: true
+	HubURL string `json:"hub_url" gorm:"not null;"`
+
+	// TopicURL is the URL the feed is published under at the hub.
+	// required: true
+	TopicURL string `json:"topic_url" gorm:"not null;"`
+
+	// Secret signs the pushed content. It is only sent to HTTPS hubs.
+	Secret string `json:"-"`
+
+	// State is one of pending, subscribed, denied or failed.
+	// required: true
+	State string `json:"state" gorm:"index; not null;"`
+
+	// Reason is why the hub denied the subscription or the request failed.
+	// required: false
+	Reason string `json:"reason,omitempty"`
+
+	// ExpiresAt is the unix timestamp the lease granted by the hub ends at.
+	// required: false
+	ExpiresAt int64 `json:"expires_at,omitempty" gorm:"index"`
+
+	// LastPushAt is the unix timestamp of the last content push.
+	// required: false
+	LastPushAt int64 `json:"last_push_at,omitempty"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+
+	// UpdatedAt is the unix timestamp of the last update.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (s *WebSubSubscription) TableName() string {
+	return WebSubSubscriptionTableName
+}
+
+// Active reports whether the hub currently pushes the feed's updates.
+func (s *WebSubSubscription) Active(now int64) bool {
+	return s.State == WebSubSubscribed && s.ExpiresAt > now
+}
+
+func GetWebSubSubscription(ctx context.Context, feedID int64) (*WebSubSubscription, error) {
+	var s WebSubSubscription
+	result := db.WithContext(ctx).First(&s, "feed_id = ?", feedID)
+	if result.Error != nil {
+		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+			return nil, ErrNotFound
+		}
+		return nil, result.Error
+	}
+	return &s, nil
+}
+
+// SaveWebSubSubscription creates or replaces the subscription of s.FeedID.
+func SaveWebSubSubscription(ctx context.Context, s *WebSubSubscription) error {
+	s.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Clauses(clause.OnConflict{UpdateAll: true}).Create(s).Error
+}
+
+// UpdateWebSubPush records that the hub pushed content for the feed.
+func UpdateWebSubPush(ctx context.Context, feedID, at int64) error {
+	return db.WithContext(ctx).Model(&WebSubSubscription{}).Where("feed_id = ?", feedID).Update("last_push_at", at).Error
+}
+
+// ListWebSubToRenew returns up to limit subscriptions of subscribed feeds
+// whose lease ends before expiresBefore or that did not succeed, and that
+// were last requested before retryBefore.
+func ListWebSubToRenew(ctx context.Context, expiresBefore, retryBefore int64, limit int) ([]WebSubSubscription, error) {
+	var subs []WebSubSubscription
+	result := db.WithContext(ctx).
+		Where("(state <> ? OR expires_at < ?) AND updated_at < ?", WebSubSubscribed, expiresBefore, retryBefore).
+		Where("EXISTS (SELECT 1 FROM subscriptions WHERE subscriptions.feed_id = websub_subscriptions.feed_id)").
+		Order("updated_at").
+		Limit(limit).
+		Find(&subs)
+	return subs, result.Error
+}
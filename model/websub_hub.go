@@ -0,0 +1,186 @@
+package model
+
+import (
+	"context"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+const (
+	HubSubscriptionTableName = "hub_subscriptions"
+	HubDeliveryTableName     = "hub_deliveries"
+)
+
+// HubSubscription is a downstream subscription to a topic published by
+// feedr's own WebSub hub.
+type HubSubscription struct {
+	// ID is the unique identifier of the subscription.
+	// required: true
+	ID string `json:"id" gorm:"primaryKey"`
+
+	// Topic is the URL of the feed subscribed to.
+	// required: true
+	Topic string `json:"topic" gorm:"uniqueIndex:idx_hub_subscription; not null;"`
+
+	// Callback is the URL the content is pushed to.
+	// required: true
+	Callback string `json:"callback" gorm:"uniqueIndex:idx_hub_subscription; not null;"`
+
+	// Secret signs the pushed content when set.
+	Secret string `json:"-"`
+
+	// ExpiresAt is the unix timestamp the lease ends at.
+	// required: true
+	ExpiresAt int64 `json:"expires_at" gorm:"index; not null;"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+
+	// UpdatedAt is the unix timestamp of the last renewal.
+	// required: true
+	UpdatedAt int64 `json:"updated_at"`
+}
+
+func (s *HubSubscription) TableName() string {
+	return HubSubscriptionTableName
+}
+
+// HubDelivery is content waiting to be pushed to a subscriber.
+type HubDelivery struct {
+	// ID is the unique identifier of the delivery.
+	// required: true
+	ID int64 `json:"id" gorm:"primaryKey;autoIncrement"`
+
+	// SubscriptionID is the ID of the subscription delivered to.
+	// required: true
+	SubscriptionID string `json:"subscription_id" gorm:"index; not null;"`
+
+	// ContentType is the media type of Body.
+	// required: true
+	ContentType string `json:"content_type" gorm:"not null;"`
+
+	// Body is the content of the topic when it was published.
+	// required: true
+	Body []byte `json:"-" gorm:"not null;"`
+
+	// Attempts is the number of failed delivery attempts.
+	// required: true
+	Attempts int `json:"attempts" gorm:"not null; default:0"`
+
+	// LastError is the error of the last failed attempt.
+	// required: false
+	LastError string `json:"last_error,omitempty"`
+
+	// NextAttemptAt is the unix timestamp of the next attempt.
+	// required: true
+	NextAttemptAt int64 `json:"next_attempt_at" gorm:"index; not null;"`
+
+	// CreatedAt is the unix timestamp of the creation date.
+	// required: true
+	CreatedAt int64 `json:"created_at" gorm:"autoCreateTime"`
+}
+
+func (d *HubDelivery) TableName() string {
+	return HubDeliveryTableName
+}
+
+// SaveHubSubscription creates the subscription of s.Callback to s.Topic, or
+// renews it with the lease and secret of s.
+func SaveHubSubscription(ctx context.Context, s *HubSubscription) error {
+	if s.ID == "" {
+		s.ID = NewID()
+	}
+	s.UpdatedAt = time.Now().Unix()
+	return db.WithContext(ctx).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "topic"}, {Name: "callback"}},
+		DoUpdates: clause.AssignmentColumns([]string{"secret", "expires_at", "updated_at"}),
+	}).Create(s).Error
+}
+
+// DeleteHubSubscription removes the subscription of callback to topic and
+// its pending deliveries.
+func DeleteHubSubscription(ctx context.Context, topic, callback string) error {
+	var s HubSubscription
+	result := db.WithContext(ctx).Where("topic = ? AND callback = ?", topic, callback).Limit(1).Find(&s)
+	if result.Error != nil || result.RowsAffected == 0 {
+		return result.Error
+	}
+	return deleteHubSubscriptions(ctx, []string{s.ID})
+}
+
+// DeleteExpiredHubSubscriptions removes the subscriptions whose lease ended
+// before now.
+func DeleteExpiredHubSubscriptions(ctx context.Context, now int64) error {
+	var ids []string
+	if err := db.WithContext(ctx).Model(&HubSubscription{}).Where("expires_at < ?", now).Pluck("id", &ids).Error; err != nil {
+		return err
+	}
+	return deleteHubSubscriptions(ctx, ids)
+}
+
+func deleteHubSubscriptions(ctx context.Context, ids []string) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("subscription_id IN ?", ids).Delete(&HubDelivery{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("id IN ?", ids).Delete(&HubSubscription{}).Error
+	})
+}
+
+// ListHubSubscribers returns the subscriptions to topic whose lease runs
+// past now.
+func ListHubSubscribers(ctx context.Context, topic string, now int64) ([]HubSubscription, error) {
+	var subs []HubSubscription
+	result := db.WithContext(ctx).Where("topic = ? AND expires_at >= ?", topic, now).Find(&subs)
+	return subs, result.Error
+}
+
+// CreateHubDeliveries queues content for each of the subscriptions.
+func CreateHubDeliveries(ctx context.Context, deliveries []*HubDelivery) error {
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return db.WithContext(ctx).Create(deliveries).Error
+}
+
+// HubDeliveryTarget is a due delivery with the subscription it goes to.
+type HubDeliveryTarget struct {
+	HubDelivery
+	Topic    string
+	Callback string
+	Secret   string
+}
+
+// ListDueHubDeliveries returns up to limit deliveries to attempt at now,
+// oldest first.
+func ListDueHubDeliveries(ctx context.Context, now int64, limit int) ([]HubDeliveryTarget, error) {
+	var targets []HubDeliveryTarget
+	result := db.WithContext(ctx).Model(&HubDelivery{}).
+		Select("hub_deliveries.*, hub_subscriptions.topic, hub_subscriptions.callback, hub_subscriptions.secret").
+		Joins("JOIN hub_subscriptions ON hub_subscriptions.id = hub_deliveries.subscription_id").
+		Where("hub_deliveries.next_attempt_at <= ?", now).
+		Order("hub_deliveries.id").
+		Limit(limit).
+		Find(&targets)
+	return targets, result.Error
+}
+
+// UpdateHubDeliveryAttempt records a failed attempt and schedules the next.
+func UpdateHubDeliveryAttempt(ctx context.Context, d *HubDelivery) error {
+	return db.WithContext(ctx).Model(&HubDelivery{}).Where("id = ?", d.ID).Updates(map[string]interface{}{
+		"attempts":        d.Attempts,
+		"last_error":      d.LastError,
+		"next_attempt_at": d.NextAttemptAt,
+	}).Error
+}
+
+// DeleteHubDelivery removes a delivery that succeeded or was given up on.
+func DeleteHubDelivery(ctx context.Context, id int64) error {
+	return db.WithContext(ctx).Delete(&HubDelivery{}, id).Error
+}
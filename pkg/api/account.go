@@ -0,0 +1,89 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/auth"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+type loginRequest struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+func login(w http.ResponseWriter, r *http.Request) {
+	var req loginRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	u, err := model.Authenticate(r.Context(), req.Email, req.Password)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidCredentials) || errors.Is(err, model.ErrUserInactive) {
+			render.Error(w, http.StatusUnauthorized, "invalid email or password")
+			return
+		}
+		slog.Error("api: authenticating user", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	pending, err := auth.BeginLogin(w, r, u)
+	if err != nil {
+		slog.Error("api: saving session", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if pending {
+		render.JSON(w, http.StatusAccepted, map[string]bool{"two_factor_required": true})
+		return
+	}
+	render.JSON(w, http.StatusOK, u)
+}
+
+func logout(w http.ResponseWriter, r *http.Request) {
+	if err := auth.Logout(w, r); err != nil {
+		slog.Error("api: deleting session", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func me(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, http.StatusOK, model.UserFromContext(r.Context()))
+}
+
+type feverPasswordRequest struct {
+	Password string `json:"password"`
+}
+
+// setFeverPassword sets the password Fever clients log in with, alongside
+// the user's email.
+func setFeverPassword(w http.ResponseWriter, r *http.Request) {
+	var req feverPasswordRequest
+	if err := render.DecodeJSON(r, &req); err != nil || req.Password == "" {
+		render.Error(w, http.StatusBadRequest, "password is required")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if err := model.SetFeverPassword(r.Context(), u, req.Password); err != nil {
+		slog.Error("api: setting fever password", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deleteFeverPassword(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	if err := model.DeleteFeverPassword(r.Context(), u.ID); err != nil {
+		slog.Error("api: deleting fever password", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,121 @@
+// Package api implements feedr's JSON API under /api/v1.
+package api
+
+import (
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/auth"
+)
+
+// Mount registers the /api/v1 routes on r.
+func Mount(r chi.Router) {
+	r.Route("/api/v1", func(r chi.Router) {
+		r.Use(auth.Authenticate)
+
+		r.Get("/", func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("welcome"))
+		})
+
+		r.Post("/auth/login", login)
+		r.Post("/auth/logout", logout)
+		r.Post("/auth/2fa", verifySecondFactor)
+		r.Post("/auth/passkey/begin", beginPasskeyLogin)
+		r.Post("/auth/passkey/finish", finishPasskeyLogin)
+		r.Get("/auth/providers", listProviders)
+		r.Get("/auth/oidc/{provider}/login", oidcLogin)
+		r.Get("/auth/oidc/{provider}/callback", oidcCallback)
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireUser)
+			r.Get("/me", me)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.Use(auth.RequireSession)
+			r.Get("/me/2fa", getTwoFactor)
+			r.Post("/me/2fa/totp", enrollTOTP)
+			r.Post("/me/2fa/totp/confirm", confirmTOTP)
+			r.Delete("/me/2fa/totp", disableTOTP)
+			r.Post("/me/2fa/recovery-codes", regenerateRecoveryCodes)
+
+			r.Get("/me/passkeys", listPasskeys)
+			r.Post("/me/passkeys/register/begin", beginPasskeyRegistration)
+			r.Post("/me/passkeys/register/finish", finishPasskeyRegistration)
+			r.Patch("/me/passkeys/{id}", renamePasskey)
+			r.Delete("/me/passkeys/{id}", deletePasskey)
+
+			r.Put("/me/fever", setFeverPassword)
+			r.Delete("/me/fever", deleteFeverPassword)
+
+			r.Get("/me/digest", getDigestSettings)
+			r.Put("/me/digest", saveDigestSettings)
+			r.Post("/me/digest/preview", previewDigest)
+
+			r.Get("/tokens", listTokens)
+			r.Post("/tokens", createToken)
+			r.Delete("/tokens/{id}", deleteToken)
+		})
+
+		r.Group(func(r chi.Router) {
+			r.With(auth.RequireScope(model.ScopeFeedsRead)).Get("/subscriptions", listSubscriptions)
+			r.With(auth.RequireScope(model.ScopeFeedsRead)).Get("/folders", listFolders)
+			r.With(auth.RequireScope(model.ScopeFeedsRead)).Get("/discover", discoverFeeds)
+			r.With(auth.RequireScope(model.ScopeFeedsRead)).Post("/scrape/preview", previewScrape)
+			r.With(auth.RequireScope(model.ScopeFeedsRead)).Get("/inbound-addresses", listInboundAddresses)
+			r.With(auth.RequireScope(model.ScopeFeedsRead)).Get("/imap-accounts", listIMAPAccounts)
+			r.Group(func(r chi.Router) {
+				r.Use(auth.RequireScope(model.ScopeFeedsWrite))
+				r.Post("/folders", createFolder)
+				r.Patch("/folders/{id}", renameFolder)
+				r.Delete("/folders/{id}", deleteFolder)
+				r.Post("/folders/{id}/publish", publishFolder)
+				r.Delete("/folders/{id}/publish", unpublishFolder)
+				r.Post("/subscriptions", createSubscription)
+				r.Patch("/subscriptions/{id}", updateSubscription)
+				r.Delete("/subscriptions/{id}", deleteSubscription)
+				r.Post("/subscriptions/{id}/unsubscribe", unsubscribeNewsletter)
+				r.Post("/inbound-addresses", createInboundAddress)
+				r.Delete("/inbound-addresses/{id}", deleteInboundAddress)
+				r.Post("/imap-accounts", createIMAPAccount)
+				r.Delete("/imap-accounts/{id}", deleteIMAPAccount)
+			})
+
+			r.With(auth.RequireScope(model.ScopeEntriesRead)).Get("/entries", listEntries)
+			r.With(auth.RequireScope(model.ScopeEntriesRead)).Get("/entries/{id}", getEntry)
+			r.With(auth.RequireScope(model.ScopeEntriesWrite)).Put("/entries/{id}/read", setEntryRead)
+			r.With(auth.RequireScope(model.ScopeEntriesWrite)).Put("/entries/{id}/tags", setEntryTags)
+			r.With(auth.RequireScope(model.ScopeEntriesWrite)).Post("/entries/{id}/suggestions", decideSuggestion)
+			r.With(auth.RequireScope(model.ScopeEntriesWrite)).Post("/entries/{id}/extract", extractEntry)
+			r.With(auth.RequireScope(model.ScopeEntriesRead)).Post("/entries/{id}/summary", summarizeEntry)
+			r.With(auth.RequireScope(model.ScopeEntriesWrite)).Put("/entries/{id}/playback", savePlayback)
+			r.With(auth.RequireScope(model.ScopeEntriesRead)).Get("/episodes", listEpisodes)
+			r.With(auth.RequireScope(model.ScopeEntriesRead)).Get("/notifications", listNotifications)
+			r.With(auth.RequireScope(model.ScopeEntriesWrite)).Post("/notifications/dismiss", dismissNotifications)
+			r.With(auth.RequireScope(model.ScopeEntriesRead)).Post("/ask", ask)
+			r.With(auth.RequireScope(model.ScopeEntriesRead)).Get("/tags", listTags)
+			r.With(auth.RequireScope(model.ScopeEntriesRead)).Get("/tag-keywords", listTagKeywords)
+			r.With(auth.RequireScope(model.ScopeEntriesWrite)).Put("/tag-keywords/{tag}", saveTagKeywords)
+			r.With(auth.RequireScope(model.ScopeEntriesWrite)).Delete("/tag-keywords/{tag}", deleteTagKeywords)
+
+			r.With(auth.RequireScope(model.ScopeFeedsRead)).Get("/rules", listRules)
+			r.With(auth.RequireScope(model.ScopeFeedsRead)).Post("/rules/dry-run", dryRunRule)
+			r.Group(func(r chi.Router) {
+				r.Use(auth.RequireScope(model.ScopeFeedsWrite))
+				r.Post("/rules", createRule)
+				r.Put("/rules/{id}", updateRule)
+				r.Delete("/rules/{id}", deleteRule)
+			})
+		})
+
+		r.Route("/admin", func(r chi.Router) {
+			r.Use(auth.RequireScope(model.ScopeAdmin))
+			r.Delete("/users/{id}/2fa", adminResetTwoFactor)
+
+			r.Get("/scraper-rules", listScraperRules)
+			r.Put("/scraper-rules/{domain}", saveScraperRule)
+			r.Delete("/scraper-rules/{domain}", deleteScraperRule)
+		})
+	})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/llm"
+	"github.com/swartzfoundation/feedr/pkg/rag"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+const maxQuestion = 1000
+
+type askRequest struct {
+	Question string `json:"question"`
+	FeedID   int64  `json:"feed_id"`
+	FolderID int64  `json:"folder_id"`
+}
+
+// ask answers a question from the entries of the user's feeds, citing the
+// entries it is based on.
+func ask(w http.ResponseWriter, r *http.Request) {
+	if !rag.Enabled() {
+		render.Error(w, http.StatusNotImplemented, "questions are not configured")
+		return
+	}
+	var req askRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	question := strings.TrimSpace(req.Question)
+	if question == "" || utf8.RuneCountInString(question) > maxQuestion {
+		render.Error(w, http.StatusBadRequest, "question must be 1 to 1000 characters")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	answer, err := rag.Ask(r.Context(), u.ID, rag.Query{Question: question, FeedID: req.FeedID, FolderID: req.FolderID})
+	if err != nil {
+		var apiErr *llm.APIError
+		if errors.As(err, &apiErr) || errors.Is(err, llm.ErrEmptyResponse) {
+			slog.Warn("api: answering question", "error", err)
+			render.Error(w, http.StatusBadGateway, "the question service failed")
+			return
+		}
+		slog.Error("api: answering question", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, answer)
+}
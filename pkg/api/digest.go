@@ -0,0 +1,124 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/digest"
+	"github.com/swartzfoundation/feedr/pkg/mailer"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+// maxDigestEntries bounds the entries of a digest.
+const maxDigestEntries = 50
+
+func getDigestSettings(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	s, err := model.GetDigestSettings(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: loading digest settings", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, s)
+}
+
+type digestRequest struct {
+	Enabled    bool   `json:"enabled"`
+	Hour       int    `json:"hour"`
+	Minute     int    `json:"minute"`
+	TimeZone   string `json:"time_zone"`
+	MaxEntries int    `json:"max_entries"`
+}
+
+// saveDigestSettings sets when the user receives the daily digest.
+func saveDigestSettings(w http.ResponseWriter, r *http.Request) {
+	var req digestRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Enabled && mailer.New(config.Config.Email) == nil {
+		render.Error(w, http.StatusNotImplemented, "email is not configured")
+		return
+	}
+	if req.Hour < 0 || req.Hour > 23 || req.Minute < 0 || req.Minute > 59 {
+		render.Error(w, http.StatusBadRequest, "invalid time")
+		return
+	}
+	if req.TimeZone == "" {
+		req.TimeZone = "UTC"
+	}
+	loc, err := time.LoadLocation(req.TimeZone)
+	if err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid time_zone")
+		return
+	}
+	if req.MaxEntries == 0 {
+		req.MaxEntries = model.DefaultDigestEntries
+	}
+	if req.MaxEntries < 1 || req.MaxEntries > maxDigestEntries {
+		render.Error(w, http.StatusBadRequest, "max_entries must be between 1 and 50")
+		return
+	}
+
+	u := model.UserFromContext(r.Context())
+	s, err := model.GetDigestSettings(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: loading digest settings", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	s.Enabled = req.Enabled
+	s.Hour, s.Minute = req.Hour, req.Minute
+	s.TimeZone = loc.String()
+	s.MaxEntries = req.MaxEntries
+	s.NextSendAt = 0
+	if s.Enabled {
+		s.NextSendAt = digest.NextSend(time.Now(), s.Hour, s.Minute, loc).Unix()
+	}
+	if err := model.SaveDigestSettings(r.Context(), s); err != nil {
+		slog.Error("api: saving digest settings", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, s)
+}
+
+type digestPreview struct {
+	Subject string `json:"subject"`
+	Text    string `json:"text"`
+	HTML    string `json:"html"`
+}
+
+// previewDigest renders the digest the user would receive now, without
+// sending it.
+func previewDigest(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	s, err := model.GetDigestSettings(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: loading digest settings", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	d, err := digest.Build(r.Context(), s, u, time.Now(), config.Config.BASE_URL)
+	if err != nil {
+		slog.Error("api: building digest", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if d == nil {
+		render.Error(w, http.StatusNotFound, "no unread entries for a digest")
+		return
+	}
+	var p digestPreview
+	if p.Subject, p.Text, p.HTML, err = d.Render(); err != nil {
+		slog.Error("api: rendering digest", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, p)
+}
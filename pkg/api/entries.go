@@ -0,0 +1,220 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/ingest"
+	"github.com/swartzfoundation/feedr/pkg/proxy"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+// maxEntries bounds the page size of the entry list.
+const maxEntries = 200
+
+// listEntries returns the newest entries of the user's subscriptions. The
+// optional "feed_id", "folder_id" and "tag" parameters restrict the list,
+// "unread=true", "starred=true" and "sentiment" filter it, "sort=sentiment"
+// and "order=asc" sort it, and "limit" and "offset" page through it.
+// Entries telling the same story in several feeds are shown once, listing
+// the others in also_in, unless "collapse=false".
+func listEntries(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	u := model.UserFromContext(r.Context())
+	q := model.EntryQuery{UserID: u.ID, Limit: 50, Collapse: query.Get("collapse") != "false"}
+	for _, p := range []struct {
+		name string
+		dst  *int64
+	}{{"feed_id", &q.FeedID}, {"folder_id", &q.FolderID}} {
+		if v := query.Get(p.name); v != "" {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				render.Error(w, http.StatusBadRequest, "invalid "+p.name)
+				return
+			}
+			*p.dst = id
+		}
+	}
+	q.Tag = model.NormalizeTag(query.Get("tag"))
+	if query.Get("unread") == "true" {
+		unread := false
+		q.Read = &unread
+	}
+	if query.Get("starred") == "true" {
+		starred := true
+		q.Starred = &starred
+	}
+	if v := query.Get("sentiment"); v != "" {
+		if !model.ValidSentiment(v) {
+			render.Error(w, http.StatusBadRequest, "invalid sentiment")
+			return
+		}
+		q.Sentiment = v
+	}
+	switch query.Get("sort") {
+	case "", "published":
+	case "sentiment":
+		q.OrderBySentiment = true
+	default:
+		render.Error(w, http.StatusBadRequest, "invalid sort")
+		return
+	}
+	switch query.Get("order") {
+	case "", "desc":
+	case "asc":
+		q.Ascending = true
+	default:
+		render.Error(w, http.StatusBadRequest, "invalid order")
+		return
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			render.Error(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q.Limit = min(n, maxEntries)
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			render.Error(w, http.StatusBadRequest, "invalid offset")
+			return
+		}
+		q.Offset = n
+	}
+
+	entries, err := model.ListEntries(r.Context(), q)
+	if err != nil {
+		slog.Error("api: listing entries", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if err := model.AddAlsoIn(r.Context(), u.ID, entries); err != nil {
+		slog.Error("api: listing clusters", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if err := model.AddTags(r.Context(), u.ID, entries); err != nil {
+		slog.Error("api: listing tags", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	for i := range entries {
+		proxyEntry(&entries[i])
+	}
+	render.JSON(w, http.StatusOK, entries)
+}
+
+func getEntry(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadEntry(w, r)
+	if !ok {
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	entries := []model.UserEntry{*e}
+	if err := model.AddAlsoIn(r.Context(), u.ID, entries); err != nil {
+		slog.Error("api: listing clusters", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if err := model.AddTags(r.Context(), u.ID, entries); err != nil {
+		slog.Error("api: listing tags", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, proxyEntry(&entries[0]))
+}
+
+type readRequest struct {
+	Read bool `json:"read"`
+	// Cluster applies the change to the entries telling the same story in
+	// the user's other feeds.
+	Cluster bool `json:"cluster"`
+}
+
+// setEntryRead marks the entry, and optionally its cluster, read or
+// unread.
+func setEntryRead(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadEntry(w, r)
+	if !ok {
+		return
+	}
+	var req readRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	ids := []int64{e.ID}
+	if req.Cluster {
+		var err error
+		if ids, err = model.ExpandClusters(r.Context(), u.ID, ids); err != nil {
+			slog.Error("api: expanding cluster", "error", err)
+			render.Error(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+	if err := model.SetEntriesRead(r.Context(), u.ID, ids, req.Read); err != nil {
+		slog.Error("api: marking entries read", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, map[string][]int64{"entry_ids": ids})
+}
+
+// extractEntry fetches the entry's link and stores its readable article,
+// regardless of the subscription's extraction setting. The article is shared
+// by all subscribers of the feed, so an entry that has one keeps it.
+func extractEntry(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadEntry(w, r)
+	if !ok {
+		return
+	}
+	if e.ExtractedContent != "" {
+		render.JSON(w, http.StatusOK, proxyEntry(e))
+		return
+	}
+	if e.URL == "" {
+		render.Error(w, http.StatusUnprocessableEntity, "entry has no link")
+		return
+	}
+	if err := ingest.ExtractEntry(r.Context(), &e.Entry); err != nil {
+		slog.Warn("api: extracting entry", "entry", e.ID, "error", err)
+		render.Error(w, http.StatusBadGateway, "could not extract article")
+		return
+	}
+	render.JSON(w, http.StatusOK, proxyEntry(e))
+}
+
+func loadEntry(w http.ResponseWriter, r *http.Request) (*model.UserEntry, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.Error(w, http.StatusNotFound, "entry not found")
+		return nil, false
+	}
+	u := model.UserFromContext(r.Context())
+	e, err := model.GetUserEntry(r.Context(), u.ID, id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "entry not found")
+			return nil, false
+		}
+		slog.Error("api: loading entry", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return nil, false
+	}
+	return e, true
+}
+
+// proxyEntry rewrites the images of e to go through the image proxy.
+func proxyEntry(e *model.UserEntry) *model.UserEntry {
+	e.Content = proxy.RewriteHTML(e.Content)
+	e.ExtractedContent = proxy.RewriteHTML(e.ExtractedContent)
+	e.ImageURL = proxy.URL(e.ImageURL)
+	return e
+}
@@ -0,0 +1,159 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+// maxFolderName bounds the length of folder names.
+const maxFolderName = 100
+
+func listFolders(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	folders, err := model.ListFolders(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: listing folders", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, folders)
+}
+
+type folderRequest struct {
+	Name string `json:"name"`
+}
+
+// decodeFolder reads the folder name of the request, writing the error
+// response when it is invalid.
+func decodeFolder(w http.ResponseWriter, r *http.Request) (string, bool) {
+	var req folderRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return "", false
+	}
+	name := strings.TrimSpace(req.Name)
+	if name == "" || len(name) > maxFolderName {
+		render.Error(w, http.StatusBadRequest, "name must be 1 to 100 characters")
+		return "", false
+	}
+	return name, true
+}
+
+func createFolder(w http.ResponseWriter, r *http.Request) {
+	name, ok := decodeFolder(w, r)
+	if !ok {
+		return
+	}
+	f := &model.Folder{UserID: model.UserFromContext(r.Context()).ID, Name: name}
+	if err := model.CreateFolder(r.Context(), f); err != nil {
+		if errors.Is(err, model.ErrFolderExists) {
+			render.Error(w, http.StatusConflict, err.Error())
+			return
+		}
+		slog.Error("api: creating folder", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusCreated, f)
+}
+
+func renameFolder(w http.ResponseWriter, r *http.Request) {
+	f, ok := loadFolder(w, r)
+	if !ok {
+		return
+	}
+	name, ok := decodeFolder(w, r)
+	if !ok {
+		return
+	}
+	f.Name = name
+	if err := model.RenameFolder(r.Context(), f); err != nil {
+		if errors.Is(err, model.ErrFolderExists) {
+			render.Error(w, http.StatusConflict, err.Error())
+			return
+		}
+		slog.Error("api: renaming folder", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, f)
+}
+
+// deleteFolder deletes the folder, leaving its subscriptions unfiled.
+func deleteFolder(w http.ResponseWriter, r *http.Request) {
+	f, ok := loadFolder(w, r)
+	if !ok {
+		return
+	}
+	if err := model.DeleteFolder(r.Context(), f.UserID, f.ID); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "folder not found")
+			return
+		}
+		slog.Error("api: deleting folder", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// publishFolder publishes the folder's entries as a public feed, keeping
+// the token of a folder already published.
+func publishFolder(w http.ResponseWriter, r *http.Request) {
+	f, ok := loadFolder(w, r)
+	if !ok {
+		return
+	}
+	if f.PublishToken == nil {
+		token := model.NewToken(16)
+		f.PublishToken = &token
+		if err := model.SetFolderPublishToken(r.Context(), f); err != nil {
+			slog.Error("api: publishing folder", "error", err)
+			render.Error(w, http.StatusInternalServerError, "internal error")
+			return
+		}
+	}
+	render.JSON(w, http.StatusOK, f)
+}
+
+// unpublishFolder stops publishing the folder. Its feed URL stops working.
+func unpublishFolder(w http.ResponseWriter, r *http.Request) {
+	f, ok := loadFolder(w, r)
+	if !ok {
+		return
+	}
+	f.PublishToken = nil
+	if err := model.SetFolderPublishToken(r.Context(), f); err != nil {
+		slog.Error("api: unpublishing folder", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, f)
+}
+
+func loadFolder(w http.ResponseWriter, r *http.Request) (*model.Folder, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.Error(w, http.StatusNotFound, "folder not found")
+		return nil, false
+	}
+	u := model.UserFromContext(r.Context())
+	f, err := model.GetFolder(r.Context(), u.ID, id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "folder not found")
+			return nil, false
+		}
+		slog.Error("api: loading folder", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return nil, false
+	}
+	return f, true
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/newsletter"
+	"github.com/swartzfoundation/feedr/pkg/render"
+	"github.com/swartzfoundation/feedr/pkg/secret"
+)
+
+func listIMAPAccounts(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	accounts, err := model.ListIMAPAccounts(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: listing imap accounts", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, accounts)
+}
+
+type createIMAPAccountRequest struct {
+	Host       string `json:"host"`
+	Port       int    `json:"port"`
+	Security   string `json:"security"`
+	Username   string `json:"username"`
+	Password   string `json:"password"`
+	Mailbox    string `json:"mailbox"`
+	AfterFetch string `json:"after_fetch"`
+	MoveTo     string `json:"move_to"`
+	FolderID   *int64 `json:"folder_id"`
+}
+
+// createIMAPAccount connects a mailbox to be polled for newsletters. The
+// credentials are checked against the server before being stored.
+func createIMAPAccount(w http.ResponseWriter, r *http.Request) {
+	if !secret.Enabled() {
+		render.Error(w, http.StatusServiceUnavailable, "IMAP accounts require ENCRYPTION_KEY to be set")
+		return
+	}
+	var req createIMAPAccountRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	a := &model.IMAPAccount{
+		Host:       strings.TrimSpace(req.Host),
+		Port:       req.Port,
+		Security:   req.Security,
+		Username:   req.Username,
+		Mailbox:    strings.TrimSpace(req.Mailbox),
+		AfterFetch: req.AfterFetch,
+		MoveTo:     strings.TrimSpace(req.MoveTo),
+		FolderID:   req.FolderID,
+	}
+	if a.Security == "" {
+		a.Security = model.IMAPSecurityTLS
+	}
+	if a.Port == 0 {
+		a.Port = 993
+		if a.Security != model.IMAPSecurityTLS {
+			a.Port = 143
+		}
+	}
+	if a.Mailbox == "" {
+		a.Mailbox = "INBOX"
+	}
+	switch {
+	case a.Host == "" || a.Username == "" || req.Password == "":
+		render.Error(w, http.StatusBadRequest, "host, username and password are required")
+		return
+	case a.Port < 1 || a.Port > 65535:
+		render.Error(w, http.StatusBadRequest, "invalid port")
+		return
+	case a.Security != model.IMAPSecurityTLS && a.Security != model.IMAPSecuritySTARTTLS && a.Security != model.IMAPSecurityNone:
+		render.Error(w, http.StatusBadRequest, newsletter.ErrInvalidSecurity.Error())
+		return
+	case a.AfterFetch != model.IMAPAfterFetchKeep && a.AfterFetch != model.IMAPAfterFetchRead && a.AfterFetch != model.IMAPAfterFetchMove:
+		render.Error(w, http.StatusBadRequest, "after_fetch must be empty, read or move")
+		return
+	case a.AfterFetch == model.IMAPAfterFetchMove && a.MoveTo == "":
+		render.Error(w, http.StatusBadRequest, "move_to is required to move messages")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	a.UserID = u.ID
+	if !checkFolder(w, r, u.ID, a.FolderID) {
+		return
+	}
+
+	if err := newsletter.CheckIMAP(a, req.Password); err != nil {
+		render.Error(w, http.StatusBadRequest, "could not connect: "+err.Error())
+		return
+	}
+	var err error
+	if a.Password, err = secret.Encrypt(req.Password); err != nil {
+		slog.Error("api: encrypting imap password", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if err := model.CreateIMAPAccount(r.Context(), a); err != nil {
+		slog.Error("api: creating imap account", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusCreated, a)
+}
+
+func deleteIMAPAccount(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.Error(w, http.StatusNotFound, "imap account not found")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if err := model.DeleteIMAPAccount(r.Context(), u.ID, id); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "imap account not found")
+			return
+		}
+		slog.Error("api: deleting imap account", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
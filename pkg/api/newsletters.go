@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/newsletter"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+// withAddress fills in the full email address of a when the inbound domain
+// is configured.
+func withAddress(a *model.InboundAddress) {
+	if domain := config.Config.Inbound.Domain; domain != "" {
+		a.Address = a.Token + "@" + domain
+	}
+}
+
+func listInboundAddresses(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	addrs, err := model.ListInboundAddresses(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: listing inbound addresses", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	for i := range addrs {
+		withAddress(&addrs[i])
+	}
+	render.JSON(w, http.StatusOK, addrs)
+}
+
+type createInboundAddressRequest struct {
+	Name     string `json:"name"`
+	FolderID *int64 `json:"folder_id"`
+}
+
+// createInboundAddress generates a new address for the user to sign up to
+// newsletters with.
+func createInboundAddress(w http.ResponseWriter, r *http.Request) {
+	var req createInboundAddressRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if !checkFolder(w, r, u.ID, req.FolderID) {
+		return
+	}
+	a := &model.InboundAddress{
+		UserID:   u.ID,
+		Name:     strings.TrimSpace(req.Name),
+		FolderID: req.FolderID,
+	}
+	if err := model.CreateInboundAddress(r.Context(), a); err != nil {
+		slog.Error("api: creating inbound address", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	withAddress(a)
+	render.JSON(w, http.StatusCreated, a)
+}
+
+func deleteInboundAddress(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	if err := model.DeleteInboundAddress(r.Context(), u.ID, chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "inbound address not found")
+			return
+		}
+		slog.Error("api: deleting inbound address", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// unsubscribeNewsletter asks the sender of a newsletter subscription to stop
+// sending it. Senders without one-click support get a 409 listing the
+// List-Unsubscribe URLs for the user to follow.
+func unsubscribeNewsletter(w http.ResponseWriter, r *http.Request) {
+	s, ok := loadSubscription(w, r)
+	if !ok {
+		return
+	}
+	if s.Feed.Kind != model.FeedKindNewsletter {
+		render.Error(w, http.StatusBadRequest, "not a newsletter subscription")
+		return
+	}
+	if err := newsletter.Unsubscribe(r.Context(), &s.Feed); err != nil {
+		if errors.Is(err, newsletter.ErrNoOneClick) {
+			urls := newsletter.UnsubscribeURLs(s.Feed.Unsubscribe)
+			if urls == nil {
+				urls = []string{}
+			}
+			render.JSON(w, http.StatusConflict, map[string]any{
+				"error": err.Error(),
+				"urls":  urls,
+			})
+			return
+		}
+		slog.Warn("api: unsubscribing from newsletter", "feed", s.FeedID, "error", err)
+		render.Error(w, http.StatusBadGateway, "the sender rejected the unsubscription")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,112 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/auth"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+type providerResponse struct {
+	Name        string `json:"name"`
+	DisplayName string `json:"display_name"`
+	LoginURL    string `json:"login_url"`
+}
+
+func listProviders(w http.ResponseWriter, r *http.Request) {
+	providers := auth.OIDCProviders()
+	out := make([]providerResponse, 0, len(providers))
+	for _, p := range providers {
+		out = append(out, providerResponse{
+			Name:        p.Config.Name,
+			DisplayName: p.Config.DisplayName,
+			LoginURL:    "/api/v1/auth/oidc/" + url.PathEscape(p.Config.Name) + "/login",
+		})
+	}
+	render.JSON(w, http.StatusOK, out)
+}
+
+// oidcLogin redirects the browser to the identity provider.
+func oidcLogin(w http.ResponseWriter, r *http.Request) {
+	p, err := auth.GetOIDCProvider(chi.URLParam(r, "provider"))
+	if err != nil {
+		render.Error(w, http.StatusNotFound, "unknown provider")
+		return
+	}
+	redirect, flow, err := p.Begin(r.Context())
+	if err != nil {
+		slog.Error("api: starting oidc login", "provider", p.Config.Name, "error", err)
+		render.Error(w, http.StatusBadGateway, "identity provider unavailable")
+		return
+	}
+	if err := auth.SaveOIDCFlow(w, r, flow); err != nil {
+		slog.Error("api: saving oidc flow", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+// oidcCallback completes the login and sends the browser back to the app,
+// with a login_error query parameter on failure.
+func oidcCallback(w http.ResponseWriter, r *http.Request) {
+	fail := func(reason string) {
+		http.Redirect(w, r, "/?login_error="+url.QueryEscape(reason), http.StatusFound)
+	}
+
+	p, err := auth.GetOIDCProvider(chi.URLParam(r, "provider"))
+	if err != nil {
+		render.Error(w, http.StatusNotFound, "unknown provider")
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("error") != "" {
+		fail(q.Get("error"))
+		return
+	}
+	flow, err := auth.TakeOIDCFlow(w, r)
+	if err != nil {
+		fail("invalid_state")
+		return
+	}
+	ext, err := p.Finish(r.Context(), flow, q.Get("state"), q.Get("code"))
+	if err != nil {
+		slog.Warn("api: finishing oidc login", "provider", p.Config.Name, "error", err)
+		fail("invalid_response")
+		return
+	}
+
+	u, err := model.ResolveIdentity(r.Context(), *ext, p.Config.AllowSignup)
+	switch {
+	case errors.Is(err, model.ErrIdentityUnverified):
+		fail("email_unverified")
+		return
+	case errors.Is(err, model.ErrSignupDisabled):
+		fail("no_account")
+		return
+	case errors.Is(err, model.ErrUserInactive):
+		fail("inactive")
+		return
+	case err != nil:
+		slog.Error("api: resolving identity", "provider", p.Config.Name, "error", err)
+		fail("internal_error")
+		return
+	}
+
+	pending, err := auth.BeginLogin(w, r, u)
+	if err != nil {
+		slog.Error("api: saving session", "error", err)
+		fail("internal_error")
+		return
+	}
+	if pending {
+		http.Redirect(w, r, "/?two_factor=required", http.StatusFound)
+		return
+	}
+	http.Redirect(w, r, "/", http.StatusFound)
+}
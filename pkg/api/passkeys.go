@@ -0,0 +1,125 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/auth"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+func listPasskeys(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	keys, err := model.ListPasskeys(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: listing passkeys", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, keys)
+}
+
+func beginPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	creation, err := auth.BeginPasskeyRegistration(w, r, u)
+	if err != nil {
+		writePasskeyError(w, "starting passkey registration", err)
+		return
+	}
+	render.JSON(w, http.StatusOK, creation)
+}
+
+// finishPasskeyRegistration takes the authenticator response as body and the
+// passkey label as the "name" query parameter.
+func finishPasskeyRegistration(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	if name == "" {
+		name = "Passkey"
+	}
+	p, err := auth.FinishPasskeyRegistration(w, r, u, name)
+	if err != nil {
+		writePasskeyError(w, "finishing passkey registration", err)
+		return
+	}
+	render.JSON(w, http.StatusCreated, p)
+}
+
+type renamePasskeyRequest struct {
+	Name string `json:"name"`
+}
+
+func renamePasskey(w http.ResponseWriter, r *http.Request) {
+	var req renamePasskeyRequest
+	if err := render.DecodeJSON(r, &req); err != nil || strings.TrimSpace(req.Name) == "" {
+		render.Error(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if err := model.RenamePasskey(r.Context(), u.ID, chi.URLParam(r, "id"), strings.TrimSpace(req.Name)); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "passkey not found")
+			return
+		}
+		slog.Error("api: renaming passkey", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func deletePasskey(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	if err := model.DeletePasskey(r.Context(), u.ID, chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "passkey not found")
+			return
+		}
+		slog.Error("api: deleting passkey", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func beginPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	assertion, err := auth.BeginPasskeyLogin(w, r)
+	if err != nil {
+		writePasskeyError(w, "starting passkey login", err)
+		return
+	}
+	render.JSON(w, http.StatusOK, assertion)
+}
+
+// finishPasskeyLogin logs the passkey owner in. A passkey with user
+// verification already is a second factor, so no TOTP step follows.
+func finishPasskeyLogin(w http.ResponseWriter, r *http.Request) {
+	u, err := auth.FinishPasskeyLogin(w, r)
+	if err != nil {
+		slog.Warn("api: finishing passkey login", "error", err)
+		render.Error(w, http.StatusUnauthorized, "passkey login failed")
+		return
+	}
+	if err := auth.Login(w, r, u); err != nil {
+		slog.Error("api: saving session", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, u)
+}
+
+func writePasskeyError(w http.ResponseWriter, msg string, err error) {
+	switch {
+	case errors.Is(err, auth.ErrPasskeysDisabled):
+		render.Error(w, http.StatusNotImplemented, "passkeys are not configured")
+	case errors.Is(err, auth.ErrNoCeremony):
+		render.Error(w, http.StatusBadRequest, "no pending passkey ceremony")
+	default:
+		slog.Warn("api: "+msg, "error", err)
+		render.Error(w, http.StatusBadRequest, "passkey verification failed")
+	}
+}
@@ -0,0 +1,92 @@
+package api
+
+import (
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/proxy"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+// maxEpisodes bounds the page size of the episode list.
+const maxEpisodes = 200
+
+// listEpisodes returns the newest entries with audio or video enclosures,
+// with the user's playback positions. The optional "feed_id" parameter
+// restricts the list to one podcast, "unplayed=true" hides finished
+// episodes, and "limit" and "offset" page through the list.
+func listEpisodes(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	u := model.UserFromContext(r.Context())
+	q := model.EntryQuery{UserID: u.ID, Limit: 50}
+	if v := query.Get("feed_id"); v != "" {
+		id, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			render.Error(w, http.StatusBadRequest, "invalid feed_id")
+			return
+		}
+		q.FeedID = id
+	}
+	if v := query.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 {
+			render.Error(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q.Limit = min(n, maxEpisodes)
+	}
+	if v := query.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			render.Error(w, http.StatusBadRequest, "invalid offset")
+			return
+		}
+		q.Offset = n
+	}
+	unplayed := query.Get("unplayed") == "true"
+
+	episodes, err := model.ListEpisodes(r.Context(), q, unplayed)
+	if err != nil {
+		slog.Error("api: listing episodes", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	for i := range episodes {
+		proxyEntry(&episodes[i].UserEntry)
+		episodes[i].FeedImageURL = proxy.URL(episodes[i].FeedImageURL)
+	}
+	render.JSON(w, http.StatusOK, episodes)
+}
+
+type playbackRequest struct {
+	Position  int64 `json:"position"`
+	Completed bool  `json:"completed"`
+}
+
+// savePlayback stores how far the user got into the entry's media, so
+// playback resumes there on any device.
+func savePlayback(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadEntry(w, r)
+	if !ok {
+		return
+	}
+	var req playbackRequest
+	if err := render.DecodeJSON(r, &req); err != nil || req.Position < 0 {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	p := &model.PlaybackPosition{
+		UserID:    model.UserFromContext(r.Context()).ID,
+		EntryID:   e.ID,
+		Position:  req.Position,
+		Completed: req.Completed,
+	}
+	if err := model.SavePlaybackPosition(r.Context(), p); err != nil {
+		slog.Error("api: saving playback position", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, p)
+}
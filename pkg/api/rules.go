@@ -0,0 +1,208 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/render"
+	"github.com/swartzfoundation/feedr/pkg/rules"
+)
+
+const (
+	// maxDryRunScan bounds the number of entries a dry run evaluates.
+	maxDryRunScan = 5000
+	// maxDryRunMatches bounds the number of matches a dry run lists.
+	maxDryRunMatches = 100
+)
+
+func listRules(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	list, err := model.ListRules(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: listing rules", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, list)
+}
+
+type ruleRequest struct {
+	Name           string             `json:"name"`
+	Condition      string             `json:"condition"`
+	Actions        []model.RuleAction `json:"actions"`
+	Position       int                `json:"position"`
+	Enabled        *bool              `json:"enabled"`
+	StopProcessing bool               `json:"stop_processing"`
+}
+
+// apply copies the request to rule and validates it, writing the error
+// response when it is invalid.
+func (req *ruleRequest) apply(w http.ResponseWriter, rule *model.Rule) bool {
+	rule.Name = strings.TrimSpace(req.Name)
+	rule.Condition = strings.TrimSpace(req.Condition)
+	rule.Actions = req.Actions
+	rule.Position = req.Position
+	rule.StopProcessing = req.StopProcessing
+	rule.Enabled = req.Enabled == nil || *req.Enabled
+	if rule.Name == "" {
+		render.Error(w, http.StatusBadRequest, "name is required")
+		return false
+	}
+	if err := rules.Validate(rule); err != nil {
+		render.Error(w, http.StatusBadRequest, err.Error())
+		return false
+	}
+	return true
+}
+
+func createRule(w http.ResponseWriter, r *http.Request) {
+	var req ruleRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	rule := &model.Rule{UserID: model.UserFromContext(r.Context()).ID}
+	if !req.apply(w, rule) {
+		return
+	}
+	if err := model.SaveRule(r.Context(), rule); err != nil {
+		slog.Error("api: creating rule", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusCreated, rule)
+}
+
+// updateRule replaces the rule with the request.
+func updateRule(w http.ResponseWriter, r *http.Request) {
+	rule, ok := loadRule(w, r)
+	if !ok {
+		return
+	}
+	var req ruleRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !req.apply(w, rule) {
+		return
+	}
+	if err := model.SaveRule(r.Context(), rule); err != nil {
+		slog.Error("api: updating rule", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, rule)
+}
+
+func deleteRule(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.Error(w, http.StatusNotFound, "rule not found")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if err := model.DeleteRule(r.Context(), u.ID, id); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "rule not found")
+			return
+		}
+		slog.Error("api: deleting rule", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+type dryRunRequest struct {
+	Condition string `json:"condition"`
+	// FeedID restricts the dry run to one feed.
+	FeedID int64 `json:"feed_id"`
+	// Limit is the number of most recent entries evaluated.
+	Limit int `json:"limit"`
+}
+
+// dryRunRule shows which of the user's recent entries a condition would
+// have matched, without applying any action.
+func dryRunRule(w http.ResponseWriter, r *http.Request) {
+	var req dryRunRequest
+	if err := render.DecodeJSON(r, &req); err != nil || req.Limit < 0 {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Limit == 0 {
+		req.Limit = 1000
+	}
+	u := model.UserFromContext(r.Context())
+	q := model.EntryQuery{UserID: u.ID, FeedID: req.FeedID, Limit: min(req.Limit, maxDryRunScan)}
+	res, err := rules.DryRun(r.Context(), req.Condition, q, maxDryRunMatches)
+	if err != nil {
+		var syntax *rules.SyntaxError
+		if errors.As(err, &syntax) {
+			render.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		slog.Error("api: dry running rule", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, res)
+}
+
+func loadRule(w http.ResponseWriter, r *http.Request) (*model.Rule, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.Error(w, http.StatusNotFound, "rule not found")
+		return nil, false
+	}
+	u := model.UserFromContext(r.Context())
+	rule, err := model.GetRule(r.Context(), u.ID, id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "rule not found")
+			return nil, false
+		}
+		slog.Error("api: loading rule", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return nil, false
+	}
+	return rule, true
+}
+
+// listNotifications returns the newest notifications of the user's rules,
+// only the undismissed ones with "unread=true".
+func listNotifications(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	list, err := model.ListNotifications(r.Context(), u.ID, r.URL.Query().Get("unread") == "true", 100)
+	if err != nil {
+		slog.Error("api: listing notifications", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, list)
+}
+
+type dismissNotificationsRequest struct {
+	// IDs are the notifications to dismiss, all of them when empty.
+	IDs []int64 `json:"ids"`
+}
+
+func dismissNotifications(w http.ResponseWriter, r *http.Request) {
+	var req dismissNotificationsRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if err := model.DismissNotifications(r.Context(), u.ID, req.IDs); err != nil {
+		slog.Error("api: dismissing notifications", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,61 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/render"
+	"github.com/swartzfoundation/feedr/pkg/scraper"
+)
+
+// listScraperRules returns the effective rules, built-in ones included.
+func listScraperRules(w http.ResponseWriter, r *http.Request) {
+	render.JSON(w, http.StatusOK, scraper.Default.Rules())
+}
+
+// saveScraperRule creates or replaces the stored rule of a domain. A stored
+// rule overrides the built-in rule of the same domain.
+func saveScraperRule(w http.ResponseWriter, r *http.Request) {
+	var req model.ScraperRule
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Domain = chi.URLParam(r, "domain")
+	rule, err := scraper.Compile(req)
+	if err != nil {
+		render.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := model.SaveScraperRule(r.Context(), &rule.ScraperRule); err != nil {
+		slog.Error("api: saving scraper rule", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if err := scraper.Default.Load(r.Context()); err != nil {
+		slog.Error("api: reloading scraper rules", "error", err)
+	}
+	render.JSON(w, http.StatusOK, rule.ScraperRule)
+}
+
+// deleteScraperRule removes a stored rule, restoring the built-in rule of the
+// domain if there is one.
+func deleteScraperRule(w http.ResponseWriter, r *http.Request) {
+	domain := scraper.NormalizeDomain(chi.URLParam(r, "domain"))
+	if err := model.DeleteScraperRule(r.Context(), domain); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "scraper rule not found")
+			return
+		}
+		slog.Error("api: deleting scraper rule", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if err := scraper.Default.Load(r.Context()); err != nil {
+		slog.Error("api: reloading scraper rules", "error", err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
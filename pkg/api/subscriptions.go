@@ -0,0 +1,267 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/discover"
+	"github.com/swartzfoundation/feedr/pkg/feed"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+	"github.com/swartzfoundation/feedr/pkg/proxy"
+	"github.com/swartzfoundation/feedr/pkg/render"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+)
+
+func listSubscriptions(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	subs, err := model.ListSubscriptions(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: listing subscriptions", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, subs)
+}
+
+// createSubscriptionRequest subscribes to the feed at URL, or, when Scrape
+// is set, to a feed generated from the HTML page at URL.
+type createSubscriptionRequest struct {
+	URL            string             `json:"url"`
+	Title          string             `json:"title"`
+	FolderID       *int64             `json:"folder_id"`
+	ExtractContent bool               `json:"extract_content"`
+	Scrape         *feed.ScrapeConfig `json:"scrape"`
+}
+
+func createSubscription(w http.ResponseWriter, r *http.Request) {
+	var req createSubscriptionRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !validFeedURL(req.URL) {
+		render.Error(w, http.StatusBadRequest, "url must be an http or https URL")
+		return
+	}
+	if req.Scrape != nil {
+		if err := req.Scrape.Validate(); err != nil {
+			render.Error(w, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	u := model.UserFromContext(r.Context())
+	if !checkFolder(w, r, u.ID, req.FolderID) {
+		return
+	}
+
+	s := &model.Subscription{
+		UserID:         u.ID,
+		FolderID:       req.FolderID,
+		Title:          strings.TrimSpace(req.Title),
+		ExtractContent: req.ExtractContent,
+	}
+	var err error
+	if req.Scrape != nil {
+		err = model.CreateScrapedSubscription(r.Context(), s, req.URL, *req.Scrape)
+	} else {
+		err = model.CreateSubscription(r.Context(), s, req.URL)
+	}
+	if err != nil {
+		if errors.Is(err, model.ErrAlreadySubscribed) {
+			render.Error(w, http.StatusConflict, err.Error())
+			return
+		}
+		slog.Error("api: creating subscription", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusCreated, s)
+}
+
+// updateSubscriptionRequest holds the fields to change; omitted fields are
+// left untouched. A folder_id of 0 removes the subscription from its folder.
+type updateSubscriptionRequest struct {
+	Title          *string `json:"title"`
+	FolderID       *int64  `json:"folder_id"`
+	ExtractContent *bool   `json:"extract_content"`
+}
+
+func updateSubscription(w http.ResponseWriter, r *http.Request) {
+	s, ok := loadSubscription(w, r)
+	if !ok {
+		return
+	}
+	var req updateSubscriptionRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Title != nil {
+		s.Title = strings.TrimSpace(*req.Title)
+	}
+	if req.FolderID != nil {
+		if *req.FolderID == 0 {
+			s.FolderID = nil
+		} else {
+			if !checkFolder(w, r, s.UserID, req.FolderID) {
+				return
+			}
+			s.FolderID = req.FolderID
+		}
+	}
+	if req.ExtractContent != nil {
+		s.ExtractContent = *req.ExtractContent
+	}
+	if err := model.SaveSubscription(r.Context(), s); err != nil {
+		slog.Error("api: updating subscription", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, s)
+}
+
+func deleteSubscription(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.Error(w, http.StatusNotFound, "subscription not found")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if err := model.DeleteSubscription(r.Context(), u.ID, id); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "subscription not found")
+			return
+		}
+		slog.Error("api: deleting subscription", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func loadSubscription(w http.ResponseWriter, r *http.Request) (*model.Subscription, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil {
+		render.Error(w, http.StatusNotFound, "subscription not found")
+		return nil, false
+	}
+	u := model.UserFromContext(r.Context())
+	s, err := model.GetSubscription(r.Context(), u.ID, id)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "subscription not found")
+			return nil, false
+		}
+		slog.Error("api: loading subscription", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return nil, false
+	}
+	return s, true
+}
+
+// checkFolder verifies that folderID, when set, is one of the user's folders.
+func checkFolder(w http.ResponseWriter, r *http.Request, userID string, folderID *int64) bool {
+	if folderID == nil {
+		return true
+	}
+	if _, err := model.GetFolder(r.Context(), userID, *folderID); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusBadRequest, "folder not found")
+			return false
+		}
+		slog.Error("api: loading folder", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return false
+	}
+	return true
+}
+
+func validFeedURL(raw string) bool {
+	u, err := url.Parse(strings.TrimSpace(raw))
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// discoverFeeds lists the feeds offered by the page given as the "url" query
+// parameter, for the user to pick one to subscribe to.
+func discoverFeeds(w http.ResponseWriter, r *http.Request) {
+	candidates, err := discover.Discover(r.Context(), r.URL.Query().Get("url"))
+	if err != nil {
+		if errors.Is(err, discover.ErrInvalidURL) {
+			render.Error(w, http.StatusBadRequest, "url must be an http or https URL")
+			return
+		}
+		slog.Warn("api: discovering feeds", "error", err)
+		render.Error(w, http.StatusBadGateway, "could not fetch the page")
+		return
+	}
+	if candidates == nil {
+		candidates = []discover.Candidate{}
+	}
+	render.JSON(w, http.StatusOK, candidates)
+}
+
+type scrapePreviewRequest struct {
+	URL    string            `json:"url"`
+	Scrape feed.ScrapeConfig `json:"scrape"`
+}
+
+// previewScrape fetches the page and returns the items the scrape selectors
+// would turn into entries, without subscribing.
+func previewScrape(w http.ResponseWriter, r *http.Request) {
+	var req scrapePreviewRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if !validFeedURL(req.URL) {
+		render.Error(w, http.StatusBadRequest, "url must be an http or https URL")
+		return
+	}
+	if err := req.Scrape.Validate(); err != nil {
+		render.Error(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	resp, err := fetch.Get(r.Context(), fetch.Request{URL: strings.TrimSpace(req.URL), Client: fetch.PublicClient})
+	if err != nil {
+		slog.Warn("api: fetching scrape preview", "error", err)
+		render.Error(w, http.StatusBadGateway, "could not fetch the page")
+		return
+	}
+	parsed, err := feed.Scrape(resp.Body, resp.URL, req.Scrape)
+	if err != nil {
+		render.Error(w, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+
+	type previewItem struct {
+		GUID      string `json:"guid"`
+		URL       string `json:"url"`
+		Title     string `json:"title"`
+		Content   string `json:"content"`
+		Published int64  `json:"published_at,omitempty"`
+	}
+	items := make([]previewItem, 0, len(parsed.Items))
+	for _, it := range parsed.Items {
+		p := previewItem{
+			GUID:    it.GUID,
+			URL:     sanitize.URL(it.URL, resp.URL),
+			Title:   it.Title,
+			Content: proxy.RewriteHTML(sanitize.HTML(it.Content, resp.URL)),
+		}
+		if !it.Published.IsZero() {
+			p.Published = it.Published.Unix()
+		}
+		items = append(items, p)
+	}
+	render.JSON(w, http.StatusOK, map[string]any{
+		"title":    parsed.Title,
+		"site_url": parsed.SiteURL,
+		"items":    items,
+	})
+}
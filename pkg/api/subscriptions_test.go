@@ -0,0 +1,24 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPreviewScrapeRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the scrape preview reached %s", r.URL)
+	}))
+	defer srv.Close()
+
+	body := `{"url":"` + srv.URL + `","scrape":{"item_selector":"article","title_selector":"h2"}}`
+	r := httptest.NewRequest(http.MethodPost, "/subscriptions/scrape/preview", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	previewScrape(w, r)
+	if w.Code != http.StatusBadGateway {
+		t.Errorf("status = %d, want %d", w.Code, http.StatusBadGateway)
+	}
+}
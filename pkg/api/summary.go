@@ -0,0 +1,50 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/llm"
+	"github.com/swartzfoundation/feedr/pkg/render"
+	"github.com/swartzfoundation/feedr/pkg/summary"
+)
+
+type summaryResponse struct {
+	*model.Summary
+	// Cached reports whether the summary was written before.
+	Cached bool `json:"cached"`
+}
+
+// summarizeEntry returns the summary of the entry, writing it with the
+// configured model when it is not cached.
+func summarizeEntry(w http.ResponseWriter, r *http.Request) {
+	if !summary.Enabled() {
+		render.Error(w, http.StatusNotImplemented, "summaries are not configured")
+		return
+	}
+	e, ok := loadEntry(w, r)
+	if !ok {
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	s, cached, err := summary.Summarize(r.Context(), u.ID, &e.Entry)
+	if err != nil {
+		var apiErr *llm.APIError
+		switch {
+		case errors.Is(err, summary.ErrQuotaExceeded):
+			render.Error(w, http.StatusTooManyRequests, "daily summary quota exceeded")
+		case errors.Is(err, summary.ErrNoText):
+			render.Error(w, http.StatusUnprocessableEntity, "the entry has no text to summarize")
+		case errors.As(err, &apiErr), errors.Is(err, llm.ErrEmptyResponse):
+			slog.Warn("api: summarizing entry", "entry", e.ID, "error", err)
+			render.Error(w, http.StatusBadGateway, "the summary service failed")
+		default:
+			slog.Error("api: summarizing entry", "error", err)
+			render.Error(w, http.StatusInternalServerError, "internal error")
+		}
+		return
+	}
+	render.JSON(w, http.StatusOK, summaryResponse{s, cached})
+}
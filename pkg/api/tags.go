@@ -0,0 +1,184 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+const (
+	// maxEntryTags bounds the tags of an entry.
+	maxEntryTags = 20
+	// maxKeywords bounds the keywords of a tag's dictionary.
+	maxKeywords = 100
+)
+
+func listTags(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	tags, err := model.ListTags(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: listing tags", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, tags)
+}
+
+// normalizeTags normalizes and deduplicates tags, writing the error
+// response when one is invalid.
+func normalizeTags(w http.ResponseWriter, tags []string) ([]string, bool) {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, t := range tags {
+		t = model.NormalizeTag(t)
+		if t == "" || len(t) > model.MaxTagLength {
+			render.Error(w, http.StatusBadRequest, fmt.Sprintf("tags must be 1 to %d characters", model.MaxTagLength))
+			return nil, false
+		}
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	if len(out) > maxEntryTags {
+		render.Error(w, http.StatusBadRequest, fmt.Sprintf("an entry has at most %d tags", maxEntryTags))
+		return nil, false
+	}
+	return out, true
+}
+
+type entryTagsRequest struct {
+	Tags []string `json:"tags"`
+}
+
+// setEntryTags replaces the user's tags of the entry.
+func setEntryTags(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadEntry(w, r)
+	if !ok {
+		return
+	}
+	var req entryTagsRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	tags, ok := normalizeTags(w, req.Tags)
+	if !ok {
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if err := model.SetEntryTags(r.Context(), u.ID, e.ID, tags); err != nil {
+		slog.Error("api: tagging entry", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, entryTagsRequest{Tags: tags})
+}
+
+type suggestionRequest struct {
+	Tag    string `json:"tag"`
+	Accept bool   `json:"accept"`
+}
+
+// decideSuggestion accepts or rejects a tag suggested for the entry. The
+// decision weighs future suggestions of the tag.
+func decideSuggestion(w http.ResponseWriter, r *http.Request) {
+	e, ok := loadEntry(w, r)
+	if !ok {
+		return
+	}
+	var req suggestionRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if err := model.DecideTagSuggestion(r.Context(), u.ID, e.ID, model.NormalizeTag(req.Tag), req.Accept); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "suggestion not found")
+			return
+		}
+		slog.Error("api: deciding tag suggestion", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func listTagKeywords(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	dicts, err := model.ListTagKeywords(r.Context(), []string{u.ID})
+	if err != nil {
+		slog.Error("api: listing tag keywords", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, dicts)
+}
+
+type tagKeywordsRequest struct {
+	Keywords []string `json:"keywords"`
+}
+
+// saveTagKeywords replaces the dictionary of the tag. New entries
+// mentioning one of the keywords get the tag.
+func saveTagKeywords(w http.ResponseWriter, r *http.Request) {
+	tag := tagParam(r)
+	if tag == "" || len(tag) > model.MaxTagLength {
+		render.Error(w, http.StatusBadRequest, fmt.Sprintf("tags must be 1 to %d characters", model.MaxTagLength))
+		return
+	}
+	var req tagKeywordsRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	keywords := []string{}
+	for _, k := range req.Keywords {
+		if k = strings.TrimSpace(k); k != "" {
+			keywords = append(keywords, k)
+		}
+	}
+	if len(keywords) == 0 || len(keywords) > maxKeywords {
+		render.Error(w, http.StatusBadRequest, fmt.Sprintf("keywords must list 1 to %d keywords", maxKeywords))
+		return
+	}
+	k := &model.TagKeywords{UserID: model.UserFromContext(r.Context()).ID, Tag: tag, Keywords: keywords}
+	if err := model.SaveTagKeywords(r.Context(), k); err != nil {
+		slog.Error("api: saving tag keywords", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, k)
+}
+
+func deleteTagKeywords(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	if err := model.DeleteTagKeywords(r.Context(), u.ID, tagParam(r)); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "tag keywords not found")
+			return
+		}
+		slog.Error("api: deleting tag keywords", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// tagParam returns the normalized tag of the path, in which spaces are
+// escaped.
+func tagParam(r *http.Request) string {
+	tag, err := url.PathUnescape(chi.URLParam(r, "tag"))
+	if err != nil {
+		return ""
+	}
+	return model.NormalizeTag(tag)
+}
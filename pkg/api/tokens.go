@@ -0,0 +1,85 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+type tokenResponse struct {
+	*model.APIToken
+	Scopes []string `json:"scopes"`
+	// Token is the plain token, only returned on creation.
+	Token string `json:"token,omitempty"`
+}
+
+type createTokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	ExpiresAt int64    `json:"expires_at"`
+}
+
+func listTokens(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	tokens, err := model.ListAPITokens(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: listing tokens", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	out := make([]tokenResponse, len(tokens))
+	for i := range tokens {
+		out[i] = tokenResponse{APIToken: &tokens[i], Scopes: tokens[i].ScopeList()}
+	}
+	render.JSON(w, http.StatusOK, out)
+}
+
+func createToken(w http.ResponseWriter, r *http.Request) {
+	var req createTokenRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		render.Error(w, http.StatusBadRequest, "name is required")
+		return
+	}
+	if req.ExpiresAt != 0 && req.ExpiresAt <= time.Now().Unix() {
+		render.Error(w, http.StatusBadRequest, "expires_at must be in the future")
+		return
+	}
+
+	u := model.UserFromContext(r.Context())
+	t, plain, err := model.CreateAPIToken(r.Context(), u, req.Name, req.Scopes, req.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, model.ErrInvalidScope) {
+			render.Error(w, http.StatusBadRequest, "invalid scopes, expected any of "+strings.Join(model.Scopes, ", "))
+			return
+		}
+		slog.Error("api: creating token", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusCreated, tokenResponse{APIToken: t, Scopes: t.ScopeList(), Token: plain})
+}
+
+func deleteToken(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	if err := model.DeleteAPIToken(r.Context(), u.ID, chi.URLParam(r, "id")); err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			render.Error(w, http.StatusNotFound, "token not found")
+			return
+		}
+		slog.Error("api: deleting token", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
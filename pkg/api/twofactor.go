@@ -0,0 +1,247 @@
+package api
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/auth"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+// totpIssuer is the account issuer shown in authenticator apps.
+const totpIssuer = "feedr"
+
+type secondFactorRequest struct {
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// verifySecondFactor completes a login left pending by login.
+func verifySecondFactor(w http.ResponseWriter, r *http.Request) {
+	var req secondFactorRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	u, err := auth.PendingLoginUser(r)
+	if err != nil {
+		render.Error(w, http.StatusUnauthorized, "no pending login")
+		return
+	}
+	ok, err := auth.VerifySecondFactor(r.Context(), u.ID, req.Code, req.RecoveryCode)
+	if err != nil {
+		slog.Error("api: verifying second factor", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if !ok {
+		if err := auth.FailSecondFactor(w, r); err != nil {
+			slog.Error("api: saving session", "error", err)
+		}
+		render.Error(w, http.StatusUnauthorized, "invalid code")
+		return
+	}
+	if err := auth.CompleteLogin(w, r, u); err != nil {
+		slog.Error("api: saving session", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, u)
+}
+
+func getTwoFactor(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	tf, err := model.GetTwoFactor(r.Context(), u.ID)
+	if errors.Is(err, model.ErrNotFound) {
+		render.JSON(w, http.StatusOK, map[string]any{"enabled": false})
+		return
+	}
+	if err != nil {
+		slog.Error("api: getting two factor", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	left, err := model.CountRecoveryCodes(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: counting recovery codes", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, map[string]any{
+		"enabled":             tf.Enabled,
+		"confirmed_at":        tf.ConfirmedAt,
+		"recovery_codes_left": left,
+	})
+}
+
+// enrollTOTP starts an enrollment and returns the secret to add to an
+// authenticator app. It is not enforced until confirmed.
+func enrollTOTP(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	enabled, err := model.HasTwoFactor(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: getting two factor", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if enabled {
+		render.Error(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+
+	secret := auth.GenerateTOTPSecret()
+	if err := model.StartTwoFactor(r.Context(), u.ID, secret); err != nil {
+		slog.Error("api: starting two factor", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	uri := auth.TOTPURI(totpIssuer, u.Email, secret)
+	qr, err := auth.TOTPQRCode(uri)
+	if err != nil {
+		slog.Error("api: rendering qr code", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, map[string]string{
+		"secret":      secret,
+		"otpauth_uri": uri,
+		"qr_code":     qr,
+	})
+}
+
+// confirmTOTP enables two-factor authentication once the user proves the
+// authenticator works, and returns the recovery codes. They are only shown
+// here.
+func confirmTOTP(w http.ResponseWriter, r *http.Request) {
+	var req secondFactorRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	tf, err := model.GetTwoFactor(r.Context(), u.ID)
+	if errors.Is(err, model.ErrNotFound) {
+		render.Error(w, http.StatusNotFound, "no pending enrollment")
+		return
+	}
+	if err != nil {
+		slog.Error("api: getting two factor", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	if tf.Enabled {
+		render.Error(w, http.StatusConflict, "two-factor authentication is already enabled")
+		return
+	}
+	step, ok := auth.ValidateTOTP(tf.Secret, req.Code, time.Now(), tf.LastUsedStep)
+	if !ok {
+		render.Error(w, http.StatusBadRequest, "invalid code")
+		return
+	}
+	codes, err := model.ConfirmTwoFactor(r.Context(), u.ID, step)
+	if err != nil {
+		slog.Error("api: confirming two factor", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+}
+
+// disableTOTP turns two-factor authentication off after checking a current
+// code or a recovery code.
+func disableTOTP(w http.ResponseWriter, r *http.Request) {
+	var req secondFactorRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if !checkSecondFactor(w, r, u, req) {
+		return
+	}
+	if err := model.DisableTwoFactor(r.Context(), u.ID); err != nil {
+		slog.Error("api: disabling two factor", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func regenerateRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	var req secondFactorRequest
+	if err := render.DecodeJSON(r, &req); err != nil {
+		render.Error(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	if !checkSecondFactor(w, r, u, req) {
+		return
+	}
+	codes, err := model.RegenerateRecoveryCodes(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: regenerating recovery codes", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	render.JSON(w, http.StatusOK, map[string]any{"recovery_codes": codes})
+}
+
+// checkSecondFactor verifies req for an enabled enrollment, writing the
+// error response and returning false when it does not pass.
+func checkSecondFactor(w http.ResponseWriter, r *http.Request, u *model.User, req secondFactorRequest) bool {
+	enabled, err := model.HasTwoFactor(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("api: getting two factor", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return false
+	}
+	if !enabled {
+		render.Error(w, http.StatusNotFound, "two-factor authentication is not enabled")
+		return false
+	}
+	allowed, err := auth.AllowSecondFactor(r)
+	if err != nil {
+		slog.Error("api: reading session", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return false
+	}
+	if !allowed {
+		render.Error(w, http.StatusTooManyRequests, "too many invalid codes, try again later")
+		return false
+	}
+	ok, err := auth.VerifySecondFactor(r.Context(), u.ID, req.Code, req.RecoveryCode)
+	if err != nil {
+		slog.Error("api: verifying second factor", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return false
+	}
+	if err := auth.CountSecondFactor(w, r, ok); err != nil {
+		slog.Error("api: saving session", "error", err)
+	}
+	if !ok {
+		render.Error(w, http.StatusBadRequest, "invalid code")
+		return false
+	}
+	return true
+}
+
+// adminResetTwoFactor removes a user's two-factor enrollment, for users who
+// lost both their authenticator and their recovery codes.
+func adminResetTwoFactor(w http.ResponseWriter, r *http.Request) {
+	id := chi.URLParam(r, "id")
+	if _, err := model.GetUserByID(r.Context(), id); err != nil {
+		render.Error(w, http.StatusNotFound, "user not found")
+		return
+	}
+	if err := model.DisableTwoFactor(r.Context(), id); err != nil {
+		slog.Error("api: resetting two factor", "error", err)
+		render.Error(w, http.StatusInternalServerError, "internal error")
+		return
+	}
+	slog.Warn("api: two factor reset by admin", "user", id, "admin", model.UserFromContext(r.Context()).ID)
+	w.WriteHeader(http.StatusNoContent)
+}
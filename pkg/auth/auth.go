@@ -0,0 +1,196 @@
+// Package auth resolves the user behind a request, either from the session
+// cookie minted by model.DatabaseStore or from a personal API token sent as
+// "Authorization: Bearer <token>".
+package auth
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/sessions"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+// TokenContextKey is the key used to store the API token in the context.
+const TokenContextKey model.ContextKey = "api_token"
+
+// sessionUserIDKey is the session value holding the logged in user ID.
+const sessionUserIDKey = "user_id"
+
+// ErrNoSessionStore is returned when sessions are used before their store is
+// created.
+var ErrNoSessionStore = errors.New("auth: the session store is not configured")
+
+// SessionStore stores sessions and gives them new IDs. model.DatabaseStore
+// is one.
+type SessionStore interface {
+	sessions.Store
+	// Renew saves session under a new ID, deleting the one it had.
+	Renew(r *http.Request, w http.ResponseWriter, session *sessions.Session) error
+}
+
+// sessionStore returns the store of the sessions and the name of their
+// cookie, or a nil store before it is created. Tests replace it with a
+// cookie store.
+var sessionStore = func() (SessionStore, string) {
+	if s := model.GetSessionsStore(); s != nil {
+		return s, config.Config.Session.SessionCookieName
+	}
+	return nil, ""
+}
+
+// Session returns the request's session.
+func Session(r *http.Request) (*sessions.Session, error) {
+	store, name := sessionStore()
+	if store == nil {
+		return nil, ErrNoSessionStore
+	}
+	return store.Get(r, name)
+}
+
+// Authenticate stores the user authenticated by the request in its context.
+// Requests without credentials continue as anonymous; requests with invalid
+// bearer tokens are rejected.
+func Authenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if plain, ok := bearerToken(r); ok {
+			t, u, err := model.GetAPIToken(ctx, plain, r.RemoteAddr)
+			if err != nil {
+				render.Error(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
+			ctx = model.WithUserContext(ctx, u)
+			ctx = context.WithValue(ctx, TokenContextKey, t)
+			next.ServeHTTP(w, r.WithContext(ctx))
+			return
+		}
+
+		if u := sessionUser(r); u != nil {
+			ctx = model.WithUserContext(ctx, u)
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func bearerToken(r *http.Request) (string, bool) {
+	header := r.Header.Get("Authorization")
+	scheme, token, ok := strings.Cut(header, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return "", false
+	}
+	token = strings.TrimSpace(token)
+	return token, token != ""
+}
+
+func sessionUser(r *http.Request) *model.User {
+	session, err := Session(r)
+	if err != nil {
+		return nil
+	}
+	id, ok := session.Values[sessionUserIDKey].(string)
+	if !ok || id == "" {
+		return nil
+	}
+	u, err := model.GetUserByID(r.Context(), id)
+	if err != nil || !u.IsActive {
+		return nil
+	}
+	return u
+}
+
+// TokenFromContext returns the API token the request was authenticated
+// with, or nil for session and anonymous requests.
+func TokenFromContext(ctx context.Context) *model.APIToken {
+	t, _ := ctx.Value(TokenContextKey).(*model.APIToken)
+	return t
+}
+
+// RequireUser rejects anonymous requests.
+func RequireUser(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if model.UserFromContext(r.Context()).IsAnon() {
+			render.Error(w, http.StatusUnauthorized, "authentication required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireSession rejects requests that are not authenticated by a session
+// cookie, so tokens cannot be used to manage credentials.
+func RequireSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if model.UserFromContext(r.Context()).IsAnon() || TokenFromContext(r.Context()) != nil {
+			render.Error(w, http.StatusUnauthorized, "session required")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// RequireScope rejects requests whose token lacks scope. Session requests
+// hold every scope the user is entitled to; the admin scope additionally
+// requires an admin user.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			u := model.UserFromContext(r.Context())
+			if u.IsAnon() {
+				render.Error(w, http.StatusUnauthorized, "authentication required")
+				return
+			}
+			if scope == model.ScopeAdmin && !u.IsAdminUser() {
+				render.Error(w, http.StatusForbidden, "admin required")
+				return
+			}
+			if t := TokenFromContext(r.Context()); t != nil && !t.HasScope(scope) {
+				render.Error(w, http.StatusForbidden, "token lacks scope "+scope)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Login records the login and mints the session cookie for u. The session
+// gets a new ID, so that an ID planted in the browser beforehand does not
+// become logged in.
+func Login(w http.ResponseWriter, r *http.Request, u *model.User) error {
+	if err := renewSession(w, r, u); err != nil {
+		return err
+	}
+	if err := model.RecordLogin(r.Context(), u, r.RemoteAddr); err != nil {
+		slog.Error("auth: recording login", "error", err)
+	}
+	return nil
+}
+
+// renewSession logs u in the request's session and saves it under a new ID.
+func renewSession(w http.ResponseWriter, r *http.Request, u *model.User) error {
+	store, name := sessionStore()
+	if store == nil {
+		return ErrNoSessionStore
+	}
+	session, err := store.Get(r, name)
+	if err != nil {
+		return err
+	}
+	session.Values[sessionUserIDKey] = u.ID
+	return store.Renew(r, w, session)
+}
+
+// Logout deletes the session and expires its cookie.
+func Logout(w http.ResponseWriter, r *http.Request) error {
+	session, err := Session(r)
+	if err != nil {
+		return err
+	}
+	session.Options.MaxAge = -1
+	return session.Save(r, w)
+}
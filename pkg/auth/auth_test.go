@@ -0,0 +1,68 @@
+package auth
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gorilla/sessions"
+	"github.com/swartzfoundation/feedr/model"
+)
+
+// cookieStore keeps sessions in cookies. As they have no ID on the server,
+// renewing one saves it again.
+type cookieStore struct {
+	*sessions.CookieStore
+	renewed int
+}
+
+func newCookieStore() *cookieStore {
+	return &cookieStore{CookieStore: sessions.NewCookieStore(make([]byte, 32))}
+}
+
+func (s *cookieStore) Renew(r *http.Request, w http.ResponseWriter, session *sessions.Session) error {
+	s.renewed++
+	return session.Save(r, w)
+}
+
+// useSessionStore stores sessions in store for the test.
+func useSessionStore(t *testing.T, store SessionStore) {
+	old := sessionStore
+	sessionStore = func() (SessionStore, string) { return store, "feedr" }
+	t.Cleanup(func() { sessionStore = old })
+}
+
+func TestRenewSession(t *testing.T) {
+	store := newCookieStore()
+	useSessionStore(t, store)
+
+	w := httptest.NewRecorder()
+	if err := renewSession(w, httptest.NewRequest(http.MethodPost, "/", nil), &model.User{ID: "user-1"}); err != nil {
+		t.Fatal(err)
+	}
+	if store.renewed != 1 {
+		t.Fatalf("renewed %d sessions, want 1", store.renewed)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	for _, c := range w.Result().Cookies() {
+		r.AddCookie(c)
+	}
+	session, err := Session(r)
+	if err != nil || session.Values[sessionUserIDKey] != "user-1" {
+		t.Errorf("session = %v, %v, want user-1 logged in", session.Values, err)
+	}
+}
+
+func TestSessionWithoutStore(t *testing.T) {
+	useSessionStore(t, nil)
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	if _, err := Session(r); !errors.Is(err, ErrNoSessionStore) {
+		t.Errorf("Session error = %v, want ErrNoSessionStore", err)
+	}
+	if err := Login(httptest.NewRecorder(), r, &model.User{ID: "user-1"}); !errors.Is(err, ErrNoSessionStore) {
+		t.Errorf("Login error = %v, want ErrNoSessionStore", err)
+	}
+}
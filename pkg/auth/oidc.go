@@ -0,0 +1,218 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+
+	"github.com/coreos/go-oidc/v3/oidc"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"golang.org/x/oauth2"
+)
+
+var (
+	ErrUnknownProvider = errors.New("auth: unknown identity provider")
+	ErrOIDCState       = errors.New("auth: oidc state mismatch")
+	ErrOIDCNonce       = errors.New("auth: oidc nonce mismatch")
+)
+
+// OIDCFlow is the per-login state kept between the redirect to the identity
+// provider and its callback.
+type OIDCFlow struct {
+	Provider string `json:"provider"`
+	State    string `json:"state"`
+	Nonce    string `json:"nonce"`
+	Verifier string `json:"verifier"`
+}
+
+// OIDCProvider performs the authorization code flow with PKCE against one
+// identity provider. Discovery happens on first use so feedr starts even when
+// a provider is unreachable.
+type OIDCProvider struct {
+	Config      config.OIDCProvider
+	RedirectURL string
+
+	mu       sync.Mutex
+	oauth    *oauth2.Config
+	verifier *oidc.IDTokenVerifier
+}
+
+// NewOIDCProvider returns a provider calling back to redirectURL.
+func NewOIDCProvider(cfg config.OIDCProvider, redirectURL string) *OIDCProvider {
+	return &OIDCProvider{Config: cfg, RedirectURL: redirectURL}
+}
+
+func (p *OIDCProvider) discover(ctx context.Context) (*oauth2.Config, *oidc.IDTokenVerifier, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.oauth != nil {
+		return p.oauth, p.verifier, nil
+	}
+	provider, err := oidc.NewProvider(ctx, p.Config.Issuer)
+	if err != nil {
+		return nil, nil, fmt.Errorf("auth: discovering %s: %w", p.Config.Name, err)
+	}
+	scopes := []string{oidc.ScopeOpenID, "email", "profile"}
+	for _, s := range p.Config.Scopes {
+		if !slices.Contains(scopes, s) {
+			scopes = append(scopes, s)
+		}
+	}
+	p.oauth = &oauth2.Config{
+		ClientID:     p.Config.ClientID,
+		ClientSecret: p.Config.ClientSecret,
+		Endpoint:     provider.Endpoint(),
+		RedirectURL:  p.RedirectURL,
+		Scopes:       scopes,
+	}
+	p.verifier = provider.Verifier(&oidc.Config{ClientID: p.Config.ClientID})
+	return p.oauth, p.verifier, nil
+}
+
+// Begin starts a login and returns the URL to send the user to along with
+// the flow to keep until the callback.
+func (p *OIDCProvider) Begin(ctx context.Context) (string, *OIDCFlow, error) {
+	oauth, _, err := p.discover(ctx)
+	if err != nil {
+		return "", nil, err
+	}
+	flow := &OIDCFlow{
+		Provider: p.Config.Name,
+		State:    model.NewToken(16),
+		Nonce:    model.NewToken(16),
+		Verifier: oauth2.GenerateVerifier(),
+	}
+	u := oauth.AuthCodeURL(flow.State, oidc.Nonce(flow.Nonce), oauth2.S256ChallengeOption(flow.Verifier))
+	return u, flow, nil
+}
+
+// Finish exchanges the authorization code returned to the callback and
+// validates the ID token against the flow.
+func (p *OIDCProvider) Finish(ctx context.Context, flow *OIDCFlow, state, code string) (*model.ExternalIdentity, error) {
+	if flow == nil || flow.Provider != p.Config.Name || flow.State == "" || flow.State != state {
+		return nil, ErrOIDCState
+	}
+	oauth, verifier, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+	token, err := oauth.Exchange(ctx, code, oauth2.VerifierOption(flow.Verifier))
+	if err != nil {
+		return nil, fmt.Errorf("auth: exchanging code: %w", err)
+	}
+	raw, ok := token.Extra("id_token").(string)
+	if !ok {
+		return nil, errors.New("auth: token response has no id_token")
+	}
+	idToken, err := verifier.Verify(ctx, raw)
+	if err != nil {
+		return nil, fmt.Errorf("auth: verifying id token: %w", err)
+	}
+	if idToken.Nonce != flow.Nonce {
+		return nil, ErrOIDCNonce
+	}
+
+	var claims struct {
+		Email             string `json:"email"`
+		EmailVerified     any    `json:"email_verified"`
+		GivenName         string `json:"given_name"`
+		FamilyName        string `json:"family_name"`
+		PreferredUsername string `json:"preferred_username"`
+	}
+	if err := idToken.Claims(&claims); err != nil {
+		return nil, fmt.Errorf("auth: decoding claims: %w", err)
+	}
+	return &model.ExternalIdentity{
+		Provider:      p.Config.Name,
+		Subject:       idToken.Subject,
+		Email:         claims.Email,
+		EmailVerified: isTrue(claims.EmailVerified),
+		FirstName:     claims.GivenName,
+		LastName:      claims.FamilyName,
+		Username:      claims.PreferredUsername,
+	}, nil
+}
+
+// isTrue accepts email_verified as a boolean or, as some providers send it,
+// a string.
+func isTrue(v any) bool {
+	switch v := v.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
+
+var oidcProviders []*OIDCProvider
+
+// ConfigureOIDC registers the configured identity providers. Callbacks are
+// served under baseURL.
+func ConfigureOIDC(cfg config.OIDCConfig, baseURL string) {
+	oidcProviders = nil
+	for _, p := range cfg.Providers {
+		redirect := strings.TrimRight(baseURL, "/") + "/api/v1/auth/oidc/" + p.Name + "/callback"
+		oidcProviders = append(oidcProviders, NewOIDCProvider(p, redirect))
+	}
+}
+
+// OIDCProviders returns the registered identity providers.
+func OIDCProviders() []*OIDCProvider {
+	return oidcProviders
+}
+
+// GetOIDCProvider returns the registered provider called name.
+func GetOIDCProvider(name string) (*OIDCProvider, error) {
+	for _, p := range oidcProviders {
+		if p.Config.Name == name {
+			return p, nil
+		}
+	}
+	return nil, ErrUnknownProvider
+}
+
+// oidcFlowKey is the session value holding the pending OIDC flow.
+const oidcFlowKey = "oidc_flow"
+
+// SaveOIDCFlow keeps flow in the session until the provider calls back.
+func SaveOIDCFlow(w http.ResponseWriter, r *http.Request, flow *OIDCFlow) error {
+	session, err := Session(r)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(flow)
+	if err != nil {
+		return err
+	}
+	session.Values[oidcFlowKey] = string(b)
+	return session.Save(r, w)
+}
+
+// TakeOIDCFlow returns the pending OIDC flow and removes it from the session
+// so it cannot be replayed.
+func TakeOIDCFlow(w http.ResponseWriter, r *http.Request) (*OIDCFlow, error) {
+	session, err := Session(r)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := session.Values[oidcFlowKey].(string)
+	if !ok {
+		return nil, ErrOIDCState
+	}
+	delete(session.Values, oidcFlowKey)
+	if err := session.Save(r, w); err != nil {
+		return nil, err
+	}
+	var flow OIDCFlow
+	if err := json.Unmarshal([]byte(raw), &flow); err != nil {
+		return nil, ErrOIDCState
+	}
+	return &flow, nil
+}
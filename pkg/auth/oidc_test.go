@@ -0,0 +1,192 @@
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/go-jose/go-jose/v4"
+	"github.com/swartzfoundation/feedr/pkg/config"
+)
+
+// mockOIDC is a minimal identity provider issuing one authorization code.
+type mockOIDC struct {
+	t         *testing.T
+	server    *httptest.Server
+	key       *rsa.PrivateKey
+	challenge string
+	nonce     string
+	claims    map[string]any
+}
+
+func newMockOIDC(t *testing.T) *mockOIDC {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := &mockOIDC{t: t, key: key}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", m.discovery)
+	mux.HandleFunc("/jwks", m.jwks)
+	mux.HandleFunc("/token", m.token)
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockOIDC) discovery(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(map[string]any{
+		"issuer":                                m.server.URL,
+		"authorization_endpoint":                m.server.URL + "/authorize",
+		"token_endpoint":                        m.server.URL + "/token",
+		"jwks_uri":                              m.server.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (m *mockOIDC) jwks(w http.ResponseWriter, r *http.Request) {
+	json.NewEncoder(w).Encode(jose.JSONWebKeySet{Keys: []jose.JSONWebKey{
+		{Key: &m.key.PublicKey, KeyID: "test", Algorithm: "RS256", Use: "sig"},
+	}})
+}
+
+// authorize plays the user approving the login at the authorization URL.
+func (m *mockOIDC) authorize(authURL string) (state, code string) {
+	u, err := url.Parse(authURL)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	q := u.Query()
+	if q.Get("code_challenge_method") != "S256" {
+		m.t.Fatalf("expected S256 PKCE challenge, got %q", q.Get("code_challenge_method"))
+	}
+	m.challenge = q.Get("code_challenge")
+	m.nonce = q.Get("nonce")
+	return q.Get("state"), "the-code"
+}
+
+func (m *mockOIDC) token(w http.ResponseWriter, r *http.Request) {
+	r.ParseForm()
+	sum := sha256.Sum256([]byte(r.Form.Get("code_verifier")))
+	if r.Form.Get("code") != "the-code" || base64.RawURLEncoding.EncodeToString(sum[:]) != m.challenge {
+		http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+		return
+	}
+	claims := map[string]any{
+		"iss":   m.server.URL,
+		"sub":   "subject-1",
+		"aud":   "feedr",
+		"exp":   time.Now().Add(time.Hour).Unix(),
+		"iat":   time.Now().Unix(),
+		"nonce": m.nonce,
+	}
+	for k, v := range m.claims {
+		claims[k] = v
+	}
+	signer, err := jose.NewSigner(jose.SigningKey{Algorithm: jose.RS256, Key: m.key},
+		(&jose.SignerOptions{}).WithType("JWT").WithHeader("kid", "test"))
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	payload, _ := json.Marshal(claims)
+	jws, err := signer.Sign(payload)
+	if err != nil {
+		m.t.Fatal(err)
+	}
+	idToken, _ := jws.CompactSerialize()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     idToken,
+	})
+}
+
+func newTestProvider(m *mockOIDC) *OIDCProvider {
+	return NewOIDCProvider(config.OIDCProvider{
+		Name:     "mock",
+		Issuer:   m.server.URL,
+		ClientID: "feedr",
+	}, "http://feedr.test/api/v1/auth/oidc/mock/callback")
+}
+
+func TestOIDCLogin(t *testing.T) {
+	m := newMockOIDC(t)
+	m.claims = map[string]any{
+		"email":          "ada@example.com",
+		"email_verified": true,
+		"given_name":     "Ada",
+	}
+	p := newTestProvider(m)
+	ctx := context.Background()
+
+	authURL, flow, err := p.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	state, code := m.authorize(authURL)
+
+	ext, err := p.Finish(ctx, flow, state, code)
+	if err != nil {
+		t.Fatalf("Finish: %v", err)
+	}
+	if ext.Subject != "subject-1" || ext.Email != "ada@example.com" || !ext.EmailVerified || ext.FirstName != "Ada" {
+		t.Errorf("unexpected identity %+v", ext)
+	}
+}
+
+func TestOIDCRejectsStateMismatch(t *testing.T) {
+	m := newMockOIDC(t)
+	p := newTestProvider(m)
+	ctx := context.Background()
+
+	authURL, flow, err := p.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	_, code := m.authorize(authURL)
+	if _, err := p.Finish(ctx, flow, "forged", code); err != ErrOIDCState {
+		t.Errorf("expected ErrOIDCState, got %v", err)
+	}
+}
+
+func TestOIDCRejectsNonceMismatch(t *testing.T) {
+	m := newMockOIDC(t)
+	p := newTestProvider(m)
+	ctx := context.Background()
+
+	authURL, flow, err := p.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	state, code := m.authorize(authURL)
+	m.nonce = "replayed"
+	if _, err := p.Finish(ctx, flow, state, code); err != ErrOIDCNonce {
+		t.Errorf("expected ErrOIDCNonce, got %v", err)
+	}
+}
+
+func TestOIDCRejectsWrongVerifier(t *testing.T) {
+	m := newMockOIDC(t)
+	p := newTestProvider(m)
+	ctx := context.Background()
+
+	authURL, flow, err := p.Begin(ctx)
+	if err != nil {
+		t.Fatalf("Begin: %v", err)
+	}
+	state, code := m.authorize(authURL)
+	flow.Verifier = "not-the-verifier"
+	if _, err := p.Finish(ctx, flow, state, code); err == nil {
+		t.Errorf("expected exchange with a wrong PKCE verifier to fail")
+	}
+}
@@ -0,0 +1,255 @@
+package auth
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/swartzfoundation/feedr/model"
+)
+
+// webAuthnSessionKey is the session value holding the pending ceremony.
+const webAuthnSessionKey = "webauthn_session"
+
+// ceremonyTimeout bounds the time between the two steps of a registration
+// or a login.
+const ceremonyTimeout = 5 * time.Minute
+
+var (
+	ErrPasskeysDisabled = errors.New("auth: passkeys are not configured")
+	ErrNoCeremony       = errors.New("auth: no pending passkey ceremony")
+	ErrPasskeyCloned    = errors.New("auth: passkey signature counter went backwards")
+)
+
+var webAuthn *webauthn.WebAuthn
+
+// ConfigurePasskeys sets up the relying party for the public baseURL.
+func ConfigurePasskeys(displayName, baseURL string) error {
+	u, err := url.Parse(baseURL)
+	if err != nil {
+		return err
+	}
+	w, err := webauthn.New(&webauthn.Config{
+		RPID:          u.Hostname(),
+		RPDisplayName: displayName,
+		RPOrigins:     []string{u.Scheme + "://" + u.Host},
+		AuthenticatorSelection: protocol.AuthenticatorSelection{
+			ResidentKey:      protocol.ResidentKeyRequirementRequired,
+			UserVerification: protocol.VerificationRequired,
+		},
+		Timeouts: webauthn.TimeoutsConfig{
+			Login:        webauthn.TimeoutConfig{Enforce: true, Timeout: ceremonyTimeout, TimeoutUVD: ceremonyTimeout},
+			Registration: webauthn.TimeoutConfig{Enforce: true, Timeout: ceremonyTimeout, TimeoutUVD: ceremonyTimeout},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	webAuthn = w
+	return nil
+}
+
+// passkeyUser adapts a user and their passkeys to webauthn.User.
+type passkeyUser struct {
+	user        *model.User
+	credentials []webauthn.Credential
+}
+
+func (u *passkeyUser) WebAuthnID() []byte                         { return []byte(u.user.ID) }
+func (u *passkeyUser) WebAuthnName() string                       { return u.user.Email }
+func (u *passkeyUser) WebAuthnCredentials() []webauthn.Credential { return u.credentials }
+
+func (u *passkeyUser) WebAuthnDisplayName() string {
+	if u.user.FirstName != "" {
+		return u.user.FirstName + " " + u.user.LastName
+	}
+	return u.user.Username
+}
+
+func loadPasskeyUser(r *http.Request, u *model.User) (*passkeyUser, error) {
+	keys, err := model.ListPasskeys(r.Context(), u.ID)
+	if err != nil {
+		return nil, err
+	}
+	pu := &passkeyUser{user: u}
+	for _, k := range keys {
+		var c webauthn.Credential
+		if err := json.Unmarshal([]byte(k.Data), &c); err != nil {
+			return nil, fmt.Errorf("auth: decoding passkey %s: %w", k.ID, err)
+		}
+		pu.credentials = append(pu.credentials, c)
+	}
+	return pu, nil
+}
+
+func saveCeremony(w http.ResponseWriter, r *http.Request, data *webauthn.SessionData) error {
+	session, err := Session(r)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	session.Values[webAuthnSessionKey] = string(b)
+	return session.Save(r, w)
+}
+
+func takeCeremony(w http.ResponseWriter, r *http.Request) (*webauthn.SessionData, error) {
+	session, err := Session(r)
+	if err != nil {
+		return nil, err
+	}
+	raw, ok := session.Values[webAuthnSessionKey].(string)
+	if !ok {
+		return nil, ErrNoCeremony
+	}
+	delete(session.Values, webAuthnSessionKey)
+	if err := session.Save(r, w); err != nil {
+		return nil, err
+	}
+	var data webauthn.SessionData
+	if err := json.Unmarshal([]byte(raw), &data); err != nil {
+		return nil, ErrNoCeremony
+	}
+	// webauthn only checks the expiry of logins naming the user.
+	if !data.Expires.IsZero() && data.Expires.Before(time.Now()) {
+		return nil, ErrNoCeremony
+	}
+	return &data, nil
+}
+
+// BeginPasskeyRegistration returns the creation options for a new passkey
+// of u. Already registered authenticators are excluded.
+func BeginPasskeyRegistration(w http.ResponseWriter, r *http.Request, u *model.User) (*protocol.CredentialCreation, error) {
+	if webAuthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	pu, err := loadPasskeyUser(r, u)
+	if err != nil {
+		return nil, err
+	}
+	creation, data, err := beginRegistration(pu)
+	if err != nil {
+		return nil, err
+	}
+	return creation, saveCeremony(w, r, data)
+}
+
+func beginRegistration(pu *passkeyUser) (*protocol.CredentialCreation, *webauthn.SessionData, error) {
+	exclude := make([]protocol.CredentialDescriptor, len(pu.credentials))
+	for i, c := range pu.credentials {
+		exclude[i] = c.Descriptor()
+	}
+	return webAuthn.BeginRegistration(pu, webauthn.WithExclusions(exclude))
+}
+
+// FinishPasskeyRegistration verifies the authenticator response in the
+// request body and stores the new passkey under name.
+func FinishPasskeyRegistration(w http.ResponseWriter, r *http.Request, u *model.User, name string) (*model.Passkey, error) {
+	if webAuthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	data, err := takeCeremony(w, r)
+	if err != nil {
+		return nil, err
+	}
+	pu, err := loadPasskeyUser(r, u)
+	if err != nil {
+		return nil, err
+	}
+	cred, err := webAuthn.FinishRegistration(pu, *data, r)
+	if err != nil {
+		return nil, err
+	}
+	b, err := json.Marshal(cred)
+	if err != nil {
+		return nil, err
+	}
+	p := &model.Passkey{
+		UserID:       u.ID,
+		Name:         name,
+		CredentialID: base64.RawURLEncoding.EncodeToString(cred.ID),
+		Data:         string(b),
+	}
+	if err := model.CreatePasskey(r.Context(), p); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+// BeginPasskeyLogin returns the assertion options for a passwordless login
+// with any discoverable passkey.
+func BeginPasskeyLogin(w http.ResponseWriter, r *http.Request) (*protocol.CredentialAssertion, error) {
+	if webAuthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	assertion, data, err := webAuthn.BeginDiscoverableLogin(webauthn.WithUserVerification(protocol.VerificationRequired))
+	if err != nil {
+		return nil, err
+	}
+	return assertion, saveCeremony(w, r, data)
+}
+
+// FinishPasskeyLogin verifies the assertion in the request body and returns
+// the user owning the passkey. The caller mints the session.
+func FinishPasskeyLogin(w http.ResponseWriter, r *http.Request) (*model.User, error) {
+	if webAuthn == nil {
+		return nil, ErrPasskeysDisabled
+	}
+	data, err := takeCeremony(w, r)
+	if err != nil {
+		return nil, err
+	}
+
+	owner, cred, err := finishLogin(r, data, func(userHandle []byte) (*passkeyUser, error) {
+		u, err := model.GetUserByID(r.Context(), string(userHandle))
+		if err != nil {
+			return nil, err
+		}
+		if !u.IsActive {
+			return nil, model.ErrUserInactive
+		}
+		return loadPasskeyUser(r, u)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(cred)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.TouchPasskey(r.Context(), base64.RawURLEncoding.EncodeToString(cred.ID), string(b)); err != nil {
+		return nil, err
+	}
+	return owner.user, nil
+}
+
+// finishLogin verifies the assertion in the request body against the
+// ceremony. lookup returns the owner of the passkey from its user handle.
+func finishLogin(r *http.Request, data *webauthn.SessionData, lookup func(userHandle []byte) (*passkeyUser, error)) (*passkeyUser, *webauthn.Credential, error) {
+	var owner *passkeyUser
+	handler := func(rawID, userHandle []byte) (webauthn.User, error) {
+		pu, err := lookup(userHandle)
+		if err != nil {
+			return nil, err
+		}
+		owner = pu
+		return pu, nil
+	}
+	cred, err := webAuthn.FinishDiscoverableLogin(handler, *data, r)
+	if err != nil {
+		return nil, nil, err
+	}
+	if cred.Authenticator.CloneWarning {
+		return nil, nil, ErrPasskeyCloned
+	}
+	return owner, cred, nil
+}
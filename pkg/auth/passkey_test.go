@@ -0,0 +1,288 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-webauthn/webauthn/protocol/webauthncbor"
+	"github.com/go-webauthn/webauthn/protocol/webauthncose"
+	"github.com/go-webauthn/webauthn/webauthn"
+	"github.com/swartzfoundation/feedr/model"
+)
+
+const passkeyOrigin = "https://feedr.test"
+
+// softAuthenticator is a platform authenticator holding one passkey.
+type softAuthenticator struct {
+	t       *testing.T
+	key     *ecdsa.PrivateKey
+	id      []byte
+	counter uint32
+}
+
+func newSoftAuthenticator(t *testing.T) *softAuthenticator {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := make([]byte, 16)
+	rand.Read(id)
+	return &softAuthenticator{t: t, key: key, id: id}
+}
+
+func (a *softAuthenticator) clientData(typ, challenge string) []byte {
+	b, _ := json.Marshal(map[string]any{
+		"type":      typ,
+		"challenge": challenge,
+		"origin":    passkeyOrigin,
+	})
+	return b
+}
+
+// authData returns the authenticator data with the user present and
+// verified, and the next signature counter.
+func (a *softAuthenticator) authData(flags byte, extra []byte) []byte {
+	a.counter++
+	rpIDHash := sha256.Sum256([]byte("feedr.test"))
+	var b bytes.Buffer
+	b.Write(rpIDHash[:])
+	b.WriteByte(flags)
+	binary.Write(&b, binary.BigEndian, a.counter)
+	b.Write(extra)
+	return b.Bytes()
+}
+
+// create answers the creation options of a registration ceremony.
+func (a *softAuthenticator) create(data *webauthn.SessionData) *http.Request {
+	pub, err := webauthncbor.Marshal(webauthncose.EC2PublicKeyData{
+		PublicKeyData: webauthncose.PublicKeyData{
+			KeyType:   int64(webauthncose.EllipticKey),
+			Algorithm: int64(webauthncose.AlgES256),
+		},
+		Curve:  1,
+		XCoord: a.key.X.FillBytes(make([]byte, 32)),
+		YCoord: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	var cred bytes.Buffer
+	cred.Write(make([]byte, 16)) // AAGUID
+	binary.Write(&cred, binary.BigEndian, uint16(len(a.id)))
+	cred.Write(a.id)
+	cred.Write(pub)
+	attestation, err := webauthncbor.Marshal(map[string]any{
+		"fmt":      "none",
+		"attStmt":  map[string]any{},
+		"authData": a.authData(0x45, cred.Bytes()),
+	})
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.respond(map[string]string{
+		"clientDataJSON":    b64(a.clientData("webauthn.create", data.Challenge)),
+		"attestationObject": b64(attestation),
+	})
+}
+
+// get answers the assertion options of a login ceremony for userID.
+func (a *softAuthenticator) get(data *webauthn.SessionData, userID string) *http.Request {
+	clientData := a.clientData("webauthn.get", data.Challenge)
+	authData := a.authData(0x05, nil)
+	sum := sha256.Sum256(clientData)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), sum[:]...))
+	sig, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		a.t.Fatal(err)
+	}
+	return a.respond(map[string]string{
+		"clientDataJSON":    b64(clientData),
+		"authenticatorData": b64(authData),
+		"signature":         b64(sig),
+		"userHandle":        b64([]byte(userID)),
+	})
+}
+
+func (a *softAuthenticator) respond(response map[string]string) *http.Request {
+	body, _ := json.Marshal(map[string]any{
+		"id":       b64(a.id),
+		"rawId":    b64(a.id),
+		"type":     "public-key",
+		"response": response,
+	})
+	return httptest.NewRequest(http.MethodPost, "/", bytes.NewReader(body))
+}
+
+func b64(b []byte) string { return base64.RawURLEncoding.EncodeToString(b) }
+
+func setupPasskeys(t *testing.T) {
+	if err := ConfigurePasskeys("Feedr", passkeyOrigin); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { webAuthn = nil })
+}
+
+// registerPasskey runs a registration ceremony and returns the user with
+// the new passkey.
+func registerPasskey(t *testing.T, a *softAuthenticator) *passkeyUser {
+	pu := &passkeyUser{user: &model.User{ID: "user-1", Email: "ada@example.com", Username: "ada"}}
+	_, data, err := beginRegistration(pu)
+	if err != nil {
+		t.Fatalf("beginRegistration: %v", err)
+	}
+	cred, err := webAuthn.FinishRegistration(pu, *data, a.create(data))
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	pu.credentials = append(pu.credentials, *cred)
+	return pu
+}
+
+func beginLogin(t *testing.T) *webauthn.SessionData {
+	_, data, err := webAuthn.BeginDiscoverableLogin()
+	if err != nil {
+		t.Fatalf("BeginDiscoverableLogin: %v", err)
+	}
+	return data
+}
+
+func lookupPasskeyUser(pu *passkeyUser) func([]byte) (*passkeyUser, error) {
+	return func(userHandle []byte) (*passkeyUser, error) {
+		if string(userHandle) != pu.user.ID {
+			return nil, model.ErrNotFound
+		}
+		return pu, nil
+	}
+}
+
+func TestPasskeyRegistration(t *testing.T) {
+	setupPasskeys(t)
+	a := newSoftAuthenticator(t)
+	pu := registerPasskey(t, a)
+	if !bytes.Equal(pu.credentials[0].ID, a.id) {
+		t.Errorf("credential ID = %x, want %x", pu.credentials[0].ID, a.id)
+	}
+
+	// A registered authenticator is excluded from the next registration.
+	creation, _, err := beginRegistration(pu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if excluded := creation.Response.CredentialExcludeList; len(excluded) != 1 || !bytes.Equal(excluded[0].CredentialID, a.id) {
+		t.Errorf("unexpected exclusions %+v", excluded)
+	}
+}
+
+func TestPasskeyLogin(t *testing.T) {
+	setupPasskeys(t)
+	a := newSoftAuthenticator(t)
+	pu := registerPasskey(t, a)
+
+	data := beginLogin(t)
+	owner, cred, err := finishLogin(a.get(data, pu.user.ID), data, lookupPasskeyUser(pu))
+	if err != nil {
+		t.Fatalf("finishLogin: %v", err)
+	}
+	if owner.user.ID != "user-1" || cred.Authenticator.SignCount != a.counter {
+		t.Errorf("unexpected owner %q or counter %d", owner.user.ID, cred.Authenticator.SignCount)
+	}
+}
+
+func TestPasskeyLoginRejectsReusedChallenge(t *testing.T) {
+	setupPasskeys(t)
+	a := newSoftAuthenticator(t)
+	pu := registerPasskey(t, a)
+
+	first := beginLogin(t)
+	replayed := a.get(first, pu.user.ID)
+	second := beginLogin(t)
+	if _, _, err := finishLogin(replayed, second, lookupPasskeyUser(pu)); err == nil {
+		t.Error("expected an assertion for another challenge to fail")
+	}
+}
+
+func TestPasskeyLoginRejectsClonedAuthenticator(t *testing.T) {
+	setupPasskeys(t)
+	a := newSoftAuthenticator(t)
+	pu := registerPasskey(t, a)
+
+	a.counter-- // signs with the counter already seen at registration
+	data := beginLogin(t)
+	if _, _, err := finishLogin(a.get(data, pu.user.ID), data, lookupPasskeyUser(pu)); !errors.Is(err, ErrPasskeyCloned) {
+		t.Errorf("expected ErrPasskeyCloned, got %v", err)
+	}
+}
+
+func TestPasskeyCeremonyExpires(t *testing.T) {
+	setupPasskeys(t)
+	data := beginLogin(t)
+	if data.Expires.IsZero() || data.Expires.After(time.Now().Add(ceremonyTimeout)) {
+		t.Fatalf("unexpected ceremony expiry %v", data.Expires)
+	}
+
+	pu := &passkeyUser{user: &model.User{ID: "user-1", Email: "ada@example.com"}}
+	_, data, err := beginRegistration(pu)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data.Expires = time.Now().Add(-time.Second)
+	if _, err := webAuthn.FinishRegistration(pu, *data, newSoftAuthenticator(t).create(data)); err == nil {
+		t.Error("expected an expired registration to fail")
+	}
+}
+
+// useCookieSessions stores sessions in cookies for the test and returns a
+// function taking the pending ceremony from a request with cookies.
+func useCookieSessions(t *testing.T) func([]*http.Cookie) (*webauthn.SessionData, []*http.Cookie, error) {
+	useSessionStore(t, newCookieStore())
+
+	return func(cookies []*http.Cookie) (*webauthn.SessionData, []*http.Cookie, error) {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		for _, c := range cookies {
+			r.AddCookie(c)
+		}
+		w := httptest.NewRecorder()
+		got, err := takeCeremony(w, r)
+		return got, w.Result().Cookies(), err
+	}
+}
+
+func saveTestCeremony(t *testing.T, data *webauthn.SessionData) []*http.Cookie {
+	w := httptest.NewRecorder()
+	if err := saveCeremony(w, httptest.NewRequest(http.MethodGet, "/", nil), data); err != nil {
+		t.Fatal(err)
+	}
+	return w.Result().Cookies()
+}
+
+func TestTakeCeremonyOnce(t *testing.T) {
+	take := useCookieSessions(t)
+	cookies := saveTestCeremony(t, &webauthn.SessionData{Challenge: "challenge", Expires: time.Now().Add(time.Minute)})
+
+	got, cookies, err := take(cookies)
+	if err != nil || got.Challenge != "challenge" {
+		t.Fatalf("takeCeremony = %+v, %v", got, err)
+	}
+	if _, _, err := take(cookies); err != ErrNoCeremony {
+		t.Errorf("expected ErrNoCeremony on reuse, got %v", err)
+	}
+}
+
+func TestTakeCeremonyExpired(t *testing.T) {
+	take := useCookieSessions(t)
+	cookies := saveTestCeremony(t, &webauthn.SessionData{Challenge: "challenge", Expires: time.Now().Add(-time.Second)})
+	if _, _, err := take(cookies); err != ErrNoCeremony {
+		t.Errorf("expected ErrNoCeremony for an expired ceremony, got %v", err)
+	}
+}
@@ -0,0 +1,61 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTOTPCode(t *testing.T) {
+	// RFC 6238 appendix B test vectors for SHA1, truncated to 6 digits.
+	key := []byte("12345678901234567890")
+	var tests = []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("at %d got %s expected %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+	now := time.Unix(1111111109, 0)
+
+	step, ok := ValidateTOTP(secret, "081804", now, 0)
+	if !ok {
+		t.Fatalf("expected code to validate")
+	}
+	if _, ok := ValidateTOTP(secret, "081804", now, step); ok {
+		t.Errorf("expected a used code to be refused")
+	}
+	if _, ok := ValidateTOTP(secret, "081804", now.Add(30*time.Second), 0); !ok {
+		t.Errorf("expected the previous step to be accepted for clock drift")
+	}
+	if _, ok := ValidateTOTP(secret, "081804", now.Add(2*time.Minute), 0); ok {
+		t.Errorf("expected an old code to be refused")
+	}
+	if _, ok := ValidateTOTP(secret, "12345", now, 0); ok {
+		t.Errorf("expected a short code to be refused")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("feedr", "ada@example.com", "ABC")
+	if !strings.HasPrefix(uri, "otpauth://totp/feedr:ada@example.com?") {
+		t.Errorf("unexpected uri %s", uri)
+	}
+	if !strings.Contains(uri, "secret=ABC") || !strings.Contains(uri, "issuer=feedr") {
+		t.Errorf("uri is missing parameters: %s", uri)
+	}
+}
@@ -0,0 +1,179 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+)
+
+// Session values tracking a login that passed the password step and waits
+// for the second factor.
+const (
+	sessionPendingUserIDKey   = "pending_user_id"
+	sessionPendingAtKey       = "pending_at"
+	sessionPendingAttemptsKey = "pending_attempts"
+)
+
+// Session values counting the wrong codes of a logged in user managing
+// their two-factor authentication.
+const (
+	sessionFailuresKey = "second_factor_failures"
+	sessionFailedAtKey = "second_factor_failed_at"
+)
+
+const (
+	// pendingLoginTTL bounds the time between the two login steps.
+	pendingLoginTTL = 5 * time.Minute
+	// maxSecondFactorAttempts is the number of wrong codes accepted before
+	// the pending login is dropped and the password must be entered again.
+	maxSecondFactorAttempts = 5
+	// secondFactorLockout is the delay before a logged in user can try
+	// codes again after too many wrong ones.
+	secondFactorLockout = 15 * time.Minute
+)
+
+var ErrNoPendingLogin = errors.New("auth: no pending login")
+
+// BeginLogin logs u in, unless u has two-factor authentication enabled, in
+// which case the login is left pending in the session and true is returned.
+func BeginLogin(w http.ResponseWriter, r *http.Request, u *model.User) (bool, error) {
+	enabled, err := model.HasTwoFactor(r.Context(), u.ID)
+	if err != nil {
+		return false, err
+	}
+	if !enabled {
+		return false, Login(w, r, u)
+	}
+	session, err := Session(r)
+	if err != nil {
+		return false, err
+	}
+	delete(session.Values, sessionUserIDKey)
+	session.Values[sessionPendingUserIDKey] = u.ID
+	session.Values[sessionPendingAtKey] = time.Now().Unix()
+	session.Values[sessionPendingAttemptsKey] = 0
+	return true, session.Save(r, w)
+}
+
+// PendingLoginUser returns the user whose login waits for a second factor.
+func PendingLoginUser(r *http.Request) (*model.User, error) {
+	session, err := Session(r)
+	if err != nil {
+		return nil, err
+	}
+	id, _ := session.Values[sessionPendingUserIDKey].(string)
+	at, _ := session.Values[sessionPendingAtKey].(int64)
+	if id == "" || time.Since(time.Unix(at, 0)) > pendingLoginTTL {
+		return nil, ErrNoPendingLogin
+	}
+	return model.GetUserByID(r.Context(), id)
+}
+
+// CompleteLogin finishes a pending login once the second factor passed.
+func CompleteLogin(w http.ResponseWriter, r *http.Request, u *model.User) error {
+	session, err := Session(r)
+	if err != nil {
+		return err
+	}
+	clearPendingLogin(session.Values)
+	return Login(w, r, u)
+}
+
+// FailSecondFactor counts a wrong code and drops the pending login after too
+// many of them.
+func FailSecondFactor(w http.ResponseWriter, r *http.Request) error {
+	session, err := Session(r)
+	if err != nil {
+		return err
+	}
+	attempts, _ := session.Values[sessionPendingAttemptsKey].(int)
+	attempts++
+	if attempts >= maxSecondFactorAttempts {
+		clearPendingLogin(session.Values)
+	} else {
+		session.Values[sessionPendingAttemptsKey] = attempts
+	}
+	return session.Save(r, w)
+}
+
+func clearPendingLogin(values map[any]any) {
+	delete(values, sessionPendingUserIDKey)
+	delete(values, sessionPendingAtKey)
+	delete(values, sessionPendingAttemptsKey)
+}
+
+// VerifySecondFactor checks a TOTP code, or a recovery code when code is
+// empty, for the user and consumes it.
+func VerifySecondFactor(ctx context.Context, userID, code, recoveryCode string) (bool, error) {
+	if code == "" {
+		if recoveryCode == "" {
+			return false, nil
+		}
+		return model.UseRecoveryCode(ctx, userID, recoveryCode)
+	}
+	tf, err := model.GetTwoFactor(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+	step, ok := ValidateTOTP(tf.Secret, code, time.Now(), tf.LastUsedStep)
+	if !ok {
+		return false, nil
+	}
+	if err := model.UseTwoFactorStep(ctx, userID, step); err != nil {
+		if errors.Is(err, model.ErrTwoFactorStepUsed) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// AllowSecondFactor reports whether the session may check a code to manage
+// its two-factor authentication. After maxSecondFactorAttempts wrong codes,
+// it must wait secondFactorLockout, as a login would have to start over.
+func AllowSecondFactor(r *http.Request) (bool, error) {
+	session, err := Session(r)
+	if err != nil {
+		return false, err
+	}
+	return !secondFactorLocked(session.Values, time.Now()), nil
+}
+
+// CountSecondFactor records the outcome of a code checked by
+// AllowSecondFactor's caller.
+func CountSecondFactor(w http.ResponseWriter, r *http.Request, ok bool) error {
+	session, err := Session(r)
+	if err != nil {
+		return err
+	}
+	if ok {
+		if _, found := session.Values[sessionFailuresKey]; !found {
+			return nil
+		}
+		delete(session.Values, sessionFailuresKey)
+		delete(session.Values, sessionFailedAtKey)
+	} else {
+		countSecondFactorFailure(session.Values, time.Now())
+	}
+	return session.Save(r, w)
+}
+
+func secondFactorLocked(values map[any]any, now time.Time) bool {
+	failures, _ := values[sessionFailuresKey].(int)
+	at, _ := values[sessionFailedAtKey].(int64)
+	return failures >= maxSecondFactorAttempts && now.Sub(time.Unix(at, 0)) < secondFactorLockout
+}
+
+func countSecondFactorFailure(values map[any]any, now time.Time) {
+	failures, _ := values[sessionFailuresKey].(int)
+	at, _ := values[sessionFailedAtKey].(int64)
+	if now.Sub(time.Unix(at, 0)) >= secondFactorLockout {
+		// Failures older than the lockout are forgotten.
+		failures = 0
+	}
+	values[sessionFailuresKey] = failures + 1
+	values[sessionFailedAtKey] = now.Unix()
+}
@@ -0,0 +1,29 @@
+package auth
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSecondFactorLockout(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	values := map[any]any{}
+	for i := range maxSecondFactorAttempts {
+		if secondFactorLocked(values, now) {
+			t.Fatalf("locked after %d failures", i)
+		}
+		countSecondFactorFailure(values, now)
+	}
+	if !secondFactorLocked(values, now.Add(time.Minute)) {
+		t.Error("not locked after too many failures")
+	}
+	if secondFactorLocked(values, now.Add(secondFactorLockout)) {
+		t.Error("still locked after the lockout")
+	}
+
+	// Failures older than the lockout are forgotten.
+	countSecondFactorFailure(values, now.Add(secondFactorLockout))
+	if got := values[sessionFailuresKey]; got != 1 {
+		t.Errorf("failures after the lockout = %v, want 1", got)
+	}
+}
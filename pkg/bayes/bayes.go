@@ -0,0 +1,190 @@
+// Package bayes implements a multi-label Naive Bayes text classifier that
+// is trained incrementally. Each label is an independent binary classifier
+// over the presence of terms in documents, with Laplace smoothing.
+// Predictions only depend on the training counts, so they are
+// deterministic.
+package bayes
+
+import (
+	"math"
+	"sort"
+)
+
+const (
+	// MinExamples is the number of documents needed with and without a
+	// label before it is predicted.
+	MinExamples = 3
+	// MaxVocabulary bounds the number of distinct terms of a model. The
+	// rarest terms are pruned beyond it.
+	MaxVocabulary = 20000
+)
+
+// Label holds the training counts of the documents with a label.
+type Label struct {
+	// Docs is the number of documents with the label.
+	Docs int `json:"docs"`
+	// Terms is the number of documents with the label each term appears in.
+	Terms map[string]int `json:"terms"`
+	// Total is the sum of Terms.
+	Total int `json:"total"`
+}
+
+// Model is a trained classifier. The zero value is an empty model.
+type Model struct {
+	// Docs is the number of training documents.
+	Docs int `json:"docs"`
+	// Terms is the number of documents each term appears in.
+	Terms map[string]int `json:"terms"`
+	// Total is the sum of Terms.
+	Total  int               `json:"total"`
+	Labels map[string]*Label `json:"labels"`
+}
+
+// distinct returns the distinct terms, sorted so that predictions sum
+// floating point numbers in a stable order.
+func distinct(terms []string) []string {
+	seen := make(map[string]bool, len(terms))
+	out := make([]string, 0, len(terms))
+	for _, t := range terms {
+		if !seen[t] {
+			seen[t] = true
+			out = append(out, t)
+		}
+	}
+	sort.Strings(out)
+	return out
+}
+
+// Train adds a document with the given labels. A document without labels
+// is a negative example for every label.
+func (m *Model) Train(terms, labels []string) {
+	m.add(distinct(terms), distinct(labels), 1)
+	if len(m.Terms) > MaxVocabulary {
+		m.prune()
+	}
+}
+
+// Untrain removes a document previously added with Train, so that a
+// document's labels can be changed.
+func (m *Model) Untrain(terms, labels []string) {
+	m.add(distinct(terms), distinct(labels), -1)
+}
+
+func (m *Model) add(terms, labels []string, delta int) {
+	if m.Terms == nil {
+		m.Terms = map[string]int{}
+	}
+	if m.Labels == nil {
+		m.Labels = map[string]*Label{}
+	}
+	m.Docs = max(m.Docs+delta, 0)
+	m.Total = addTerms(m.Terms, m.Total, terms, delta)
+	for _, name := range labels {
+		l := m.Labels[name]
+		if l == nil {
+			if delta < 0 {
+				continue
+			}
+			l = &Label{Terms: map[string]int{}}
+			m.Labels[name] = l
+		}
+		l.Docs = max(l.Docs+delta, 0)
+		l.Total = addTerms(l.Terms, l.Total, terms, delta)
+		if l.Docs == 0 {
+			delete(m.Labels, name)
+		}
+	}
+}
+
+// addTerms adds delta to the counts of the terms, dropping counts that
+// reach zero, and returns the updated total.
+func addTerms(counts map[string]int, total int, terms []string, delta int) int {
+	for _, t := range terms {
+		n, ok := counts[t]
+		if !ok && delta < 0 {
+			continue
+		}
+		n = max(n+delta, 0)
+		total += n - counts[t]
+		if n == 0 {
+			delete(counts, t)
+		} else {
+			counts[t] = n
+		}
+	}
+	return total
+}
+
+// prune drops the rarest terms until the vocabulary fits MaxVocabulary.
+func (m *Model) prune() {
+	terms := make([]string, 0, len(m.Terms))
+	for t := range m.Terms {
+		terms = append(terms, t)
+	}
+	sort.Slice(terms, func(i, j int) bool {
+		if m.Terms[terms[i]] != m.Terms[terms[j]] {
+			return m.Terms[terms[i]] < m.Terms[terms[j]]
+		}
+		return terms[i] < terms[j]
+	})
+	for _, t := range terms[:len(terms)-MaxVocabulary] {
+		m.Total -= m.Terms[t]
+		delete(m.Terms, t)
+		for _, l := range m.Labels {
+			l.Total -= l.Terms[t]
+			delete(l.Terms, t)
+		}
+	}
+}
+
+// Probability returns the probability that a document with the terms has
+// the label, and false when the label has too few examples with or without
+// it to be predicted.
+func (m *Model) Probability(terms []string, label string) (float64, bool) {
+	return m.probability(distinct(terms), label)
+}
+
+func (m *Model) probability(terms []string, label string) (float64, bool) {
+	l := m.Labels[label]
+	if l == nil || l.Docs < MinExamples || m.Docs-l.Docs < MinExamples {
+		return 0, false
+	}
+	vocabulary := float64(len(m.Terms))
+	logit := math.Log(float64(l.Docs+1) / float64(m.Docs-l.Docs+1))
+	for _, t := range terms {
+		n, ok := m.Terms[t]
+		if !ok {
+			continue
+		}
+		in := l.Terms[t]
+		out := n - in
+		logit += math.Log(float64(in+1)/(float64(l.Total)+vocabulary)) -
+			math.Log(float64(out+1)/(float64(m.Total-l.Total)+vocabulary))
+	}
+	return 1 / (1 + math.Exp(-logit)), true
+}
+
+// Prediction is a label with the probability of a document having it.
+type Prediction struct {
+	Label       string
+	Probability float64
+}
+
+// Predict returns the labels a document with the terms has with at least
+// the given probability, most probable first.
+func (m *Model) Predict(terms []string, threshold float64) []Prediction {
+	terms = distinct(terms)
+	var predictions []Prediction
+	for name := range m.Labels {
+		if p, ok := m.probability(terms, name); ok && p >= threshold {
+			predictions = append(predictions, Prediction{name, p})
+		}
+	}
+	sort.Slice(predictions, func(i, j int) bool {
+		if predictions[i].Probability != predictions[j].Probability {
+			return predictions[i].Probability > predictions[j].Probability
+		}
+		return predictions[i].Label < predictions[j].Label
+	})
+	return predictions
+}
@@ -0,0 +1,92 @@
+package bayes
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+var training = []struct {
+	text   string
+	labels []string
+}{
+	{"kubernetes cluster upgrade operator", []string{"devops"}},
+	{"kubernetes helm chart deployment", []string{"devops"}},
+	{"terraform cluster deployment pipeline", []string{"devops"}},
+	{"sourdough bread recipe flour", []string{"cooking"}},
+	{"pasta recipe tomato basil", []string{"cooking"}},
+	{"bread flour hydration recipe", []string{"cooking"}},
+	{"election results parliament vote", nil},
+	{"football match results league", nil},
+}
+
+func train() *Model {
+	m := &Model{}
+	for _, ex := range training {
+		m.Train(strings.Fields(ex.text), ex.labels)
+	}
+	return m
+}
+
+func TestPredict(t *testing.T) {
+	m := train()
+	for _, tt := range []struct {
+		text string
+		want string
+	}{
+		{"kubernetes operator deployment", "devops"},
+		{"bread recipe", "cooking"},
+		{"parliament vote", ""},
+	} {
+		got := m.Predict(strings.Fields(tt.text), 0.8)
+		switch {
+		case tt.want == "" && len(got) > 0:
+			t.Errorf("Predict(%q) = %v, want nothing", tt.text, got)
+		case tt.want != "" && (len(got) != 1 || got[0].Label != tt.want):
+			t.Errorf("Predict(%q) = %v, want %s", tt.text, got, tt.want)
+		}
+	}
+}
+
+func TestMinExamples(t *testing.T) {
+	m := train()
+	m.Train([]string{"chess", "opening"}, []string{"chess"})
+	if _, ok := m.Probability([]string{"chess"}, "chess"); ok {
+		t.Error("label with a single example is predicted")
+	}
+}
+
+func TestUntrain(t *testing.T) {
+	m := train()
+	m.Train(strings.Fields("kubernetes pasta"), []string{"devops", "cooking"})
+	m.Untrain(strings.Fields("kubernetes pasta"), []string{"devops", "cooking"})
+	if want := train(); !reflect.DeepEqual(m, want) {
+		t.Errorf("model after Untrain = %+v, want %+v", m, want)
+	}
+
+	m.Untrain(strings.Fields("bread flour hydration recipe"), []string{"cooking"})
+	if m.Labels["cooking"].Docs != 2 || m.Terms["hydration"] != 0 {
+		t.Errorf("model after Untrain = %+v", m)
+	}
+}
+
+func TestDeterministic(t *testing.T) {
+	doc := strings.Fields("kubernetes bread recipe cluster flour deployment")
+	a, _ := train().Probability(doc, "cooking")
+
+	// A model restored from its serialization predicts the same.
+	data, err := json.Marshal(train())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var m Model
+	if err := json.Unmarshal(data, &m); err != nil {
+		t.Fatal(err)
+	}
+	for range 10 {
+		if b, _ := m.Probability(doc, "cooking"); b != a {
+			t.Fatalf("Probability = %v, then %v", a, b)
+		}
+	}
+}
@@ -2,7 +2,9 @@ package config
 
 import (
 	"context"
+	"encoding/json"
 	"os"
+	"time"
 
 	"log/slog"
 
@@ -15,7 +17,8 @@ var (
 
 type SessionConfig struct {
 	// SessionKey is the key used to sign the session cookie
-	SessionCookieName   string `env:"SESSION_COOKIE_NAME"`
+	SessionKey          string `env:"SESSION_KEY"`
+	SessionCookieName   string `env:"SESSION_COOKIE_NAME,default=feedr_session"`
 	SessionCookieDomain string `env:"SESSION_COOKIE_DOMAIN,required"`
 }
 
@@ -53,16 +56,107 @@ type EmailConfig struct {
 	FromName    string `env:"FROM_NAME"`
 }
 
+// OpenAIConfig contains the configuration for the AI features, which work
+// with any OpenAI-compatible API. They are enabled when an API key or a base
+// URL is set.
 type OpenAIConfig struct {
 	// APIKey is the API key for the OpenAI API
 	APIKey string `env:"OPENAI_API_KEY"`
+	// BaseURL is the URL of an OpenAI-compatible API, such as a local llama
+	// server, empty for OpenAI
+	BaseURL string `env:"OPENAI_BASE_URL"`
+	// Model is the chat model
+	Model string `env:"OPENAI_MODEL,default=gpt-4o-mini"`
+	// EmbeddingModel is the model embedding entries for questions
+	EmbeddingModel string `env:"OPENAI_EMBEDDING_MODEL,default=text-embedding-3-small"`
+	// Timeout bounds each API call
+	Timeout time.Duration `env:"OPENAI_TIMEOUT,default=60s"`
+	// SummaryQuota is the number of summaries a user can generate per day,
+	// 0 for no limit
+	SummaryQuota int `env:"OPENAI_SUMMARY_QUOTA,default=50"`
+	// Sentiment rates the tone of entries with the chat model instead of
+	// the built-in lexicon
+	Sentiment bool `env:"OPENAI_SENTIMENT,default=false"`
+}
+
+// OIDCProvider configures an OpenID Connect identity provider.
+type OIDCProvider struct {
+	// Name identifies the provider in login URLs, e.g. "google"
+	Name string `json:"name"`
+	// DisplayName is shown on the login button
+	DisplayName string `json:"display_name"`
+	// Issuer is the issuer URL used for discovery
+	Issuer       string `json:"issuer"`
+	ClientID     string `json:"client_id"`
+	ClientSecret string `json:"client_secret"`
+	// Scopes requested in addition to "openid"
+	Scopes []string `json:"scopes"`
+	// AllowSignup creates a user on first login when no account matches
+	AllowSignup bool `json:"allow_signup"`
+}
+
+// OIDCProviders decodes a JSON list of providers from the environment.
+type OIDCProviders []OIDCProvider
+
+func (p *OIDCProviders) EnvDecode(val string) error {
+	if val == "" {
+		return nil
+	}
+	return json.Unmarshal([]byte(val), p)
+}
+
+// OIDCConfig contains the configuration for single sign-on.
+type OIDCConfig struct {
+	// Providers is a JSON list of identity providers
+	Providers OIDCProviders `env:"OIDC_PROVIDERS"`
+}
+
+// ProxyConfig contains the configuration for the image proxy.
+type ProxyConfig struct {
+	// Enabled rewrites entry images to go through the proxy
+	Enabled bool `env:"PROXY_IMAGES,default=true"`
+	// Key is the key used to sign proxied URLs
+	Key string `env:"PROXY_KEY"`
+	// MaxSize is the maximum size in bytes of a proxied file
+	MaxSize int64 `env:"PROXY_MAX_SIZE,default=10485760"`
+	// CacheDir is the directory proxied files are cached in, empty disables the cache
+	CacheDir string `env:"PROXY_CACHE_DIR"`
+	// CacheSize is the maximum size in bytes of the cache
+	CacheSize int64 `env:"PROXY_CACHE_SIZE,default=536870912"`
+}
+
+// InboundConfig contains the configuration for newsletter ingestion.
+type InboundConfig struct {
+	// ListenAddr is the address of the SMTP listener, empty disables it
+	ListenAddr string `env:"INBOUND_SMTP_ADDR"`
+	// Domain is the domain of inbound addresses, e.g. "in.example.com"
+	Domain string `env:"INBOUND_DOMAIN"`
+	// MaxSize is the maximum size in bytes of a received message
+	MaxSize int64 `env:"INBOUND_MAX_SIZE,default=10485760"`
+}
+
+// WebSubConfig contains the configuration for push updates from WebSub
+// hubs, which requires BASE_URL to be reachable from the internet.
+type WebSubConfig struct {
+	// Enabled subscribes feeds advertising a hub to it
+	Enabled bool `env:"WEBSUB_ENABLED,default=false"`
+	// LeaseSeconds is the subscription lease requested from hubs
+	LeaseSeconds int `env:"WEBSUB_LEASE_SECONDS,default=864000"`
 }
 
 type config struct {
 	DEBUG           bool     `env:"DEBUG,default=false"`
 	PORT            string   `env:"PORT,default=8000"`
 	ALLOWED_ORIGINS []string `env:"ALLOWED_ORIGINS,default=*"`
-	Session         SessionConfig
+	// BASE_URL is the public URL feedr is reachable at
+	BASE_URL string `env:"BASE_URL,default=http://localhost:8000"`
+	// ENCRYPTION_KEY encrypts credentials stored in the database
+	ENCRYPTION_KEY string `env:"ENCRYPTION_KEY"`
+	Session        SessionConfig
+	OIDC           OIDCConfig
+	Proxy          ProxyConfig
+	Inbound        InboundConfig
+	WebSub         WebSubConfig
 
 	Email  EmailConfig
 	OpenAI OpenAIConfig
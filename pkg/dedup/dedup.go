@@ -0,0 +1,156 @@
+// Package dedup recognizes the same story published under different URLs,
+// GUIDs or feeds, by canonicalizing links and fingerprinting text.
+package dedup
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"net/url"
+	"strings"
+	"unicode"
+)
+
+// MaxDistance is the largest number of differing fingerprint bits between
+// two texts considered near duplicates.
+const MaxDistance = 3
+
+// minTokens is the number of words below which a text is too short to be
+// fingerprinted reliably.
+const minTokens = 20
+
+// shingleSize is the number of consecutive words hashed together.
+const shingleSize = 2
+
+// trackingParams are query parameters that identify the campaign or the
+// visitor rather than the resource.
+var trackingParams = map[string]bool{
+	"fbclid":  true,
+	"gclid":   true,
+	"dclid":   true,
+	"msclkid": true,
+	"yclid":   true,
+	"igshid":  true,
+	"mc_cid":  true,
+	"mc_eid":  true,
+	"_hsenc":  true,
+	"_hsmi":   true,
+	"mkt_tok": true,
+	"ref":     true,
+	"ref_src": true,
+	"ncid":    true,
+	"cmpid":   true,
+	"spm":     true,
+}
+
+// CanonicalURL normalizes rawURL so that links to the same resource compare
+// equal: the scheme is reduced to https, the host is lowercased without
+// "www." or a default port, tracking parameters and the fragment are
+// removed, the remaining parameters are sorted and trailing slashes are
+// trimmed. The result identifies the resource and is not meant to be
+// fetched. Invalid and relative URLs return "".
+func CanonicalURL(rawURL string) string {
+	u, err := url.Parse(strings.TrimSpace(rawURL))
+	if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	host := strings.ToLower(u.Hostname())
+	host = strings.TrimPrefix(host, "www.")
+	if port := u.Port(); port != "" && port != "80" && port != "443" {
+		host += ":" + port
+	}
+
+	q := u.Query()
+	for k := range q {
+		lk := strings.ToLower(k)
+		if strings.HasPrefix(lk, "utm_") || trackingParams[lk] {
+			q.Del(k)
+		}
+	}
+	path := strings.TrimRight(u.EscapedPath(), "/")
+	if strings.HasSuffix(path, "/index.html") {
+		path = strings.TrimSuffix(path, "/index.html")
+	}
+
+	out := "https://" + host + path
+	if len(q) > 0 {
+		// Encode sorts by key.
+		out += "?" + q.Encode()
+	}
+	return out
+}
+
+// IsRoot reports whether the canonical URL points to the root of a site,
+// which feeds link to when their items have no page of their own.
+func IsRoot(canonical string) bool {
+	rest := strings.TrimPrefix(canonical, "https://")
+	return !strings.ContainsAny(rest, "/?")
+}
+
+// SimHash returns the 64 bit SimHash fingerprint of text, computed over
+// shingles of lowercased words. Texts with few differing words have
+// fingerprints with few differing bits. Texts too short to be compared
+// return 0.
+func SimHash(text string) uint64 {
+	tokens := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	if len(tokens) < minTokens {
+		return 0
+	}
+
+	var weights [64]int
+	h := fnv.New64a()
+	for i := 0; i+shingleSize <= len(tokens); i++ {
+		h.Reset()
+		h.Write([]byte(strings.Join(tokens[i:i+shingleSize], " ")))
+		sum := h.Sum64()
+		for b := range weights {
+			if sum&(1<<b) != 0 {
+				weights[b]++
+			} else {
+				weights[b]--
+			}
+		}
+	}
+	var fp uint64
+	for b, w := range weights {
+		if w > 0 {
+			fp |= 1 << b
+		}
+	}
+	// 0 means "no fingerprint"; an actual zero is vanishingly rare.
+	return max(fp, 1)
+}
+
+// Distance returns the number of bits that differ between two
+// fingerprints.
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+// Bands is the number of bands a fingerprint is split into. Near duplicates
+// differ in at most MaxDistance bits, so they have at least one equal band.
+const Bands = MaxDistance + 1
+
+// bandBits is the width of a band.
+const bandBits = 64 / Bands
+
+// SplitBands returns the bands of fingerprint h, which index fingerprints
+// to look up their near duplicates without comparing with every one. Bands
+// are numbered from 1 so that missing fingerprints have none.
+func SplitBands(h uint64) [Bands]int32 {
+	var bands [Bands]int32
+	if h == 0 {
+		return bands
+	}
+	for i := range bands {
+		bands[i] = int32(h>>(i*bandBits)&(1<<bandBits-1)) + 1
+	}
+	return bands
+}
+
+// Similar reports whether two fingerprints are near duplicates. Missing
+// fingerprints are never similar.
+func Similar(a, b uint64) bool {
+	return a != 0 && b != 0 && Distance(a, b) <= MaxDistance
+}
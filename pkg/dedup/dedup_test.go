@@ -0,0 +1,86 @@
+package dedup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCanonicalURL(t *testing.T) {
+	var tests = []struct {
+		in, want string
+	}{
+		{"https://example.com/post", "https://example.com/post"},
+		{"http://WWW.Example.com:80/post/", "https://example.com/post"},
+		{"https://example.com:8443/post", "https://example.com:8443/post"},
+		{"https://example.com/post?utm_source=rss&utm_medium=feed", "https://example.com/post"},
+		{"https://example.com/post?id=2&fbclid=abc&a=1#comments", "https://example.com/post?a=1&id=2"},
+		{"https://example.com/blog/index.html", "https://example.com/blog"},
+		{"https://example.com/", "https://example.com"},
+		{"/relative/post", ""},
+		{"mailto:someone@example.com", ""},
+		{"", ""},
+	}
+	for _, tt := range tests {
+		if got := CanonicalURL(tt.in); got != tt.want {
+			t.Errorf("CanonicalURL(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestIsRoot(t *testing.T) {
+	if !IsRoot(CanonicalURL("https://www.example.com/")) {
+		t.Errorf("expected the home page to be a root")
+	}
+	if IsRoot(CanonicalURL("https://example.com/post")) || IsRoot(CanonicalURL("https://example.com/?p=1")) {
+		t.Errorf("expected pages not to be roots")
+	}
+}
+
+const story = `The city council approved the new transit plan on Tuesday evening after
+a long debate, adding three bus lines and extending the light rail to the airport by
+the end of next year, according to officials who spoke at the meeting downtown.`
+
+func TestSimHash(t *testing.T) {
+	a := SimHash(story)
+	if a == 0 {
+		t.Fatalf("expected a fingerprint")
+	}
+	if b := SimHash(strings.ToUpper(story) + " Read more."); !Similar(a, b) {
+		t.Errorf("expected near duplicates, distance %d", Distance(a, b))
+	}
+	other := SimHash(`A new species of frog was discovered in the rainforest by a team of
+biologists who spent six months cataloguing the wildlife of the remote valley, the
+university announced in a statement published on its website this morning.`)
+	if Similar(a, other) {
+		t.Errorf("expected different stories, distance %d", Distance(a, other))
+	}
+	if fp := SimHash("Too short to compare"); fp != 0 || Similar(fp, fp) {
+		t.Errorf("expected no fingerprint for a short text, got %x", fp)
+	}
+}
+
+func TestSplitBands(t *testing.T) {
+	if b := SplitBands(0); b != [Bands]int32{} {
+		t.Errorf("expected no bands for a missing fingerprint, got %v", b)
+	}
+	h := uint64(0x0123_4567_89ab_cdef)
+	if b := SplitBands(h); b != [Bands]int32{0xcdef + 1, 0x89ab + 1, 0x4567 + 1, 0x0123 + 1} {
+		t.Errorf("unexpected bands %x", b)
+	}
+
+	// Near duplicates share a band wherever their bits differ.
+	for _, flips := range [][]int{{0, 1, 2}, {5, 21, 37}, {63, 47, 31}, {15, 16, 48}} {
+		other := h
+		for _, bit := range flips {
+			other ^= 1 << bit
+		}
+		a, b := SplitBands(h), SplitBands(other)
+		shared := false
+		for i := range a {
+			shared = shared || a[i] == b[i]
+		}
+		if !Similar(h, other) || !shared {
+			t.Errorf("bits %v: expected a shared band, got %v and %v", flips, a, b)
+		}
+	}
+}
@@ -0,0 +1,219 @@
+// Package digest emails users a daily digest of their best unread entries,
+// at the local time they choose. Entries are ranked by the interest the
+// user's classifier predicts and by how many feeds cover the story, grouped
+// by folder and summarized by the configured model, or by extracting their
+// key sentences when none is configured.
+package digest
+
+import (
+	"bytes"
+	"context"
+	"embed"
+	htmltemplate "html/template"
+	"log/slog"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+	"github.com/swartzfoundation/feedr/pkg/summary"
+)
+
+const (
+	// maxCandidates bounds the unread entries ranked for a digest.
+	maxCandidates = 500
+	// extractSentences is the length of extractive summaries.
+	extractSentences = 2
+	// window is the period covered by a digest at most.
+	window = 24 * time.Hour
+)
+
+//go:embed templates
+var templates embed.FS
+
+var (
+	htmlTemplate = htmltemplate.Must(htmltemplate.ParseFS(templates, "templates/digest.html.tmpl"))
+	textTemplate = texttemplate.Must(texttemplate.ParseFS(templates, "templates/digest.txt.tmpl"))
+)
+
+// Item is an entry of a digest.
+type Item struct {
+	Title   string
+	URL     string
+	Feed    string
+	Summary string
+	// AlsoIn is the number of other feeds telling the same story.
+	AlsoIn int
+}
+
+// Group lists the items of a folder.
+type Group struct {
+	Name  string
+	Items []Item
+}
+
+// Digest is the content of a digest email.
+type Digest struct {
+	Lang   string
+	Date   time.Time
+	AppURL string
+	Groups []Group
+}
+
+// Count returns the number of items of the digest.
+func (d *Digest) Count() int {
+	n := 0
+	for _, g := range d.Groups {
+		n += len(g.Items)
+	}
+	return n
+}
+
+// T returns the text of key in the language of the digest.
+func (d *Digest) T(key string, args ...any) string {
+	return translate(d.Lang, key, args...)
+}
+
+// DateText returns the date of the digest formatted for its language.
+func (d *Digest) DateText() string {
+	return d.Date.Format(translate(d.Lang, "date"))
+}
+
+// Render returns the subject and the text and HTML bodies of the digest.
+func (d *Digest) Render() (subject, text, html string, err error) {
+	var tb, hb bytes.Buffer
+	if err := textTemplate.Execute(&tb, d); err != nil {
+		return "", "", "", err
+	}
+	if err := htmlTemplate.Execute(&hb, d); err != nil {
+		return "", "", "", err
+	}
+	return d.T("subject", d.Count()), tb.String(), hb.String(), nil
+}
+
+// NextSend returns the first time after after that is hour:minute in loc.
+func NextSend(after time.Time, hour, minute int, loc *time.Location) time.Time {
+	local := after.In(loc)
+	t := time.Date(local.Year(), local.Month(), local.Day(), hour, minute, 0, 0, loc)
+	if !t.After(after) {
+		t = time.Date(local.Year(), local.Month(), local.Day()+1, hour, minute, 0, 0, loc)
+	}
+	return t
+}
+
+// score ranks an entry: the predicted probability that the user reads it,
+// 0.5 when unknown, with a bonus for stories covered by several feeds.
+func score(e *model.UserEntry) float64 {
+	s := 0.5
+	if e.PredictedInterest != nil {
+		s = *e.PredictedInterest
+	}
+	return s + 0.1*float64(min(len(e.AlsoIn), 3))
+}
+
+// rank sorts the entries best first, newest first among equals.
+func rank(entries []model.UserEntry) {
+	sort.SliceStable(entries, func(i, j int) bool {
+		si, sj := score(&entries[i]), score(&entries[j])
+		if si != sj {
+			return si > sj
+		}
+		return entries[i].PublishedAt > entries[j].PublishedAt
+	})
+}
+
+// group groups the ranked entries by the folder of their subscription,
+// ordering groups by their best entry.
+func group(entries []model.UserEntry, subs map[int64]*model.Subscription, unfiled string, summarize func(*model.UserEntry) string) []Group {
+	var groups []Group
+	index := map[string]int{}
+	for i := range entries {
+		e := &entries[i]
+		name, feed := unfiled, ""
+		if s := subs[e.FeedID]; s != nil {
+			feed = s.DisplayTitle()
+			if s.Folder != nil {
+				name = s.Folder.Name
+			}
+		}
+		g, ok := index[name]
+		if !ok {
+			g = len(groups)
+			index[name] = g
+			groups = append(groups, Group{Name: name})
+		}
+		groups[g].Items = append(groups[g].Items, Item{
+			Title:   sanitize.Text(e.Title),
+			URL:     e.URL,
+			Feed:    feed,
+			Summary: summarize(e),
+			AlsoIn:  len(e.AlsoIn),
+		})
+	}
+	return groups
+}
+
+// Build returns the digest of the user's best unread entries published
+// since the last digest, or nil when there are none.
+func Build(ctx context.Context, s *model.DigestSettings, u *model.User, now time.Time, appURL string) (*Digest, error) {
+	loc, err := time.LoadLocation(s.TimeZone)
+	if err != nil {
+		loc = time.UTC
+	}
+	since := now.Add(-window).Unix()
+	if s.LastSentAt > since {
+		since = s.LastSentAt
+	}
+	unread := false
+	entries, err := model.ListEntries(ctx, model.EntryQuery{
+		UserID:         u.ID,
+		Read:           &unread,
+		PublishedAfter: since,
+		Collapse:       true,
+		Limit:          maxCandidates,
+	})
+	if err != nil || len(entries) == 0 {
+		return nil, err
+	}
+	if err := model.AddAlsoIn(ctx, u.ID, entries); err != nil {
+		return nil, err
+	}
+	if err := model.AddTags(ctx, u.ID, entries); err != nil {
+		return nil, err
+	}
+	rank(entries)
+	if n := s.MaxEntries; n > 0 && len(entries) > n {
+		entries = entries[:n]
+	}
+
+	list, err := model.ListSubscriptions(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	subs := make(map[int64]*model.Subscription, len(list))
+	for i := range list {
+		subs[list[i].FeedID] = &list[i]
+	}
+
+	d := &Digest{Lang: language(u.Locale), Date: now.In(loc), AppURL: appURL}
+	d.Groups = group(entries, subs, d.T("unfiled"), func(e *model.UserEntry) string {
+		return summarize(ctx, e)
+	})
+	return d, nil
+}
+
+// summarize returns the summary of the entry written by the configured
+// model, or its key sentences.
+func summarize(ctx context.Context, e *model.UserEntry) string {
+	if summary.Enabled() {
+		// Digests do not count towards the quota of the user.
+		s, _, err := summary.Summarize(ctx, "", &e.Entry)
+		if err == nil {
+			return s.Summary
+		}
+		slog.Warn("digest: summarizing entry", "entry", e.ID, "error", err)
+	}
+	return strings.TrimSpace(summary.Extract(sanitize.Text(e.Body()), extractSentences))
+}
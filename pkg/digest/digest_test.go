@@ -0,0 +1,97 @@
+package digest
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+)
+
+func TestNextSend(t *testing.T) {
+	paris, err := time.LoadLocation("Europe/Paris")
+	if err != nil {
+		t.Skip(err)
+	}
+	for _, tt := range []struct {
+		after string
+		want  string
+	}{
+		{"2026-03-10T05:00:00Z", "2026-03-10T07:30:00+01:00"},
+		{"2026-03-10T06:30:00Z", "2026-03-11T07:30:00+01:00"},
+		// The clocks go forward on the night of March 29.
+		{"2026-03-28T07:00:00Z", "2026-03-29T07:30:00+02:00"},
+	} {
+		after, _ := time.Parse(time.RFC3339, tt.after)
+		if got := NextSend(after, 7, 30, paris).Format(time.RFC3339); got != tt.want {
+			t.Errorf("NextSend(%s) = %s, want %s", tt.after, got, tt.want)
+		}
+	}
+}
+
+func TestLanguage(t *testing.T) {
+	for locale, want := range map[string]string{"fr": "fr", "fr-CA": "fr", "de_AT": "de", "ja": "en", "": "en"} {
+		if got := language(locale); got != want {
+			t.Errorf("language(%q) = %q, want %q", locale, got, want)
+		}
+	}
+}
+
+func TestRankAndGroup(t *testing.T) {
+	interest := func(p float64) *float64 { return &p }
+	entries := []model.UserEntry{
+		{Entry: model.Entry{ID: 1, FeedID: 1, Title: "Low", PublishedAt: 3}, PredictedInterest: interest(0.1)},
+		{Entry: model.Entry{ID: 2, FeedID: 2, Title: "Covered", PublishedAt: 1}, AlsoIn: make([]model.ClusterMember, 2)},
+		{Entry: model.Entry{ID: 3, FeedID: 1, Title: "High", PublishedAt: 2}, PredictedInterest: interest(0.9)},
+	}
+	rank(entries)
+	var order []int64
+	for _, e := range entries {
+		order = append(order, e.ID)
+	}
+	if want := []int64{3, 2, 1}; !slices.Equal(order, want) {
+		t.Errorf("rank order = %v, want %v", order, want)
+	}
+
+	subs := map[int64]*model.Subscription{
+		1: {Title: "Tech Blog", Folder: &model.Folder{Name: "Tech"}},
+		2: {Title: "News"},
+	}
+	groups := group(entries, subs, "Feeds", func(*model.UserEntry) string { return "summary" })
+	if len(groups) != 2 || groups[0].Name != "Tech" || len(groups[0].Items) != 2 || groups[1].Name != "Feeds" {
+		t.Fatalf("groups = %+v", groups)
+	}
+	if it := groups[1].Items[0]; it.Feed != "News" || it.AlsoIn != 2 {
+		t.Errorf("item = %+v", it)
+	}
+}
+
+func TestRender(t *testing.T) {
+	d := &Digest{
+		Lang:   "fr",
+		Date:   time.Date(2026, 3, 10, 7, 30, 0, 0, time.UTC),
+		AppURL: "https://feedr.example.com",
+		Groups: []Group{{Name: "Tech", Items: []Item{
+			{Title: "Go <1.25> released", URL: "https://go.dev/blog", Feed: "Go Blog", Summary: "A summary.", AlsoIn: 2},
+			{Title: "Bad link", URL: "javascript:alert(1)", Feed: "Evil"},
+		}}},
+	}
+	subject, text, html, err := d.Render()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject != "Votre résumé du jour : 2 articles non lus à la une" {
+		t.Errorf("subject = %q", subject)
+	}
+	for _, want := range []string{"10/03/2026", "== Tech ==", "* Go <1.25> released (Go Blog)", "  A summary.", "Aussi dans 2 autres flux", "https://go.dev/blog"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("text does not contain %q:\n%s", want, text)
+		}
+	}
+	for _, want := range []string{`lang="fr"`, "Go &lt;1.25&gt; released", `href="https://go.dev/blog"`, "Lire la suite", `href="#ZgotmplZ"`} {
+		if !strings.Contains(html, want) {
+			t.Errorf("html does not contain %q", want)
+		}
+	}
+}
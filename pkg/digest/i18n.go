@@ -0,0 +1,77 @@
+package digest
+
+import (
+	"fmt"
+	"strings"
+)
+
+// messages are the texts of the digest by language. English is the
+// fallback of missing languages and texts.
+var messages = map[string]map[string]string{
+	"en": {
+		"subject":   "Your daily digest: %d unread highlights",
+		"heading":   "Your daily digest",
+		"intro":     "The %d best unread entries since your last digest.",
+		"read_more": "Read more",
+		"also_in":   "Also in %d other feeds",
+		"unfiled":   "Feeds",
+		"open":      "Open feedr",
+		"footer":    "You receive this email because you enabled the daily digest in your feedr settings.",
+		"date":      "2006-01-02",
+	},
+	"fr": {
+		"subject":   "Votre résumé du jour : %d articles non lus à la une",
+		"heading":   "Votre résumé du jour",
+		"intro":     "Les %d meilleurs articles non lus depuis votre dernier résumé.",
+		"read_more": "Lire la suite",
+		"also_in":   "Aussi dans %d autres flux",
+		"unfiled":   "Flux",
+		"open":      "Ouvrir feedr",
+		"footer":    "Vous recevez cet email car vous avez activé le résumé quotidien dans vos réglages feedr.",
+		"date":      "02/01/2006",
+	},
+	"de": {
+		"subject":   "Ihre Tageszusammenfassung: %d ungelesene Highlights",
+		"heading":   "Ihre Tageszusammenfassung",
+		"intro":     "Die %d besten ungelesenen Einträge seit Ihrer letzten Zusammenfassung.",
+		"read_more": "Weiterlesen",
+		"also_in":   "Auch in %d weiteren Feeds",
+		"unfiled":   "Feeds",
+		"open":      "feedr öffnen",
+		"footer":    "Sie erhalten diese E-Mail, weil Sie die tägliche Zusammenfassung in Ihren feedr-Einstellungen aktiviert haben.",
+		"date":      "02.01.2006",
+	},
+	"es": {
+		"subject":   "Tu resumen diario: %d destacados sin leer",
+		"heading":   "Tu resumen diario",
+		"intro":     "Las %d mejores entradas sin leer desde tu último resumen.",
+		"read_more": "Leer más",
+		"also_in":   "También en %d fuentes más",
+		"unfiled":   "Fuentes",
+		"open":      "Abrir feedr",
+		"footer":    "Recibes este correo porque activaste el resumen diario en tus ajustes de feedr.",
+		"date":      "02/01/2006",
+	},
+}
+
+// language returns the supported language of a locale such as "fr-CA".
+func language(locale string) string {
+	lang, _, _ := strings.Cut(strings.ToLower(locale), "-")
+	lang, _, _ = strings.Cut(lang, "_")
+	if _, ok := messages[lang]; ok {
+		return lang
+	}
+	return "en"
+}
+
+// translate returns the text of key in lang, formatted with args.
+func translate(lang, key string, args ...any) string {
+	msg, ok := messages[lang][key]
+	if !ok {
+		msg = messages["en"][key]
+	}
+	if len(args) > 0 {
+		return fmt.Sprintf(msg, args...)
+	}
+	return msg
+}
@@ -0,0 +1,97 @@
+package digest
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/mailer"
+)
+
+// retryDelay is the delay before sending a digest again after a failure.
+const retryDelay = 15 * time.Minute
+
+// Sender sends the digests when they are due.
+type Sender struct {
+	Mailer   *mailer.Mailer
+	AppURL   string
+	Interval time.Duration
+}
+
+// New returns a sender checking for due digests every minute.
+func New(m *mailer.Mailer, appURL string) *Sender {
+	return &Sender{Mailer: m, AppURL: appURL, Interval: time.Minute}
+}
+
+// Run sends the due digests until ctx is cancelled.
+func (s *Sender) Run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		s.sendDue(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sender) sendDue(ctx context.Context) {
+	now := time.Now()
+	due, err := model.ListDueDigests(ctx, now.Unix(), 100)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			slog.Error("digest: listing due digests", "error", err)
+		}
+		return
+	}
+	for i := range due {
+		if ctx.Err() != nil {
+			return
+		}
+		d := &due[i]
+		loc, err := time.LoadLocation(d.TimeZone)
+		if err != nil {
+			loc = time.UTC
+		}
+		sent, err := s.send(ctx, d, now)
+		switch {
+		case err == nil:
+			if sent {
+				d.LastSentAt = now.Unix()
+			}
+			d.NextSendAt = NextSend(now, d.Hour, d.Minute, loc).Unix()
+		case errors.Is(err, mailer.ErrInvalidAddress):
+			slog.Warn("digest: invalid address", "user", d.UserID, "error", err)
+			d.NextSendAt = NextSend(now, d.Hour, d.Minute, loc).Unix()
+		default:
+			slog.Error("digest: sending digest", "user", d.UserID, "error", err)
+			d.NextSendAt = now.Add(retryDelay).Unix()
+		}
+		if err := model.UpdateDigestSchedule(ctx, d); err != nil {
+			slog.Error("digest: scheduling digest", "user", d.UserID, "error", err)
+		}
+	}
+}
+
+// send emails the digest of the user, and reports whether there was
+// anything to send.
+func (s *Sender) send(ctx context.Context, d *model.DigestSettings, now time.Time) (bool, error) {
+	u, err := model.GetUserByID(ctx, d.UserID)
+	if err != nil {
+		return false, err
+	}
+	digest, err := Build(ctx, d, u, now, s.AppURL)
+	if err != nil || digest == nil {
+		return false, err
+	}
+	subject, text, html, err := digest.Render()
+	if err != nil {
+		return false, err
+	}
+	err = s.Mailer.Send(&mailer.Message{To: u.Email, Subject: subject, Text: text, HTML: html})
+	return err == nil, err
+}
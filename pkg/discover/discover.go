@@ -0,0 +1,197 @@
+// Package discover finds the feeds offered by a website, so users can
+// subscribe by pasting any page URL rather than the feed URL itself.
+package discover
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/swartzfoundation/feedr/pkg/feed"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var ErrInvalidURL = errors.New("discover: invalid URL")
+
+// client fetches the pages users paste, so they cannot reach internal
+// services.
+var client = fetch.PublicClient
+
+// Candidate is a feed found for a page.
+type Candidate struct {
+	URL   string `json:"url"`
+	Title string `json:"title"`
+}
+
+// commonPaths are probed when a page does not advertise its feeds.
+var commonPaths = []string{
+	"/feed", "/rss", "/feed.xml", "/rss.xml", "/atom.xml", "/index.xml", "/feed.json",
+}
+
+// feedTypes are the link types advertising a feed.
+var feedTypes = map[string]bool{
+	"application/rss+xml":   true,
+	"application/atom+xml":  true,
+	"application/rdf+xml":   true,
+	"application/feed+json": true,
+	"application/json":      true,
+	"text/xml":              true,
+	"application/xml":       true,
+}
+
+// Discover returns the feeds found for rawURL. When rawURL is a feed itself
+// it is the only candidate.
+func Discover(ctx context.Context, rawURL string) ([]Candidate, error) {
+	u, err := normalize(rawURL)
+	if err != nil {
+		return nil, err
+	}
+
+	var candidates []Candidate
+	known := knownFeeds(u)
+	for _, k := range known {
+		if c, err := probe(ctx, k.URL); err == nil && c.Title != "" {
+			k.Title = c.Title
+		}
+		candidates = append(candidates, k)
+	}
+
+	resp, err := fetch.Get(ctx, fetch.Request{URL: u.String(), Client: client})
+	if err != nil {
+		if len(candidates) > 0 {
+			return candidates, nil
+		}
+		return nil, err
+	}
+	if f, err := feed.Parse(resp.Body, resp.URL); err == nil {
+		return []Candidate{{URL: resp.URL, Title: f.Title}}, nil
+	}
+
+	var found []Candidate
+	if base, err := url.Parse(resp.URL); err == nil {
+		found = FindLinks(resp.Body, base)
+	}
+	if len(found) == 0 && len(known) == 0 {
+		found = probeCommonPaths(ctx, u)
+	}
+	return dedupe(append(candidates, found...)), nil
+}
+
+// normalize parses rawURL, defaulting to https when no scheme is given.
+func normalize(rawURL string) (*url.URL, error) {
+	rawURL = strings.TrimSpace(rawURL)
+	if !strings.Contains(rawURL, "://") {
+		rawURL = "https://" + rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, ErrInvalidURL
+	}
+	return u, nil
+}
+
+// FindLinks returns the feeds advertised by <link rel="alternate"> elements
+// of an HTML page.
+func FindLinks(page []byte, base *url.URL) []Candidate {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil
+	}
+	var candidates []Candidate
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Link {
+			var rel, typ, href, title string
+			for _, a := range n.Attr {
+				switch a.Key {
+				case "rel":
+					rel = strings.ToLower(a.Val)
+				case "type":
+					typ = strings.ToLower(strings.TrimSpace(a.Val))
+				case "href":
+					href = strings.TrimSpace(a.Val)
+				case "title":
+					title = strings.TrimSpace(a.Val)
+				}
+			}
+			if href != "" && feedTypes[typ] && hasToken(rel, "alternate") {
+				if ref, err := base.Parse(href); err == nil {
+					candidates = append(candidates, Candidate{URL: ref.String(), Title: title})
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return candidates
+}
+
+func hasToken(list, token string) bool {
+	for _, t := range strings.Fields(list) {
+		if t == token {
+			return true
+		}
+	}
+	return false
+}
+
+// probeCommonPaths tries the usual feed locations of the site concurrently
+// and returns those serving a feed, in the order of commonPaths.
+func probeCommonPaths(ctx context.Context, u *url.URL) []Candidate {
+	results := make([]*Candidate, len(commonPaths))
+	var wg sync.WaitGroup
+	for i, path := range commonPaths {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			feedURL := (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: path}).String()
+			if c, err := probe(ctx, feedURL); err == nil {
+				results[i] = c
+			}
+		}()
+	}
+	wg.Wait()
+
+	var candidates []Candidate
+	for _, c := range results {
+		if c != nil {
+			candidates = append(candidates, *c)
+		}
+	}
+	return candidates
+}
+
+// probe fetches feedURL and returns it as a candidate if it is a feed. The
+// candidate holds the URL redirects led to.
+func probe(ctx context.Context, feedURL string) (*Candidate, error) {
+	resp, err := fetch.Get(ctx, fetch.Request{URL: feedURL, Client: client})
+	if err != nil {
+		return nil, err
+	}
+	f, err := feed.Parse(resp.Body, resp.URL)
+	if err != nil {
+		return nil, err
+	}
+	return &Candidate{URL: resp.URL, Title: f.Title}, nil
+}
+
+// dedupe removes candidates with the same URL, keeping the first.
+func dedupe(candidates []Candidate) []Candidate {
+	seen := map[string]bool{}
+	out := candidates[:0]
+	for _, c := range candidates {
+		if seen[c.URL] {
+			continue
+		}
+		seen[c.URL] = true
+		out = append(out, c)
+	}
+	return out
+}
@@ -0,0 +1,119 @@
+package discover
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+)
+
+const rss = `<?xml version="1.0"?><rss version="2.0"><channel><title>Probed</title><link>https://example.com/</link></channel></rss>`
+
+func TestKnownFeeds(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"https://www.youtube.com/channel/UCsBjURrPoezykLs9EqgamOA", "https://www.youtube.com/feeds/videos.xml?channel_id=UCsBjURrPoezykLs9EqgamOA"},
+		{"https://www.youtube.com/user/google", "https://www.youtube.com/feeds/videos.xml?user=google"},
+		{"https://www.youtube.com/playlist?list=PL123", "https://www.youtube.com/feeds/videos.xml?playlist_id=PL123"},
+		{"https://github.com/golang/go", "https://github.com/golang/go/releases.atom"},
+		{"https://github.com/golang/go/tree/master/src", "https://github.com/golang/go/releases.atom"},
+		{"https://github.com/rsc", "https://github.com/rsc.atom"},
+		{"https://old.reddit.com/r/golang/", "https://www.reddit.com/r/golang/.rss"},
+		{"https://www.reddit.com/u/spez", "https://www.reddit.com/user/spez/.rss"},
+		{"https://mastodon.social/@Gargron", "https://mastodon.social/@Gargron.rss"},
+		{"https://medium.com/@someone", "https://medium.com/feed/@someone"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			u, _ := url.Parse(tt.input)
+			got := knownFeeds(u)
+			if len(got) == 0 || got[0].URL != tt.want {
+				t.Errorf("got %+v expected %q first", got, tt.want)
+			}
+		})
+	}
+
+	for _, input := range []string{"https://github.com/trending", "https://www.youtube.com/@handle", "https://example.com/blog"} {
+		u, _ := url.Parse(input)
+		if got := knownFeeds(u); len(got) != 0 {
+			t.Errorf("knownFeeds(%q) = %+v expected none", input, got)
+		}
+	}
+}
+
+func TestFindLinks(t *testing.T) {
+	page := []byte(`<html><head>
+		<link rel="alternate" type="application/rss+xml" title="Posts" href="/feed.xml">
+		<link rel="alternate" type="application/atom+xml" href="https://cdn.example.com/atom.xml">
+		<link rel="alternate" hreflang="fr" href="/fr/">
+		<link rel="stylesheet" type="text/css" href="/style.css">
+	</head></html>`)
+	base, _ := url.Parse("https://example.com/blog/")
+	got := FindLinks(page, base)
+	if len(got) != 2 {
+		t.Fatalf("got %d candidates expected 2: %+v", len(got), got)
+	}
+	if got[0].URL != "https://example.com/feed.xml" || got[0].Title != "Posts" {
+		t.Errorf("unexpected first candidate %+v", got[0])
+	}
+	if got[1].URL != "https://cdn.example.com/atom.xml" {
+		t.Errorf("unexpected second candidate %+v", got[1])
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	client = fetch.DefaultClient
+	defer func() { client = fetch.PublicClient }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte(`<html><head><title>Home</title></head><body>No links here</body></html>`))
+	})
+	mux.HandleFunc("/index.xml", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/rss+xml")
+		w.Write([]byte(rss))
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	got, err := Discover(context.Background(), srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].URL != srv.URL+"/index.xml" || got[0].Title != "Probed" {
+		t.Errorf("expected probed feed, got %+v", got)
+	}
+
+	got, err = Discover(context.Background(), srv.URL+"/index.xml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 1 || got[0].URL != srv.URL+"/index.xml" {
+		t.Errorf("expected feed URL to be its own candidate, got %+v", got)
+	}
+
+	if _, err := Discover(context.Background(), "ftp://example.com"); err != ErrInvalidURL {
+		t.Errorf("expected ErrInvalidURL, got %v", err)
+	}
+}
+
+func TestDiscoverRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the public client reached %s", r.URL)
+	}))
+	defer srv.Close()
+	if _, err := Discover(context.Background(), srv.URL); !errors.Is(err, fetch.ErrForbiddenAddress) {
+		t.Errorf("Discover of a loopback URL = %v, want ErrForbiddenAddress", err)
+	}
+}
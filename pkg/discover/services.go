@@ -0,0 +1,85 @@
+package discover
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	youtubeChannelRe = regexp.MustCompile(`^/channel/(UC[\w-]{22})`)
+	youtubeUserRe    = regexp.MustCompile(`^/user/([\w.-]+)`)
+	githubRepoRe     = regexp.MustCompile(`^/([\w.-]+)/([\w.-]+)(?:/|$)`)
+	githubUserRe     = regexp.MustCompile(`^/([\w-]+)/?$`)
+	redditRe         = regexp.MustCompile(`^/(r|u|user)/([\w-]+)`)
+	mastodonRe       = regexp.MustCompile(`^/@([\w.]+)/?$`)
+)
+
+// githubReserved are top level GitHub paths that are not users.
+var githubReserved = map[string]bool{
+	"about": true, "explore": true, "features": true, "login": true, "marketplace": true,
+	"notifications": true, "orgs": true, "pricing": true, "settings": true, "topics": true,
+	"trending": true, "sponsors": true, "search": true, "pulls": true, "issues": true,
+}
+
+// knownFeeds maps pages of well known services to the feeds they offer but
+// do not always advertise.
+func knownFeeds(u *url.URL) []Candidate {
+	host := strings.TrimPrefix(strings.ToLower(u.Hostname()), "www.")
+	host = strings.TrimPrefix(host, "m.")
+	path := u.EscapedPath()
+
+	switch host {
+	case "youtube.com":
+		if m := youtubeChannelRe.FindStringSubmatch(path); m != nil {
+			return []Candidate{{URL: "https://www.youtube.com/feeds/videos.xml?channel_id=" + m[1], Title: "YouTube channel videos"}}
+		}
+		if m := youtubeUserRe.FindStringSubmatch(path); m != nil {
+			return []Candidate{{URL: "https://www.youtube.com/feeds/videos.xml?user=" + m[1], Title: m[1] + " on YouTube"}}
+		}
+		if list := u.Query().Get("list"); list != "" {
+			return []Candidate{{URL: "https://www.youtube.com/feeds/videos.xml?playlist_id=" + url.QueryEscape(list), Title: "YouTube playlist"}}
+		}
+		// Handle pages (/@name) advertise their channel feed in the page.
+		return nil
+
+	case "github.com":
+		if m := githubRepoRe.FindStringSubmatch(path); m != nil && !githubReserved[m[1]] {
+			repo := "https://github.com/" + m[1] + "/" + strings.TrimSuffix(m[2], ".git")
+			name := m[1] + "/" + strings.TrimSuffix(m[2], ".git")
+			return []Candidate{
+				{URL: repo + "/releases.atom", Title: "Releases of " + name},
+				{URL: repo + "/tags.atom", Title: "Tags of " + name},
+				{URL: repo + "/commits.atom", Title: "Commits to " + name},
+			}
+		}
+		if m := githubUserRe.FindStringSubmatch(path); m != nil && !githubReserved[m[1]] {
+			return []Candidate{{URL: "https://github.com/" + m[1] + ".atom", Title: m[1] + " on GitHub"}}
+		}
+
+	case "reddit.com", "old.reddit.com":
+		if m := redditRe.FindStringSubmatch(path); m != nil {
+			kind := m[1]
+			if kind == "u" {
+				kind = "user"
+			}
+			return []Candidate{{URL: "https://www.reddit.com/" + kind + "/" + m[2] + "/.rss", Title: m[1] + "/" + m[2] + " on Reddit"}}
+		}
+		if path == "" || path == "/" {
+			return []Candidate{{URL: "https://www.reddit.com/.rss", Title: "Reddit front page"}}
+		}
+
+	case "medium.com":
+		if m := mastodonRe.FindStringSubmatch(path); m != nil {
+			return []Candidate{{URL: "https://medium.com/feed/@" + m[1], Title: "@" + m[1] + " on Medium"}}
+		}
+
+	default:
+		// Mastodon and other Fediverse servers serve a profile feed next to
+		// the profile page.
+		if m := mastodonRe.FindStringSubmatch(path); m != nil {
+			return []Candidate{{URL: u.Scheme + "://" + u.Host + "/@" + m[1] + ".rss", Title: "@" + m[1] + "@" + u.Hostname()}}
+		}
+	}
+	return nil
+}
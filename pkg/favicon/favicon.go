@@ -0,0 +1,108 @@
+// Package favicon finds and fetches the icons of the websites feeds belong
+// to, which Fever clients show next to the feeds.
+package favicon
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// MaxSize bounds the size of icons.
+const MaxSize = 256 << 10
+
+var ErrNotFound = errors.New("favicon: the website has no usable icon")
+
+// client fetches the website feeds point to, so they cannot reach internal
+// services.
+var client = fetch.PublicClient
+
+// types are the image types accepted as icons, as sniffed from their
+// content. SVG is left out as it may carry scripts.
+var types = map[string]bool{
+	"image/x-icon": true,
+	"image/png":    true,
+	"image/gif":    true,
+	"image/jpeg":   true,
+	"image/webp":   true,
+	"image/bmp":    true,
+}
+
+// Fetch returns the icon of the website at siteURL: the first usable icon
+// its home page advertises, otherwise /favicon.ico.
+func Fetch(ctx context.Context, siteURL string) (mimeType string, data []byte, err error) {
+	u, err := url.Parse(siteURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "", nil, ErrNotFound
+	}
+
+	var candidates []string
+	if resp, err := fetch.Get(ctx, fetch.Request{URL: u.String(), Accept: "text/html", Client: client}); err == nil {
+		if base, err := url.Parse(resp.URL); err == nil {
+			u = base
+			candidates = Links(resp.Body, base)
+		}
+	}
+	candidates = append(candidates, (&url.URL{Scheme: u.Scheme, Host: u.Host, Path: "/favicon.ico"}).String())
+
+	for _, c := range candidates {
+		if ctx.Err() != nil {
+			return "", nil, ctx.Err()
+		}
+		resp, err := fetch.Get(ctx, fetch.Request{URL: c, Accept: "image/*", Client: client})
+		if err != nil || len(resp.Body) == 0 || len(resp.Body) > MaxSize {
+			continue
+		}
+		if t := http.DetectContentType(resp.Body); types[t] {
+			return t, resp.Body, nil
+		}
+	}
+	return "", nil, ErrNotFound
+}
+
+// Links returns the icons advertised by the <link rel="icon"> elements of
+// an HTML page, resolved against base, with "icon" and "shortcut icon"
+// before Apple touch icons.
+func Links(page []byte, base *url.URL) []string {
+	doc, err := html.Parse(bytes.NewReader(page))
+	if err != nil {
+		return nil
+	}
+	var icons, touch []string
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && n.DataAtom == atom.Link {
+			var rel, href string
+			for _, a := range n.Attr {
+				switch a.Key {
+				case "rel":
+					rel = strings.ToLower(a.Val)
+				case "href":
+					href = strings.TrimSpace(a.Val)
+				}
+			}
+			if ref, err := base.Parse(href); href != "" && err == nil {
+				tokens := strings.Fields(rel)
+				switch {
+				case slices.Contains(tokens, "icon"):
+					icons = append(icons, ref.String())
+				case slices.Contains(tokens, "apple-touch-icon"), slices.Contains(tokens, "apple-touch-icon-precomposed"):
+					touch = append(touch, ref.String())
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+	return append(icons, touch...)
+}
@@ -0,0 +1,66 @@
+package favicon
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+)
+
+// ico is the header of an ICO file.
+var ico = []byte("\x00\x00\x01\x00\x01\x00\x10\x10\x00\x00\x01\x00\x20\x00")
+
+func TestLinks(t *testing.T) {
+	page := []byte(`<html><head>
+		<link rel="apple-touch-icon" href="/touch.png">
+		<link rel="stylesheet" href="/style.css">
+		<link rel="Shortcut Icon" href="img/fav.png">
+		<link rel="icon" href="">
+	</head></html>`)
+	base, _ := url.Parse("https://example.com/blog/")
+	got := Links(page, base)
+	want := []string{"https://example.com/blog/img/fav.png", "https://example.com/touch.png"}
+	if len(got) != len(want) || got[0] != want[0] || got[1] != want[1] {
+		t.Errorf("Links = %q, want %q", got, want)
+	}
+}
+
+func TestFetch(t *testing.T) {
+	client = fetch.DefaultClient
+	defer func() { client = fetch.PublicClient }()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`<link rel="icon" href="/missing.png"><link rel="icon" href="/page.html">`))
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		// Not an image, whatever its content type says.
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("<html></html>"))
+	})
+	mux.HandleFunc("/favicon.ico", func(w http.ResponseWriter, r *http.Request) {
+		w.Write(ico)
+	})
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	mimeType, data, err := Fetch(t.Context(), srv.URL+"/")
+	if err != nil || mimeType != "image/x-icon" || len(data) != len(ico) {
+		t.Errorf("Fetch = %q, %d bytes, %v, want the favicon.ico", mimeType, len(data), err)
+	}
+	if _, _, err := Fetch(t.Context(), "ftp://example.com"); err != ErrNotFound {
+		t.Errorf("Fetch of an ftp URL = %v, want ErrNotFound", err)
+	}
+}
+
+func TestFetchRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the public client reached %s", r.URL)
+	}))
+	defer srv.Close()
+	if _, _, err := Fetch(t.Context(), srv.URL); err != ErrNotFound {
+		t.Errorf("Fetch of a loopback URL = %v, want ErrNotFound", err)
+	}
+}
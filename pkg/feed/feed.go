@@ -0,0 +1,530 @@
+// Package feed parses RSS 2.0, RSS 1.0 (RDF), Atom 1.0 and JSON Feed
+// documents into a common representation.
+package feed
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"errors"
+	"html"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html/charset"
+)
+
+var ErrUnknownFormat = errors.New("feed: unknown format")
+
+// Feed is a parsed feed document.
+type Feed struct {
+	Title       string
+	Description string
+	SiteURL     string
+	// ImageURL is the feed artwork, such as a podcast cover.
+	ImageURL string
+	// HubURL is the WebSub hub advertised by the feed, and SelfURL the
+	// canonical feed URL to subscribe to it with.
+	HubURL  string
+	SelfURL string
+	Items   []Item
+}
+
+// Item is a single entry of a feed.
+type Item struct {
+	GUID       string
+	URL        string
+	Title      string
+	Author     string
+	Content    string
+	Published  time.Time
+	Categories []string
+
+	// Enclosures are the attached media files.
+	Enclosures []Enclosure
+	// ImageURL is the episode artwork.
+	ImageURL string
+	// Duration, Episode and Season describe podcast episodes.
+	Duration time.Duration
+	Episode  int
+	Season   int
+	// ChaptersURL links to Podcasting 2.0 chapters of type ChaptersType.
+	ChaptersURL  string
+	ChaptersType string
+	Transcripts  []Transcript
+}
+
+// Parse parses data fetched from feedURL. Relative links are resolved
+// against feedURL.
+func Parse(data []byte, feedURL string) (*Feed, error) {
+	trimmed := bytes.TrimSpace(data)
+	if bytes.HasPrefix(trimmed, []byte("{")) {
+		return parseJSON(trimmed, feedURL)
+	}
+
+	root, err := rootElement(data)
+	if err != nil {
+		return nil, err
+	}
+	var f *Feed
+	switch strings.ToLower(root) {
+	case "rss":
+		f, err = parseRSS(data)
+	case "rdf":
+		f, err = parseRDF(data)
+	case "feed":
+		f, err = parseAtom(data)
+	default:
+		return nil, ErrUnknownFormat
+	}
+	if err != nil {
+		return nil, err
+	}
+	f.normalize(feedURL)
+	return f, nil
+}
+
+func newDecoder(data []byte) *xml.Decoder {
+	d := xml.NewDecoder(bytes.NewReader(data))
+	d.CharsetReader = charset.NewReaderLabel
+	d.Strict = false
+	d.Entity = xml.HTMLEntity
+	return d
+}
+
+func rootElement(data []byte) (string, error) {
+	d := newDecoder(data)
+	for {
+		tok, err := d.Token()
+		if err != nil {
+			return "", ErrUnknownFormat
+		}
+		if se, ok := tok.(xml.StartElement); ok {
+			return se.Name.Local, nil
+		}
+	}
+}
+
+// normalize resolves links, trims text and fills missing GUIDs.
+func (f *Feed) normalize(feedURL string) {
+	f.Title = strings.TrimSpace(html.UnescapeString(f.Title))
+	f.Description = strings.TrimSpace(f.Description)
+	f.SiteURL = resolveURL(feedURL, strings.TrimSpace(f.SiteURL))
+	f.ImageURL = resolveURL(feedURL, strings.TrimSpace(f.ImageURL))
+	f.HubURL = resolveURL(feedURL, strings.TrimSpace(f.HubURL))
+	f.SelfURL = resolveURL(feedURL, strings.TrimSpace(f.SelfURL))
+	for i := range f.Items {
+		it := &f.Items[i]
+		it.Title = strings.TrimSpace(html.UnescapeString(it.Title))
+		it.Author = strings.TrimSpace(it.Author)
+		it.Content = strings.TrimSpace(it.Content)
+		it.URL = resolveURL(f.SiteURL, resolveURL(feedURL, strings.TrimSpace(it.URL)))
+		it.GUID = strings.TrimSpace(it.GUID)
+		if it.GUID == "" {
+			it.GUID = it.URL
+		}
+		for j := range it.Enclosures {
+			it.Enclosures[j].URL = resolveURL(feedURL, strings.TrimSpace(it.Enclosures[j].URL))
+			it.Enclosures[j].Type = strings.ToLower(strings.TrimSpace(it.Enclosures[j].Type))
+		}
+		if it.GUID == "" && len(it.Enclosures) > 0 {
+			it.GUID = it.Enclosures[0].URL
+		}
+		it.ImageURL = resolveURL(feedURL, strings.TrimSpace(it.ImageURL))
+		it.ChaptersURL = resolveURL(feedURL, strings.TrimSpace(it.ChaptersURL))
+		for j := range it.Transcripts {
+			it.Transcripts[j].URL = resolveURL(feedURL, strings.TrimSpace(it.Transcripts[j].URL))
+		}
+	}
+}
+
+// resolveURL resolves ref against base, returning ref unchanged when either
+// is not a valid URL.
+func resolveURL(base, ref string) string {
+	if ref == "" || base == "" {
+		return ref
+	}
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return b.ResolveReference(r).String()
+}
+
+// dateLayouts are the date formats seen in the wild, tried in order.
+var dateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	time.RFC3339,
+	time.RFC3339Nano,
+	time.RFC822Z,
+	time.RFC822,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 02 Jan 2006 15:04 -0700",
+	"Mon, 2 January 2006 15:04:05 -0700",
+	"Mon, 2 January 2006 15:04:05 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05 -0700",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseDate parses a feed date, returning the zero time when no layout
+// matches.
+func ParseDate(s string) time.Time {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}
+	}
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+type rssLink struct {
+	Href string `xml:"href,attr"`
+	Rel  string `xml:"rel,attr"`
+	Text string `xml:",chardata"`
+}
+
+type rssItem struct {
+	Title       string    `xml:"title"`
+	Links       []rssLink `xml:"link"`
+	GUID        string    `xml:"guid"`
+	Description string    `xml:"description"`
+	Encoded     string    `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	Author      string    `xml:"author"`
+	Creator     string    `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	PubDate     string    `xml:"pubDate"`
+	Date        string    `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Categories  []string  `xml:"category"`
+	About       string    `xml:"about,attr"`
+	podcastItem
+}
+
+func (it rssItem) toItem() Item {
+	item := Item{
+		GUID:       it.GUID,
+		Title:      it.Title,
+		Author:     firstNonEmpty(it.Creator, it.Author),
+		Content:    firstNonEmpty(it.Encoded, it.Description),
+		Published:  ParseDate(firstNonEmpty(it.PubDate, it.Date)),
+		Categories: it.Categories,
+	}
+	for _, l := range it.Links {
+		if l.Href == "" && strings.TrimSpace(l.Text) != "" {
+			item.URL = l.Text
+			break
+		}
+	}
+	if item.GUID == "" {
+		item.GUID = it.About
+	}
+	it.podcastItem.apply(&item)
+	return item
+}
+
+type rssChannel struct {
+	Title       string     `xml:"title"`
+	Links       []rssLink  `xml:"link"`
+	Description string     `xml:"description"`
+	Images      []rssImage `xml:"image"`
+	Items       []rssItem  `xml:"item"`
+}
+
+// relLink returns the first atom:link of the channel with the relation rel.
+func (c rssChannel) relLink(rel string) string {
+	for _, l := range c.Links {
+		if l.Href != "" && l.Rel == rel {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+func (c rssChannel) siteURL() string {
+	for _, l := range c.Links {
+		if l.Href == "" && strings.TrimSpace(l.Text) != "" {
+			return l.Text
+		}
+	}
+	return ""
+}
+
+func parseRSS(data []byte) (*Feed, error) {
+	var doc struct {
+		Channel rssChannel `xml:"channel"`
+	}
+	if err := newDecoder(data).Decode(&doc); err != nil {
+		return nil, err
+	}
+	f := &Feed{
+		Title:       doc.Channel.Title,
+		Description: doc.Channel.Description,
+		SiteURL:     doc.Channel.siteURL(),
+		ImageURL:    imageURL(doc.Channel.Images),
+		HubURL:      doc.Channel.relLink("hub"),
+		SelfURL:     doc.Channel.relLink("self"),
+	}
+	for _, it := range doc.Channel.Items {
+		f.Items = append(f.Items, it.toItem())
+	}
+	return f, nil
+}
+
+// parseRDF parses RSS 1.0, where items are siblings of the channel.
+func parseRDF(data []byte) (*Feed, error) {
+	var doc struct {
+		Channel rssChannel `xml:"channel"`
+		Items   []rssItem  `xml:"item"`
+	}
+	if err := newDecoder(data).Decode(&doc); err != nil {
+		return nil, err
+	}
+	f := &Feed{
+		Title:       doc.Channel.Title,
+		Description: doc.Channel.Description,
+		SiteURL:     doc.Channel.siteURL(),
+	}
+	for _, it := range doc.Items {
+		f.Items = append(f.Items, it.toItem())
+	}
+	return f, nil
+}
+
+type atomText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+// HTML returns the text as HTML according to its type.
+func (t atomText) HTML() string {
+	switch strings.ToLower(t.Type) {
+	case "xhtml":
+		return t.Inner
+	case "html", "text/html":
+		return t.Text
+	default:
+		return html.EscapeString(t.Text)
+	}
+}
+
+// Plain returns the text without markup, for titles.
+func (t atomText) Plain() string {
+	if strings.ToLower(t.Type) == "xhtml" {
+		return stripTags(t.Inner)
+	}
+	return t.Text
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+func alternateLink(links []atomLink) string {
+	for _, l := range links {
+		if l.Rel == "" || l.Rel == "alternate" {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+func relLink(links []atomLink, rel string) string {
+	for _, l := range links {
+		if l.Rel == rel {
+			return l.Href
+		}
+	}
+	return ""
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	ID         string       `xml:"id"`
+	Title      atomText     `xml:"title"`
+	Links      []atomLink   `xml:"link"`
+	Published  string       `xml:"published"`
+	Updated    string       `xml:"updated"`
+	Authors    []atomPerson `xml:"author"`
+	Content    atomText     `xml:"content"`
+	Summary    atomText     `xml:"summary"`
+	Categories []struct {
+		Term string `xml:"term,attr"`
+	} `xml:"category"`
+}
+
+func parseAtom(data []byte) (*Feed, error) {
+	var doc struct {
+		Title    atomText     `xml:"title"`
+		Subtitle atomText     `xml:"subtitle"`
+		Links    []atomLink   `xml:"link"`
+		Authors  []atomPerson `xml:"author"`
+		Entries  []atomEntry  `xml:"entry"`
+	}
+	if err := newDecoder(data).Decode(&doc); err != nil {
+		return nil, err
+	}
+	f := &Feed{
+		Title:       doc.Title.Plain(),
+		Description: doc.Subtitle.Plain(),
+		SiteURL:     alternateLink(doc.Links),
+		HubURL:      relLink(doc.Links, "hub"),
+		SelfURL:     relLink(doc.Links, "self"),
+	}
+	for _, e := range doc.Entries {
+		item := Item{
+			GUID:      e.ID,
+			URL:       alternateLink(e.Links),
+			Title:     e.Title.Plain(),
+			Published: ParseDate(firstNonEmpty(e.Published, e.Updated)),
+		}
+		if strings.TrimSpace(e.Content.Inner) != "" {
+			item.Content = e.Content.HTML()
+		} else {
+			item.Content = e.Summary.HTML()
+		}
+		authors := e.Authors
+		if len(authors) == 0 {
+			authors = doc.Authors
+		}
+		if len(authors) > 0 {
+			item.Author = authors[0].Name
+		}
+		for _, c := range e.Categories {
+			item.Categories = append(item.Categories, c.Term)
+		}
+		for _, l := range e.Links {
+			if l.Rel == "enclosure" && l.Href != "" {
+				length, _ := strconv.ParseInt(l.Length, 10, 64)
+				item.Enclosures = append(item.Enclosures, Enclosure{URL: l.Href, Type: l.Type, Length: length})
+			}
+		}
+		f.Items = append(f.Items, item)
+	}
+	return f, nil
+}
+
+func parseJSON(data []byte, feedURL string) (*Feed, error) {
+	var doc struct {
+		Version     string `json:"version"`
+		Title       string `json:"title"`
+		HomePageURL string `json:"home_page_url"`
+		Description string `json:"description"`
+		Icon        string `json:"icon"`
+		Items       []struct {
+			ID            any      `json:"id"`
+			URL           string   `json:"url"`
+			Title         string   `json:"title"`
+			ContentHTML   string   `json:"content_html"`
+			ContentText   string   `json:"content_text"`
+			Summary       string   `json:"summary"`
+			DatePublished string   `json:"date_published"`
+			DateModified  string   `json:"date_modified"`
+			Tags          []string `json:"tags"`
+			Image         string   `json:"image"`
+			Attachments   []struct {
+				URL      string  `json:"url"`
+				MIMEType string  `json:"mime_type"`
+				Size     int64   `json:"size_in_bytes"`
+				Duration float64 `json:"duration_in_seconds"`
+			} `json:"attachments"`
+			Authors []struct {
+				Name string `json:"name"`
+			} `json:"authors"`
+			Author struct {
+				Name string `json:"name"`
+			} `json:"author"`
+		} `json:"items"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+	if !strings.HasPrefix(doc.Version, "https://jsonfeed.org/version/") {
+		return nil, ErrUnknownFormat
+	}
+	f := &Feed{Title: doc.Title, Description: doc.Description, SiteURL: doc.HomePageURL, ImageURL: doc.Icon}
+	for _, it := range doc.Items {
+		item := Item{
+			URL:        it.URL,
+			Title:      it.Title,
+			Published:  ParseDate(firstNonEmpty(it.DatePublished, it.DateModified)),
+			Categories: it.Tags,
+			Author:     it.Author.Name,
+			ImageURL:   it.Image,
+		}
+		for _, a := range it.Attachments {
+			item.Enclosures = append(item.Enclosures, Enclosure{URL: a.URL, Type: a.MIMEType, Length: a.Size})
+			if item.Duration == 0 {
+				item.Duration = time.Duration(a.Duration * float64(time.Second)).Round(time.Second)
+			}
+		}
+		switch id := it.ID.(type) {
+		case string:
+			item.GUID = id
+		case float64:
+			item.GUID = strconv.FormatFloat(id, 'f', -1, 64)
+		}
+		if len(it.Authors) > 0 {
+			item.Author = it.Authors[0].Name
+		}
+		switch {
+		case it.ContentHTML != "":
+			item.Content = it.ContentHTML
+		case it.ContentText != "":
+			item.Content = html.EscapeString(it.ContentText)
+		default:
+			item.Content = html.EscapeString(it.Summary)
+		}
+		f.Items = append(f.Items, item)
+	}
+	f.normalize(feedURL)
+	return f, nil
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// stripTags removes markup from s, keeping its text.
+func stripTags(s string) string {
+	var b strings.Builder
+	inTag := false
+	for _, r := range s {
+		switch {
+		case r == '<':
+			inTag = true
+		case r == '>':
+			inTag = false
+		case !inTag:
+			b.WriteRune(r)
+		}
+	}
+	return html.UnescapeString(b.String())
+}
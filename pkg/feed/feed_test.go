@@ -0,0 +1,261 @@
+package feed
+
+import (
+	"os"
+	"testing"
+	"time"
+)
+
+func parseFile(t *testing.T, name, feedURL string) *Feed {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := Parse(data, feedURL)
+	if err != nil {
+		t.Fatalf("Parse(%s) returned error %v", name, err)
+	}
+	return f
+}
+
+func TestParseRSS(t *testing.T) {
+	f := parseFile(t, "rss.xml", "https://example.com/feed.xml")
+	if f.Title != "Example & Co" || f.SiteURL != "https://example.com/" {
+		t.Errorf("unexpected feed %q %q", f.Title, f.SiteURL)
+	}
+	if f.HubURL != "https://hub.example.com/" || f.SelfURL != "https://example.com/feed.xml" {
+		t.Errorf("unexpected websub links %q %q", f.HubURL, f.SelfURL)
+	}
+	if len(f.Items) != 2 {
+		t.Fatalf("got %d items expected 2", len(f.Items))
+	}
+
+	first := f.Items[0]
+	if first.GUID != "post-1" || first.URL != "https://example.com/posts/first" {
+		t.Errorf("unexpected guid/url %q %q", first.GUID, first.URL)
+	}
+	if first.Content != "<p>Full <b>content</b></p>" {
+		t.Errorf("expected content:encoded to win, got %q", first.Content)
+	}
+	if first.Author != "Jane Doe" || len(first.Categories) != 2 {
+		t.Errorf("unexpected author/categories %q %v", first.Author, first.Categories)
+	}
+	if !first.Published.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected published %v", first.Published)
+	}
+
+	second := f.Items[1]
+	if second.GUID != second.URL {
+		t.Errorf("expected guid to fall back to the link, got %q", second.GUID)
+	}
+	if second.Content != "<p>Only a summary</p>" {
+		t.Errorf("unexpected content %q", second.Content)
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	f := parseFile(t, "atom.xml", "https://atom.example.org/atom.xml")
+	if f.Title != "Atom Example" || f.SiteURL != "https://atom.example.org/" {
+		t.Errorf("unexpected feed %q %q", f.Title, f.SiteURL)
+	}
+	if f.HubURL != "" || f.SelfURL != "https://atom.example.org/atom.xml" {
+		t.Errorf("unexpected websub links %q %q", f.HubURL, f.SelfURL)
+	}
+	if len(f.Items) != 2 {
+		t.Fatalf("got %d items expected 2", len(f.Items))
+	}
+
+	first := f.Items[0]
+	if first.URL != "https://atom.example.org/entries/1" {
+		t.Errorf("unexpected url %q", first.URL)
+	}
+	if first.Author != "Feed Author" {
+		t.Errorf("expected feed author, got %q", first.Author)
+	}
+	if first.Title != "A <em>title</em>" {
+		t.Errorf("unexpected title %q", first.Title)
+	}
+	if !first.Published.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("expected published over updated, got %v", first.Published)
+	}
+
+	second := f.Items[1]
+	if second.Title != "Plain & simple" || second.Author != "Guest" {
+		t.Errorf("unexpected title/author %q %q", second.Title, second.Author)
+	}
+	if second.Content != "1 &lt; 2" {
+		t.Errorf("expected escaped text summary, got %q", second.Content)
+	}
+}
+
+func TestParseRDF(t *testing.T) {
+	f := parseFile(t, "rdf.xml", "https://rdf.example.net/rss")
+	if f.Title != "RDF Café" {
+		t.Errorf("unexpected title %q", f.Title)
+	}
+	if len(f.Items) != 1 || f.Items[0].Title != "Café news" {
+		t.Fatalf("unexpected items %+v", f.Items)
+	}
+	if f.Items[0].GUID != "https://rdf.example.net/1" {
+		t.Errorf("unexpected guid %q", f.Items[0].GUID)
+	}
+}
+
+func TestParseJSON(t *testing.T) {
+	data := []byte(`{
+		"version": "https://jsonfeed.org/version/1.1",
+		"title": "JSON",
+		"home_page_url": "https://json.example.com/",
+		"items": [{"id": 7, "url": "/7", "content_text": "a < b", "date_published": "2006-01-02T15:04:05Z"}]
+	}`)
+	f, err := Parse(data, "https://json.example.com/feed.json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Items) != 1 {
+		t.Fatalf("got %d items expected 1", len(f.Items))
+	}
+	it := f.Items[0]
+	if it.GUID != "7" || it.URL != "https://json.example.com/7" || it.Content != "a &lt; b" {
+		t.Errorf("unexpected item %+v", it)
+	}
+}
+
+func TestParseUnknown(t *testing.T) {
+	if _, err := Parse([]byte("<html><body>nope</body></html>"), ""); err != ErrUnknownFormat {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	var tests = []string{
+		"Mon, 02 Jan 2006 15:04:05 +0000",
+		"Mon, 2 Jan 2006 15:04:05 GMT",
+		"2006-01-02T15:04:05Z",
+		"2006-01-02T15:04:05+00:00",
+		"2006-01-02 15:04:05",
+	}
+	want := time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)
+	for _, input := range tests {
+		t.Run(input, func(t *testing.T) {
+			if got := ParseDate(input); !got.Equal(want) {
+				t.Errorf("got %v expected %v", got, want)
+			}
+		})
+	}
+	if !ParseDate("yesterday").IsZero() {
+		t.Errorf("expected zero time for unparseable date")
+	}
+}
+
+func TestScrape(t *testing.T) {
+	data, err := os.ReadFile("testdata/changelog.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := ScrapeConfig{
+		ItemSelector:    "section.release",
+		TitleSelector:   "h2",
+		DateSelector:    "time, .date",
+		DateFormat:      "January 2, 2006",
+		ContentSelector: ".notes",
+	}
+	f, err := Scrape(data, "https://acme.example.com/changelog#feedr-scrape", cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.Title != "Acme API Changelog" || f.SiteURL != "https://acme.example.com/changelog" {
+		t.Errorf("unexpected feed %q %q", f.Title, f.SiteURL)
+	}
+	if len(f.Items) != 3 {
+		t.Fatalf("got %d items expected 3", len(f.Items))
+	}
+
+	first := f.Items[0]
+	if first.Title != "Version 2.1.0" || first.URL != "https://acme.example.com/changelog/2.1.0" {
+		t.Errorf("unexpected first item %q %q", first.Title, first.URL)
+	}
+	if !first.Published.Equal(time.Date(2024, 3, 5, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected datetime attribute to be used, got %v", first.Published)
+	}
+	if first.Content != "<p>Added <code>webhooks</code> endpoint.</p>" {
+		t.Errorf("unexpected content %q", first.Content)
+	}
+
+	second := f.Items[1]
+	if second.URL != "https://acme.example.com/changelog#v2-0-1" {
+		t.Errorf("expected anchor link, got %q", second.URL)
+	}
+	if !second.Published.Equal(time.Date(2024, 2, 20, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("expected date format to be used, got %v", second.Published)
+	}
+
+	third := f.Items[2]
+	if third.URL != "https://acme.example.com/changelog" || third.GUID == third.URL {
+		t.Errorf("expected page link with a content GUID, got %q %q", third.URL, third.GUID)
+	}
+
+	if _, err := Scrape(data, "https://acme.example.com/", ScrapeConfig{ItemSelector: "article", TitleSelector: "h2"}); err != ErrNoItems {
+		t.Errorf("expected ErrNoItems, got %v", err)
+	}
+	if err := (ScrapeConfig{ItemSelector: "div[", TitleSelector: "h2"}).Validate(); err == nil {
+		t.Errorf("expected invalid selector error")
+	}
+}
+
+func TestParsePodcast(t *testing.T) {
+	f := parseFile(t, "podcast.xml", "https://podcast.example.com/feed.xml")
+	if f.ImageURL != "https://cdn.example.com/cover.jpg" {
+		t.Errorf("expected itunes:image as feed image, got %q", f.ImageURL)
+	}
+	if len(f.Items) != 2 {
+		t.Fatalf("got %d items expected 2", len(f.Items))
+	}
+
+	ep := f.Items[0]
+	if len(ep.Enclosures) != 1 {
+		t.Fatalf("got %d enclosures expected 1", len(ep.Enclosures))
+	}
+	enc := ep.Enclosures[0]
+	if enc.URL != "https://podcast.example.com/media/df-12.mp3" || enc.Type != "audio/mpeg" || enc.Length != 48213760 {
+		t.Errorf("unexpected enclosure %+v", enc)
+	}
+	if ep.Duration != time.Hour+5*time.Minute+30*time.Second || ep.Episode != 12 || ep.Season != 2 {
+		t.Errorf("unexpected duration/episode/season %v %d %d", ep.Duration, ep.Episode, ep.Season)
+	}
+	if ep.ImageURL != "https://cdn.example.com/df-12.jpg" || ep.Content != "What is the universe made of?" {
+		t.Errorf("unexpected image/content %q %q", ep.ImageURL, ep.Content)
+	}
+	if ep.ChaptersURL != "https://podcast.example.com/df-12/chapters.json" || ep.ChaptersType != "application/json+chapters" {
+		t.Errorf("unexpected chapters %q %q", ep.ChaptersURL, ep.ChaptersType)
+	}
+	if len(ep.Transcripts) != 2 || ep.Transcripts[0].Language != "en" || ep.Transcripts[1].Rel != "captions" {
+		t.Errorf("unexpected transcripts %+v", ep.Transcripts)
+	}
+
+	trailer := f.Items[1]
+	if trailer.GUID != "https://podcast.example.com/media/trailer.m4a" {
+		t.Errorf("expected guid to fall back to the enclosure, got %q", trailer.GUID)
+	}
+	if trailer.Enclosures[0].Type != "audio/x-m4a" || trailer.Duration != 95*time.Second {
+		t.Errorf("unexpected trailer %+v %v", trailer.Enclosures, trailer.Duration)
+	}
+}
+
+func TestParseDuration(t *testing.T) {
+	var tests = map[string]time.Duration{
+		"3600":     time.Hour,
+		"45:10":    45*time.Minute + 10*time.Second,
+		"01:02:03": time.Hour + 2*time.Minute + 3*time.Second,
+		"90.6":     91 * time.Second,
+		"":         0,
+		"1 hour":   0,
+		"1:2:3:4":  0,
+	}
+	for input, want := range tests {
+		if got := ParseDuration(input); got != want {
+			t.Errorf("ParseDuration(%q) = %v expected %v", input, got, want)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package feed
+
+import (
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Namespaces of the podcast extensions.
+const (
+	itunesNS  = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	podcastNS = "https://podcastindex.org/namespace/1.0"
+)
+
+// Enclosure is a media file attached to an item, such as a podcast episode.
+type Enclosure struct {
+	URL    string
+	Type   string
+	Length int64
+}
+
+// Transcript is a Podcasting 2.0 transcript of an episode.
+type Transcript struct {
+	URL      string
+	Type     string
+	Language string
+	Rel      string
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+// rssImage matches both the RSS <image><url> element and <itunes:image href>.
+type rssImage struct {
+	URL  string `xml:"url"`
+	Href string `xml:"href,attr"`
+}
+
+func imageURL(images []rssImage) string {
+	for _, img := range images {
+		if u := firstNonEmpty(img.Href, img.URL); u != "" {
+			return u
+		}
+	}
+	return ""
+}
+
+type podcastChapters struct {
+	URL  string `xml:"url,attr"`
+	Type string `xml:"type,attr"`
+}
+
+type podcastTranscript struct {
+	URL      string `xml:"url,attr"`
+	Type     string `xml:"type,attr"`
+	Language string `xml:"language,attr"`
+	Rel      string `xml:"rel,attr"`
+}
+
+// podcastItem holds the iTunes and Podcasting 2.0 elements of an RSS item.
+type podcastItem struct {
+	Enclosures  []rssEnclosure      `xml:"enclosure"`
+	Images      []rssImage          `xml:"image"`
+	Duration    string              `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+	Episode     string              `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd episode"`
+	Season      string              `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd season"`
+	Summary     string              `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd summary"`
+	Chapters    podcastChapters     `xml:"https://podcastindex.org/namespace/1.0 chapters"`
+	Transcripts []podcastTranscript `xml:"https://podcastindex.org/namespace/1.0 transcript"`
+}
+
+func (p podcastItem) apply(item *Item) {
+	for _, e := range p.Enclosures {
+		if strings.TrimSpace(e.URL) == "" {
+			continue
+		}
+		length, _ := strconv.ParseInt(strings.TrimSpace(e.Length), 10, 64)
+		item.Enclosures = append(item.Enclosures, Enclosure{URL: e.URL, Type: e.Type, Length: length})
+	}
+	item.ImageURL = imageURL(p.Images)
+	item.Duration = ParseDuration(p.Duration)
+	item.Episode, _ = strconv.Atoi(strings.TrimSpace(p.Episode))
+	item.Season, _ = strconv.Atoi(strings.TrimSpace(p.Season))
+	item.ChaptersURL = p.Chapters.URL
+	item.ChaptersType = p.Chapters.Type
+	for _, t := range p.Transcripts {
+		if strings.TrimSpace(t.URL) != "" {
+			item.Transcripts = append(item.Transcripts, Transcript(t))
+		}
+	}
+	if item.Content == "" && p.Summary != "" {
+		item.Content = p.Summary
+	}
+}
+
+// ParseDuration parses an itunes:duration, given either in seconds or as
+// [[HH:]MM:]SS. It returns 0 when s is not a duration.
+func ParseDuration(s string) time.Duration {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return 0
+	}
+	parts := strings.Split(s, ":")
+	if len(parts) > 3 {
+		return 0
+	}
+	var total float64
+	for _, p := range parts {
+		n, err := strconv.ParseFloat(p, 64)
+		if err != nil || n < 0 {
+			return 0
+		}
+		total = total*60 + n
+	}
+	return time.Duration(total * float64(time.Second)).Round(time.Second)
+}
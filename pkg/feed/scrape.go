@@ -0,0 +1,216 @@
+package feed
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var ErrNoItems = errors.New("feed: item selector matched nothing")
+
+// ScrapeConfig describes how to turn an HTML page without a feed into feed
+// items. Selectors other than ItemSelector are evaluated within each item.
+type ScrapeConfig struct {
+	// ItemSelector matches the element of each item.
+	ItemSelector string `json:"item_selector"`
+	// TitleSelector matches the item title.
+	TitleSelector string `json:"title_selector"`
+	// LinkSelector matches the element whose href links to the item. When
+	// empty the first link of the item is used.
+	LinkSelector string `json:"link_selector,omitempty"`
+	// DateSelector matches the publication date of the item. The datetime
+	// attribute is used when present, the text otherwise.
+	DateSelector string `json:"date_selector,omitempty"`
+	// DateFormat is the Go time layout of the date, e.g. "January 2, 2006".
+	// Common formats are recognized when empty.
+	DateFormat string `json:"date_format,omitempty"`
+	// ContentSelector matches the item content. When empty the whole item
+	// is used.
+	ContentSelector string `json:"content_selector,omitempty"`
+}
+
+type compiledScrape struct {
+	item, title, link, date, content cascadia.Matcher
+}
+
+func (c ScrapeConfig) compile() (*compiledScrape, error) {
+	if strings.TrimSpace(c.ItemSelector) == "" || strings.TrimSpace(c.TitleSelector) == "" {
+		return nil, errors.New("feed: item and title selectors are required")
+	}
+	var out compiledScrape
+	for _, s := range []struct {
+		dst *cascadia.Matcher
+		src string
+	}{
+		{&out.item, c.ItemSelector},
+		{&out.title, c.TitleSelector},
+		{&out.link, c.LinkSelector},
+		{&out.date, c.DateSelector},
+		{&out.content, c.ContentSelector},
+	} {
+		if strings.TrimSpace(s.src) == "" {
+			continue
+		}
+		sel, err := cascadia.ParseGroup(s.src)
+		if err != nil {
+			return nil, fmt.Errorf("feed: invalid selector %q: %w", s.src, err)
+		}
+		*s.dst = sel
+	}
+	return &out, nil
+}
+
+// Validate checks that the selectors are valid.
+func (c ScrapeConfig) Validate() error {
+	_, err := c.compile()
+	return err
+}
+
+// Key returns a short stable hash of the configuration, which tells apart
+// scraped feeds of the same page.
+func (c ScrapeConfig) Key() string {
+	b, _ := json.Marshal(c)
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])[:12]
+}
+
+// Scrape extracts feed items from the HTML page fetched from pageURL.
+func Scrape(data []byte, pageURL string, cfg ScrapeConfig) (*Feed, error) {
+	sel, err := cfg.compile()
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	base, err := url.Parse(pageURL)
+	if err != nil {
+		return nil, err
+	}
+	base.Fragment = ""
+
+	f := &Feed{SiteURL: base.String()}
+	if t := cascadia.Query(doc, cascadia.MustCompile("title")); t != nil {
+		f.Title = nodeText(t)
+	}
+	if d := cascadia.Query(doc, cascadia.MustCompile(`meta[name=description]`)); d != nil {
+		f.Description = attr(d, "content")
+	}
+
+	nodes := cascadia.QueryAll(doc, sel.item)
+	if len(nodes) == 0 {
+		return nil, ErrNoItems
+	}
+	for _, n := range nodes {
+		it := Item{}
+		if t := cascadia.Query(n, sel.title); t != nil {
+			it.Title = nodeText(t)
+		}
+		if it.Title == "" {
+			continue
+		}
+		it.URL = scrapeLink(n, sel.link, base)
+		if sel.date != nil {
+			if d := cascadia.Query(n, sel.date); d != nil {
+				it.Published = scrapeDate(d, cfg.DateFormat)
+			}
+		}
+		content := n
+		if sel.content != nil {
+			content = cascadia.Query(n, sel.content)
+		}
+		if content != nil {
+			it.Content = innerHTML(content)
+		}
+		// Items sharing the page URL are told apart by their text.
+		it.GUID = it.URL
+		if it.URL == base.String() {
+			sum := sha256.Sum256([]byte(it.Title + "\x00" + it.Content))
+			it.GUID = base.String() + "#" + hex.EncodeToString(sum[:8])
+		}
+		f.Items = append(f.Items, it)
+	}
+	f.normalize(base.String())
+	return f, nil
+}
+
+// scrapeLink returns the absolute link of an item. Items without a link
+// point to their anchor on the page when they have an id.
+func scrapeLink(n *html.Node, sel cascadia.Matcher, base *url.URL) string {
+	var a *html.Node
+	switch {
+	case sel != nil:
+		a = cascadia.Query(n, sel)
+	case n.DataAtom == atom.A:
+		a = n
+	default:
+		a = cascadia.Query(n, cascadia.MustCompile("a[href]"))
+	}
+	if a != nil {
+		if ref, err := base.Parse(strings.TrimSpace(attr(a, "href"))); err == nil && attr(a, "href") != "" {
+			return ref.String()
+		}
+	}
+	if id := attr(n, "id"); id != "" {
+		u := *base
+		u.Fragment = id
+		return u.String()
+	}
+	return base.String()
+}
+
+func scrapeDate(n *html.Node, layout string) time.Time {
+	value := attr(n, "datetime")
+	if value == "" {
+		value = nodeText(n)
+	}
+	if layout != "" {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t
+		}
+	}
+	return ParseDate(value)
+}
+
+func nodeText(n *html.Node) string {
+	var b strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+func innerHTML(n *html.Node) string {
+	var b strings.Builder
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		html.Render(&b, c)
+	}
+	return b.String()
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
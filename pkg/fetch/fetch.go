@@ -0,0 +1,142 @@
+// Package fetch performs the outgoing HTTP requests feedr makes to feeds and
+// websites.
+package fetch
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// UserAgent identifies feedr to the sites it fetches.
+const UserAgent = "feedr/1.0 (+https://github.com/swartzfoundation/feedr)"
+
+// MaxBodySize bounds the size of fetched documents.
+const MaxBodySize = 10 << 20
+
+var (
+	ErrTooLarge         = errors.New("fetch: response body too large")
+	ErrForbiddenAddress = errors.New("fetch: refusing to connect to a private address")
+)
+
+// DefaultClient is used when a Request has no Client.
+var DefaultClient = &http.Client{Timeout: 30 * time.Second}
+
+// PublicClient refuses to connect to loopback, private and link-local
+// addresses. It is used for URLs users or remote parties choose, so they
+// cannot reach internal services.
+var PublicClient = &http.Client{
+	Timeout: 30 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 10 * time.Second,
+			Control: publicOnly,
+		}).DialContext,
+		MaxIdleConnsPerHost: 4,
+		IdleConnTimeout:     90 * time.Second,
+	},
+}
+
+// publicOnly refuses connections to addresses other than public unicast
+// ones. It runs after name resolution, so names resolving to private
+// addresses are refused too.
+func publicOnly(network, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return ErrForbiddenAddress
+	}
+	return nil
+}
+
+// Request describes a GET request. ETag and LastModified make the request
+// conditional.
+type Request struct {
+	URL          string
+	ETag         string
+	LastModified string
+	Accept       string
+	Header       http.Header
+	Client       *http.Client
+}
+
+// Response is a fully read response.
+type Response struct {
+	// URL is the final URL after redirects.
+	URL          string
+	StatusCode   int
+	ContentType  string
+	ETag         string
+	LastModified string
+	Body         []byte
+	// Links are the values of the Link headers.
+	Links []string
+	// NotModified is true when a conditional request returned 304.
+	NotModified bool
+}
+
+// Get performs req and reads the body. Responses other than 2xx and 304 are
+// returned as errors.
+func Get(ctx context.Context, req Request) (*Response, error) {
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodGet, req.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range req.Header {
+		httpReq.Header[k] = v
+	}
+	if httpReq.Header.Get("User-Agent") == "" {
+		httpReq.Header.Set("User-Agent", UserAgent)
+	}
+	if req.Accept != "" {
+		httpReq.Header.Set("Accept", req.Accept)
+	}
+	if req.ETag != "" {
+		httpReq.Header.Set("If-None-Match", req.ETag)
+	}
+	if req.LastModified != "" {
+		httpReq.Header.Set("If-Modified-Since", req.LastModified)
+	}
+
+	client := req.Client
+	if client == nil {
+		client = DefaultClient
+	}
+	resp, err := client.Do(httpReq)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	out := &Response{
+		URL:          resp.Request.URL.String(),
+		StatusCode:   resp.StatusCode,
+		ContentType:  resp.Header.Get("Content-Type"),
+		ETag:         resp.Header.Get("ETag"),
+		LastModified: resp.Header.Get("Last-Modified"),
+		Links:        resp.Header.Values("Link"),
+	}
+	if resp.StatusCode == http.StatusNotModified {
+		out.NotModified = true
+		return out, nil
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return nil, fmt.Errorf("fetch: %s returned %s", req.URL, resp.Status)
+	}
+	out.Body, err = io.ReadAll(io.LimitReader(resp.Body, MaxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(out.Body) > MaxBodySize {
+		return nil, ErrTooLarge
+	}
+	return out, nil
+}
@@ -0,0 +1,50 @@
+package fetch
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPublicClientRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the public client reached %s", r.URL)
+	}))
+	defer srv.Close()
+	port := srv.URL[strings.LastIndex(srv.URL, ":"):]
+
+	for _, u := range []string{
+		srv.URL,
+		"http://localhost" + port,
+		"http://[::1]" + port,
+		"http://[::ffff:127.0.0.1]" + port,
+		"http://10.0.0.1/",
+		"http://172.16.0.1/",
+		"http://192.168.1.1/",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://[fe80::1]/",
+		"http://[fd00::1]/",
+		"http://0.0.0.0" + port,
+	} {
+		_, err := Get(context.Background(), Request{URL: u, Client: PublicClient})
+		if !errors.Is(err, ErrForbiddenAddress) {
+			t.Errorf("%s: expected ErrForbiddenAddress, got %v", u, err)
+		}
+	}
+}
+
+func TestPublicOnly(t *testing.T) {
+	for _, addr := range []string{"93.184.216.34:80", "[2606:2800:220:1:248:1893:25c8:1946]:443"} {
+		if err := publicOnly("tcp", addr, nil); err != nil {
+			t.Errorf("%s: expected a public address to be allowed, got %v", addr, err)
+		}
+	}
+	for _, addr := range []string{"127.0.0.1:80", "[::ffff:127.0.0.1]:80", "[::ffff:10.1.2.3]:80", "224.0.0.1:80"} {
+		if err := publicOnly("tcp", addr, nil); err != ErrForbiddenAddress {
+			t.Errorf("%s: expected ErrForbiddenAddress, got %v", addr, err)
+		}
+	}
+}
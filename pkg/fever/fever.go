@@ -0,0 +1,337 @@
+// Package fever implements the Fever API used by clients such as Unread and
+// Reeder classic. Every call goes to a single endpoint and is selected by
+// query parameters; see https://feedafever.com/api.
+package fever
+
+import (
+	"encoding/base64"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/proxy"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+const (
+	apiVersion = 3
+	// maxItems is the page size mandated by the Fever API.
+	maxItems = 50
+)
+
+type group struct {
+	ID    int64  `json:"id"`
+	Title string `json:"title"`
+}
+
+type feedsGroup struct {
+	GroupID int64  `json:"group_id"`
+	FeedIDs string `json:"feed_ids"`
+}
+
+type feed struct {
+	ID                int64  `json:"id"`
+	FaviconID         int64  `json:"favicon_id"`
+	Title             string `json:"title"`
+	URL               string `json:"url"`
+	SiteURL           string `json:"site_url"`
+	IsSpark           int    `json:"is_spark"`
+	LastUpdatedOnTime int64  `json:"last_updated_on_time"`
+}
+
+type favicon struct {
+	ID   int64  `json:"id"`
+	Data string `json:"data"`
+}
+
+type item struct {
+	ID            int64  `json:"id"`
+	FeedID        int64  `json:"feed_id"`
+	Title         string `json:"title"`
+	Author        string `json:"author"`
+	HTML          string `json:"html"`
+	URL           string `json:"url"`
+	IsSaved       int    `json:"is_saved"`
+	IsRead        int    `json:"is_read"`
+	CreatedOnTime int64  `json:"created_on_time"`
+}
+
+// Mount registers the Fever endpoint on r.
+func Mount(r chi.Router) {
+	r.HandleFunc("/fever", handle)
+	r.HandleFunc("/fever/", handle)
+}
+
+func handle(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		render.JSON(w, http.StatusBadRequest, map[string]any{"api_version": apiVersion, "auth": 0})
+		return
+	}
+	u, err := model.GetUserByFeverAPIKey(r.Context(), strings.ToLower(r.Form.Get("api_key")))
+	if err != nil {
+		render.JSON(w, http.StatusOK, map[string]any{"api_version": apiVersion, "auth": 0})
+		return
+	}
+	ctx := r.Context()
+
+	subs, err := model.ListSubscriptions(ctx, u.ID)
+	if err != nil {
+		writeError(w, "listing subscriptions", err)
+		return
+	}
+	var lastRefreshed int64
+	for _, s := range subs {
+		lastRefreshed = max(lastRefreshed, s.Feed.LastFetchedAt)
+	}
+	resp := map[string]any{
+		"api_version":            apiVersion,
+		"auth":                   1,
+		"last_refreshed_on_time": lastRefreshed,
+	}
+
+	// Write operations come first so the read operations in the same call
+	// reflect them.
+	if r.Form.Get("mark") != "" {
+		if err := mark(r, u); err != nil {
+			writeError(w, "marking items", err)
+			return
+		}
+	}
+
+	q := r.URL.Query()
+	if q.Has("groups") {
+		folders, err := model.ListFolders(ctx, u.ID)
+		if err != nil {
+			writeError(w, "listing folders", err)
+			return
+		}
+		groups := make([]group, 0, len(folders))
+		for _, f := range folders {
+			groups = append(groups, group{ID: f.ID, Title: f.Name})
+		}
+		resp["groups"] = groups
+		resp["feeds_groups"] = feedsGroups(subs)
+	}
+	if q.Has("feeds") {
+		feeds := make([]feed, 0, len(subs))
+		for _, s := range subs {
+			feeds = append(feeds, feed{
+				ID:                s.FeedID,
+				FaviconID:         s.FeedID,
+				Title:             s.DisplayTitle(),
+				URL:               s.Feed.URL,
+				SiteURL:           s.Feed.SiteURL,
+				LastUpdatedOnTime: s.Feed.LastFetchedAt,
+			})
+		}
+		resp["feeds"] = feeds
+		resp["feeds_groups"] = feedsGroups(subs)
+	}
+	if q.Has("favicons") {
+		feedIDs := make([]int64, 0, len(subs))
+		for _, s := range subs {
+			feedIDs = append(feedIDs, s.FeedID)
+		}
+		icons, err := model.ListFeedIcons(ctx, feedIDs)
+		if err != nil {
+			writeError(w, "listing favicons", err)
+			return
+		}
+		favicons := make([]favicon, 0, len(icons))
+		for _, i := range icons {
+			favicons = append(favicons, favicon{
+				ID:   i.FeedID,
+				Data: i.MimeType + ";base64," + base64.StdEncoding.EncodeToString(i.Data),
+			})
+		}
+		resp["favicons"] = favicons
+	}
+	if q.Has("items") {
+		items, total, err := listItems(r, u)
+		if err != nil {
+			writeError(w, "listing items", err)
+			return
+		}
+		resp["items"] = items
+		resp["total_items"] = total
+	}
+	if q.Has("links") {
+		resp["links"] = []any{}
+	}
+	if q.Has("unread_item_ids") {
+		unread := false
+		ids, err := model.ListEntryIDs(ctx, model.EntryQuery{UserID: u.ID, Read: &unread, OrderByID: true})
+		if err != nil {
+			writeError(w, "listing unread items", err)
+			return
+		}
+		resp["unread_item_ids"] = joinIDs(ids)
+	}
+	if q.Has("saved_item_ids") {
+		starred := true
+		ids, err := model.ListEntryIDs(ctx, model.EntryQuery{UserID: u.ID, Starred: &starred, OrderByID: true})
+		if err != nil {
+			writeError(w, "listing saved items", err)
+			return
+		}
+		resp["saved_item_ids"] = joinIDs(ids)
+	}
+
+	render.JSON(w, http.StatusOK, resp)
+}
+
+// listItems pages through items with since_id, max_id or with_ids, returning
+// at most maxItems of them and the total number of items.
+func listItems(r *http.Request, u *model.User) ([]item, int64, error) {
+	ctx := r.Context()
+	total, err := model.CountEntries(ctx, model.EntryQuery{UserID: u.ID})
+	if err != nil {
+		return nil, 0, err
+	}
+
+	q := model.EntryQuery{UserID: u.ID, OrderByID: true, Limit: maxItems}
+	form := r.Form
+	switch {
+	case form.Get("with_ids") != "":
+		ids := parseIDs(form.Get("with_ids"))
+		if len(ids) > maxItems {
+			ids = ids[:maxItems]
+		}
+		if len(ids) == 0 {
+			return []item{}, total, nil
+		}
+		q.EntryIDs = ids
+		q.Ascending = true
+	case form.Get("max_id") != "":
+		maxID, _ := strconv.ParseInt(form.Get("max_id"), 10, 64)
+		if maxID <= 1 {
+			return []item{}, total, nil
+		}
+		q.MaxID = maxID - 1
+	default:
+		q.SinceID, _ = strconv.ParseInt(form.Get("since_id"), 10, 64)
+		q.Ascending = true
+	}
+
+	entries, err := model.ListEntries(ctx, q)
+	if err != nil {
+		return nil, 0, err
+	}
+	items := make([]item, 0, len(entries))
+	for i := range entries {
+		items = append(items, newItem(&entries[i]))
+	}
+	return items, total, nil
+}
+
+// newItem returns the Fever item of e, its images going through the image
+// proxy.
+func newItem(e *model.UserEntry) item {
+	return item{
+		ID:            e.ID,
+		FeedID:        e.FeedID,
+		Title:         e.Title,
+		Author:        e.Author,
+		HTML:          proxy.RewriteHTML(e.Content),
+		URL:           e.URL,
+		IsSaved:       boolToInt(e.IsStarred),
+		IsRead:        boolToInt(e.IsRead),
+		CreatedOnTime: e.PublishedAt,
+	}
+}
+
+// mark handles mark=item|feed|group with as=read|unread|saved|unsaved.
+func mark(r *http.Request, u *model.User) error {
+	ctx := r.Context()
+	form := r.Form
+	id, err := strconv.ParseInt(form.Get("id"), 10, 64)
+	if err != nil {
+		return nil
+	}
+	as := form.Get("as")
+
+	switch form.Get("mark") {
+	case "item":
+		ids := []int64{id}
+		switch as {
+		case "read":
+			return model.SetEntriesRead(ctx, u.ID, ids, true)
+		case "unread":
+			return model.SetEntriesRead(ctx, u.ID, ids, false)
+		case "saved":
+			return model.SetEntriesStarred(ctx, u.ID, ids, true)
+		case "unsaved":
+			return model.SetEntriesStarred(ctx, u.ID, ids, false)
+		}
+	case "feed", "group":
+		if as != "read" {
+			return nil
+		}
+		q := model.EntryQuery{UserID: u.ID}
+		if form.Get("mark") == "feed" {
+			q.FeedID = id
+		} else if id > 0 {
+			q.FolderID = id
+		} else if id < 0 {
+			// Group -1 holds sparks, which feedr does not have.
+			return nil
+		}
+		if before, err := strconv.ParseInt(form.Get("before"), 10, 64); err == nil && before > 0 {
+			q.PublishedBefore = before + 1
+		}
+		return model.MarkEntriesRead(ctx, q)
+	}
+	return nil
+}
+
+func feedsGroups(subs []model.Subscription) []feedsGroup {
+	byFolder := make(map[int64][]int64)
+	var order []int64
+	for _, s := range subs {
+		if s.FolderID == nil {
+			continue
+		}
+		if _, ok := byFolder[*s.FolderID]; !ok {
+			order = append(order, *s.FolderID)
+		}
+		byFolder[*s.FolderID] = append(byFolder[*s.FolderID], s.FeedID)
+	}
+	out := make([]feedsGroup, 0, len(order))
+	for _, id := range order {
+		out = append(out, feedsGroup{GroupID: id, FeedIDs: joinIDs(byFolder[id])})
+	}
+	return out
+}
+
+func joinIDs(ids []int64) string {
+	parts := make([]string, len(ids))
+	for i, id := range ids {
+		parts[i] = strconv.FormatInt(id, 10)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseIDs(s string) []int64 {
+	var ids []int64
+	for _, part := range strings.Split(s, ",") {
+		if id, err := strconv.ParseInt(strings.TrimSpace(part), 10, 64); err == nil {
+			ids = append(ids, id)
+		}
+	}
+	return ids
+}
+
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+func writeError(w http.ResponseWriter, msg string, err error) {
+	slog.Error("fever: "+msg, "error", err)
+	render.JSON(w, http.StatusInternalServerError, map[string]any{"api_version": apiVersion, "auth": 1})
+}
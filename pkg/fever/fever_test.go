@@ -0,0 +1,53 @@
+package fever
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/proxy"
+)
+
+func TestParseIDs(t *testing.T) {
+	got := parseIDs("1, 2,x,30")
+	want := []int64{1, 2, 30}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %v expected %v", got, want)
+	}
+	if s := joinIDs(want); s != "1,2,30" {
+		t.Errorf("got %s expected %s", s, "1,2,30")
+	}
+}
+
+func TestFeedsGroups(t *testing.T) {
+	news, tech := int64(1), int64(2)
+	subs := []model.Subscription{
+		{FeedID: 10, FolderID: &tech},
+		{FeedID: 11, FolderID: &news},
+		{FeedID: 12},
+		{FeedID: 13, FolderID: &tech},
+	}
+	got := feedsGroups(subs)
+	want := []feedsGroup{
+		{GroupID: 2, FeedIDs: "10,13"},
+		{GroupID: 1, FeedIDs: "11"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("got %+v expected %+v", got, want)
+	}
+}
+
+func TestItemProxiesImages(t *testing.T) {
+	if err := proxy.Configure(config.ProxyConfig{Enabled: true, Key: "secret"}, "https://feedr.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { proxy.Configure(config.ProxyConfig{Key: "secret"}, "") })
+
+	e := &model.UserEntry{Entry: model.Entry{ID: 1, FeedID: 2, Content: `<p><img src="https://tracker.example.com/pixel.png"></p>`}}
+	it := newItem(e)
+	if strings.Contains(it.HTML, "tracker.example.com") || !strings.Contains(it.HTML, "https://feedr.example.com"+proxy.Path) {
+		t.Errorf("html = %q, want the image proxied", it.HTML)
+	}
+}
@@ -0,0 +1,166 @@
+// Package greader implements the subset of the Google Reader API spoken by
+// mobile clients such as Reeder and FeedMe.
+package greader
+
+import (
+	"crypto/subtle"
+	"errors"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+// Mount registers the ClientLogin endpoint and the /reader/api/0 routes on r.
+func Mount(r chi.Router) {
+	r.Post("/accounts/ClientLogin", clientLogin)
+	r.Get("/accounts/ClientLogin", clientLogin)
+
+	r.Route("/reader/api/0", func(r chi.Router) {
+		r.Use(requireAuth)
+		r.Get("/token", token)
+		r.Get("/user-info", userInfo)
+		r.Get("/subscription/list", subscriptionList)
+		r.Get("/tag/list", tagList)
+		r.Get("/stream/contents", streamContents)
+		r.Get("/stream/contents/*", streamContents)
+		r.Get("/stream/items/ids", streamItemIDs)
+		r.Get("/stream/items/contents", streamItemContents)
+		r.Post("/stream/items/contents", streamItemContents)
+		r.With(requireActionToken).Post("/edit-tag", editTag)
+		r.With(requireActionToken).Post("/mark-all-as-read", markAllAsRead)
+	})
+}
+
+// clientLogin exchanges an email and password for an auth token.
+func clientLogin(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		render.Text(w, http.StatusBadRequest, "Error=BadRequest\n")
+		return
+	}
+	u, err := authenticate(r, r.Form.Get("Email"), r.Form.Get("Passwd"))
+	if err != nil {
+		if !errors.Is(err, model.ErrInvalidCredentials) && !errors.Is(err, model.ErrUserInactive) {
+			slog.Error("greader: authenticating user", "error", err)
+		}
+		render.Text(w, http.StatusUnauthorized, "Error=BadAuthentication\n")
+		return
+	}
+	auth, err := model.CreateReaderToken(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("greader: creating token", "error", err)
+		render.Text(w, http.StatusInternalServerError, "Error=Unknown\n")
+		return
+	}
+
+	if r.Form.Get("output") == "json" {
+		render.JSON(w, http.StatusOK, map[string]string{
+			"SID":  auth,
+			"LSID": auth,
+			"Auth": auth,
+		})
+		return
+	}
+	render.Text(w, http.StatusOK, "SID="+auth+"\nLSID="+auth+"\nAuth="+auth+"\n")
+}
+
+// authenticate checks ClientLogin credentials. Users with two-factor
+// authentication cannot log in with their password; they use a personal API
+// token holding the entries:write scope as password instead.
+func authenticate(r *http.Request, email, passwd string) (*model.User, error) {
+	ctx := r.Context()
+	if strings.HasPrefix(passwd, model.APITokenPrefix) {
+		t, u, err := model.GetAPIToken(ctx, passwd, r.RemoteAddr)
+		if err != nil || !strings.EqualFold(u.Email, strings.TrimSpace(email)) || !t.HasScope(model.ScopeEntriesWrite) {
+			return nil, model.ErrInvalidCredentials
+		}
+		return u, nil
+	}
+	u, err := model.Authenticate(ctx, email, passwd)
+	if err != nil {
+		return nil, err
+	}
+	enabled, err := model.HasTwoFactor(ctx, u.ID)
+	if err != nil {
+		return nil, err
+	}
+	if enabled {
+		return nil, model.ErrInvalidCredentials
+	}
+	return u, nil
+}
+
+// requireAuth resolves the "Authorization: GoogleLogin auth=<token>" header
+// to a user and stores it in the request context.
+func requireAuth(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		header := r.Header.Get("Authorization")
+		auth, ok := strings.CutPrefix(header, "GoogleLogin auth=")
+		if !ok || auth == "" {
+			w.Header().Set("Google-Bad-Token", "true")
+			render.Text(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		u, err := model.GetUserByReaderToken(r.Context(), strings.TrimSpace(auth))
+		if err != nil {
+			w.Header().Set("Google-Bad-Token", "true")
+			render.Text(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		ctx := model.WithUserContext(r.Context(), u)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// authToken returns the auth token of the request's Authorization header.
+func authToken(r *http.Request) string {
+	auth, _ := strings.CutPrefix(r.Header.Get("Authorization"), "GoogleLogin auth=")
+	return strings.TrimSpace(auth)
+}
+
+// actionToken returns the action token clients send back as "T" on write
+// calls. It is derived from the auth token rather than stored.
+func actionToken(auth string) string {
+	return model.HashToken(auth)[:57]
+}
+
+// token returns the action token of the request's auth token.
+func token(w http.ResponseWriter, r *http.Request) {
+	render.Text(w, http.StatusOK, actionToken(authToken(r)))
+}
+
+// requireActionToken rejects write calls whose "T" parameter is not the
+// action token of their auth token. Clients fetch a new action token when
+// the response carries X-Reader-Google-Bad-Token.
+func requireActionToken(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			render.Text(w, http.StatusBadRequest, "Bad Request")
+			return
+		}
+		t := r.Form.Get("T")
+		if t == "" || subtle.ConstantTimeCompare([]byte(t), []byte(actionToken(authToken(r)))) != 1 {
+			w.Header().Set("X-Reader-Google-Bad-Token", "true")
+			render.Text(w, http.StatusUnauthorized, "Unauthorized")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func userInfo(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	name := strings.TrimSpace(u.FirstName + " " + u.LastName)
+	if name == "" {
+		name = u.Username
+	}
+	render.JSON(w, http.StatusOK, map[string]any{
+		"userId":        u.ID,
+		"userName":      name,
+		"userProfileId": u.ID,
+		"userEmail":     u.Email,
+	})
+}
@@ -0,0 +1,466 @@
+package greader
+
+import (
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/proxy"
+	"github.com/swartzfoundation/feedr/pkg/render"
+	"gorm.io/gorm"
+)
+
+const (
+	defaultItemCount = 20
+	maxContentsCount = 1000
+	maxItemIDsCount  = 10000
+)
+
+type category struct {
+	ID    string `json:"id"`
+	Label string `json:"label,omitempty"`
+	Type  string `json:"type,omitempty"`
+}
+
+type subscription struct {
+	ID         string     `json:"id"`
+	Title      string     `json:"title"`
+	Categories []category `json:"categories"`
+	URL        string     `json:"url"`
+	HTMLURL    string     `json:"htmlUrl"`
+	IconURL    string     `json:"iconUrl"`
+}
+
+type link struct {
+	Href string `json:"href"`
+	Type string `json:"type,omitempty"`
+}
+
+type content struct {
+	Direction string `json:"direction"`
+	Content   string `json:"content"`
+}
+
+type origin struct {
+	StreamID string `json:"streamId"`
+	Title    string `json:"title"`
+	HTMLURL  string `json:"htmlUrl"`
+}
+
+type item struct {
+	ID            string      `json:"id"`
+	CrawlTimeMsec string      `json:"crawlTimeMsec"`
+	TimestampUsec string      `json:"timestampUsec"`
+	Published     int64       `json:"published"`
+	Updated       int64       `json:"updated"`
+	Title         string      `json:"title"`
+	Author        string      `json:"author,omitempty"`
+	Canonical     []link      `json:"canonical"`
+	Alternate     []link      `json:"alternate"`
+	Categories    []string    `json:"categories"`
+	Origin        origin      `json:"origin"`
+	Summary       content     `json:"summary"`
+	Enclosure     []enclosure `json:"enclosure,omitempty"`
+}
+
+type enclosure struct {
+	Href   string `json:"href"`
+	Type   string `json:"type,omitempty"`
+	Length string `json:"length,omitempty"`
+}
+
+type itemRef struct {
+	ID string `json:"id"`
+}
+
+func subscriptionList(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	subs, err := model.ListSubscriptions(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("greader: listing subscriptions", "error", err)
+		render.Text(w, http.StatusInternalServerError, "Error")
+		return
+	}
+	out := make([]subscription, 0, len(subs))
+	for _, s := range subs {
+		categories := []category{}
+		if s.Folder != nil {
+			categories = append(categories, category{ID: formatLabelStream(s.Folder.Name), Label: s.Folder.Name})
+		}
+		out = append(out, subscription{
+			ID:         formatFeedStream(s.FeedID),
+			Title:      s.DisplayTitle(),
+			Categories: categories,
+			URL:        s.Feed.URL,
+			HTMLURL:    s.Feed.SiteURL,
+		})
+	}
+	render.JSON(w, http.StatusOK, map[string]any{"subscriptions": out})
+}
+
+func tagList(w http.ResponseWriter, r *http.Request) {
+	u := model.UserFromContext(r.Context())
+	folders, err := model.ListFolders(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("greader: listing folders", "error", err)
+		render.Text(w, http.StatusInternalServerError, "Error")
+		return
+	}
+	tags := []category{{ID: streamStarred}}
+	for _, f := range folders {
+		tags = append(tags, category{ID: formatLabelStream(f.Name), Label: f.Name, Type: "folder"})
+	}
+	render.JSON(w, http.StatusOK, map[string]any{"tags": tags})
+}
+
+// errUnknownStream is returned for stream IDs that do not map to anything
+// the user can read.
+var errUnknownStream = errors.New("greader: unknown stream")
+
+// buildQuery translates the stream and the standard stream parameters into
+// an entry query.
+func buildQuery(r *http.Request, user *model.User, streamID string, maxCount int) (model.EntryQuery, error) {
+	q := model.EntryQuery{UserID: user.ID}
+	if err := applyStream(r, &q, streamID); err != nil {
+		return q, err
+	}
+	form := r.Form
+
+	q.Limit = defaultItemCount
+	if n, err := strconv.Atoi(form.Get("n")); err == nil && n > 0 {
+		q.Limit = min(n, maxCount)
+	}
+	if c, err := strconv.Atoi(form.Get("c")); err == nil && c > 0 {
+		q.Offset = c
+	}
+	q.Ascending = form.Get("r") == "o"
+	if ot, err := strconv.ParseInt(form.Get("ot"), 10, 64); err == nil && ot > 0 {
+		q.PublishedAfter = ot - 1
+	}
+	if nt, err := strconv.ParseInt(form.Get("nt"), 10, 64); err == nil && nt > 0 {
+		q.PublishedBefore = nt + 1
+	}
+	for _, target := range form["xt"] {
+		switch parseStream(target).kind {
+		case streamKindRead:
+			unread := false
+			q.Read = &unread
+		case streamKindStarred:
+			unstarred := false
+			q.Starred = &unstarred
+		}
+	}
+	for _, target := range form["it"] {
+		if err := applyStream(r, &q, target); err != nil {
+			return q, err
+		}
+	}
+	return q, nil
+}
+
+func applyStream(r *http.Request, q *model.EntryQuery, streamID string) error {
+	s := parseStream(streamID)
+	switch s.kind {
+	case streamKindReadingList:
+	case streamKindRead:
+		read := true
+		q.Read = &read
+	case streamKindKeptUnread:
+		unread := false
+		q.Read = &unread
+	case streamKindStarred:
+		starred := true
+		q.Starred = &starred
+	case streamKindFeed:
+		q.FeedID = s.feedID
+	case streamKindLabel:
+		f, err := model.GetFolderByName(r.Context(), q.UserID, s.label)
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				return errUnknownStream
+			}
+			return err
+		}
+		q.FolderID = f.ID
+	default:
+		return errUnknownStream
+	}
+	return nil
+}
+
+// streamParam returns the stream ID from the "s" parameter or from the path
+// of /stream/contents/<stream>.
+func streamParam(r *http.Request) string {
+	if s := r.Form.Get("s"); s != "" {
+		return s
+	}
+	if s := chi.URLParam(r, "*"); s != "" {
+		if unescaped, err := url.PathUnescape(s); err == nil {
+			return unescaped
+		}
+		return s
+	}
+	return streamReadingList
+}
+
+func streamContents(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		render.Text(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	streamID := streamParam(r)
+	q, err := buildQuery(r, u, streamID, maxContentsCount)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	entries, err := model.ListEntries(r.Context(), q)
+	if err != nil {
+		slog.Error("greader: listing entries", "error", err)
+		render.Text(w, http.StatusInternalServerError, "Error")
+		return
+	}
+	writeItems(w, r, u, streamID, entries, continuation(q, len(entries)))
+}
+
+func streamItemIDs(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		render.Text(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	q, err := buildQuery(r, u, streamParam(r), maxItemIDsCount)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	ids, err := model.ListEntryIDs(r.Context(), q)
+	if err != nil {
+		slog.Error("greader: listing entry ids", "error", err)
+		render.Text(w, http.StatusInternalServerError, "Error")
+		return
+	}
+	refs := make([]itemRef, 0, len(ids))
+	for _, id := range ids {
+		refs = append(refs, itemRef{ID: strconv.FormatInt(id, 10)})
+	}
+	resp := map[string]any{"itemRefs": refs}
+	if c := continuation(q, len(ids)); c != "" {
+		resp["continuation"] = c
+	}
+	render.JSON(w, http.StatusOK, resp)
+}
+
+// streamItemContents returns the items listed in the "i" parameters.
+func streamItemContents(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		render.Text(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	ids, err := parseItemIDs(r.Form["i"])
+	if err != nil {
+		render.Text(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	var entries []model.UserEntry
+	if len(ids) > 0 {
+		entries, err = model.ListEntries(r.Context(), model.EntryQuery{UserID: u.ID, EntryIDs: ids})
+		if err != nil {
+			slog.Error("greader: listing entries", "error", err)
+			render.Text(w, http.StatusInternalServerError, "Error")
+			return
+		}
+	}
+	writeItems(w, r, u, streamReadingList, entries, "")
+}
+
+func editTag(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		render.Text(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	ids, err := parseItemIDs(r.Form["i"])
+	if err != nil || len(ids) == 0 {
+		render.Text(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+
+	apply := func(tags []string, add bool) error {
+		for _, tag := range tags {
+			var err error
+			switch parseStream(tag).kind {
+			case streamKindRead:
+				err = model.SetEntriesRead(r.Context(), u.ID, ids, add)
+			case streamKindKeptUnread:
+				err = model.SetEntriesRead(r.Context(), u.ID, ids, !add)
+			case streamKindStarred:
+				err = model.SetEntriesStarred(r.Context(), u.ID, ids, add)
+			}
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	if err := apply(r.Form["a"], true); err != nil {
+		slog.Error("greader: adding tags", "error", err)
+		render.Text(w, http.StatusInternalServerError, "Error")
+		return
+	}
+	if err := apply(r.Form["r"], false); err != nil {
+		slog.Error("greader: removing tags", "error", err)
+		render.Text(w, http.StatusInternalServerError, "Error")
+		return
+	}
+	render.Text(w, http.StatusOK, "OK")
+}
+
+func markAllAsRead(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		render.Text(w, http.StatusBadRequest, "Bad Request")
+		return
+	}
+	u := model.UserFromContext(r.Context())
+	q := model.EntryQuery{UserID: u.ID}
+	if err := applyStream(r, &q, r.Form.Get("s")); err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	// ts is in microseconds; only entries published up to it are marked.
+	if ts, err := strconv.ParseInt(r.Form.Get("ts"), 10, 64); err == nil && ts > 0 {
+		q.PublishedBefore = ts/int64(time.Second/time.Microsecond) + 1
+	}
+	if err := model.MarkEntriesRead(r.Context(), q); err != nil {
+		slog.Error("greader: marking all as read", "error", err)
+		render.Text(w, http.StatusInternalServerError, "Error")
+		return
+	}
+	render.Text(w, http.StatusOK, "OK")
+}
+
+func writeQueryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, errUnknownStream) {
+		render.Text(w, http.StatusBadRequest, "Unknown stream")
+		return
+	}
+	slog.Error("greader: building query", "error", err)
+	render.Text(w, http.StatusInternalServerError, "Error")
+}
+
+// continuation returns the offset of the next page, or "" when the current
+// page was not full.
+func continuation(q model.EntryQuery, n int) string {
+	if q.Limit == 0 || n < q.Limit {
+		return ""
+	}
+	return strconv.Itoa(q.Offset + n)
+}
+
+func writeItems(w http.ResponseWriter, r *http.Request, u *model.User, streamID string, entries []model.UserEntry, cont string) {
+	subs, err := model.ListSubscriptions(r.Context(), u.ID)
+	if err != nil {
+		slog.Error("greader: listing subscriptions", "error", err)
+		render.Text(w, http.StatusInternalServerError, "Error")
+		return
+	}
+	byFeed := make(map[int64]model.Subscription, len(subs))
+	for _, s := range subs {
+		byFeed[s.FeedID] = s
+	}
+	ids := make([]int64, len(entries))
+	for i, e := range entries {
+		ids[i] = e.ID
+	}
+	enclosures, err := model.ListEnclosures(r.Context(), ids)
+	if err != nil {
+		slog.Error("greader: listing enclosures", "error", err)
+		render.Text(w, http.StatusInternalServerError, "Error")
+		return
+	}
+
+	items := make([]item, 0, len(entries))
+	for i := range entries {
+		e := &entries[i]
+		sub := byFeed[e.FeedID]
+		items = append(items, newItem(e, &sub, enclosures[e.ID]))
+	}
+
+	resp := map[string]any{
+		"direction": "ltr",
+		"id":        streamID,
+		"title":     streamTitle(streamID, byFeed),
+		"self":      []link{{Href: r.URL.String()}},
+		"updated":   time.Now().Unix(),
+		"items":     items,
+	}
+	if cont != "" {
+		resp["continuation"] = cont
+	}
+	render.JSON(w, http.StatusOK, resp)
+}
+
+// newItem returns the item of e, an entry of sub, its images going through
+// the image proxy.
+func newItem(e *model.UserEntry, sub *model.Subscription, enclosures []model.Enclosure) item {
+	categories := []string{streamReadingList}
+	if e.IsRead {
+		categories = append(categories, streamRead)
+	}
+	if e.IsStarred {
+		categories = append(categories, streamStarred)
+	}
+	if sub.Folder != nil {
+		categories = append(categories, formatLabelStream(sub.Folder.Name))
+	}
+	var encs []enclosure
+	for _, enc := range enclosures {
+		ge := enclosure{Href: enc.URL, Type: enc.MimeType}
+		if enc.Length > 0 {
+			ge.Length = strconv.FormatInt(enc.Length, 10)
+		}
+		encs = append(encs, ge)
+	}
+	return item{
+		ID:            formatItemID(e.ID),
+		CrawlTimeMsec: strconv.FormatInt(e.CreatedAt*1000, 10),
+		TimestampUsec: strconv.FormatInt(e.PublishedAt*1000000, 10),
+		Published:     e.PublishedAt,
+		Updated:       e.UpdatedAt,
+		Title:         e.Title,
+		Author:        e.Author,
+		Canonical:     []link{{Href: e.URL}},
+		Alternate:     []link{{Href: e.URL, Type: "text/html"}},
+		Categories:    categories,
+		Origin: origin{
+			StreamID: formatFeedStream(e.FeedID),
+			Title:    sub.DisplayTitle(),
+			HTMLURL:  sub.Feed.SiteURL,
+		},
+		Summary:   content{Direction: "ltr", Content: proxy.RewriteHTML(e.Content)},
+		Enclosure: encs,
+	}
+}
+
+func streamTitle(streamID string, byFeed map[int64]model.Subscription) string {
+	s := parseStream(streamID)
+	switch s.kind {
+	case streamKindFeed:
+		if sub, ok := byFeed[s.feedID]; ok {
+			return sub.DisplayTitle()
+		}
+	case streamKindLabel:
+		return s.label
+	case streamKindStarred:
+		return "Starred"
+	}
+	return strings.TrimPrefix(streamID, "user/-/state/com.google/")
+}
@@ -0,0 +1,108 @@
+package greader
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/proxy"
+)
+
+// post builds a form POST authenticated with the auth token "secret".
+func post(path string, form url.Values) *http.Request {
+	r := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("Authorization", "GoogleLogin auth=secret")
+	u := &model.User{ID: "u1", IsActive: true}
+	return r.WithContext(model.WithUserContext(r.Context(), u))
+}
+
+func TestMountRequiresAuth(t *testing.T) {
+	r := chi.NewRouter()
+	Mount(r)
+	for _, path := range []string{"/reader/api/0/edit-tag", "/reader/api/0/mark-all-as-read"} {
+		req := httptest.NewRequest(http.MethodPost, path, nil)
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized || w.Header().Get("Google-Bad-Token") != "true" {
+			t.Errorf("POST %s without auth = %d, want 401", path, w.Code)
+		}
+	}
+}
+
+func TestToken(t *testing.T) {
+	w := httptest.NewRecorder()
+	token(w, post("/reader/api/0/token", nil))
+	if got := w.Body.String(); got != actionToken("secret") || len(got) != 57 {
+		t.Errorf("token = %q, want the action token of the auth token", got)
+	}
+}
+
+func TestRequireActionToken(t *testing.T) {
+	tests := []struct {
+		name string
+		t    string
+		want int
+	}{
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong", actionToken("other"), http.StatusUnauthorized},
+		{"valid", actionToken("secret"), http.StatusNoContent},
+	}
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			form := url.Values{"i": {"42"}}
+			if tt.t != "" {
+				form.Set("T", tt.t)
+			}
+			w := httptest.NewRecorder()
+			requireActionToken(next).ServeHTTP(w, post("/reader/api/0/edit-tag", form))
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d", w.Code, tt.want)
+			}
+			if bad := w.Header().Get("X-Reader-Google-Bad-Token") == "true"; bad != (tt.want == http.StatusUnauthorized) {
+				t.Errorf("X-Reader-Google-Bad-Token set = %v", bad)
+			}
+		})
+	}
+}
+
+func TestEditTagRequiresItems(t *testing.T) {
+	for _, ids := range [][]string{nil, {"zz"}} {
+		form := url.Values{"T": {actionToken("secret")}, "a": {"user/-/state/com.google/read"}, "i": ids}
+		w := httptest.NewRecorder()
+		editTag(w, post("/reader/api/0/edit-tag", form))
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("edit-tag with items %q = %d, want 400", ids, w.Code)
+		}
+	}
+}
+
+func TestMarkAllAsReadUnknownStream(t *testing.T) {
+	form := url.Values{"T": {actionToken("secret")}, "s": {"bogus"}}
+	w := httptest.NewRecorder()
+	markAllAsRead(w, post("/reader/api/0/mark-all-as-read", form))
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("mark-all-as-read of an unknown stream = %d, want 400", w.Code)
+	}
+}
+
+func TestItemProxiesImages(t *testing.T) {
+	if err := proxy.Configure(config.ProxyConfig{Enabled: true, Key: "secret"}, "https://feedr.example.com"); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { proxy.Configure(config.ProxyConfig{Key: "secret"}, "") })
+
+	e := &model.UserEntry{Entry: model.Entry{ID: 1, FeedID: 2, Content: `<p><img src="https://tracker.example.com/pixel.png"></p>`}}
+	it := newItem(e, &model.Subscription{FeedID: 2}, nil)
+	if strings.Contains(it.Summary.Content, "tracker.example.com") || !strings.Contains(it.Summary.Content, "https://feedr.example.com"+proxy.Path) {
+		t.Errorf("summary = %q, want the image proxied", it.Summary.Content)
+	}
+}
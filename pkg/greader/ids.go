@@ -0,0 +1,119 @@
+package greader
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const (
+	itemIDPrefix = "tag:google.com,2005:reader/item/"
+
+	feedStreamPrefix  = "feed/"
+	labelStreamPrefix = "user/-/label/"
+
+	streamReadingList = "user/-/state/com.google/reading-list"
+	streamRead        = "user/-/state/com.google/read"
+	streamStarred     = "user/-/state/com.google/starred"
+	streamKeptUnread  = "user/-/state/com.google/kept-unread"
+)
+
+var errInvalidItemID = errors.New("greader: invalid item id")
+
+// streamKind identifies what a stream ID refers to.
+type streamKind int
+
+const (
+	streamKindUnknown streamKind = iota
+	streamKindReadingList
+	streamKindRead
+	streamKindStarred
+	streamKindKeptUnread
+	streamKindFeed
+	streamKindLabel
+)
+
+type stream struct {
+	kind   streamKind
+	feedID int64
+	label  string
+}
+
+// formatItemID returns the long form of an item ID.
+func formatItemID(id int64) string {
+	return fmt.Sprintf("%s%016x", itemIDPrefix, id)
+}
+
+// parseItemID accepts the long form ("tag:google.com,2005:reader/item/<hex>"),
+// the bare 16 digit hex form and the short decimal form of an item ID.
+func parseItemID(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if hex, ok := strings.CutPrefix(s, itemIDPrefix); ok {
+		id, err := strconv.ParseUint(hex, 16, 64)
+		if err != nil {
+			return 0, errInvalidItemID
+		}
+		return int64(id), nil
+	}
+	if len(s) == 16 {
+		if id, err := strconv.ParseUint(s, 16, 64); err == nil {
+			return int64(id), nil
+		}
+	}
+	id, err := strconv.ParseInt(s, 10, 64)
+	if err != nil {
+		return 0, errInvalidItemID
+	}
+	return id, nil
+}
+
+// parseItemIDs parses every ID in ids.
+func parseItemIDs(ids []string) ([]int64, error) {
+	out := make([]int64, 0, len(ids))
+	for _, s := range ids {
+		id, err := parseItemID(s)
+		if err != nil {
+			return nil, err
+		}
+		out = append(out, id)
+	}
+	return out, nil
+}
+
+func formatFeedStream(feedID int64) string {
+	return feedStreamPrefix + strconv.FormatInt(feedID, 10)
+}
+
+func formatLabelStream(name string) string {
+	return labelStreamPrefix + name
+}
+
+// parseStream parses a stream ID. The "user/<id>/" form used by some clients
+// is normalised to "user/-/".
+func parseStream(s string) stream {
+	if rest, ok := strings.CutPrefix(s, "user/"); ok {
+		if i := strings.IndexByte(rest, '/'); i >= 0 {
+			s = "user/-" + rest[i:]
+		}
+	}
+	switch s {
+	case streamReadingList:
+		return stream{kind: streamKindReadingList}
+	case streamRead:
+		return stream{kind: streamKindRead}
+	case streamStarred:
+		return stream{kind: streamKindStarred}
+	case streamKeptUnread:
+		return stream{kind: streamKindKeptUnread}
+	}
+	if rest, ok := strings.CutPrefix(s, feedStreamPrefix); ok {
+		if id, err := strconv.ParseInt(rest, 10, 64); err == nil {
+			return stream{kind: streamKindFeed, feedID: id}
+		}
+	}
+	if rest, ok := strings.CutPrefix(s, labelStreamPrefix); ok && rest != "" {
+		return stream{kind: streamKindLabel, label: rest}
+	}
+	return stream{kind: streamKindUnknown}
+}
@@ -0,0 +1,53 @@
+package greader
+
+import "testing"
+
+func TestParseItemID(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  int64
+	}{
+		{"tag:google.com,2005:reader/item/000000000000002a", 42},
+		{"000000000000002a", 42},
+		{"42", 42},
+		{formatItemID(1234567), 1234567},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			got, err := parseItemID(tt.input)
+			if err != nil {
+				t.Fatalf("parseItemID(%q) returned error %v", tt.input, err)
+			}
+			if got != tt.want {
+				t.Errorf("got %d expected %d", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := parseItemID("tag:google.com,2005:reader/item/zz"); err == nil {
+		t.Errorf("expected error for invalid long form id")
+	}
+}
+
+func TestParseStream(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  stream
+	}{
+		{"user/-/state/com.google/reading-list", stream{kind: streamKindReadingList}},
+		{"user/1234/state/com.google/starred", stream{kind: streamKindStarred}},
+		{"user/-/state/com.google/read", stream{kind: streamKindRead}},
+		{"feed/12", stream{kind: streamKindFeed, feedID: 12}},
+		{"user/-/label/Tech News", stream{kind: streamKindLabel, label: "Tech News"}},
+		{"feed/not-a-number", stream{kind: streamKindUnknown}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			if got := parseStream(tt.input); got != tt.want {
+				t.Errorf("got %+v expected %+v", got, tt.want)
+			}
+		})
+	}
+}
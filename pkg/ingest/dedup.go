@@ -0,0 +1,112 @@
+package ingest
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/dedup"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+)
+
+// clusterWindow is how far back entries are compared by content with new
+// ones; stories are syndicated within a few days.
+const clusterWindow = 72 * time.Hour
+
+// listDuplicateCandidates looks up the stored entries new ones are compared
+// with. Tests replace it.
+var listDuplicateCandidates = model.ListDuplicateCandidates
+
+// fingerprint sets the canonical URL and the text fingerprint of e.
+func fingerprint(e *model.Entry) {
+	e.CanonicalURL = dedup.CanonicalURL(e.URL)
+	h := dedup.SimHash(e.Title + " " + sanitize.Text(e.Content))
+	e.SimHash = int64(h)
+	b := dedup.SplitBands(h)
+	e.SimBand0, e.SimBand1, e.SimBand2, e.SimBand3 = b[0], b[1], b[2], b[3]
+}
+
+// sameStory reports whether the entries tell the same story: they link to
+// the same page, other than a site's home page, or their texts are near
+// duplicates.
+func sameStory(e *model.Entry, c *model.DuplicateCandidate) bool {
+	if e.CanonicalURL != "" && e.CanonicalURL == c.CanonicalURL && !dedup.IsRoot(e.CanonicalURL) {
+		return true
+	}
+	return dedup.Similar(uint64(e.SimHash), uint64(c.SimHash))
+}
+
+// republished reports whether e is an entry of the same feed published
+// again under a new GUID. Feeds may link every item to the same page, so
+// the texts must match too.
+func republished(e *model.Entry, c *model.DuplicateCandidate) bool {
+	if e.CanonicalURL == "" || e.CanonicalURL != c.CanonicalURL {
+		return false
+	}
+	return dedup.Similar(uint64(e.SimHash), uint64(c.SimHash)) || (e.Title != "" && e.Title == c.Title)
+}
+
+// deduplicate drops the entries f already published under another GUID
+// and assigns the others to the cluster of the first matching entry of
+// another feed. It returns the entries to store and the IDs of stored
+// entries that start a new cluster.
+func deduplicate(ctx context.Context, f *model.Feed, entries []*model.Entry) ([]*model.Entry, []int64, error) {
+	var (
+		urls  []string
+		bands [][4]int32
+	)
+	for _, e := range entries {
+		fingerprint(e)
+		if e.CanonicalURL != "" {
+			urls = append(urls, e.CanonicalURL)
+		}
+		if e.SimHash != 0 {
+			bands = append(bands, dedup.SplitBands(uint64(e.SimHash)))
+		}
+	}
+	since := time.Now().Add(-clusterWindow).Unix()
+	candidates, err := listDuplicateCandidates(ctx, urls, bands, since)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		kept    []*model.Entry
+		started []int64
+	)
+	for _, e := range entries {
+		duplicate := false
+		for i := range candidates {
+			c := &candidates[i]
+			if c.FeedID == f.ID {
+				if republished(e, c) {
+					duplicate = true
+					break
+				}
+				continue
+			}
+			if e.ClusterID == 0 && sameStory(e, c) {
+				if c.ClusterID == 0 {
+					c.ClusterID = c.ID
+					started = append(started, c.ID)
+				}
+				e.ClusterID = c.ClusterID
+			}
+		}
+		if duplicate {
+			slog.Debug("ingest: dropping republished entry", "feed", f.ID, "guid", e.GUID)
+			continue
+		}
+		kept = append(kept, e)
+		// Entries of the same document are compared with each other.
+		candidates = append(candidates, model.DuplicateCandidate{
+			FeedID:       f.ID,
+			ClusterID:    e.ClusterID,
+			Title:        e.Title,
+			CanonicalURL: e.CanonicalURL,
+			SimHash:      e.SimHash,
+		})
+	}
+	return kept, started, nil
+}
@@ -0,0 +1,122 @@
+package ingest
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/swartzfoundation/feedr/model"
+)
+
+const story = "The city council approved the new budget on Tuesday after a long debate " +
+	"about funding for public transport, schools and the maintenance of roads across the region."
+
+func entry(guid, url, title, content string) *model.Entry {
+	e := &model.Entry{GUID: guid, URL: url, Title: title, Content: content}
+	fingerprint(e)
+	return e
+}
+
+func candidate(id, feedID int64, e *model.Entry) model.DuplicateCandidate {
+	return model.DuplicateCandidate{
+		ID:           id,
+		FeedID:       feedID,
+		Title:        e.Title,
+		CanonicalURL: e.CanonicalURL,
+		SimHash:      e.SimHash,
+	}
+}
+
+func TestSameStory(t *testing.T) {
+	e := entry("1", "https://news.example.com/budget?utm_source=rss", "Budget approved", story)
+	var tests = []struct {
+		name  string
+		other *model.Entry
+		want  bool
+	}{
+		{"same page", entry("2", "https://news.example.com/budget", "Other title", "Short."), true},
+		{"same text", entry("3", "https://wire.example.org/1", "Budget approved", strings.ToUpper(story)), true},
+		{"home page", entry("4", "https://news.example.com/", "Other", "Short."), false},
+		{"different story", entry("5", "https://other.example.org/2", "Weather", "Sunny skies are expected all week long with mild temperatures and light winds from the south across the whole country."), false},
+	}
+	for _, tt := range tests {
+		c := candidate(1, 2, tt.other)
+		if got := sameStory(e, &c); got != tt.want {
+			t.Errorf("%s: sameStory = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	home := entry("6", "https://news.example.com/", "Home", "Short.")
+	c := candidate(1, 2, entry("7", "https://news.example.com", "Home", "Short."))
+	if sameStory(home, &c) {
+		t.Error("entries linking to a home page are not the same story")
+	}
+}
+
+func TestRepublished(t *testing.T) {
+	e := entry("new-guid", "https://blog.example.com/post", "Post", "Short text.")
+	var tests = []struct {
+		name  string
+		other *model.Entry
+		want  bool
+	}{
+		{"same page and title", entry("old-guid", "https://blog.example.com/post", "Post", "Other text."), true},
+		{"same page, other title", entry("old-guid", "https://blog.example.com/post", "Other", "Other text."), false},
+		{"other page", entry("old-guid", "https://blog.example.com/other", "Post", "Short text."), false},
+	}
+	for _, tt := range tests {
+		c := candidate(1, 1, tt.other)
+		if got := republished(e, &c); got != tt.want {
+			t.Errorf("%s: republished = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+
+	long := entry("a", "https://blog.example.com/daily", "Monday", story)
+	c := candidate(1, 1, entry("b", "https://blog.example.com/daily", "Tuesday", story))
+	if !republished(long, &c) {
+		t.Error("expected the same text under a new title to be republished")
+	}
+	c = candidate(1, 1, entry("b", "https://blog.example.com/daily", "Tuesday", "Something else entirely."))
+	if republished(long, &c) {
+		t.Error("expected other items linking to the same page to be kept")
+	}
+}
+
+func TestDeduplicate(t *testing.T) {
+	f := &model.Feed{ID: 1}
+	stored := []model.DuplicateCandidate{
+		candidate(10, 1, entry("old", "https://blog.example.com/post", "Post", "Short.")),
+		candidate(20, 2, entry("x", "https://wire.example.org/budget", "Budget", story)),
+		candidate(30, 3, entry("y", "https://other.example.org/budget", "Budget", story)),
+	}
+	stored[2].ClusterID = 20
+	var gotURLs []string
+	var gotBands [][4]int32
+	listDuplicateCandidates = func(ctx context.Context, urls []string, bands [][4]int32, since int64) ([]model.DuplicateCandidate, error) {
+		gotURLs, gotBands = urls, bands
+		return append([]model.DuplicateCandidate(nil), stored...), nil
+	}
+	defer func() { listDuplicateCandidates = model.ListDuplicateCandidates }()
+
+	republishedEntry := entry("new", "https://blog.example.com/post", "Post", "Short.")
+	syndicated := entry("budget", "https://blog.example.com/budget", "Budget", story)
+	fresh := entry("fresh", "https://blog.example.com/fresh", "Fresh", "Short.")
+	again := entry("fresh-2", "https://blog.example.com/fresh", "Fresh", "Short.")
+
+	kept, started, err := deduplicate(context.Background(), f, []*model.Entry{republishedEntry, syndicated, fresh, again})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(gotURLs) != 4 || len(gotBands) != 1 {
+		t.Errorf("looked up %d URLs and %d fingerprints, want 4 and 1", len(gotURLs), len(gotBands))
+	}
+	if len(kept) != 2 || kept[0] != syndicated || kept[1] != fresh {
+		t.Fatalf("unexpected kept entries %+v", kept)
+	}
+	if syndicated.ClusterID != 20 || len(started) != 1 || started[0] != 20 {
+		t.Errorf("expected the entry to join the cluster started by entry 20, got cluster %d and started %v", syndicated.ClusterID, started)
+	}
+	if fresh.ClusterID != 0 {
+		t.Errorf("expected a new story to stay out of clusters, got %d", fresh.ClusterID)
+	}
+}
@@ -0,0 +1,162 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+	"github.com/swartzfoundation/feedr/pkg/readability"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+	"github.com/swartzfoundation/feedr/pkg/scraper"
+)
+
+var ErrNotHTML = errors.New("ingest: entry link is not an HTML page")
+
+// Extract fetches the page at pageURL and returns its readable article,
+// applying the scraper rule of the page's domain.
+func Extract(ctx context.Context, pageURL string) (*readability.Article, error) {
+	pageURL = scraper.Default.RewriteURL(pageURL)
+	req := fetch.Request{
+		URL:    pageURL,
+		Accept: "text/html,application/xhtml+xml;q=0.9,*/*;q=0.1",
+		Client: fetch.PublicClient,
+	}
+	var opts readability.Options
+	if rule := scraper.Default.Lookup(pageURL); rule != nil {
+		req.Header = rule.Header()
+		opts = rule.Options()
+	}
+	resp, err := fetch.Get(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	ct := strings.ToLower(resp.ContentType)
+	if ct != "" && !strings.Contains(ct, "html") {
+		return nil, ErrNotHTML
+	}
+	return readability.ExtractWith(resp.Body, resp.URL, opts)
+}
+
+// LinkRewriter is a Processor applying the scraper rules' URL rewrites to
+// the links of new entries, such as AMP to canonical pages.
+type LinkRewriter struct{}
+
+func (LinkRewriter) Process(ctx context.Context, f *model.Feed, e *model.Entry) error {
+	if e.URL != "" {
+		e.URL = scraper.Default.RewriteURL(e.URL)
+	}
+	return nil
+}
+
+// ExtractEntry fetches the link of e and stores its readable article,
+// cleaned by the sanitizer. The article's image becomes the entry's when it
+// has none.
+func ExtractEntry(ctx context.Context, e *model.Entry) error {
+	a, err := Extract(ctx, e.URL)
+	if err != nil {
+		return err
+	}
+	content := sanitize.HTML(a.Content, e.URL)
+	var imageURL string
+	if e.ImageURL == "" {
+		imageURL = sanitize.URL(a.ImageURL, e.URL)
+	}
+	if err := model.SetEntryExtraction(ctx, e.ID, a.Content, content, imageURL); err != nil {
+		return err
+	}
+	e.ExtractedContent = content
+	e.ExtractedAt = time.Now().Unix()
+	if imageURL != "" {
+		e.ImageURL = imageURL
+	}
+	return nil
+}
+
+const (
+	// extractBatch is the number of entries extracted per round.
+	extractBatch = 100
+	// extractPerFeed bounds the entries of one feed extracted per round, so
+	// that a feed publishing many items does not hold up the others.
+	extractPerFeed = 10
+	// extractWindow is the age of the oldest entries extracted.
+	extractWindow = 2 * 24 * time.Hour
+)
+
+// Extractor stores the readable article of new entries whose feed has at
+// least one subscriber that enabled extraction. It runs apart from
+// ingestion, so that slow websites do not hold up polls and pushes.
+type Extractor struct {
+	Interval time.Duration
+	// Workers is the number of pages fetched concurrently.
+	Workers int
+}
+
+// NewExtractor returns an extractor checking for new entries every minute.
+func NewExtractor() *Extractor {
+	return &Extractor{Interval: time.Minute, Workers: 4}
+}
+
+// Run extracts articles until ctx is cancelled.
+func (x *Extractor) Run(ctx context.Context) {
+	ticker := time.NewTicker(x.Interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := x.extract(ctx)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					slog.Error("ingest: extracting articles", "error", err)
+				}
+				break
+			}
+			if n < extractBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// extract stores the articles of a batch of entries and returns its size.
+// Entries whose page cannot be extracted are skipped for good.
+func (x *Extractor) extract(ctx context.Context) (int, error) {
+	after := time.Now().Add(-extractWindow).Unix()
+	entries, err := model.ListEntriesToExtract(ctx, after, extractPerFeed, extractBatch)
+	if err != nil {
+		return 0, err
+	}
+
+	jobs := make(chan *model.Entry)
+	var wg sync.WaitGroup
+	for range max(x.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for e := range jobs {
+				err := ExtractEntry(ctx, e)
+				if err == nil || ctx.Err() != nil {
+					continue
+				}
+				slog.Warn("ingest: extracting article", "entry", e.ID, "url", e.URL, "error", err)
+				if err := model.SkipEntryExtraction(ctx, e.ID); err != nil {
+					slog.Error("ingest: marking extraction", "entry", e.ID, "error", err)
+				}
+			}
+		}()
+	}
+	for i := range entries {
+		jobs <- &entries[i]
+	}
+	close(jobs)
+	wg.Wait()
+	return len(entries), ctx.Err()
+}
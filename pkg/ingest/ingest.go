@@ -0,0 +1,167 @@
+// Package ingest turns parsed feed items into stored entries. Items pass
+// through a pipeline of processors before they are stored, which lets
+// features such as link rewriting enrich new entries.
+package ingest
+
+import (
+	"context"
+	"log/slog"
+	"strings"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/dedup"
+	"github.com/swartzfoundation/feedr/pkg/feed"
+)
+
+// Processor enriches a new entry before it is stored. Errors are logged and
+// do not prevent the entry from being stored.
+type Processor interface {
+	Process(ctx context.Context, f *model.Feed, e *model.Entry) error
+}
+
+// ProcessorFunc adapts a function to the Processor interface.
+type ProcessorFunc func(ctx context.Context, f *model.Feed, e *model.Entry) error
+
+func (fn ProcessorFunc) Process(ctx context.Context, f *model.Feed, e *model.Entry) error {
+	return fn(ctx, f, e)
+}
+
+// Hook is notified of the entries a pipeline stored, such as to apply the
+// users' filter rules. Errors are logged.
+type Hook interface {
+	Stored(ctx context.Context, f *model.Feed, entries []*model.Entry) error
+}
+
+// Pipeline runs new entries through its processors in the order they were
+// added, then passes the stored entries to its hooks.
+type Pipeline struct {
+	processors []Processor
+	hooks      []Hook
+}
+
+// Use appends processors to the pipeline.
+func (p *Pipeline) Use(processors ...Processor) {
+	p.processors = append(p.processors, processors...)
+}
+
+// OnStored appends hooks to the pipeline.
+func (p *Pipeline) OnStored(hooks ...Hook) {
+	p.hooks = append(p.hooks, hooks...)
+}
+
+// Ingest stores the items of f that are not stored yet and returns the new
+// entries.
+func (p *Pipeline) Ingest(ctx context.Context, f *model.Feed, items []feed.Item) ([]*model.Entry, error) {
+	guids := make([]string, 0, len(items))
+	lookup := make([]string, 0, len(items))
+	for _, it := range items {
+		guid := entryGUID(it)
+		guids = append(guids, guid)
+		// Entries stored before links were canonicalized use the raw one.
+		lookup = append(lookup, guid, it.GUID)
+	}
+	existing, err := model.ExistingEntryGUIDs(ctx, f.ID, lookup)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().Unix()
+	var entries []*model.Entry
+	for i, it := range items {
+		guid := guids[i]
+		if guid == "" || existing[guid] || existing[it.GUID] {
+			continue
+		}
+		// Feeds occasionally repeat an item within one document.
+		existing[guid] = true
+
+		e := &model.Entry{
+			FeedID:      f.ID,
+			GUID:        guid,
+			URL:         it.URL,
+			Title:       it.Title,
+			Author:      it.Author,
+			Content:     it.Content,
+			Source:      &model.EntrySource{Content: it.Content},
+			Categories:  it.Categories,
+			ImageURL:    it.ImageURL,
+			PublishedAt: now,
+			UpdatedAt:   now,
+		}
+		addPodcastFields(e, it)
+		if !it.Published.IsZero() && it.Published.Unix() < now {
+			e.PublishedAt = it.Published.Unix()
+		}
+		for _, proc := range p.processors {
+			if err := proc.Process(ctx, f, e); err != nil {
+				slog.Warn("ingest: processing entry", "feed", f.ID, "guid", guid, "error", err)
+			}
+		}
+		entries = append(entries, e)
+	}
+
+	entries, started, err := deduplicate(ctx, f, entries)
+	if err != nil {
+		return nil, err
+	}
+	if err := model.CreateEntries(ctx, entries); err != nil {
+		return nil, err
+	}
+	if err := model.StartClusters(ctx, started); err != nil {
+		slog.Error("ingest: starting clusters", "feed", f.ID, "error", err)
+	}
+
+	stored := make([]*model.Entry, 0, len(entries))
+	for _, e := range entries {
+		if e.ID != 0 {
+			stored = append(stored, e)
+		}
+	}
+	for _, h := range p.hooks {
+		if err := h.Stored(ctx, f, stored); err != nil {
+			slog.Error("ingest: running hook", "feed", f.ID, "error", err)
+		}
+	}
+	return entries, nil
+}
+
+// addPodcastFields copies the enclosures and episode metadata of it to e.
+// Feeds give a single duration per item, which belongs to its first media
+// enclosure.
+func addPodcastFields(e *model.Entry, it feed.Item) {
+	durationSet := false
+	for _, enc := range it.Enclosures {
+		me := model.Enclosure{URL: enc.URL, MimeType: enc.Type, Length: enc.Length}
+		if !durationSet && (strings.HasPrefix(enc.Type, "audio/") || strings.HasPrefix(enc.Type, "video/")) {
+			me.Duration = int64(it.Duration.Seconds())
+			durationSet = true
+		}
+		e.Enclosures = append(e.Enclosures, me)
+	}
+	e.Episode = it.Episode
+	e.Season = it.Season
+	e.ChaptersURL = it.ChaptersURL
+	e.ChaptersType = it.ChaptersType
+	for _, t := range it.Transcripts {
+		e.Transcripts = append(e.Transcripts, model.Transcript(t))
+	}
+}
+
+// entryGUID returns the GUID of it. Items identified by their link use
+// its canonical form, so rotating tracking parameters do not make them new
+// again, and items without a GUID or a link use a hash of their title.
+func entryGUID(it feed.Item) string {
+	if it.GUID != "" && it.GUID == it.URL {
+		if canonical := dedup.CanonicalURL(it.URL); canonical != "" {
+			return canonical
+		}
+	}
+	if it.GUID != "" {
+		return it.GUID
+	}
+	if it.Title == "" {
+		return ""
+	}
+	return model.HashToken(it.Title + "\x00" + it.Content)
+}
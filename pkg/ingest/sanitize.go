@@ -0,0 +1,108 @@
+package ingest
+
+import (
+	"context"
+	"log/slog"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+)
+
+// Sanitizer is a Processor cleaning the untrusted fields of new entries. It
+// must run after every processor that sets content.
+type Sanitizer struct{}
+
+func (Sanitizer) Process(ctx context.Context, f *model.Feed, e *model.Entry) error {
+	SanitizeEntry(f, e)
+	return nil
+}
+
+// SanitizeEntry cleans the fields of e rendered by the frontend and stamps
+// it with the current sanitizer version. Content is cleaned from the Source
+// of e when it is set.
+func SanitizeEntry(f *model.Feed, e *model.Entry) {
+	base := f.SiteURL
+	if base == "" {
+		base = f.URL
+	}
+	e.URL = sanitize.URL(e.URL, base)
+	if e.URL != "" {
+		base = e.URL
+	}
+	e.Title = sanitize.Text(e.Title)
+	e.Author = sanitize.Text(e.Author)
+	categories := e.Categories[:0]
+	for _, c := range e.Categories {
+		if c = sanitize.Text(c); c != "" {
+			categories = append(categories, c)
+		}
+	}
+	e.Categories = categories
+	if e.Source != nil {
+		e.Content = e.Source.Content
+		if e.Source.ExtractedContent != "" {
+			e.ExtractedContent = e.Source.ExtractedContent
+		}
+	}
+	e.Content = sanitize.HTML(e.Content, base)
+	e.ExtractedContent = sanitize.HTML(e.ExtractedContent, base)
+	e.ImageURL = sanitize.URL(e.ImageURL, base)
+	e.ChaptersURL = sanitize.URL(e.ChaptersURL, base)
+	enclosures := e.Enclosures[:0]
+	for _, enc := range e.Enclosures {
+		if enc.URL = sanitize.URL(enc.URL, base); enc.URL != "" {
+			enclosures = append(enclosures, enc)
+		}
+	}
+	e.Enclosures = enclosures
+	transcripts := e.Transcripts[:0]
+	for _, t := range e.Transcripts {
+		if t.URL = sanitize.URL(t.URL, base); t.URL != "" {
+			transcripts = append(transcripts, t)
+		}
+	}
+	e.Transcripts = transcripts
+	e.SanitizerVersion = sanitize.Version
+}
+
+// Resanitize cleans the stored entries sanitized with older rules again,
+// from the HTML they were received with. Entries stored before it was kept
+// have their cleaned content cleaned again, which only applies rules that
+// got stricter.
+func Resanitize(ctx context.Context) error {
+	feeds := map[int64]*model.Feed{}
+	var afterID int64
+	var count int
+	for {
+		entries, err := model.ListEntriesToSanitize(ctx, sanitize.Version, afterID, 500)
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			break
+		}
+		if err := model.LoadEntrySources(ctx, entries); err != nil {
+			return err
+		}
+		for i := range entries {
+			e := &entries[i]
+			afterID = e.ID
+			f, ok := feeds[e.FeedID]
+			if !ok {
+				if f, err = model.GetFeedByID(ctx, e.FeedID); err != nil {
+					return err
+				}
+				feeds[e.FeedID] = f
+			}
+			SanitizeEntry(f, e)
+			if err := model.SaveEntrySanitized(ctx, e); err != nil {
+				return err
+			}
+			count++
+		}
+	}
+	if count > 0 {
+		slog.Info("ingest: resanitized entries", "count", count, "version", sanitize.Version)
+	}
+	return nil
+}
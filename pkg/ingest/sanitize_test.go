@@ -0,0 +1,39 @@
+package ingest
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+)
+
+func TestSanitizeEntryFromSource(t *testing.T) {
+	f := &model.Feed{URL: "https://example.com/feed.xml"}
+	// The stored content lost what older rules removed; the source has it.
+	e := &model.Entry{
+		Content:          "<p>Hello</p>",
+		ExtractedContent: "<p>Article</p>",
+		Source: &model.EntrySource{
+			Content:          `<p>Hello <b>world</b></p><script>alert(1)</script>`,
+			ExtractedContent: `<p>Article <img src="/a.png"></p>`,
+		},
+	}
+	SanitizeEntry(f, e)
+	if !strings.Contains(e.Content, "<b>world</b>") || strings.Contains(e.Content, "script") {
+		t.Errorf("Content = %q, want the source cleaned", e.Content)
+	}
+	if !strings.Contains(e.ExtractedContent, "https://example.com/a.png") {
+		t.Errorf("ExtractedContent = %q, want the source cleaned", e.ExtractedContent)
+	}
+	if e.SanitizerVersion != sanitize.Version {
+		t.Errorf("SanitizerVersion = %d, want %d", e.SanitizerVersion, sanitize.Version)
+	}
+
+	// Entries stored before sources were kept are cleaned as stored.
+	e = &model.Entry{Content: `<p>Hello</p><script>alert(1)</script>`}
+	SanitizeEntry(f, e)
+	if e.Content != "<p>Hello</p>" {
+		t.Errorf("Content = %q, want the stored content cleaned", e.Content)
+	}
+}
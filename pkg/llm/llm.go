@@ -0,0 +1,191 @@
+// Package llm is a client for OpenAI-compatible chat and embedding APIs,
+// which OpenAI, local llama servers and most hosted models provide.
+package llm
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+)
+
+// DefaultBaseURL is the URL of the OpenAI API.
+const DefaultBaseURL = "https://api.openai.com/v1"
+
+// maxResponseSize bounds the size of API responses.
+const maxResponseSize = 10 << 20
+
+var ErrEmptyResponse = errors.New("llm: the API returned no choices")
+
+// APIError is an error returned by the API.
+type APIError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("llm: API returned %d: %s", e.StatusCode, e.Message)
+}
+
+// Temporary reports whether err is a failure of the API rather than of the
+// request, which may succeed when retried later: a network error, a timeout,
+// a rate limit or a server error.
+func Temporary(err error) bool {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode == http.StatusRequestTimeout ||
+			apiErr.StatusCode == http.StatusTooManyRequests ||
+			apiErr.StatusCode >= 500
+	}
+	var netErr net.Error
+	return errors.As(err, &netErr)
+}
+
+// Message is a chat message.
+type Message struct {
+	// Role is system, user or assistant.
+	Role    string `json:"role"`
+	Content string `json:"content"`
+}
+
+// Client calls an OpenAI-compatible API.
+type Client struct {
+	BaseURL        string
+	APIKey         string
+	Model          string
+	EmbeddingModel string
+	HTTP           *http.Client
+}
+
+// New returns a client for the API of cfg, or nil when cfg sets neither an
+// API key nor a base URL.
+func New(cfg config.OpenAIConfig) *Client {
+	if cfg.APIKey == "" && cfg.BaseURL == "" {
+		return nil
+	}
+	baseURL := cfg.BaseURL
+	if baseURL == "" {
+		baseURL = DefaultBaseURL
+	}
+	return &Client{
+		BaseURL:        strings.TrimRight(baseURL, "/"),
+		APIKey:         cfg.APIKey,
+		Model:          cfg.Model,
+		EmbeddingModel: cfg.EmbeddingModel,
+		// The API is set by the administrator and may be a local server.
+		HTTP: &http.Client{Timeout: cfg.Timeout},
+	}
+}
+
+type chatRequest struct {
+	Model       string    `json:"model"`
+	Messages    []Message `json:"messages"`
+	Temperature float64   `json:"temperature"`
+}
+
+type chatResponse struct {
+	Choices []struct {
+		Message Message `json:"message"`
+	} `json:"choices"`
+}
+
+// Chat returns the reply of the model to the messages. The temperature is
+// low, so that replies stick to the given text.
+func (c *Client) Chat(ctx context.Context, messages []Message) (string, error) {
+	var resp chatResponse
+	if err := c.post(ctx, "/chat/completions", chatRequest{c.Model, messages, 0.2}, &resp); err != nil {
+		return "", err
+	}
+	if len(resp.Choices) == 0 {
+		return "", ErrEmptyResponse
+	}
+	return strings.TrimSpace(resp.Choices[0].Message.Content), nil
+}
+
+type embeddingRequest struct {
+	Model string   `json:"model"`
+	Input []string `json:"input"`
+}
+
+type embeddingResponse struct {
+	Data []struct {
+		Index     int       `json:"index"`
+		Embedding []float32 `json:"embedding"`
+	} `json:"data"`
+}
+
+// Embed returns the embeddings of the texts, in the same order.
+func (c *Client) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	var resp embeddingResponse
+	if err := c.post(ctx, "/embeddings", embeddingRequest{c.EmbeddingModel, texts}, &resp); err != nil {
+		return nil, err
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("llm: the API returned %d embeddings for %d texts", len(resp.Data), len(texts))
+	}
+	out := make([][]float32, len(texts))
+	for _, d := range resp.Data {
+		if d.Index < 0 || d.Index >= len(texts) || len(d.Embedding) == 0 {
+			return nil, fmt.Errorf("llm: invalid embedding %d", d.Index)
+		}
+		out[d.Index] = d.Embedding
+	}
+	return out, nil
+}
+
+// post sends body as JSON to the endpoint at path and decodes the response
+// into v.
+func (c *Client) post(ctx context.Context, path string, body, v any) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, c.BaseURL+path, bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fetch.UserAgent)
+	if c.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.APIKey)
+	}
+	resp, err := c.HTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	data, err = io.ReadAll(io.LimitReader(resp.Body, maxResponseSize))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return &APIError{StatusCode: resp.StatusCode, Message: errorMessage(data)}
+	}
+	return json.Unmarshal(data, v)
+}
+
+// errorMessage returns the message of an OpenAI error body, or the
+// beginning of the body.
+func errorMessage(body []byte) string {
+	var e struct {
+		Error struct {
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	if json.Unmarshal(body, &e) == nil && e.Error.Message != "" {
+		return e.Error.Message
+	}
+	s := strings.TrimSpace(string(body))
+	if len(s) > 200 {
+		s = s[:200]
+	}
+	return s
+}
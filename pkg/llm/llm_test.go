@@ -0,0 +1,106 @@
+package llm
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/swartzfoundation/feedr/pkg/config"
+)
+
+func TestNew(t *testing.T) {
+	if c := New(config.OpenAIConfig{Model: "m"}); c != nil {
+		t.Errorf("New without key or URL = %+v, want nil", c)
+	}
+	if c := New(config.OpenAIConfig{APIKey: "k"}); c == nil || c.BaseURL != DefaultBaseURL {
+		t.Errorf("New with a key = %+v, want the OpenAI API", c)
+	}
+}
+
+func TestChat(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/chat/completions" || r.Header.Get("Authorization") != "Bearer key" {
+			t.Errorf("request to %s with %q", r.URL.Path, r.Header.Get("Authorization"))
+		}
+		var req chatRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if req.Model != "llama" || len(req.Messages) != 2 || req.Messages[1].Content != "hello" {
+			t.Errorf("request = %+v", req)
+		}
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":" hi \n"}}]}`))
+	}))
+	defer srv.Close()
+
+	c := New(config.OpenAIConfig{APIKey: "key", BaseURL: srv.URL + "/v1/", Model: "llama", Timeout: time.Second})
+	got, err := c.Chat(t.Context(), []Message{{"system", "be brief"}, {"user", "hello"}})
+	if err != nil || got != "hi" {
+		t.Errorf("Chat = %q, %v, want hi", got, err)
+	}
+}
+
+func TestChatError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTooManyRequests)
+		w.Write([]byte(`{"error":{"message":"rate limited","type":"requests"}}`))
+	}))
+	defer srv.Close()
+
+	c := New(config.OpenAIConfig{BaseURL: srv.URL, Timeout: time.Second})
+	_, err := c.Chat(t.Context(), []Message{{"user", "hello"}})
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusTooManyRequests || apiErr.Message != "rate limited" {
+		t.Errorf("Chat error = %v, want the API error", err)
+	}
+}
+
+func TestTemporary(t *testing.T) {
+	srv := httptest.NewServer(http.NotFoundHandler())
+	srv.Close()
+	_, err := New(config.OpenAIConfig{BaseURL: srv.URL, Timeout: time.Second}).Chat(t.Context(), []Message{{"user", "hello"}})
+	if err == nil || !Temporary(err) {
+		t.Errorf("Temporary(%v) = false for an unreachable API", err)
+	}
+
+	for _, tt := range []struct {
+		err  error
+		want bool
+	}{
+		{&APIError{StatusCode: http.StatusTooManyRequests}, true},
+		{&APIError{StatusCode: http.StatusBadGateway}, true},
+		{fmt.Errorf("embedding: %w", &APIError{StatusCode: http.StatusServiceUnavailable}), true},
+		{&APIError{StatusCode: http.StatusBadRequest}, false},
+		{&APIError{StatusCode: http.StatusUnauthorized}, false},
+		{ErrEmptyResponse, false},
+	} {
+		if got := Temporary(tt.err); got != tt.want {
+			t.Errorf("Temporary(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestEmbed(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req embeddingRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			t.Fatal(err)
+		}
+		if r.URL.Path != "/embeddings" || req.Model != "embed" || len(req.Input) != 2 {
+			t.Errorf("request to %s = %+v", r.URL.Path, req)
+		}
+		// The API may return the embeddings in any order.
+		w.Write([]byte(`{"data":[{"index":1,"embedding":[0,1]},{"index":0,"embedding":[1,0]}]}`))
+	}))
+	defer srv.Close()
+
+	c := New(config.OpenAIConfig{BaseURL: srv.URL, EmbeddingModel: "embed", Timeout: time.Second})
+	got, err := c.Embed(t.Context(), []string{"a", "b"})
+	if err != nil || len(got) != 2 || got[0][0] != 1 || got[1][1] != 1 {
+		t.Errorf("Embed = %v, %v", got, err)
+	}
+}
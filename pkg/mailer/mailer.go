@@ -0,0 +1,129 @@
+// Package mailer sends email through the SMTP server of the configuration.
+package mailer
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"maps"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/swartzfoundation/feedr/pkg/config"
+)
+
+var ErrInvalidAddress = errors.New("mailer: invalid address")
+
+// Message is an email with a plain text and an HTML version.
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+	// Headers are added to the message, such as List-Unsubscribe.
+	Headers map[string]string
+}
+
+// Mailer sends messages from the configured address.
+type Mailer struct {
+	Addr     string
+	From     mail.Address
+	Auth     smtp.Auth
+	hostname string
+}
+
+// New returns a mailer for cfg, or nil when no SMTP host or from address
+// is set.
+func New(cfg config.EmailConfig) *Mailer {
+	if cfg.SMTPHost == "" || cfg.FromAddress == "" {
+		return nil
+	}
+	m := &Mailer{
+		Addr:     net.JoinHostPort(cfg.SMTPHost, cfg.SMTPPort),
+		From:     mail.Address{Name: cfg.FromName, Address: cfg.FromAddress},
+		hostname: cfg.SMTPHost,
+	}
+	if cfg.SMTPAuth {
+		// The connection is upgraded with STARTTLS before authenticating.
+		m.Auth = smtp.PlainAuth("", cfg.SMTPUsername, cfg.SMTPPassword, cfg.SMTPHost)
+	}
+	return m
+}
+
+// Send sends msg.
+func (m *Mailer) Send(msg *Message) error {
+	to, err := mail.ParseAddress(msg.To)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrInvalidAddress, msg.To)
+	}
+	data, err := m.Build(msg, time.Now())
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(m.Addr, m.Auth, m.From.Address, []string{to.Address}, data)
+}
+
+// Build returns the MIME encoding of msg, a multipart/alternative message
+// with its text and HTML versions.
+func (m *Mailer) Build(msg *Message, date time.Time) ([]byte, error) {
+	var body bytes.Buffer
+	w := multipart.NewWriter(&body)
+	for _, part := range []struct{ contentType, content string }{
+		{"text/plain; charset=utf-8", msg.Text},
+		{"text/html; charset=utf-8", msg.HTML},
+	} {
+		pw, err := w.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(pw)
+		if _, err := qp.Write([]byte(part.content)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	header := func(k, v string) {
+		// Values must not break out of their header.
+		v = strings.NewReplacer("\r", " ", "\n", " ").Replace(v)
+		fmt.Fprintf(&b, "%s: %s\r\n", k, v)
+	}
+	header("From", m.From.String())
+	header("To", msg.To)
+	header("Subject", mime.QEncoding.Encode("utf-8", msg.Subject))
+	header("Date", date.Format(time.RFC1123Z))
+	header("Message-ID", "<"+messageID()+"@"+m.hostname+">")
+	for _, k := range slices.Sorted(maps.Keys(msg.Headers)) {
+		header(k, msg.Headers[k])
+	}
+	header("MIME-Version", "1.0")
+	header("Content-Type", "multipart/alternative; boundary="+w.Boundary())
+	b.WriteString("\r\n")
+	b.Write(body.Bytes())
+	return b.Bytes(), nil
+}
+
+func messageID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
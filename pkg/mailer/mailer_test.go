@@ -0,0 +1,66 @@
+package mailer
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/swartzfoundation/feedr/pkg/config"
+)
+
+func TestNew(t *testing.T) {
+	if m := New(config.EmailConfig{SMTPHost: "smtp.example.com"}); m != nil {
+		t.Errorf("New without a from address = %+v, want nil", m)
+	}
+}
+
+func TestBuild(t *testing.T) {
+	m := New(config.EmailConfig{SMTPHost: "smtp.example.com", SMTPPort: "587", FromAddress: "feedr@example.com", FromName: "feedr"})
+	data, err := m.Build(&Message{
+		To:      "ada@example.com",
+		Subject: "Votre résumé\r\nBcc: eve@example.com",
+		Text:    "Bonjour, voici votre résumé.",
+		HTML:    "<p>Bonjour</p>",
+	}, time.Date(2026, 3, 1, 7, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg, err := mail.ReadMessage(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := msg.Header.Get("Bcc"); got != "" {
+		t.Errorf("Bcc header injected: %q", got)
+	}
+	subject, err := new(mime.WordDecoder).DecodeHeader(msg.Header.Get("Subject"))
+	if err != nil || !strings.HasPrefix(subject, "Votre résumé") {
+		t.Errorf("Subject = %q, %v", subject, err)
+	}
+	if got := msg.Header.Get("From"); got != `"feedr" <feedr@example.com>` {
+		t.Errorf("From = %q", got)
+	}
+
+	mediaType, params, err := mime.ParseMediaType(msg.Header.Get("Content-Type"))
+	if err != nil || mediaType != "multipart/alternative" {
+		t.Fatalf("Content-Type = %q, %v", mediaType, err)
+	}
+	r := multipart.NewReader(msg.Body, params["boundary"])
+	for _, want := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", "Bonjour, voici votre résumé."},
+		{"text/html; charset=utf-8", "<p>Bonjour</p>"},
+	} {
+		p, err := r.NextPart()
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(p)
+		if p.Header.Get("Content-Type") != want.contentType || string(body) != want.body {
+			t.Errorf("part %q = %q, want %q", p.Header.Get("Content-Type"), body, want.body)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package newsletter
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/feed"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+	"github.com/swartzfoundation/feedr/pkg/ingest"
+)
+
+// ErrNoOneClick is returned by Unsubscribe when the sender does not support
+// one-click unsubscription and the user has to follow a link instead.
+var ErrNoOneClick = errors.New("newsletter: sender does not support one-click unsubscribe")
+
+// Deliver stores msg, received by the inbound address addr, as an entry of
+// the sender's feed.
+func Deliver(ctx context.Context, p *ingest.Pipeline, addr *model.InboundAddress, msg *Message) error {
+	return DeliverTo(ctx, p, addr.UserID, addr.FolderID, "newsletter:"+addr.Token, msg)
+}
+
+// DeliverTo stores msg as an entry of the sender's feed under the URL
+// prefix source. The feed and the user's subscription to it, in folderID,
+// are created on the first message; messages of senders the user
+// unsubscribed from are dropped.
+func DeliverTo(ctx context.Context, p *ingest.Pipeline, userID string, folderID *int64, source string, msg *Message) error {
+	sender := msg.SenderKey()
+	if sender == "" {
+		return ErrNoSender
+	}
+	template := &model.Feed{
+		URL:                 source + "/" + sender,
+		Title:               msg.SenderName(),
+		Unsubscribe:         msg.Unsubscribe,
+		UnsubscribeOneClick: msg.UnsubscribeOneClick,
+	}
+	if i := strings.LastIndexByte(msg.From.Address, '@'); i >= 0 {
+		template.SiteURL = "https://" + msg.From.Address[i+1:] + "/"
+	}
+	sub := &model.Subscription{UserID: userID, FolderID: folderID}
+	f, created, err := model.GetOrCreateNewsletterFeed(ctx, template, sub)
+	if err != nil {
+		return err
+	}
+	if !created {
+		subscribed, err := model.IsSubscribed(ctx, userID, f.ID)
+		if err != nil {
+			return err
+		}
+		if !subscribed {
+			slog.Info("newsletter: dropping message of unsubscribed sender", "feed", f.ID)
+			return nil
+		}
+		if msg.Unsubscribe != "" && (msg.Unsubscribe != f.Unsubscribe || msg.UnsubscribeOneClick != f.UnsubscribeOneClick) {
+			f.Unsubscribe, f.UnsubscribeOneClick = msg.Unsubscribe, msg.UnsubscribeOneClick
+			if err := model.UpdateFeedUnsubscribe(ctx, f); err != nil {
+				return err
+			}
+		}
+	}
+	_, err = p.Ingest(ctx, f, []feed.Item{msg.Item()})
+	return err
+}
+
+// Unsubscribe asks the sender of the newsletter feed f to stop sending it,
+// with a one-click POST to its HTTPS List-Unsubscribe URL (RFC 8058).
+func Unsubscribe(ctx context.Context, f *model.Feed) error {
+	if !f.UnsubscribeOneClick {
+		return ErrNoOneClick
+	}
+	var target string
+	for _, u := range UnsubscribeURLs(f.Unsubscribe) {
+		if parsed, err := url.Parse(u); err == nil && parsed.Scheme == "https" {
+			target = u
+			break
+		}
+	}
+	if target == "" {
+		return ErrNoOneClick
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target, strings.NewReader("List-Unsubscribe=One-Click"))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", fetch.UserAgent)
+	resp, err := fetch.PublicClient.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("newsletter: unsubscribe returned status %d", resp.StatusCode)
+	}
+	return nil
+}
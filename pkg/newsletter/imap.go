@@ -0,0 +1,177 @@
+package newsletter
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/client"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/ingest"
+	"github.com/swartzfoundation/feedr/pkg/secret"
+)
+
+// imapTimeout bounds each IMAP command.
+const imapTimeout = 30 * time.Second
+
+// imapBatchSize is the maximum number of messages ingested per poll, so a
+// large backlog is worked through over several polls.
+const imapBatchSize = 50
+
+var ErrInvalidSecurity = errors.New("newsletter: security must be tls, starttls or none")
+
+// dialIMAP connects and logs in to the account with the plain password.
+func dialIMAP(a *model.IMAPAccount, password string) (*client.Client, error) {
+	addr := net.JoinHostPort(a.Host, strconv.Itoa(a.Port))
+	dialer := &net.Dialer{Timeout: imapTimeout}
+	tlsConfig := &tls.Config{ServerName: a.Host}
+
+	var (
+		c   *client.Client
+		err error
+	)
+	switch a.Security {
+	case model.IMAPSecurityTLS:
+		c, err = client.DialWithDialerTLS(dialer, addr, tlsConfig)
+	case model.IMAPSecuritySTARTTLS, model.IMAPSecurityNone:
+		c, err = client.DialWithDialer(dialer, addr)
+		if err == nil && a.Security == model.IMAPSecuritySTARTTLS {
+			if err = c.StartTLS(tlsConfig); err != nil {
+				c.Logout()
+			}
+		}
+	default:
+		return nil, ErrInvalidSecurity
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.Timeout = imapTimeout
+	if err := c.Login(a.Username, password); err != nil {
+		c.Logout()
+		return nil, err
+	}
+	return c, nil
+}
+
+// CheckIMAP verifies that the account can log in and open its mailboxes.
+func CheckIMAP(a *model.IMAPAccount, password string) error {
+	c, err := dialIMAP(a, password)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+	if _, err := c.Select(a.Mailbox, true); err != nil {
+		return fmt.Errorf("opening %s: %w", a.Mailbox, err)
+	}
+	if a.AfterFetch == model.IMAPAfterFetchMove {
+		if _, err := c.Status(a.MoveTo, []imap.StatusItem{imap.StatusMessages}); err != nil {
+			return fmt.Errorf("opening %s: %w", a.MoveTo, err)
+		}
+	}
+	return nil
+}
+
+// fetchIMAP passes the unseen messages of the account's mailbox received
+// after a.LastUID to deliver, then applies a.AfterFetch to them. a.LastUID
+// and a.UIDValidity are advanced past the delivered messages; a message
+// that fails to be delivered stops the poll so it is retried next time.
+func fetchIMAP(a *model.IMAPAccount, password string, deliver func(*Message) error) error {
+	c, err := dialIMAP(a, password)
+	if err != nil {
+		return err
+	}
+	defer c.Logout()
+
+	status, err := c.Select(a.Mailbox, false)
+	if err != nil {
+		return err
+	}
+	if status.UidValidity != a.UIDValidity {
+		// The mailbox was recreated, its UIDs start over.
+		a.UIDValidity = status.UidValidity
+		a.LastUID = 0
+	}
+
+	criteria := imap.NewSearchCriteria()
+	criteria.WithoutFlags = []string{imap.SeenFlag, imap.DeletedFlag}
+	criteria.Uid = new(imap.SeqSet)
+	criteria.Uid.AddRange(a.LastUID+1, 0)
+	uids, err := c.UidSearch(criteria)
+	if err != nil {
+		return err
+	}
+	// "n:*" always matches the last message, even below n.
+	pending := uids[:0]
+	for _, uid := range uids {
+		if uid > a.LastUID {
+			pending = append(pending, uid)
+		}
+	}
+	if len(pending) == 0 {
+		return nil
+	}
+	if len(pending) > imapBatchSize {
+		pending = pending[:imapBatchSize]
+	}
+
+	set := new(imap.SeqSet)
+	set.AddNum(pending...)
+	section := &imap.BodySectionName{Peek: true}
+	messages := make(chan *imap.Message, len(pending))
+	if err := c.UidFetch(set, []imap.FetchItem{imap.FetchUid, section.FetchItem()}, messages); err != nil {
+		return err
+	}
+
+	done := new(imap.SeqSet)
+	var deliverErr error
+	for m := range messages {
+		if deliverErr != nil {
+			continue
+		}
+		body := m.GetBody(section)
+		if body == nil {
+			continue
+		}
+		// Malformed messages are skipped rather than retried forever.
+		if msg, err := Parse(body); err != nil {
+			slog.Warn("newsletter: parsing imap message", "account", a.ID, "uid", m.Uid, "error", err)
+		} else if err := deliver(msg); err != nil {
+			deliverErr = err
+			continue
+		}
+		done.AddNum(m.Uid)
+		a.LastUID = max(a.LastUID, m.Uid)
+	}
+
+	if !done.Empty() {
+		switch a.AfterFetch {
+		case model.IMAPAfterFetchRead:
+			err = c.UidStore(done, imap.FormatFlagsOp(imap.AddFlags, true), []interface{}{imap.SeenFlag}, nil)
+		case model.IMAPAfterFetchMove:
+			err = c.UidMove(done, a.MoveTo)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return deliverErr
+}
+
+// FetchIMAP ingests the new messages of the account through the pipeline.
+func FetchIMAP(ctx context.Context, p *ingest.Pipeline, a *model.IMAPAccount) error {
+	password, err := secret.Decrypt(a.Password)
+	if err != nil {
+		return err
+	}
+	source := "imap:" + strconv.FormatInt(a.ID, 10)
+	return fetchIMAP(a, password, func(msg *Message) error {
+		return DeliverTo(ctx, p, a.UserID, a.FolderID, source, msg)
+	})
+}
@@ -0,0 +1,273 @@
+// Package newsletter turns emails sent to users' inbound addresses into feed
+// entries, one feed per sender, through an embedded SMTP server.
+package newsletter
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/swartzfoundation/feedr/pkg/feed"
+	"golang.org/x/net/html/charset"
+)
+
+// maxDepth bounds the nesting of multipart bodies.
+const maxDepth = 8
+
+var ErrNoSender = errors.New("newsletter: message has no sender")
+
+var wordDecoder = &mime.WordDecoder{CharsetReader: charset.NewReaderLabel}
+
+// Message is a parsed email.
+type Message struct {
+	From      mail.Address
+	Subject   string
+	Date      time.Time
+	MessageID string
+	// ListID is the identifier of the mailing list, without angle brackets.
+	ListID string
+	// HTML and Text are the first HTML and plain text bodies, in UTF-8.
+	HTML string
+	Text string
+	// Unsubscribe is the List-Unsubscribe header.
+	Unsubscribe string
+	// UnsubscribeOneClick is true when List-Unsubscribe-Post announces
+	// one-click unsubscription (RFC 8058).
+	UnsubscribeOneClick bool
+}
+
+// header is implemented by both mail.Header and textproto.MIMEHeader.
+type header interface {
+	Get(key string) string
+}
+
+// Parse reads an RFC 5322 message and decodes its headers and bodies.
+// Attachments are skipped.
+func Parse(r io.Reader) (*Message, error) {
+	m, err := mail.ReadMessage(r)
+	if err != nil {
+		return nil, err
+	}
+	parser := mail.AddressParser{WordDecoder: wordDecoder}
+	from, err := parser.Parse(m.Header.Get("From"))
+	if err != nil {
+		if from, err = parser.Parse(m.Header.Get("Sender")); err != nil {
+			return nil, ErrNoSender
+		}
+	}
+
+	_, params, _ := mime.ParseMediaType(m.Header.Get("Content-Type"))
+	msg := &Message{
+		From:        *from,
+		Subject:     decodeHeader(m.Header.Get("Subject"), params["charset"]),
+		MessageID:   strings.Trim(strings.TrimSpace(m.Header.Get("Message-Id")), "<>"),
+		ListID:      listID(m.Header.Get("List-Id")),
+		Unsubscribe: strings.Join(strings.Fields(m.Header.Get("List-Unsubscribe")), " "),
+	}
+	msg.From.Address = strings.ToLower(msg.From.Address)
+	if date, err := m.Header.Date(); err == nil {
+		msg.Date = date
+	}
+	if msg.Unsubscribe != "" {
+		post := m.Header.Get("List-Unsubscribe-Post")
+		msg.UnsubscribeOneClick = strings.EqualFold(strings.TrimSpace(post), "List-Unsubscribe=One-Click")
+	}
+
+	if err := msg.walk(m.Header, m.Body, 0); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// walk stores the first HTML and text parts of the body, descending into
+// multipart bodies.
+func (msg *Message) walk(h header, body io.Reader, depth int) error {
+	mediaType, params, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		mediaType, params = "text/plain", nil
+	}
+	if disposition, _, _ := mime.ParseMediaType(h.Get("Content-Disposition")); disposition == "attachment" {
+		return nil
+	}
+
+	if strings.HasPrefix(mediaType, "multipart/") {
+		if depth >= maxDepth || params["boundary"] == "" {
+			return nil
+		}
+		mr := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := mr.NextRawPart()
+			if err == io.EOF {
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			if err := msg.walk(part.Header, part, depth+1); err != nil {
+				return err
+			}
+		}
+	}
+
+	if (mediaType == "text/html" && msg.HTML != "") || (mediaType == "text/plain" && msg.Text != "") {
+		return nil
+	}
+	if mediaType != "text/html" && mediaType != "text/plain" {
+		return nil
+	}
+	text, err := decodeBody(body, h.Get("Content-Transfer-Encoding"), params["charset"])
+	if err != nil {
+		return err
+	}
+	if mediaType == "text/html" {
+		msg.HTML = text
+	} else {
+		msg.Text = text
+	}
+	return nil
+}
+
+// decodeBody undoes the transfer encoding of a part and converts it from
+// cs to UTF-8.
+func decodeBody(body io.Reader, encoding, cs string) (string, error) {
+	switch strings.ToLower(strings.TrimSpace(encoding)) {
+	case "quoted-printable":
+		body = quotedprintable.NewReader(body)
+	case "base64":
+		body = base64.NewDecoder(base64.StdEncoding, &newlineStripper{r: body})
+	}
+	if cs != "" && !strings.EqualFold(cs, "utf-8") && !strings.EqualFold(cs, "us-ascii") {
+		r, err := charset.NewReaderLabel(cs, body)
+		if err == nil {
+			body = r
+		}
+	}
+	data, err := io.ReadAll(body)
+	return string(data), err
+}
+
+// newlineStripper removes the line breaks of base64 bodies, which the
+// standard decoder only tolerates between quanta.
+type newlineStripper struct {
+	r io.Reader
+}
+
+func (n *newlineStripper) Read(p []byte) (int, error) {
+	for {
+		c, err := n.r.Read(p)
+		j := 0
+		for _, b := range p[:c] {
+			if b != '\r' && b != '\n' && b != ' ' && b != '\t' {
+				p[j] = b
+				j++
+			}
+		}
+		if j > 0 || err != nil {
+			return j, err
+		}
+	}
+}
+
+// decodeHeader decodes the encoded words of s. Raw 8-bit headers, which
+// some senders use despite RFC 2047, are assumed to be in the charset of
+// the body, or else Windows-1252.
+func decodeHeader(s, cs string) string {
+	if d, err := wordDecoder.DecodeHeader(s); err == nil {
+		s = d
+	}
+	if !utf8.ValidString(s) {
+		if cs == "" || strings.EqualFold(cs, "utf-8") {
+			cs = "windows-1252"
+		}
+		if r, err := charset.NewReaderLabel(cs, strings.NewReader(s)); err == nil {
+			if d, err := io.ReadAll(r); err == nil {
+				s = string(d)
+			}
+		}
+	}
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// listID extracts the identifier of a List-Id header such as
+// "Weekly News <weekly.example.com>".
+func listID(s string) string {
+	if i := strings.LastIndexByte(s, '<'); i >= 0 {
+		s = s[i+1:]
+		if j := strings.IndexByte(s, '>'); j >= 0 {
+			s = s[:j]
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(s))
+}
+
+// SenderKey identifies the feed the message belongs to: its mailing list
+// when it has one, since lists may send from several addresses, or else
+// its sender address.
+func (msg *Message) SenderKey() string {
+	if msg.ListID != "" {
+		return msg.ListID
+	}
+	return msg.From.Address
+}
+
+// SenderName is the display name of the sender, falling back to its address.
+func (msg *Message) SenderName() string {
+	if msg.From.Name != "" {
+		return msg.From.Name
+	}
+	return msg.From.Address
+}
+
+// Content returns the HTML body, or the text body converted to paragraphs.
+func (msg *Message) Content() string {
+	if strings.TrimSpace(msg.HTML) != "" {
+		return msg.HTML
+	}
+	var b bytes.Buffer
+	text := strings.ReplaceAll(msg.Text, "\r\n", "\n")
+	for _, para := range strings.Split(text, "\n\n") {
+		para = strings.TrimSpace(para)
+		if para == "" {
+			continue
+		}
+		lines := strings.Split(para, "\n")
+		for i, line := range lines {
+			lines[i] = html.EscapeString(line)
+		}
+		b.WriteString("<p>" + strings.Join(lines, "<br>") + "</p>")
+	}
+	return b.String()
+}
+
+// Item converts the message to a feed item.
+func (msg *Message) Item() feed.Item {
+	return feed.Item{
+		GUID:      msg.MessageID,
+		Title:     msg.Subject,
+		Author:    msg.SenderName(),
+		Content:   msg.Content(),
+		Published: msg.Date,
+	}
+}
+
+// UnsubscribeURLs returns the URLs of a List-Unsubscribe header, which lists
+// them in angle brackets separated by commas.
+func UnsubscribeURLs(header string) []string {
+	var urls []string
+	for _, field := range strings.Split(header, ",") {
+		field = strings.TrimSpace(field)
+		if strings.HasPrefix(field, "<") && strings.HasSuffix(field, ">") {
+			urls = append(urls, strings.TrimSpace(field[1:len(field)-1]))
+		}
+	}
+	return urls
+}
@@ -0,0 +1,253 @@
+package newsletter
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"net/smtp"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/emersion/go-imap"
+	"github.com/emersion/go-imap/backend"
+	"github.com/emersion/go-imap/backend/memory"
+	imapserver "github.com/emersion/go-imap/server"
+	"github.com/swartzfoundation/feedr/model"
+)
+
+func parseFile(t *testing.T, name string) *Message {
+	t.Helper()
+	f, err := os.Open("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	msg, err := Parse(f)
+	if err != nil {
+		t.Fatalf("Parse(%s) returned error %v", name, err)
+	}
+	return msg
+}
+
+// crlf converts the line endings of a fixture to the CRLF of the wire.
+func crlf(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+func TestParseMultipart(t *testing.T) {
+	msg := parseFile(t, "weekly.eml")
+
+	if msg.From.Name != "Café Weekly" || msg.From.Address != "news@weekly.example.com" {
+		t.Errorf("unexpected sender %+v", msg.From)
+	}
+	if msg.Subject != "Issue #42: café culture" {
+		t.Errorf("unexpected subject %q", msg.Subject)
+	}
+	if msg.MessageID != "issue-42@weekly.example.com" || msg.SenderKey() != "weekly.list.example.com" {
+		t.Errorf("unexpected message id %q or sender key %q", msg.MessageID, msg.SenderKey())
+	}
+	if !msg.Date.Equal(time.Date(2006, 1, 2, 15, 4, 5, 0, time.UTC)) {
+		t.Errorf("unexpected date %v", msg.Date)
+	}
+	if !strings.Contains(msg.HTML, "<h1>Hello café readers</h1>") || !strings.Contains(msg.HTML, "a very long line") {
+		t.Errorf("unexpected html %q", msg.HTML)
+	}
+	if strings.Contains(msg.HTML, "Attachment") {
+		t.Errorf("expected attachment to be skipped")
+	}
+	if !strings.HasPrefix(msg.Text, "Hello café readers") {
+		t.Errorf("unexpected text %q", msg.Text)
+	}
+	if msg.Content() != msg.HTML {
+		t.Errorf("expected html to be preferred")
+	}
+
+	urls := UnsubscribeURLs(msg.Unsubscribe)
+	if len(urls) != 2 || urls[1] != "https://weekly.example.com/unsubscribe/abc" || !msg.UnsubscribeOneClick {
+		t.Errorf("unexpected unsubscribe %v %v", urls, msg.UnsubscribeOneClick)
+	}
+}
+
+func TestParsePlainText(t *testing.T) {
+	msg := parseFile(t, "plain.eml")
+
+	if msg.Subject != "Café notes" || msg.SenderName() != "plain@example.org" {
+		t.Errorf("unexpected subject %q or sender %q", msg.Subject, msg.SenderName())
+	}
+	if msg.SenderKey() != "plain@example.org" {
+		t.Errorf("expected sender address as key, got %q", msg.SenderKey())
+	}
+	want := "<p>Café &amp; tea<br>second line</p><p>Next &lt;para&gt;</p>"
+	if got := msg.Content(); got != want {
+		t.Errorf("got content %q expected %q", got, want)
+	}
+}
+
+func TestServer(t *testing.T) {
+	var (
+		mu        sync.Mutex
+		delivered []string
+	)
+	s := &Server{
+		Domain:  "in.example.com",
+		MaxSize: 1 << 20,
+		Lookup: func(ctx context.Context, token string) (*model.InboundAddress, error) {
+			if token != "0123456789abcdef" {
+				return nil, model.ErrNotFound
+			}
+			return &model.InboundAddress{ID: "a1", Token: token, UserID: "u1"}, nil
+		},
+		Deliver: func(ctx context.Context, addr *model.InboundAddress, msg *Message) error {
+			mu.Lock()
+			defer mu.Unlock()
+			delivered = append(delivered, addr.UserID+" "+msg.Subject)
+			return nil
+		},
+	}
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go s.Serve(l)
+	defer s.Close()
+
+	data, err := os.ReadFile("testdata/weekly.eml")
+	if err != nil {
+		t.Fatal(err)
+	}
+	data = crlf(data)
+	addr := l.Addr().String()
+
+	if err := smtp.SendMail(addr, nil, "news@weekly.example.com", []string{"0123456789ABCDEF@in.example.com"}, data); err != nil {
+		t.Fatalf("sending message: %v", err)
+	}
+	mu.Lock()
+	if len(delivered) != 1 || delivered[0] != "u1 Issue #42: café culture" {
+		t.Errorf("unexpected deliveries %v", delivered)
+	}
+	mu.Unlock()
+
+	for _, rcpt := range []string{"unknown@in.example.com", "0123456789abcdef@example.net"} {
+		err := smtp.SendMail(addr, nil, "news@weekly.example.com", []string{rcpt}, data)
+		if err == nil || !strings.HasPrefix(err.Error(), "550") {
+			t.Errorf("expected %s to be rejected, got %v", rcpt, err)
+		}
+	}
+}
+
+// moveBackend adds the MOVE extension, which the server advertises, to the
+// memory backend.
+type moveBackend struct{ *memory.Backend }
+
+type moveUser struct{ backend.User }
+
+type moveMailbox struct{ backend.Mailbox }
+
+func (b moveBackend) Login(info *imap.ConnInfo, username, password string) (backend.User, error) {
+	u, err := b.Backend.Login(info, username, password)
+	return moveUser{u}, err
+}
+
+func (u moveUser) GetMailbox(name string) (backend.Mailbox, error) {
+	mbox, err := u.User.GetMailbox(name)
+	return moveMailbox{mbox}, err
+}
+
+func (m moveMailbox) MoveMessages(uid bool, seqset *imap.SeqSet, dest string) error {
+	if err := m.CopyMessages(uid, seqset, dest); err != nil {
+		return err
+	}
+	if err := m.UpdateMessagesFlags(uid, seqset, imap.AddFlags, []string{imap.DeletedFlag}); err != nil {
+		return err
+	}
+	return m.Expunge()
+}
+
+func TestFetchIMAP(t *testing.T) {
+	srv := imapserver.New(moveBackend{memory.New()})
+	srv.AllowInsecureAuth = true
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Serve(l)
+	defer srv.Close()
+
+	host, port, _ := net.SplitHostPort(l.Addr().String())
+	a := &model.IMAPAccount{
+		Host:       host,
+		Security:   model.IMAPSecurityNone,
+		Username:   "username",
+		Mailbox:    "INBOX",
+		AfterFetch: model.IMAPAfterFetchMove,
+		MoveTo:     "Archive",
+	}
+	a.Port, _ = strconv.Atoi(port)
+
+	c, err := dialIMAP(a, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Create("Archive"); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"weekly.eml", "plain.eml"} {
+		data, err := os.ReadFile("testdata/" + name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := c.Append("INBOX", nil, time.Now(), bytes.NewBuffer(crlf(data))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	c.Logout()
+
+	if err := CheckIMAP(a, "wrong"); err == nil {
+		t.Errorf("expected login to fail with a wrong password")
+	}
+	if err := CheckIMAP(a, "password"); err != nil {
+		t.Errorf("CheckIMAP returned error %v", err)
+	}
+
+	var subjects []string
+	deliver := func(msg *Message) error {
+		subjects = append(subjects, msg.Subject)
+		return nil
+	}
+	if err := fetchIMAP(a, "password", deliver); err != nil {
+		t.Fatal(err)
+	}
+	if len(subjects) != 2 || subjects[0] != "Issue #42: café culture" || subjects[1] != "Café notes" {
+		t.Errorf("expected the two unseen messages, got %q", subjects)
+	}
+	if a.LastUID == 0 || a.UIDValidity == 0 {
+		t.Errorf("expected the last uid to be recorded, got %d %d", a.LastUID, a.UIDValidity)
+	}
+
+	c, err = dialIMAP(a, "password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	inbox, err := c.Select("INBOX", true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	archive, err := c.Status("Archive", []imap.StatusItem{imap.StatusMessages})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.Logout()
+	if inbox.Messages != 1 || archive.Messages != 2 {
+		t.Errorf("expected messages to be moved, inbox has %d archive %d", inbox.Messages, archive.Messages)
+	}
+
+	subjects = nil
+	if err := fetchIMAP(a, "password", deliver); err != nil || len(subjects) != 0 {
+		t.Errorf("expected nothing new, got %q %v", subjects, err)
+	}
+}
@@ -0,0 +1,149 @@
+package newsletter
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/emersion/go-smtp"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/ingest"
+)
+
+// maxRecipients bounds the inbound addresses a single message is sent to.
+const maxRecipients = 50
+
+// Server receives newsletters over SMTP. It only accepts mail for the
+// inbound addresses of its domain and never relays.
+type Server struct {
+	Addr    string
+	Domain  string
+	MaxSize int64
+	// Lookup returns the inbound address with the given local part, or
+	// model.ErrNotFound.
+	Lookup func(ctx context.Context, token string) (*model.InboundAddress, error)
+	// Deliver stores a message received by addr.
+	Deliver func(ctx context.Context, addr *model.InboundAddress, msg *Message) error
+
+	srv *smtp.Server
+}
+
+// New returns a server delivering messages through the pipeline p.
+func New(cfg config.InboundConfig, p *ingest.Pipeline) *Server {
+	return &Server{
+		Addr:    cfg.ListenAddr,
+		Domain:  cfg.Domain,
+		MaxSize: cfg.MaxSize,
+		Lookup:  model.GetInboundAddressByToken,
+		Deliver: func(ctx context.Context, addr *model.InboundAddress, msg *Message) error {
+			return Deliver(ctx, p, addr, msg)
+		},
+	}
+}
+
+func (s *Server) init() {
+	if s.srv != nil {
+		return
+	}
+	s.srv = smtp.NewServer(smtp.BackendFunc(func(c *smtp.Conn) (smtp.Session, error) {
+		return &session{server: s}, nil
+	}))
+	s.srv.Addr = s.Addr
+	s.srv.Domain = s.Domain
+	s.srv.MaxMessageBytes = s.MaxSize
+	s.srv.MaxRecipients = maxRecipients
+	s.srv.ReadTimeout = time.Minute
+	s.srv.WriteTimeout = time.Minute
+}
+
+// ListenAndServe listens on s.Addr and serves until Close is called.
+func (s *Server) ListenAndServe() error {
+	s.init()
+	slog.Info("newsletter: listening", "addr", s.Addr, "domain", s.Domain)
+	return s.srv.ListenAndServe()
+}
+
+// Serve accepts connections on l until Close is called.
+func (s *Server) Serve(l net.Listener) error {
+	s.init()
+	return s.srv.Serve(l)
+}
+
+func (s *Server) Close() error {
+	if s.srv == nil {
+		return nil
+	}
+	return s.srv.Close()
+}
+
+// session handles one SMTP transaction at a time.
+type session struct {
+	server *Server
+	from   string
+	rcpts  []*model.InboundAddress
+}
+
+func (s *session) Reset() {
+	s.from = ""
+	s.rcpts = nil
+}
+
+func (s *session) Logout() error {
+	return nil
+}
+
+func (s *session) Mail(from string, opts *smtp.MailOptions) error {
+	s.Reset()
+	s.from = from
+	return nil
+}
+
+func (s *session) Rcpt(to string, opts *smtp.RcptOptions) error {
+	i := strings.LastIndexByte(to, '@')
+	if i < 0 {
+		return &smtp.SMTPError{Code: 501, EnhancedCode: smtp.EnhancedCode{5, 1, 3}, Message: "Bad recipient address syntax"}
+	}
+	local, domain := strings.ToLower(to[:i]), to[i+1:]
+	if s.server.Domain != "" && !strings.EqualFold(domain, s.server.Domain) {
+		return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 7, 1}, Message: "Relaying denied"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	addr, err := s.server.Lookup(ctx, local)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			return &smtp.SMTPError{Code: 550, EnhancedCode: smtp.EnhancedCode{5, 1, 1}, Message: "No such mailbox"}
+		}
+		slog.Error("newsletter: looking up inbound address", "error", err)
+		return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 3, 0}, Message: "Temporary failure, try again later"}
+	}
+	s.rcpts = append(s.rcpts, addr)
+	return nil
+}
+
+func (s *session) Data(r io.Reader) error {
+	msg, err := Parse(r)
+	if err != nil {
+		// Drain the message so the connection stays usable.
+		io.Copy(io.Discard, r)
+		slog.Warn("newsletter: parsing message", "from", s.from, "error", err)
+		return &smtp.SMTPError{Code: 554, EnhancedCode: smtp.EnhancedCode{5, 6, 0}, Message: "Malformed message"}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	for _, addr := range s.rcpts {
+		if err := s.server.Deliver(ctx, addr, msg); err != nil {
+			slog.Error("newsletter: delivering message", "address", addr.ID, "error", err)
+			return &smtp.SMTPError{Code: 451, EnhancedCode: smtp.EnhancedCode{4, 3, 0}, Message: "Temporary failure, try again later"}
+		}
+	}
+	slog.Info("newsletter: received message", "from", msg.From.Address, "recipients", len(s.rcpts))
+	return nil
+}
@@ -0,0 +1,244 @@
+// Package poller periodically fetches subscribed feeds and IMAP mailboxes
+// and ingests their new items.
+package poller
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/favicon"
+	"github.com/swartzfoundation/feedr/pkg/feed"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+	"github.com/swartzfoundation/feedr/pkg/ingest"
+	"github.com/swartzfoundation/feedr/pkg/newsletter"
+	"github.com/swartzfoundation/feedr/pkg/websub"
+)
+
+// MaxBackoff bounds the delay between fetches of a failing feed.
+const MaxBackoff = 24 * time.Hour
+
+// IconMaxAge is the delay before the icon of a feed's website is fetched
+// again, including when the website had none.
+const IconMaxAge = 7 * 24 * time.Hour
+
+// Poller refreshes due feeds on every tick.
+type Poller struct {
+	Pipeline *ingest.Pipeline
+	// Interval is the delay between two fetches of a healthy feed.
+	Interval time.Duration
+	// Workers is the number of feeds fetched concurrently.
+	Workers int
+	// BatchSize is the maximum number of feeds refreshed per tick.
+	BatchSize int
+	// WebSub subscribes feeds to their hubs when set.
+	WebSub *websub.Subscriber
+	// PushInterval replaces Interval for feeds whose hub pushes updates,
+	// as a fallback should pushes stop.
+	PushInterval time.Duration
+}
+
+// New returns a poller with the default settings.
+func New(p *ingest.Pipeline) *Poller {
+	return &Poller{
+		Pipeline:     p,
+		Interval:     30 * time.Minute,
+		Workers:      4,
+		BatchSize:    100,
+		PushInterval: 12 * time.Hour,
+	}
+}
+
+// Run refreshes due feeds every minute until ctx is cancelled.
+func (p *Poller) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		p.Tick(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// Tick refreshes the feeds and IMAP accounts that are due now.
+func (p *Poller) Tick(ctx context.Context) {
+	p.tickFeeds(ctx)
+	p.tickIMAP(ctx)
+}
+
+func (p *Poller) tickFeeds(ctx context.Context) {
+	feeds, err := model.ListDueFeeds(ctx, time.Now().Unix(), p.BatchSize)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			slog.Error("poller: listing due feeds", "error", err)
+		}
+		return
+	}
+
+	jobs := make(chan *model.Feed)
+	var wg sync.WaitGroup
+	for range max(p.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for f := range jobs {
+				if _, err := p.Refresh(ctx, f); err != nil {
+					slog.Warn("poller: refreshing feed", "feed", f.ID, "url", f.URL, "error", err)
+				}
+			}
+		}()
+	}
+	for i := range feeds {
+		jobs <- &feeds[i]
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+// Refresh fetches f and ingests its new items. The outcome of the fetch is
+// stored on f, failing feeds are retried with an exponential backoff.
+func (p *Poller) Refresh(ctx context.Context, f *model.Feed) ([]*model.Entry, error) {
+	entries, err := p.refresh(ctx, f)
+
+	now := time.Now()
+	f.LastFetchedAt = now.Unix()
+	if err != nil {
+		f.ErrorCount++
+		f.FetchError = err.Error()
+		f.NextFetchAt = now.Add(p.backoff(f.ErrorCount)).Unix()
+	} else {
+		f.ErrorCount = 0
+		f.FetchError = ""
+		interval := p.Interval
+		if p.WebSub != nil && p.WebSub.Active(ctx, f.ID) {
+			interval = max(interval, p.PushInterval)
+		}
+		f.NextFetchAt = now.Add(interval).Unix()
+	}
+	f.UpdatedAt = now.Unix()
+	if uerr := model.UpdateFeedFetch(ctx, f); uerr != nil {
+		slog.Error("poller: updating feed", "feed", f.ID, "error", uerr)
+	}
+	return entries, err
+}
+
+// tickIMAP polls the due IMAP accounts one at a time, since a mailbox
+// backlog is fetched in a single connection.
+func (p *Poller) tickIMAP(ctx context.Context) {
+	accounts, err := model.ListDueIMAPAccounts(ctx, time.Now().Unix(), p.BatchSize)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			slog.Error("poller: listing due imap accounts", "error", err)
+		}
+		return
+	}
+	for i := range accounts {
+		if ctx.Err() != nil {
+			return
+		}
+		a := &accounts[i]
+		err := newsletter.FetchIMAP(ctx, p.Pipeline, a)
+
+		now := time.Now()
+		a.LastFetchedAt = now.Unix()
+		if err != nil {
+			slog.Warn("poller: fetching imap account", "account", a.ID, "host", a.Host, "error", err)
+			a.ErrorCount++
+			a.FetchError = err.Error()
+			a.NextFetchAt = now.Add(p.backoff(a.ErrorCount)).Unix()
+		} else {
+			a.ErrorCount = 0
+			a.FetchError = ""
+			a.NextFetchAt = now.Add(p.Interval).Unix()
+		}
+		a.UpdatedAt = now.Unix()
+		if uerr := model.UpdateIMAPAccountFetch(ctx, a); uerr != nil {
+			slog.Error("poller: updating imap account", "account", a.ID, "error", uerr)
+		}
+	}
+}
+
+func (p *Poller) refresh(ctx context.Context, f *model.Feed) ([]*model.Entry, error) {
+	resp, err := fetch.Get(ctx, fetch.Request{
+		URL:          f.URL,
+		ETag:         f.ETag,
+		LastModified: f.LastModified,
+		Accept:       "application/rss+xml, application/atom+xml, application/feed+json, application/xml;q=0.9, */*;q=0.8",
+		Client:       fetch.PublicClient,
+	})
+	if err != nil {
+		return nil, err
+	}
+	if resp.NotModified {
+		return nil, nil
+	}
+	var parsed *feed.Feed
+	if f.Scrape != nil {
+		parsed, err = feed.Scrape(resp.Body, resp.URL, *f.Scrape)
+	} else {
+		parsed, err = feed.Parse(resp.Body, resp.URL)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	f.ETag = resp.ETag
+	f.LastModified = resp.LastModified
+	if parsed.Title != "" {
+		f.Title = parsed.Title
+	}
+	if parsed.SiteURL != "" {
+		f.SiteURL = parsed.SiteURL
+	}
+	f.Description = parsed.Description
+	if parsed.ImageURL != "" {
+		f.ImageURL = parsed.ImageURL
+	}
+	entries, err := p.Pipeline.Ingest(ctx, f, parsed.Items)
+	if err == nil && f.SiteURL != "" {
+		p.refreshIcon(ctx, f)
+	}
+	if err == nil && p.WebSub != nil && f.Scrape == nil {
+		if serr := p.WebSub.Discover(ctx, f, resp.Links, parsed); serr != nil {
+			slog.Warn("poller: subscribing to websub hub", "feed", f.ID, "error", serr)
+		}
+	}
+	return entries, err
+}
+
+// refreshIcon stores the icon of the website of f when it was not fetched
+// recently. Websites without a usable icon are stored with an empty one,
+// so that they are not asked on every refresh.
+func (p *Poller) refreshIcon(ctx context.Context, f *model.Feed) {
+	icon, err := model.GetFeedIcon(ctx, f.ID)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		slog.Error("poller: getting feed icon", "feed", f.ID, "error", err)
+		return
+	}
+	if icon != nil && time.Since(time.Unix(icon.UpdatedAt, 0)) < IconMaxAge {
+		return
+	}
+	mimeType, data, err := favicon.Fetch(ctx, f.SiteURL)
+	if err != nil && !errors.Is(err, favicon.ErrNotFound) {
+		return
+	}
+	if err := model.SaveFeedIcon(ctx, &model.FeedIcon{FeedID: f.ID, MimeType: mimeType, Data: data}); err != nil {
+		slog.Error("poller: saving feed icon", "feed", f.ID, "error", err)
+	}
+}
+
+// backoff returns the delay before the next fetch after n consecutive
+// failures.
+func (p *Poller) backoff(n int) time.Duration {
+	d := p.Interval
+	for i := 1; i < n && d < MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, MaxBackoff)
+}
@@ -0,0 +1,41 @@
+package poller
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/feed"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+)
+
+func TestRefreshRefusesPrivateAddresses(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the poller reached %s", r.URL)
+	}))
+	defer srv.Close()
+
+	p := &Poller{}
+	for _, u := range []string{srv.URL + "/feed.xml", "http://169.254.169.254/latest/meta-data/"} {
+		if _, err := p.refresh(t.Context(), &model.Feed{URL: u}); !errors.Is(err, fetch.ErrForbiddenAddress) {
+			t.Errorf("%s: expected ErrForbiddenAddress, got %v", u, err)
+		}
+	}
+}
+
+func TestRefreshRefusesPrivateScrapedPages(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("the poller reached %s", r.URL)
+	}))
+	defer srv.Close()
+
+	p := &Poller{}
+	scrape := &feed.ScrapeConfig{ItemSelector: "article", TitleSelector: "h2"}
+	for _, u := range []string{srv.URL + "/news", "http://10.0.0.1/intranet/"} {
+		if _, err := p.refresh(t.Context(), &model.Feed{URL: u, Scrape: scrape}); !errors.Is(err, fetch.ErrForbiddenAddress) {
+			t.Errorf("%s: expected ErrForbiddenAddress, got %v", u, err)
+		}
+	}
+}
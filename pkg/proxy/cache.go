@@ -0,0 +1,187 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Cache stores proxied files on disk, evicting the least recently used
+// files once the total size exceeds its limit. Each file holds the content
+// type on its first line followed by the body.
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu    sync.Mutex
+	size  int64
+	ll    *list.List
+	items map[string]*list.Element
+}
+
+type cacheItem struct {
+	name string
+	size int64
+}
+
+// NewCache opens the cache in dir, indexing the files already present.
+func NewCache(dir string, maxSize int64) (*Cache, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, err
+	}
+	c := &Cache{dir: dir, maxSize: maxSize, ll: list.New(), items: map[string]*list.Element{}}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	type file struct {
+		name    string
+		size    int64
+		modTime time.Time
+	}
+	var files []file
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		if filepath.Ext(e.Name()) == ".tmp" {
+			// Left over by an interrupted Put.
+			os.Remove(filepath.Join(dir, e.Name()))
+			continue
+		}
+		info, err := e.Info()
+		if err != nil {
+			continue
+		}
+		files = append(files, file{e.Name(), info.Size(), info.ModTime()})
+	}
+	// Most recently used first, as Get refreshes the modification time.
+	sort.Slice(files, func(i, j int) bool { return files[i].modTime.After(files[j].modTime) })
+	for _, f := range files {
+		c.items[f.name] = c.ll.PushBack(&cacheItem{f.name, f.size})
+		c.size += f.size
+	}
+	c.mu.Lock()
+	c.evict()
+	c.mu.Unlock()
+	return c, nil
+}
+
+func cacheName(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Get returns the cached content type and body of key.
+func (c *Cache) Get(key string) (string, []byte, bool) {
+	name := cacheName(key)
+	c.mu.Lock()
+	el, ok := c.items[name]
+	if ok {
+		c.ll.MoveToFront(el)
+	}
+	c.mu.Unlock()
+	if !ok {
+		return "", nil, false
+	}
+
+	path := filepath.Join(c.dir, name)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		c.remove(name)
+		return "", nil, false
+	}
+	now := time.Now()
+	os.Chtimes(path, now, now)
+	contentType, body, ok := bytes.Cut(data, []byte("\n"))
+	if !ok {
+		c.remove(name)
+		return "", nil, false
+	}
+	return string(contentType), body, true
+}
+
+// Put stores body under key and evicts old files if needed.
+func (c *Cache) Put(key, contentType string, body []byte) error {
+	if int64(len(body)) > c.maxSize {
+		return errors.New("proxy: file larger than the cache")
+	}
+	name := cacheName(key)
+	tmp, err := os.CreateTemp(c.dir, name+"-*.tmp")
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(tmp)
+	w.WriteString(contentType + "\n")
+	w.Write(body)
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(c.dir, name)); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	size := int64(len(contentType) + 1 + len(body))
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[name]; ok {
+		item := el.Value.(*cacheItem)
+		c.size += size - item.size
+		item.size = size
+		c.ll.MoveToFront(el)
+	} else {
+		c.items[name] = c.ll.PushFront(&cacheItem{name, size})
+		c.size += size
+	}
+	c.evict()
+	return nil
+}
+
+// Size returns the total size of the cached files.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+func (c *Cache) remove(name string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if el, ok := c.items[name]; ok {
+		c.size -= el.Value.(*cacheItem).size
+		c.ll.Remove(el)
+		delete(c.items, name)
+	}
+}
+
+// evict removes the least recently used files until the cache fits. The
+// caller holds c.mu.
+func (c *Cache) evict() {
+	for c.size > c.maxSize {
+		el := c.ll.Back()
+		if el == nil {
+			return
+		}
+		item := el.Value.(*cacheItem)
+		c.ll.Remove(el)
+		delete(c.items, item.name)
+		c.size -= item.size
+		os.Remove(filepath.Join(c.dir, item.name))
+	}
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+	"github.com/swartzfoundation/feedr/pkg/render"
+)
+
+var (
+	ErrForbiddenAddress = fetch.ErrForbiddenAddress
+	ErrContentType      = errors.New("proxy: content type is not allowed")
+	ErrTooLarge         = errors.New("proxy: file too large")
+)
+
+// client refuses to connect to private addresses so signed URLs taken from
+// feed content cannot reach internal services.
+var client = fetch.PublicClient
+
+// Mount registers the proxy handler on r.
+func Mount(r chi.Router) {
+	r.Get(Path+"{token}", serve)
+}
+
+func serve(w http.ResponseWriter, r *http.Request) {
+	rawURL, err := Decode(chi.URLParam(r, "token"))
+	if err != nil {
+		render.Error(w, http.StatusForbidden, "invalid signature")
+		return
+	}
+
+	contentType, body, ok := "", []byte(nil), false
+	if cache != nil {
+		contentType, body, ok = cache.Get(rawURL)
+	}
+	if !ok {
+		contentType, body, err = get(r.Context(), rawURL)
+		if err != nil {
+			slog.Debug("proxy: fetching", "url", rawURL, "error", err)
+			status := http.StatusBadGateway
+			if errors.Is(err, ErrContentType) {
+				status = http.StatusUnsupportedMediaType
+			}
+			render.Error(w, status, "could not fetch resource")
+			return
+		}
+		if cache != nil {
+			if err := cache.Put(rawURL, contentType, body); err != nil {
+				slog.Warn("proxy: caching", "error", err)
+			}
+		}
+	}
+
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	h.Set("Cache-Control", "public, max-age=604800")
+	h.Set("X-Content-Type-Options", "nosniff")
+	// SVG images may hold scripts when opened directly.
+	h.Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+	h.Set("Referrer-Policy", "no-referrer")
+	w.WriteHeader(http.StatusOK)
+	w.Write(body)
+}
+
+// get fetches rawURL, accepting only images no larger than maxSize.
+func get(ctx context.Context, rawURL string) (string, []byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return "", nil, err
+	}
+	req.Header.Set("User-Agent", fetch.UserAgent)
+	req.Header.Set("Accept", "image/avif,image/webp,image/*;q=0.9")
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", nil, fmt.Errorf("proxy: %s returned %s", rawURL, resp.Status)
+	}
+
+	contentType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if err != nil || !strings.HasPrefix(contentType, "image/") {
+		return "", nil, ErrContentType
+	}
+	if resp.ContentLength > maxSize {
+		return "", nil, ErrTooLarge
+	}
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxSize+1))
+	if err != nil {
+		return "", nil, err
+	}
+	if int64(len(body)) > maxSize {
+		return "", nil, ErrTooLarge
+	}
+	return contentType, body, nil
+}
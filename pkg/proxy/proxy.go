@@ -0,0 +1,99 @@
+// Package proxy serves remote images through feedr so that rendering an
+// entry does not leak the reader's IP address to the publisher. Proxied URLs
+// are signed with an HMAC so the endpoint cannot be used as an open proxy.
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/gorilla/securecookie"
+	"github.com/swartzfoundation/feedr/pkg/config"
+)
+
+// Path is the route proxied URLs are served under.
+const Path = "/proxy/"
+
+var ErrInvalidSignature = errors.New("proxy: invalid signature")
+
+var (
+	key     []byte
+	prefix  string
+	enabled bool
+	maxSize int64 = 10 << 20
+	cache   *Cache
+)
+
+// Configure sets up the proxy for the public baseURL.
+func Configure(cfg config.ProxyConfig, baseURL string) error {
+	key = []byte(cfg.Key)
+	if len(key) == 0 {
+		slog.Warn("PROXY_KEY is not set, proxied image URLs will not survive a restart")
+		key = securecookie.GenerateRandomKey(32)
+	}
+	prefix = strings.TrimSuffix(baseURL, "/") + Path
+	enabled = cfg.Enabled
+	if cfg.MaxSize > 0 {
+		maxSize = cfg.MaxSize
+	}
+	if cfg.CacheDir != "" {
+		c, err := NewCache(cfg.CacheDir, cfg.CacheSize)
+		if err != nil {
+			return err
+		}
+		cache = c
+	}
+	return nil
+}
+
+// Enabled reports whether entry images are rewritten to go through the
+// proxy.
+func Enabled() bool {
+	return enabled && len(key) > 0
+}
+
+func sign(rawURL string) string {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(rawURL))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Encode returns the signed token identifying rawURL, of the form
+// "<signature>.<base64url encoded URL>".
+func Encode(rawURL string) string {
+	return sign(rawURL) + "." + base64.RawURLEncoding.EncodeToString([]byte(rawURL))
+}
+
+// Decode verifies token and returns the URL it identifies.
+func Decode(token string) (string, error) {
+	sig, encoded, ok := strings.Cut(token, ".")
+	if !ok {
+		return "", ErrInvalidSignature
+	}
+	raw, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(sign(string(raw)))) {
+		return "", ErrInvalidSignature
+	}
+	return string(raw), nil
+}
+
+// URL returns the proxied address of rawURL. URLs that are not absolute
+// http(s) URLs or are already proxied are returned unchanged.
+func URL(rawURL string) string {
+	if !Enabled() || strings.HasPrefix(rawURL, prefix) {
+		return rawURL
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return rawURL
+	}
+	return prefix + Encode(rawURL)
+}
@@ -0,0 +1,107 @@
+package proxy
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func setup(t *testing.T) {
+	t.Helper()
+	key, prefix, enabled = []byte("secret"), "https://feedr.example.com/proxy/", true
+	t.Cleanup(func() { key, prefix, enabled = nil, "", false })
+}
+
+func TestEncodeDecode(t *testing.T) {
+	setup(t)
+	const raw = "https://example.com/a.png?size=large"
+	token := Encode(raw)
+	got, err := Decode(token)
+	if err != nil || got != raw {
+		t.Fatalf("Decode(Encode(%q)) = %q, %v", raw, got, err)
+	}
+
+	sig, _, _ := strings.Cut(token, ".")
+	forged := sig + "." + strings.TrimPrefix(Encode("https://internal/"), sig+".")
+	if _, err := Decode(forged); err != ErrInvalidSignature {
+		t.Errorf("expected forged token to be rejected, got %v", err)
+	}
+	if _, err := Decode("garbage"); err != ErrInvalidSignature {
+		t.Errorf("expected malformed token to be rejected, got %v", err)
+	}
+}
+
+func TestURL(t *testing.T) {
+	setup(t)
+	proxied := URL("https://example.com/a.png")
+	if !strings.HasPrefix(proxied, "https://feedr.example.com/proxy/") {
+		t.Fatalf("unexpected proxied URL %q", proxied)
+	}
+	if URL(proxied) != proxied {
+		t.Errorf("expected proxied URL to be left unchanged")
+	}
+	for _, raw := range []string{"data:image/png;base64,AA", "/relative.png", ""} {
+		if got := URL(raw); got != raw {
+			t.Errorf("URL(%q) = %q expected it unchanged", raw, got)
+		}
+	}
+}
+
+func TestRewriteHTML(t *testing.T) {
+	setup(t)
+	content := `<p>Hi <a href="https://example.com/">link</a></p><img src="https://example.com/a.png" srcset="https://example.com/a.png 1x, https://example.com/b.png 2x"/>`
+	got := RewriteHTML(content)
+	if strings.Contains(got, `src="https://example.com`) || strings.Contains(got, `, https://example.com`) {
+		t.Errorf("expected images to be proxied:\n%s", got)
+	}
+	if !strings.Contains(got, `href="https://example.com/"`) {
+		t.Errorf("expected links to be left unchanged:\n%s", got)
+	}
+	if strings.Count(got, "https://feedr.example.com/proxy/") != 3 {
+		t.Errorf("expected 3 proxied URLs:\n%s", got)
+	}
+
+	enabled = false
+	if RewriteHTML(content) != content {
+		t.Errorf("expected content unchanged with the proxy disabled")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	dir := t.TempDir()
+	c, err := NewCache(dir, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	body := bytes.Repeat([]byte("x"), 10)
+	for _, key := range []string{"a", "b", "c"} {
+		if err := c.Put(key, "image/png", body); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Each file takes 20 bytes, touching "a" makes "b" the oldest.
+	if _, _, ok := c.Get("a"); !ok {
+		t.Fatalf("expected a to be cached")
+	}
+	if err := c.Put("d", "image/png", body); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, ok := c.Get("b"); ok {
+		t.Errorf("expected b to be evicted")
+	}
+	ct, got, ok := c.Get("a")
+	if !ok || ct != "image/png" || !bytes.Equal(got, body) {
+		t.Errorf("unexpected cached a: %q %q %v", ct, got, ok)
+	}
+	if c.Size() > 60 {
+		t.Errorf("cache size %d exceeds limit", c.Size())
+	}
+
+	reopened, err := NewCache(dir, 60)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.Size() != c.Size() {
+		t.Errorf("reopened cache size %d expected %d", reopened.Size(), c.Size())
+	}
+}
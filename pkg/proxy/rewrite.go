@@ -0,0 +1,72 @@
+package proxy
+
+import (
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// RewriteHTML rewrites the image and poster URLs of the sanitized HTML
+// fragment content to go through the proxy. Entries are stored with their
+// original URLs and rewritten when served, so that changing the proxy key
+// or disabling the proxy does not require migrating stored content.
+func RewriteHTML(content string) string {
+	if !Enabled() || !strings.Contains(content, "<") {
+		return content
+	}
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(content), context)
+	if err != nil {
+		return content
+	}
+
+	var changed bool
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			for i, a := range n.Attr {
+				switch {
+				case a.Key == "src" && (n.DataAtom == atom.Img || n.DataAtom == atom.Source && n.Parent != nil && n.Parent.DataAtom == atom.Picture),
+					a.Key == "poster" && n.DataAtom == atom.Video:
+					n.Attr[i].Val = URL(a.Val)
+				case a.Key == "srcset":
+					n.Attr[i].Val = rewriteSrcset(a.Val)
+				default:
+					continue
+				}
+				changed = changed || n.Attr[i].Val != a.Val
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	for _, n := range nodes {
+		walk(n)
+	}
+	if !changed {
+		return content
+	}
+
+	var b strings.Builder
+	for _, n := range nodes {
+		if err := html.Render(&b, n); err != nil {
+			return content
+		}
+	}
+	return b.String()
+}
+
+func rewriteSrcset(srcset string) string {
+	candidates := strings.Split(srcset, ",")
+	for i, c := range candidates {
+		fields := strings.Fields(c)
+		if len(fields) == 0 {
+			continue
+		}
+		fields[0] = URL(fields[0])
+		candidates[i] = strings.Join(fields, " ")
+	}
+	return strings.Join(candidates, ", ")
+}
@@ -0,0 +1,178 @@
+// Package publish serves the public Atom feeds of the folders users publish
+// and pushes their updates to subscribers through feedr's WebSub hub.
+package publish
+
+import (
+	"context"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/websub"
+)
+
+// Path is the path published feeds are served under, followed by the
+// publish token of the folder.
+const Path = "/published/"
+
+// ContentType is the media type of published feeds.
+const ContentType = "application/atom+xml; charset=utf-8"
+
+// maxEntries is the number of latest entries a published feed holds.
+const maxEntries = 50
+
+// Publisher serves published folders and publishes them to the hub when
+// their feeds get new entries.
+type Publisher struct {
+	Hub *websub.Hub
+}
+
+// New returns a publisher registering the published feeds as topics of hub.
+func New(hub *websub.Hub) *Publisher {
+	p := &Publisher{Hub: hub}
+	hub.Handle(Path, p.topic)
+	return p
+}
+
+// URL is the URL of the feed published under token.
+func (p *Publisher) URL(token string) string {
+	return p.Hub.BaseURL + Path + token
+}
+
+// Mount registers the published feeds on r.
+func (p *Publisher) Mount(r chi.Router) {
+	r.Get(Path+"{token}", p.serve)
+}
+
+func (p *Publisher) serve(w http.ResponseWriter, r *http.Request) {
+	token := chi.URLParam(r, "token")
+	body, err := p.render(r.Context(), token)
+	if err != nil {
+		if errors.Is(err, model.ErrNotFound) {
+			http.NotFound(w, r)
+			return
+		}
+		slog.Error("publish: rendering feed", "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", ContentType)
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, p.Hub.URL()))
+	w.Header().Add("Link", fmt.Sprintf(`<%s>; rel="self"`, p.URL(token)))
+	w.Write(body)
+}
+
+// topic renders a published feed for the hub.
+func (p *Publisher) topic(ctx context.Context, topic string) (string, []byte, error) {
+	body, err := p.render(ctx, strings.TrimPrefix(topic, p.Hub.BaseURL+Path))
+	return ContentType, body, err
+}
+
+func (p *Publisher) render(ctx context.Context, token string) ([]byte, error) {
+	f, err := model.GetPublishedFolder(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := model.ListEntries(ctx, model.EntryQuery{UserID: f.UserID, FolderID: f.ID, Limit: maxEntries})
+	if err != nil {
+		return nil, err
+	}
+	return Atom(f.Name, p.URL(token), p.Hub.URL(), entries)
+}
+
+// Stored publishes the folders f is filed under, so their subscribers get
+// the new entries. It runs after the filter rules, which may hide them.
+func (p *Publisher) Stored(ctx context.Context, f *model.Feed, entries []*model.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	tokens, err := model.ListFeedPublishTokens(ctx, f.ID)
+	if err != nil {
+		return err
+	}
+	for _, token := range tokens {
+		if err := p.Hub.Publish(ctx, p.URL(token)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type atomFeed struct {
+	XMLName xml.Name    `xml:"http://www.w3.org/2005/Atom feed"`
+	ID      string      `xml:"id"`
+	Title   string      `xml:"title"`
+	Updated string      `xml:"updated"`
+	Links   []atomLink  `xml:"link"`
+	Entries []atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Rel  string `xml:"rel,attr,omitempty"`
+	Href string `xml:"href,attr"`
+}
+
+type atomEntry struct {
+	ID        string     `xml:"id"`
+	Title     string     `xml:"title"`
+	Updated   string     `xml:"updated"`
+	Published string     `xml:"published,omitempty"`
+	Author    *atomName  `xml:"author"`
+	Links     []atomLink `xml:"link"`
+	Content   atomText   `xml:"content"`
+}
+
+type atomName struct {
+	Name string `xml:"name"`
+}
+
+type atomText struct {
+	Type string `xml:"type,attr"`
+	Body string `xml:",chardata"`
+}
+
+// Atom renders entries as an Atom feed titled title, linking to its own URL
+// and to the hub.
+func Atom(title, selfURL, hubURL string, entries []model.UserEntry) ([]byte, error) {
+	feed := atomFeed{
+		ID:    selfURL,
+		Title: title,
+		Links: []atomLink{{Rel: "self", Href: selfURL}, {Rel: "hub", Href: hubURL}},
+	}
+	var updated int64
+	for _, e := range entries {
+		ae := atomEntry{
+			ID:      fmt.Sprintf("%s#%d", selfURL, e.ID),
+			Title:   e.Title,
+			Updated: atomTime(max(e.UpdatedAt, e.PublishedAt)),
+			Content: atomText{Type: "html", Body: e.Content},
+		}
+		if e.PublishedAt != 0 {
+			ae.Published = atomTime(e.PublishedAt)
+		}
+		if e.Author != "" {
+			ae.Author = &atomName{Name: e.Author}
+		}
+		if e.URL != "" {
+			ae.Links = []atomLink{{Rel: "alternate", Href: e.URL}}
+		}
+		feed.Entries = append(feed.Entries, ae)
+		updated = max(updated, e.UpdatedAt, e.PublishedAt)
+	}
+	feed.Updated = atomTime(updated)
+	b, err := xml.Marshal(feed)
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), b...), nil
+}
+
+func atomTime(unix int64) string {
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
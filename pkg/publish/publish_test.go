@@ -0,0 +1,36 @@
+package publish
+
+import (
+	"testing"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/feed"
+)
+
+func TestAtom(t *testing.T) {
+	const self = "https://feedr.example.com/published/abc"
+	entries := []model.UserEntry{
+		{Entry: model.Entry{ID: 2, URL: "https://example.com/b", Title: "B & C", Author: "Ada", Content: "<p>Body</p>", PublishedAt: 1700000100}},
+		{Entry: model.Entry{ID: 1, URL: "https://example.com/a", Title: "A", PublishedAt: 1700000000}},
+	}
+	data, err := Atom("Reading", self, "https://feedr.example.com/websub/hub", entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := feed.Parse(data, self)
+	if err != nil {
+		t.Fatalf("Parse: %v\n%s", err, data)
+	}
+	if f.Title != "Reading" || f.SelfURL != self || f.HubURL != "https://feedr.example.com/websub/hub" {
+		t.Errorf("unexpected feed %q %q %q", f.Title, f.SelfURL, f.HubURL)
+	}
+	if len(f.Items) != 2 {
+		t.Fatalf("expected 2 items, got %d", len(f.Items))
+	}
+	it := f.Items[0]
+	if it.GUID != self+"#2" || it.URL != "https://example.com/b" || it.Title != "B & C" || it.Author != "Ada" ||
+		it.Content != "<p>Body</p>" || it.Published.Unix() != 1700000100 {
+		t.Errorf("unexpected item %+v", it)
+	}
+}
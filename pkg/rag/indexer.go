@@ -0,0 +1,130 @@
+package rag
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/llm"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+	"github.com/swartzfoundation/feedr/pkg/summary"
+)
+
+const (
+	// chunkSize is the number of characters of a passage.
+	chunkSize = 1500
+	// maxEntryChunks bounds the passages of an entry; the rest of long
+	// articles is not searched.
+	maxEntryChunks = 20
+	// indexBatch is the number of entries embedded at once.
+	indexBatch = 20
+	// indexWindow is the age of the oldest entries indexed.
+	indexWindow = 30 * 24 * time.Hour
+)
+
+// Indexer embeds the passages of new entries of subscribed feeds.
+type Indexer struct {
+	Interval time.Duration
+}
+
+// NewIndexer returns an indexer checking for new entries every minute.
+func NewIndexer() *Indexer {
+	return &Indexer{Interval: time.Minute}
+}
+
+// Run indexes entries until ctx is cancelled.
+func (ix *Indexer) Run(ctx context.Context) {
+	ticker := time.NewTicker(ix.Interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := ix.index(ctx)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					slog.Error("rag: indexing entries", "error", err)
+				}
+				break
+			}
+			if n < indexBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// index embeds a batch of entries and returns its size. An entry the API
+// rejects is marked indexed without passages, so it does not hold up the
+// others; the batch stops when the API is unavailable and is retried later.
+func (ix *Indexer) index(ctx context.Context) (int, error) {
+	after := time.Now().Add(-indexWindow).Unix()
+	entries, err := model.ListEntriesToIndex(ctx, after, indexBatch)
+	if err != nil {
+		return 0, err
+	}
+	for i := range entries {
+		err := indexEntry(ctx, &entries[i])
+		if err == nil {
+			continue
+		}
+		if ctx.Err() != nil || llm.Temporary(err) {
+			return 0, err
+		}
+		slog.Warn("rag: skipping entry", "entry", entries[i].ID, "error", err)
+		if err := model.SaveEntryChunks(ctx, entries[i].ID, nil); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
+
+// indexEntry replaces the passages of e.
+func indexEntry(ctx context.Context, e *model.Entry) error {
+	texts := Passages(e)
+	var chunks []model.EntryChunk
+	if len(texts) > 0 {
+		embeddings, err := embedder.Embed(ctx, texts)
+		if err != nil {
+			return err
+		}
+		for i, text := range texts {
+			chunks = append(chunks, model.EntryChunk{
+				Position:  i,
+				Text:      text,
+				Model:     embeddingModel,
+				Dims:      len(embeddings[i]),
+				Embedding: embeddings[i],
+			})
+		}
+	}
+	return model.SaveEntryChunks(ctx, e.ID, chunks)
+}
+
+// Passages splits the text of e into the passages embedded. Each starts with
+// the title, which gives context to the passages of long articles.
+func Passages(e *model.Entry) []string {
+	title := sanitize.Text(e.Title)
+	text := sanitize.Text(e.Body())
+	if text == "" {
+		text = title
+	}
+	if text == "" {
+		return nil
+	}
+	chunks := summary.Chunks(text, chunkSize)
+	if len(chunks) > maxEntryChunks {
+		chunks = chunks[:maxEntryChunks]
+	}
+	if title != "" && text != title {
+		for i := range chunks {
+			chunks[i] = title + "\n" + chunks[i]
+		}
+	}
+	return chunks
+}
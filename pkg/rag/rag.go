@@ -0,0 +1,215 @@
+// Package rag answers questions about the entries of a user's feeds. Recent
+// entries are split into passages whose embeddings are stored; a question
+// retrieves the passages closest to it, with pgvector when the database has
+// it and by comparing embeddings in memory otherwise, and a chat model
+// answers from them, citing the entries it used.
+package rag
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/llm"
+)
+
+const (
+	// topChunks is the number of passages given to the chat model.
+	topChunks = 8
+	// maxScan bounds the passages compared in memory without pgvector; only
+	// the newest entries are searched.
+	maxScan = 5000
+	// excerptLength bounds the excerpts of the citations, in characters.
+	excerptLength = 300
+)
+
+const answerPrompt = "You answer questions about articles of the user's news feeds. " +
+	"Answer only from the numbered sources below, in the language of the question. " +
+	"Cite the sources you use as [1], [2] after the sentences they support. " +
+	"If the sources do not answer the question, say so briefly."
+
+var ErrDisabled = errors.New("rag: no OpenAI-compatible API is configured")
+
+// Embedder computes the embeddings of texts. llm.Client is one.
+type Embedder interface {
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+}
+
+var (
+	client   *llm.Client
+	embedder Embedder
+	// embeddingModel names the embedding space of embedder.
+	embeddingModel string
+)
+
+// Configure sets up the API questions are answered with.
+func Configure(cfg config.OpenAIConfig) {
+	client = llm.New(cfg)
+	embedder = nil
+	if client != nil {
+		embedder = client
+		embeddingModel = client.EmbeddingModel
+	}
+}
+
+// Enabled reports whether an API is configured.
+func Enabled() bool {
+	return client != nil && embedder != nil
+}
+
+// Query is a question about the entries of the user, optionally limited to
+// a feed or a folder.
+type Query struct {
+	Question string
+	FeedID   int64
+	FolderID int64
+}
+
+// Citation is an entry the answer is based on.
+type Citation struct {
+	// Source is the number the answer cites the entry with.
+	Source  int    `json:"source"`
+	EntryID int64  `json:"entry_id"`
+	Title   string `json:"title"`
+	URL     string `json:"url"`
+	Excerpt string `json:"excerpt"`
+}
+
+// Answer is the answer to a question.
+type Answer struct {
+	Answer    string     `json:"answer"`
+	Citations []Citation `json:"citations"`
+}
+
+// Ask answers q from the entries visible to the user.
+func Ask(ctx context.Context, userID string, q Query) (*Answer, error) {
+	if !Enabled() {
+		return nil, ErrDisabled
+	}
+	embeddings, err := embedder.Embed(ctx, []string{q.Question})
+	if err != nil {
+		return nil, err
+	}
+	v := model.Vector(embeddings[0])
+
+	eq := model.EntryQuery{UserID: userID, FeedID: q.FeedID, FolderID: q.FolderID}
+	var matches []model.ChunkMatch
+	if model.VectorSearch() {
+		matches, err = model.NearestChunks(ctx, eq, embeddingModel, v, topChunks)
+	} else {
+		matches, err = model.ListRecentChunks(ctx, eq, embeddingModel, len(v), maxScan)
+		matches = nearest(matches, v, topChunks)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(matches) == 0 {
+		return &Answer{Answer: "None of your entries answer this question.", Citations: []Citation{}}, nil
+	}
+
+	text, sources := prompt(matches)
+	reply, err := client.Chat(ctx, []llm.Message{
+		{Role: "system", Content: answerPrompt},
+		{Role: "user", Content: text + "\nQuestion: " + q.Question},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &Answer{Answer: reply, Citations: cite(reply, sources)}, nil
+}
+
+// Cosine returns the cosine similarity of a and b, 0 when their lengths
+// differ or either is zero.
+func Cosine(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, na, nb float64
+	for i := range a {
+		dot += float64(a[i]) * float64(b[i])
+		na += float64(a[i]) * float64(a[i])
+		nb += float64(b[i]) * float64(b[i])
+	}
+	if na == 0 || nb == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(na*nb)
+}
+
+// nearest returns the n chunks closest to v, setting their distance.
+func nearest(chunks []model.ChunkMatch, v []float32, n int) []model.ChunkMatch {
+	for i := range chunks {
+		chunks[i].Distance = 1 - Cosine(chunks[i].Embedding, v)
+	}
+	slices.SortStableFunc(chunks, func(a, b model.ChunkMatch) int {
+		switch {
+		case a.Distance < b.Distance:
+			return -1
+		case a.Distance > b.Distance:
+			return 1
+		}
+		return 0
+	})
+	return chunks[:min(n, len(chunks))]
+}
+
+// prompt lists the chunks as numbered sources, one number per entry, and
+// returns the citation of each source.
+func prompt(chunks []model.ChunkMatch) (string, []Citation) {
+	var sources []Citation
+	number := map[int64]int{}
+	var b strings.Builder
+	for _, c := range chunks {
+		n, ok := number[c.EntryID]
+		if !ok {
+			sources = append(sources, Citation{
+				Source:  len(sources) + 1,
+				EntryID: c.EntryID,
+				Title:   c.Title,
+				URL:     c.URL,
+				Excerpt: excerpt(c.Text),
+			})
+			n = len(sources)
+			number[c.EntryID] = n
+		}
+		fmt.Fprintf(&b, "[%d] %s\n%s\n\n", n, c.Title, c.Text)
+	}
+	return b.String(), sources
+}
+
+var citationPattern = regexp.MustCompile(`\[(\d+)\]`)
+
+// cite returns the sources the answer cites, in order of first citation.
+func cite(answer string, sources []Citation) []Citation {
+	cited := []Citation{}
+	seen := map[int]bool{}
+	for _, m := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		n, err := strconv.Atoi(m[1])
+		if err != nil || n < 1 || n > len(sources) || seen[n] {
+			continue
+		}
+		seen[n] = true
+		cited = append(cited, sources[n-1])
+	}
+	return cited
+}
+
+// excerpt shortens text to excerptLength characters, at a word boundary.
+func excerpt(text string) string {
+	r := []rune(text)
+	if len(r) <= excerptLength {
+		return text
+	}
+	s := string(r[:excerptLength])
+	if i := strings.LastIndexByte(s, ' '); i > 0 {
+		s = s[:i]
+	}
+	return s + "…"
+}
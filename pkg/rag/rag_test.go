@@ -0,0 +1,74 @@
+package rag
+
+import (
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/swartzfoundation/feedr/model"
+)
+
+func TestCosine(t *testing.T) {
+	tests := []struct {
+		a, b []float32
+		want float64
+	}{
+		{[]float32{1, 0}, []float32{2, 0}, 1},
+		{[]float32{1, 0}, []float32{0, 1}, 0},
+		{[]float32{1, 1}, []float32{-1, -1}, -1},
+		{[]float32{1, 0}, []float32{1, 0, 0}, 0},
+		{[]float32{0, 0}, []float32{1, 0}, 0},
+	}
+	for _, tt := range tests {
+		if got := Cosine(tt.a, tt.b); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("Cosine(%v, %v) = %v, want %v", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func chunk(entryID int64, text string, v ...float32) model.ChunkMatch {
+	return model.ChunkMatch{EntryChunk: model.EntryChunk{EntryID: entryID, Text: text, Embedding: v}, Title: text}
+}
+
+func TestNearest(t *testing.T) {
+	chunks := []model.ChunkMatch{chunk(1, "far", 0, 1), chunk(2, "near", 1, 0.1), chunk(3, "exact", 1, 0)}
+	got := nearest(chunks, []float32{1, 0}, 2)
+	if len(got) != 2 || got[0].EntryID != 3 || got[1].EntryID != 2 {
+		t.Errorf("nearest = %+v, want entries 3 and 2", got)
+	}
+}
+
+func TestPromptAndCite(t *testing.T) {
+	chunks := []model.ChunkMatch{chunk(7, "first"), chunk(9, "second"), chunk(7, "third")}
+	text, sources := prompt(chunks)
+	if len(sources) != 2 || sources[0].EntryID != 7 || sources[1].EntryID != 9 {
+		t.Fatalf("sources = %+v", sources)
+	}
+	if !strings.Contains(text, "[1] third") || !strings.Contains(text, "[2] second") {
+		t.Errorf("prompt = %q, want passages numbered per entry", text)
+	}
+
+	got := cite("Yes [2]. Also [1][2], not [3].", sources)
+	if len(got) != 2 || got[0].EntryID != 9 || got[1].EntryID != 7 {
+		t.Errorf("cite = %+v, want entries 9 and 7", got)
+	}
+	if got := cite("No sources.", sources); got == nil || len(got) != 0 {
+		t.Errorf("cite without citations = %#v, want empty", got)
+	}
+}
+
+func TestPassages(t *testing.T) {
+	e := &model.Entry{Title: "Title", Content: "<p>" + strings.Repeat("Some words here. ", 200) + "</p>"}
+	got := Passages(e)
+	if len(got) < 2 {
+		t.Fatalf("Passages = %d passages, want several", len(got))
+	}
+	for _, p := range got {
+		if !strings.HasPrefix(p, "Title\n") || len(p) > chunkSize+len("Title\n") {
+			t.Errorf("passage %q, want the title and at most %d characters", p[:20], chunkSize)
+		}
+	}
+	if got := Passages(&model.Entry{}); got != nil {
+		t.Errorf("Passages of an empty entry = %v, want none", got)
+	}
+}
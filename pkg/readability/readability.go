@@ -0,0 +1,727 @@
+// Package readability extracts the main article of a web page, dropping
+// navigation, sidebars, comments and ads. It follows the scoring approach of
+// the original Arc90 Readability bookmarklet.
+package readability
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+var ErrNoContent = errors.New("readability: no article content found")
+
+// Article is the readable part of a page.
+type Article struct {
+	Title string
+	// Content is the cleaned article HTML.
+	Content string
+	// ImageURL is the lead image of the article, if any.
+	ImageURL string
+	// Excerpt is the first paragraph of the article as plain text.
+	Excerpt string
+}
+
+var (
+	unlikelyRe   = regexp.MustCompile(`(?i)banner|breadcrumbs|combx|comment|community|cover-wrap|disqus|extra|footer|gdpr|header|legends|menu|related|remark|replies|rss|shoutbox|sidebar|skyscraper|social|sponsor|supplemental|ad-break|agegate|pagination|pager|popup|yom-remote|cookie|newsletter|share`)
+	maybeRe      = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+	positiveRe   = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|pagination|post|text|blog|story`)
+	negativeRe   = regexp.MustCompile(`(?i)-ad-|hidden|^hid$| hid$| hid |^hid |banner|combx|comment|com-|contact|foot|footer|footnote|gdpr|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|tags|tool|widget`)
+	videoRe      = regexp.MustCompile(`(?i)//(www\.)?((dailymotion|youtube|youtube-nocookie|player\.vimeo|v\.qq)\.com|(archive|upload\.wikimedia)\.org|player\.twitch\.tv)`)
+	whitespaceRe = regexp.MustCompile(`\s+`)
+)
+
+// removedTags never hold article content.
+var removedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Link: true,
+	atom.Nav: true, atom.Aside: true, atom.Form: true, atom.Button: true,
+	atom.Input: true, atom.Select: true, atom.Textarea: true, atom.Svg: true,
+	atom.Template: true, atom.Object: true, atom.Embed: true,
+}
+
+// blockTags make a div a container rather than a paragraph.
+var blockTags = map[atom.Atom]bool{
+	atom.Blockquote: true, atom.Dl: true, atom.Div: true,
+	atom.Ol: true, atom.P: true, atom.Pre: true,
+	atom.Table: true, atom.Ul: true, atom.Section: true, atom.Article: true,
+	atom.Figure: true, atom.H1: true, atom.H2: true, atom.H3: true,
+	atom.H4: true, atom.H5: true, atom.H6: true,
+}
+
+// Options override the heuristics for sites they fail on.
+type Options struct {
+	// Include are CSS selectors matching the article content. When set,
+	// the matching elements are used as-is instead of scoring the page.
+	Include []string
+	// Exclude are CSS selectors matching elements removed from the page
+	// before extraction.
+	Exclude []string
+}
+
+// Extract returns the article of the HTML page served at pageURL. Relative
+// links and images are resolved against pageURL.
+func Extract(data []byte, pageURL string) (*Article, error) {
+	return ExtractWith(data, pageURL, Options{})
+}
+
+// ExtractWith is like Extract but applies the selectors of opts.
+func ExtractWith(data []byte, pageURL string, opts Options) (*Article, error) {
+	include, err := compileSelectors(opts.Include)
+	if err != nil {
+		return nil, err
+	}
+	exclude, err := compileSelectors(opts.Exclude)
+	if err != nil {
+		return nil, err
+	}
+	doc, err := html.Parse(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	base, _ := url.Parse(pageURL)
+	if b := find(doc, atom.Base); b != nil {
+		if href := attr(b, "href"); href != "" && base != nil {
+			if u, err := base.Parse(href); err == nil {
+				base = u
+			}
+		}
+	}
+
+	a := &Article{
+		Title:    pageTitle(doc),
+		ImageURL: metaContent(doc, "og:image", "twitter:image"),
+	}
+	if a.ImageURL != "" && base != nil {
+		a.ImageURL = resolve(base, a.ImageURL)
+	}
+
+	body := find(doc, atom.Body)
+	if body == nil {
+		return nil, ErrNoContent
+	}
+	for _, n := range exclude.MatchAll(body) {
+		if n.Parent != nil {
+			n.Parent.RemoveChild(n)
+		}
+	}
+
+	var content *html.Node
+	if len(include) > 0 {
+		content = selectContent(body, include)
+	} else {
+		prepare(body)
+		e := &extractor{scores: map[*html.Node]float64{}}
+		top := e.topCandidate(body)
+		if top == nil {
+			return nil, ErrNoContent
+		}
+		content = e.collect(top)
+		clean(content)
+	}
+	if base != nil {
+		resolveURLs(content, base)
+	}
+	if textLength(content) < 25 {
+		return nil, ErrNoContent
+	}
+
+	if img := find(content, atom.Img); img != nil {
+		if a.ImageURL == "" {
+			a.ImageURL = attr(img, "src")
+		}
+	} else if a.ImageURL != "" {
+		lead := &html.Node{Type: html.ElementNode, Data: "img", DataAtom: atom.Img,
+			Attr: []html.Attribute{{Key: "src", Val: a.ImageURL}}}
+		content.InsertBefore(lead, content.FirstChild)
+	}
+	if p := find(content, atom.P); p != nil {
+		a.Excerpt = innerText(p)
+	}
+
+	var buf bytes.Buffer
+	if err := html.Render(&buf, content); err != nil {
+		return nil, err
+	}
+	a.Content = buf.String()
+	return a, nil
+}
+
+// selectorGroup matches the union of its selectors.
+type selectorGroup []cascadia.Matcher
+
+func compileSelectors(selectors []string) (selectorGroup, error) {
+	var group selectorGroup
+	for _, s := range selectors {
+		sel, err := cascadia.ParseGroup(s)
+		if err != nil {
+			return nil, fmt.Errorf("readability: invalid selector %q: %w", s, err)
+		}
+		group = append(group, sel)
+	}
+	return group, nil
+}
+
+// MatchAll returns the elements below n matching any selector, in document
+// order.
+func (g selectorGroup) MatchAll(n *html.Node) []*html.Node {
+	if len(g) == 0 {
+		return nil
+	}
+	var matches []*html.Node
+	walk(n, func(c *html.Node) {
+		for _, sel := range g {
+			if sel.Match(c) {
+				matches = append(matches, c)
+				return
+			}
+		}
+	})
+	return matches
+}
+
+// selectContent copies the elements matching include into a div, skipping
+// matches nested in an earlier match.
+func selectContent(body *html.Node, include selectorGroup) *html.Node {
+	out := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	var last *html.Node
+	for _, n := range include.MatchAll(body) {
+		if last != nil && isAncestor(last, n) {
+			continue
+		}
+		out.AppendChild(cloneDetached(n))
+		last = n
+	}
+	removeTags(out)
+	walk(out, func(n *html.Node) {
+		if n != out {
+			stripAttributes(n)
+		}
+	})
+	return out
+}
+
+// removeTags removes comments and elements that never hold content.
+func removeTags(n *html.Node) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		if c.Type == html.CommentNode || c.Type == html.ElementNode && removedTags[c.DataAtom] {
+			n.RemoveChild(c)
+		} else {
+			removeTags(c)
+		}
+		c = next
+	}
+}
+
+func isAncestor(a, n *html.Node) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p == a {
+			return true
+		}
+	}
+	return false
+}
+
+// prepare removes nodes that never hold content and unlikely candidates.
+func prepare(body *html.Node) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			switch {
+			case c.Type == html.CommentNode:
+				n.RemoveChild(c)
+			case c.Type != html.ElementNode:
+			case removedTags[c.DataAtom] || c.DataAtom == atom.Iframe && !videoRe.MatchString(attr(c, "src")):
+				n.RemoveChild(c)
+			case isHidden(c) || isUnlikely(c):
+				n.RemoveChild(c)
+			default:
+				walk(c)
+			}
+			c = next
+		}
+	}
+	walk(body)
+}
+
+func isHidden(n *html.Node) bool {
+	if hasAttr(n, "hidden") || attr(n, "aria-hidden") == "true" {
+		return true
+	}
+	style := strings.ReplaceAll(attr(n, "style"), " ", "")
+	return strings.Contains(style, "display:none") || strings.Contains(style, "visibility:hidden")
+}
+
+func isUnlikely(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.Body, atom.Article, atom.Main, atom.A:
+		return false
+	case atom.Header, atom.Footer:
+		return true
+	}
+	if attr(n, "role") == "complementary" || attr(n, "role") == "navigation" {
+		return true
+	}
+	match := attr(n, "class") + " " + attr(n, "id")
+	if !unlikelyRe.MatchString(match) || maybeRe.MatchString(match) {
+		return false
+	}
+	return !hasAncestor(n, atom.Table) && !hasAncestor(n, atom.Code)
+}
+
+type extractor struct {
+	scores map[*html.Node]float64
+}
+
+// topCandidate scores every paragraph's ancestors and returns the best one.
+func (e *extractor) topCandidate(body *html.Node) *html.Node {
+	var candidates []*html.Node
+	walk(body, func(n *html.Node) {
+		if !isScorable(n) {
+			return
+		}
+		text := innerText(n)
+		if len(text) < 25 {
+			return
+		}
+		score := 1 + float64(strings.Count(text, ",")+strings.Count(text, "，"))
+		score += math.Min(float64(len(text))/100, 3)
+
+		level := 0
+		for p := n.Parent; p != nil && p.Type == html.ElementNode && level < 3; p = p.Parent {
+			if _, ok := e.scores[p]; !ok {
+				e.scores[p] = initialScore(p)
+				candidates = append(candidates, p)
+			}
+			switch level {
+			case 0:
+				e.scores[p] += score
+			case 1:
+				e.scores[p] += score / 2
+			default:
+				e.scores[p] += score / float64(level*3)
+			}
+			level++
+		}
+	})
+
+	var top *html.Node
+	for _, c := range candidates {
+		e.scores[c] *= 1 - linkDensity(c)
+		if top == nil || e.scores[c] > e.scores[top] {
+			top = c
+		}
+	}
+	if top == nil {
+		return nil
+	}
+
+	// A parent scoring nearly as well usually holds more of the article,
+	// such as a second column of paragraphs.
+	for p := top.Parent; p != nil && p.DataAtom != atom.Body; p = p.Parent {
+		score, ok := e.scores[p]
+		if !ok || score < e.scores[top]*0.75 {
+			break
+		}
+		if countChildren(p) > 1 {
+			top = p
+		}
+	}
+	return top
+}
+
+func isScorable(n *html.Node) bool {
+	if n.Type != html.ElementNode {
+		return false
+	}
+	switch n.DataAtom {
+	case atom.P, atom.Pre, atom.Td:
+		return true
+	case atom.Div, atom.Section:
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if c.Type == html.ElementNode && blockTags[c.DataAtom] {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
+
+func initialScore(n *html.Node) float64 {
+	score := classWeight(n)
+	switch n.DataAtom {
+	case atom.Div, atom.Article, atom.Main:
+		score += 5
+	case atom.Pre, atom.Td, atom.Blockquote:
+		score += 3
+	case atom.Address, atom.Ol, atom.Ul, atom.Dl, atom.Dd, atom.Dt, atom.Li, atom.Form:
+		score -= 3
+	case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6, atom.Th:
+		score -= 5
+	}
+	return score
+}
+
+func classWeight(n *html.Node) float64 {
+	var w float64
+	for _, s := range []string{attr(n, "class"), attr(n, "id")} {
+		if s == "" {
+			continue
+		}
+		if negativeRe.MatchString(s) {
+			w -= 25
+		}
+		if positiveRe.MatchString(s) {
+			w += 25
+		}
+	}
+	return w
+}
+
+// collect returns a div holding top and the siblings that look like part of
+// the same article.
+func (e *extractor) collect(top *html.Node) *html.Node {
+	out := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	threshold := math.Max(10, e.scores[top]*0.2)
+	for s := top.Parent.FirstChild; s != nil; s = s.NextSibling {
+		if s.Type != html.ElementNode {
+			continue
+		}
+		keep := s == top
+		if !keep {
+			if score, ok := e.scores[s]; ok && score+sameClassBonus(top, s) >= threshold {
+				keep = true
+			} else if s.DataAtom == atom.P {
+				text := innerText(s)
+				density := linkDensity(s)
+				switch {
+				case len(text) > 80 && density < 0.25:
+					keep = true
+				case len(text) > 0 && density == 0 && strings.HasSuffix(text, "."):
+					keep = true
+				}
+			}
+		}
+		if keep {
+			out.AppendChild(cloneDetached(s))
+		}
+	}
+	return out
+}
+
+func sameClassBonus(top, s *html.Node) float64 {
+	if c := attr(top, "class"); c != "" && c == attr(s, "class") {
+		return 0.2 * math.Max(0, classWeight(top)+10)
+	}
+	return 0
+}
+
+// clean removes clutter left inside the article. The collected blocks
+// themselves are kept; only their descendants are cleaned.
+func clean(content *html.Node) {
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		for c := n.FirstChild; c != nil; {
+			next := c.NextSibling
+			if c.Type == html.ElementNode {
+				if n != content && shouldDrop(c) {
+					n.RemoveChild(c)
+					c = next
+					continue
+				}
+				walk(c)
+				stripAttributes(c)
+			}
+			c = next
+		}
+	}
+	walk(content)
+}
+
+// shouldDrop implements the conditional cleaning of lists, tables and divs
+// that look like link farms or widgets rather than prose.
+func shouldDrop(n *html.Node) bool {
+	switch n.DataAtom {
+	case atom.H1, atom.H2, atom.H3:
+		return classWeight(n) < 0 || linkDensity(n) > 0.33
+	case atom.Table, atom.Ul, atom.Ol, atom.Div, atom.Section, atom.Figure:
+	default:
+		return false
+	}
+	if hasAncestor(n, atom.Pre) || hasAncestor(n, atom.Code) {
+		return false
+	}
+	weight := classWeight(n)
+	if weight < 0 {
+		return true
+	}
+	text := innerText(n)
+	if strings.Count(text, ",") >= 10 {
+		return false
+	}
+
+	var p, img, embeds, inputs int
+	walk(n, func(c *html.Node) {
+		switch c.DataAtom {
+		case atom.P:
+			p++
+		case atom.Img:
+			img++
+		case atom.Iframe, atom.Video:
+			embeds++
+		case atom.Input:
+			inputs++
+		}
+	})
+	density := linkDensity(n)
+	isList := n.DataAtom == atom.Ul || n.DataAtom == atom.Ol
+	switch {
+	case img > 1 && float64(p)/float64(img) < 0.5 && n.DataAtom != atom.Figure:
+		return true
+	case inputs > p/3:
+		return true
+	case !isList && len(text) < 25 && (img == 0 || img > 2) && embeds == 0:
+		return true
+	case weight < 25 && density > 0.2:
+		return true
+	case weight >= 25 && density > 0.5:
+		return true
+	case embeds == 1 && len(text) < 75 || embeds > 1:
+		return !isList && n.DataAtom != atom.Figure
+	}
+	return false
+}
+
+// keptAttributes are the attributes preserved on article elements.
+var keptAttributes = map[string]bool{
+	"href": true, "src": true, "srcset": true, "alt": true, "title": true,
+	"width": true, "height": true, "colspan": true, "rowspan": true,
+	"datetime": true, "cite": true, "controls": true, "poster": true,
+	"type": true, "allowfullscreen": true,
+}
+
+func stripAttributes(n *html.Node) {
+	// Lazy loaded images keep their real source in a data attribute.
+	if n.DataAtom == atom.Img {
+		for _, key := range []string{"data-src", "data-original", "data-lazy-src"} {
+			if v := attr(n, key); v != "" {
+				setAttr(n, "src", v)
+				break
+			}
+		}
+	}
+	attrs := n.Attr[:0]
+	for _, a := range n.Attr {
+		if keptAttributes[a.Key] {
+			attrs = append(attrs, a)
+		}
+	}
+	n.Attr = attrs
+}
+
+// resolveURLs makes links and media sources absolute and drops javascript
+// links.
+func resolveURLs(content *html.Node, base *url.URL) {
+	walk(content, func(n *html.Node) {
+		for i, a := range n.Attr {
+			switch a.Key {
+			case "href", "src", "poster":
+				if strings.HasPrefix(strings.ToLower(strings.TrimSpace(a.Val)), "javascript:") {
+					n.Attr[i].Val = "#"
+					continue
+				}
+				n.Attr[i].Val = resolve(base, a.Val)
+			case "srcset":
+				parts := strings.Split(a.Val, ",")
+				for j, p := range parts {
+					fields := strings.Fields(p)
+					if len(fields) == 0 {
+						continue
+					}
+					fields[0] = resolve(base, fields[0])
+					parts[j] = strings.Join(fields, " ")
+				}
+				n.Attr[i].Val = strings.Join(parts, ", ")
+			}
+		}
+	})
+}
+
+func resolve(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(ref)
+	if ref == "" || strings.HasPrefix(ref, "#") || strings.HasPrefix(ref, "data:") {
+		return ref
+	}
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ref
+	}
+	return u.String()
+}
+
+// pageTitle prefers the Open Graph title, which omits the site name most
+// <title> elements carry.
+func pageTitle(doc *html.Node) string {
+	if t := metaContent(doc, "og:title", "twitter:title"); t != "" {
+		return t
+	}
+	if t := find(doc, atom.Title); t != nil {
+		return innerText(t)
+	}
+	if h := find(doc, atom.H1); h != nil {
+		return innerText(h)
+	}
+	return ""
+}
+
+// metaContent returns the content of the first meta tag whose property or
+// name is one of keys, in order of keys.
+func metaContent(doc *html.Node, keys ...string) string {
+	values := map[string]string{}
+	walk(doc, func(n *html.Node) {
+		if n.DataAtom != atom.Meta {
+			return
+		}
+		key := attr(n, "property")
+		if key == "" {
+			key = attr(n, "name")
+		}
+		if _, ok := values[key]; !ok {
+			values[key] = strings.TrimSpace(attr(n, "content"))
+		}
+	})
+	for _, k := range keys {
+		if v := values[k]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func linkDensity(n *html.Node) float64 {
+	total := len(innerText(n))
+	if total == 0 {
+		return 0
+	}
+	var links int
+	walk(n, func(c *html.Node) {
+		if c.DataAtom == atom.A && c != n {
+			links += len(innerText(c))
+		}
+	})
+	return float64(links) / float64(total)
+}
+
+func textLength(n *html.Node) int {
+	return len(innerText(n))
+}
+
+// innerText returns the text of n with whitespace collapsed.
+func innerText(n *html.Node) string {
+	var b strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			b.WriteString(n.Data)
+			b.WriteByte(' ')
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	collect(n)
+	return strings.TrimSpace(whitespaceRe.ReplaceAllString(b.String(), " "))
+}
+
+// walk calls fn for every element below and including n.
+func walk(n *html.Node, fn func(*html.Node)) {
+	if n.Type == html.ElementNode {
+		fn(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		walk(c, fn)
+	}
+}
+
+func find(n *html.Node, a atom.Atom) *html.Node {
+	if n.Type == html.ElementNode && n.DataAtom == a {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := find(c, a); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func hasAncestor(n *html.Node, a atom.Atom) bool {
+	for p := n.Parent; p != nil; p = p.Parent {
+		if p.DataAtom == a {
+			return true
+		}
+	}
+	return false
+}
+
+func countChildren(n *html.Node) int {
+	var count int
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if c.Type == html.ElementNode {
+			count++
+		}
+	}
+	return count
+}
+
+// cloneDetached deep copies n without its parent and siblings.
+func cloneDetached(n *html.Node) *html.Node {
+	c := &html.Node{
+		Type:     n.Type,
+		Data:     n.Data,
+		DataAtom: n.DataAtom,
+		Attr:     append([]html.Attribute(nil), n.Attr...),
+	}
+	for child := n.FirstChild; child != nil; child = child.NextSibling {
+		c.AppendChild(cloneDetached(child))
+	}
+	return c
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func hasAttr(n *html.Node, key string) bool {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
@@ -0,0 +1,112 @@
+package readability
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+func extractFile(t *testing.T, name, pageURL string) *Article {
+	t.Helper()
+	data, err := os.ReadFile("testdata/" + name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := Extract(data, pageURL)
+	if err != nil {
+		t.Fatalf("Extract(%s) returned error %v", name, err)
+	}
+	return a
+}
+
+func TestExtractBlog(t *testing.T) {
+	a := extractFile(t, "blog.html", "https://eng.example.com/blog/build-system")
+
+	if a.Title != "Why We Rewrote Our Build System" {
+		t.Errorf("unexpected title %q", a.Title)
+	}
+	for _, want := range []string{
+		"For years, our monorepo was built",
+		"We evaluated several options",
+		"Build times are now under five minutes",
+		`src="https://eng.example.com/blog/images/graph.png"`,
+		`href="https://eng.example.com/migration-guide"`,
+	} {
+		if !strings.Contains(a.Content, want) {
+			t.Errorf("expected content to contain %q\n%s", want, a.Content)
+		}
+	}
+	for _, unwanted := range []string{
+		"Popular posts", "Great post", "Copyright", "Tweet", "window.analytics", "class=",
+	} {
+		if strings.Contains(a.Content, unwanted) {
+			t.Errorf("expected content not to contain %q\n%s", unwanted, a.Content)
+		}
+	}
+	if a.ImageURL != "https://eng.example.com/blog/images/graph.png" {
+		t.Errorf("expected first image as lead image, got %q", a.ImageURL)
+	}
+}
+
+func TestExtractNews(t *testing.T) {
+	a := extractFile(t, "news.html", "https://news.example.net/2024/park")
+
+	for _, want := range []string{
+		"The city council voted seven to two",
+		"Construction is expected to begin",
+		"Residents who spoke at the meeting",
+		`href="https://news.example.net/local/plans.pdf"`,
+	} {
+		if !strings.Contains(a.Content, want) {
+			t.Errorf("expected content to contain %q\n%s", want, a.Content)
+		}
+	}
+	for _, unwanted := range []string{"Advertisement", "Council budget", "Weather", "javascript:"} {
+		if strings.Contains(a.Content, unwanted) {
+			t.Errorf("expected content not to contain %q\n%s", unwanted, a.Content)
+		}
+	}
+	if a.ImageURL != "https://news.example.net/media/park-lead.jpg" {
+		t.Errorf("unexpected lead image %q", a.ImageURL)
+	}
+	if !strings.HasPrefix(a.Content, `<div><img src="https://news.example.net/media/park-lead.jpg"/>`) {
+		t.Errorf("expected lead image to be prepended\n%s", a.Content)
+	}
+	if !strings.HasPrefix(a.Title, "City council approves new park") {
+		t.Errorf("unexpected title %q", a.Title)
+	}
+}
+
+func TestExtractNoContent(t *testing.T) {
+	if _, err := Extract([]byte("<html><body><nav><a href='/'>Home</a></nav></body></html>"), ""); err != ErrNoContent {
+		t.Errorf("expected ErrNoContent, got %v", err)
+	}
+}
+
+func TestExtractWithSelectors(t *testing.T) {
+	data, err := os.ReadFile("testdata/blog.html")
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := ExtractWith(data, "https://eng.example.com/blog/build-system", Options{
+		Include: []string{"article.post p", "#comments"},
+		Exclude: []string{".byline"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"For years, our monorepo", "Great post"} {
+		if !strings.Contains(a.Content, want) {
+			t.Errorf("expected content to contain %q\n%s", want, a.Content)
+		}
+	}
+	for _, unwanted := range []string{"Sam Lee", "Dependency graph", "Popular posts"} {
+		if strings.Contains(a.Content, unwanted) {
+			t.Errorf("expected content not to contain %q\n%s", unwanted, a.Content)
+		}
+	}
+
+	if _, err := ExtractWith(data, "", Options{Include: []string{"p["}}); err == nil {
+		t.Errorf("expected error for invalid selector")
+	}
+}
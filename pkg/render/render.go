@@ -0,0 +1,34 @@
+package render
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+)
+
+// JSON writes v as a JSON response with the given status code.
+func JSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("render: encoding json", "error", err)
+	}
+}
+
+// Error writes a JSON error body of the form {"error": msg}.
+func Error(w http.ResponseWriter, status int, msg string) {
+	JSON(w, status, map[string]string{"error": msg})
+}
+
+// Text writes a plain text response with the given status code.
+func Text(w http.ResponseWriter, status int, body string) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.WriteHeader(status)
+	w.Write([]byte(body))
+}
+
+// DecodeJSON decodes the request body into v.
+func DecodeJSON(r *http.Request, v any) error {
+	defer r.Body.Close()
+	return json.NewDecoder(r.Body).Decode(v)
+}
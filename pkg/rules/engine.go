@@ -0,0 +1,380 @@
+package rules
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+)
+
+var (
+	ErrInvalidAction = errors.New("rules: action type must be read, star, tag, delete, notify or webhook")
+	ErrInvalidTag    = errors.New("rules: tag actions need a tag of at most 64 characters")
+	ErrInvalidURL    = errors.New("rules: webhook actions need an http or https URL")
+)
+
+// Validate compiles the condition of r and checks its actions, normalizing
+// their tags.
+func Validate(r *model.Rule) error {
+	if _, err := Compile(r.Condition); err != nil {
+		return err
+	}
+	if len(r.Actions) == 0 {
+		return errors.New("rules: a rule needs at least one action")
+	}
+	for i := range r.Actions {
+		a := &r.Actions[i]
+		switch a.Type {
+		case model.RuleActionRead, model.RuleActionStar, model.RuleActionDelete, model.RuleActionNotify:
+		case model.RuleActionTag:
+			a.Tag = model.NormalizeTag(a.Tag)
+			if a.Tag == "" || len(a.Tag) > model.MaxTagLength {
+				return ErrInvalidTag
+			}
+		case model.RuleActionWebhook:
+			u, err := url.Parse(a.URL)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return ErrInvalidURL
+			}
+		default:
+			return ErrInvalidAction
+		}
+	}
+	return nil
+}
+
+// NewEnv returns the fields of e as seen by the subscriber of its feed.
+func NewEnv(sub *model.Subscription, e *model.Entry) *Env {
+	env := &Env{
+		Title:   e.Title,
+		Content: sanitize.Text(e.Body()),
+		Author:  e.Author,
+		URL:     e.URL,
+		Feed:    sub.DisplayTitle(),
+		FeedURL: sub.Feed.URL,
+		FeedID:  e.FeedID,
+	}
+	if sub.Folder != nil {
+		env.Folder = sub.Folder.Name
+	}
+	return env
+}
+
+// compiled is a rule with its parsed condition.
+type compiled struct {
+	rule *model.Rule
+	expr Expr
+}
+
+// compileRules compiles the rules, skipping those whose condition no longer
+// parses.
+func compileRules(rules []model.Rule) []compiled {
+	out := make([]compiled, 0, len(rules))
+	for i := range rules {
+		expr, err := Compile(rules[i].Condition)
+		if err != nil {
+			slog.Warn("rules: skipping invalid rule", "rule", rules[i].ID, "error", err)
+			continue
+		}
+		out = append(out, compiled{&rules[i], expr})
+	}
+	return out
+}
+
+// match is an action to apply to an entry because of a rule.
+type match struct {
+	rule   *model.Rule
+	action model.RuleAction
+}
+
+// evaluate returns the actions of the rules matching env, in order. Rules
+// after one that stops processing or deletes the entry are not evaluated.
+func evaluate(rules []compiled, env *Env) []match {
+	var matches []match
+	for _, c := range rules {
+		if !c.expr.Match(env) {
+			continue
+		}
+		deleted := false
+		for _, a := range c.rule.Actions {
+			matches = append(matches, match{c.rule, a})
+			deleted = deleted || a.Type == model.RuleActionDelete
+		}
+		if c.rule.StopProcessing || deleted {
+			break
+		}
+	}
+	return matches
+}
+
+// webhookQueue bounds the webhooks waiting to be posted. Webhooks matched
+// while it is full are dropped.
+const webhookQueue = 1000
+
+// Engine is an ingest hook applying the enabled rules of each subscriber of
+// a feed to its new entries. Webhooks are posted by Run.
+type Engine struct {
+	// Client posts to webhooks; it must not reach private addresses.
+	Client *http.Client
+	// Workers is the number of webhooks posted concurrently.
+	Workers int
+
+	webhooks chan webhook
+}
+
+// NewEngine returns an engine posting webhooks with fetch.PublicClient.
+func NewEngine() *Engine {
+	return &Engine{
+		Client:   fetch.PublicClient,
+		Workers:  4,
+		webhooks: make(chan webhook, webhookQueue),
+	}
+}
+
+// Run posts the queued webhooks until ctx is cancelled.
+func (eng *Engine) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for range max(eng.Workers, 1) {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case w := <-eng.webhooks:
+					eng.post(ctx, w)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// enqueue queues w for Run and reports whether there was room for it.
+// Webhooks must not hold up ingestion.
+func (eng *Engine) enqueue(w webhook) bool {
+	select {
+	case eng.webhooks <- w:
+		return true
+	default:
+		slog.Warn("rules: dropping webhook, the queue is full", "user", w.userID, "rule", w.payload.RuleID)
+		return false
+	}
+}
+
+// Stored applies the rules to the entries of f that were just stored.
+func (eng *Engine) Stored(ctx context.Context, f *model.Feed, entries []*model.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	subs, err := model.ListFeedSubscriptions(ctx, f.ID)
+	if err != nil {
+		return err
+	}
+	userIDs := make([]string, len(subs))
+	for i, s := range subs {
+		userIDs[i] = s.UserID
+	}
+	all, err := model.ListEnabledRules(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	byUser := map[string][]model.Rule{}
+	for _, r := range all {
+		byUser[r.UserID] = append(byUser[r.UserID], r)
+	}
+
+	var errs []error
+	for i := range subs {
+		sub := &subs[i]
+		rules := compileRules(byUser[sub.UserID])
+		if len(rules) == 0 {
+			continue
+		}
+		var p plan
+		for _, e := range entries {
+			p.add(e, evaluate(rules, NewEnv(sub, e)))
+		}
+		if err := eng.apply(ctx, sub, &p); err != nil {
+			errs = append(errs, fmt.Errorf("applying rules of user %s: %w", sub.UserID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+type webhook struct {
+	userID  string
+	url     string
+	payload webhookPayload
+}
+
+// plan collects the actions to apply for one user.
+type plan struct {
+	read, star, deleted []int64
+	tags                []model.EntryTag
+	notifications       []model.Notification
+	webhooks            []webhook
+}
+
+func (p *plan) add(e *model.Entry, matches []match) {
+	for _, m := range matches {
+		switch m.action.Type {
+		case model.RuleActionRead:
+			p.read = append(p.read, e.ID)
+		case model.RuleActionStar:
+			p.star = append(p.star, e.ID)
+		case model.RuleActionDelete:
+			p.deleted = append(p.deleted, e.ID)
+		case model.RuleActionTag:
+			p.tags = append(p.tags, model.EntryTag{EntryID: e.ID, Tag: m.action.Tag})
+		case model.RuleActionNotify:
+			p.notifications = append(p.notifications, model.Notification{EntryID: e.ID, RuleID: m.rule.ID, Title: e.Title})
+		case model.RuleActionWebhook:
+			p.webhooks = append(p.webhooks, webhook{url: m.action.URL, payload: newPayload(m.rule, e)})
+		}
+	}
+}
+
+func (eng *Engine) apply(ctx context.Context, sub *model.Subscription, p *plan) error {
+	for i := range p.tags {
+		p.tags[i].UserID = sub.UserID
+	}
+	for i := range p.notifications {
+		p.notifications[i].UserID = sub.UserID
+	}
+	err := errors.Join(
+		model.SkipEntries(ctx, sub.UserID, p.read),
+		model.SetEntriesStarred(ctx, sub.UserID, p.star, true),
+		model.DeleteEntries(ctx, sub.UserID, p.deleted),
+		model.AddEntryTags(ctx, p.tags),
+		model.CreateNotifications(ctx, p.notifications),
+	)
+	for _, w := range p.webhooks {
+		w.userID = sub.UserID
+		eng.enqueue(w)
+	}
+	return err
+}
+
+// webhookPayload is the JSON body posted to webhooks.
+type webhookPayload struct {
+	RuleID      int64  `json:"rule_id"`
+	Rule        string `json:"rule"`
+	EntryID     int64  `json:"entry_id"`
+	FeedID      int64  `json:"feed_id"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	Author      string `json:"author,omitempty"`
+	PublishedAt int64  `json:"published_at"`
+}
+
+func newPayload(r *model.Rule, e *model.Entry) webhookPayload {
+	return webhookPayload{
+		RuleID:      r.ID,
+		Rule:        r.Name,
+		EntryID:     e.ID,
+		FeedID:      e.FeedID,
+		Title:       e.Title,
+		URL:         e.URL,
+		Author:      e.Author,
+		PublishedAt: e.PublishedAt,
+	}
+}
+
+func (eng *Engine) post(ctx context.Context, w webhook) {
+	ctx, cancel := context.WithTimeout(ctx, 30*time.Second)
+	defer cancel()
+	body, err := json.Marshal(w.payload)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.url, bytes.NewReader(body))
+	if err != nil {
+		slog.Warn("rules: building webhook request", "rule", w.payload.RuleID, "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", fetch.UserAgent)
+	resp, err := eng.Client.Do(req)
+	if err != nil {
+		slog.Warn("rules: posting webhook", "user", w.userID, "rule", w.payload.RuleID, "error", err)
+		return
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		slog.Warn("rules: webhook failed", "user", w.userID, "rule", w.payload.RuleID, "status", resp.StatusCode)
+	}
+}
+
+// DryRunMatch is an entry a condition would have matched.
+type DryRunMatch struct {
+	EntryID     int64  `json:"entry_id"`
+	FeedID      int64  `json:"feed_id"`
+	Feed        string `json:"feed"`
+	Title       string `json:"title"`
+	URL         string `json:"url"`
+	PublishedAt int64  `json:"published_at"`
+}
+
+// DryRunResult reports the entries a condition would have matched.
+type DryRunResult struct {
+	// Scanned is the number of entries the condition was evaluated on.
+	Scanned int `json:"scanned"`
+	// Matched is the number of matching entries, of which Matches lists
+	// the newest.
+	Matched int           `json:"matched"`
+	Matches []DryRunMatch `json:"matches"`
+}
+
+// DryRun evaluates a condition on the user's entries matching q, newest
+// first, and lists up to maxMatches of the matches. Nothing is modified.
+func DryRun(ctx context.Context, condition string, q model.EntryQuery, maxMatches int) (*DryRunResult, error) {
+	expr, err := Compile(condition)
+	if err != nil {
+		return nil, err
+	}
+	subs, err := model.ListSubscriptions(ctx, q.UserID)
+	if err != nil {
+		return nil, err
+	}
+	byFeed := make(map[int64]*model.Subscription, len(subs))
+	for i := range subs {
+		byFeed[subs[i].FeedID] = &subs[i]
+	}
+	entries, err := model.ListEntries(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &DryRunResult{Scanned: len(entries), Matches: []DryRunMatch{}}
+	for i := range entries {
+		e := &entries[i].Entry
+		sub := byFeed[e.FeedID]
+		if sub == nil || !expr.Match(NewEnv(sub, e)) {
+			continue
+		}
+		res.Matched++
+		if len(res.Matches) < maxMatches {
+			res.Matches = append(res.Matches, DryRunMatch{
+				EntryID:     e.ID,
+				FeedID:      e.FeedID,
+				Feed:        sub.DisplayTitle(),
+				Title:       e.Title,
+				URL:         e.URL,
+				PublishedAt: e.PublishedAt,
+			})
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,351 @@
+// Package rules implements the users' filter rules: a condition written in
+// a small expression language over entry fields, and the actions applied to
+// the new entries that match it.
+//
+// A condition compares fields with values and combines comparisons with
+// and, or, not and parentheses:
+//
+//	title matches /sponsored/i
+//	feed == "Krebs on Security" and author == "Brian Krebs"
+//	content contains "CVE-" or folder == "Security"
+//
+// The fields are title, content, author, url, feed, feed_url, folder,
+// feed_id and text, the title followed by the content. The operators are
+// contains, startswith, endswith, == and != which ignore case, and matches
+// which takes a regular expression, /pattern/ with an optional i flag or a
+// string.
+package rules
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Env holds the fields of an entry a condition is evaluated against.
+// Content is plain text.
+type Env struct {
+	Title   string
+	Content string
+	Author  string
+	URL     string
+	Feed    string
+	FeedURL string
+	Folder  string
+	FeedID  int64
+}
+
+func (env *Env) field(name string) string {
+	switch name {
+	case "title":
+		return env.Title
+	case "content":
+		return env.Content
+	case "author":
+		return env.Author
+	case "url":
+		return env.URL
+	case "feed":
+		return env.Feed
+	case "feed_url":
+		return env.FeedURL
+	case "folder":
+		return env.Folder
+	case "feed_id":
+		return strconv.FormatInt(env.FeedID, 10)
+	case "text":
+		return env.Title + "\n" + env.Content
+	}
+	return ""
+}
+
+var fields = map[string]bool{
+	"title": true, "content": true, "author": true, "url": true, "feed": true,
+	"feed_url": true, "folder": true, "feed_id": true, "text": true,
+}
+
+// Expr is a compiled condition.
+type Expr interface {
+	Match(env *Env) bool
+}
+
+type andExpr struct{ left, right Expr }
+
+func (e andExpr) Match(env *Env) bool { return e.left.Match(env) && e.right.Match(env) }
+
+type orExpr struct{ left, right Expr }
+
+func (e orExpr) Match(env *Env) bool { return e.left.Match(env) || e.right.Match(env) }
+
+type notExpr struct{ expr Expr }
+
+func (e notExpr) Match(env *Env) bool { return !e.expr.Match(env) }
+
+type cmpExpr struct {
+	field string
+	op    string
+	value string
+	re    *regexp.Regexp
+}
+
+func (e cmpExpr) Match(env *Env) bool {
+	v := env.field(e.field)
+	switch e.op {
+	case "matches":
+		return e.re.MatchString(v)
+	case "contains":
+		return strings.Contains(strings.ToLower(v), e.value)
+	case "startswith":
+		return strings.HasPrefix(strings.ToLower(v), e.value)
+	case "endswith":
+		return strings.HasSuffix(strings.ToLower(v), e.value)
+	case "==":
+		return strings.EqualFold(v, e.value)
+	case "!=":
+		return !strings.EqualFold(v, e.value)
+	}
+	return false
+}
+
+// SyntaxError reports an invalid condition.
+type SyntaxError struct {
+	// Pos is the byte offset of the error in the condition.
+	Pos int
+	Msg string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("rules: %s at offset %d", e.Msg, e.Pos)
+}
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokString
+	tokRegexp
+	tokNumber
+	tokOp
+	tokLParen
+	tokRParen
+)
+
+type token struct {
+	kind  tokenKind
+	text  string
+	flags string
+	pos   int
+}
+
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{kind: tokLParen, pos: i})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{kind: tokRParen, pos: i})
+			i++
+		case c == '=' || c == '!':
+			if i+1 >= len(src) || src[i+1] != '=' {
+				return nil, &SyntaxError{i, "expected == or !="}
+			}
+			tokens = append(tokens, token{kind: tokOp, text: src[i : i+2], pos: i})
+			i += 2
+		case c == '"' || c == '/':
+			text, end, err := quoted(src, i)
+			if err != nil {
+				return nil, err
+			}
+			t := token{kind: tokString, text: text, pos: i}
+			if c == '/' {
+				t.kind = tokRegexp
+				for end < len(src) && src[end] == 'i' {
+					t.flags = "i"
+					end++
+				}
+			}
+			tokens = append(tokens, t)
+			i = end
+		case c >= '0' && c <= '9':
+			j := i
+			for j < len(src) && src[j] >= '0' && src[j] <= '9' {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokNumber, text: src[i:j], pos: i})
+			i = j
+		case c == '_' || unicode.IsLetter(rune(c)):
+			j := i
+			for j < len(src) && (src[j] == '_' || unicode.IsLetter(rune(src[j])) || unicode.IsDigit(rune(src[j]))) {
+				j++
+			}
+			tokens = append(tokens, token{kind: tokIdent, text: strings.ToLower(src[i:j]), pos: i})
+			i = j
+		default:
+			return nil, &SyntaxError{i, fmt.Sprintf("unexpected %q", c)}
+		}
+	}
+	return append(tokens, token{kind: tokEOF, pos: len(src)}), nil
+}
+
+// quoted reads the string or regular expression starting with the
+// delimiter at src[start], in which a backslash escapes the delimiter. It
+// returns the text and the offset after the closing delimiter.
+func quoted(src string, start int) (string, int, error) {
+	delim := src[start]
+	var b strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		switch {
+		case src[i] == '\\' && i+1 < len(src) && (src[i+1] == delim || (delim == '"' && src[i+1] == '\\')):
+			b.WriteByte(src[i+1])
+			i++
+		case src[i] == delim:
+			return b.String(), i + 1, nil
+		default:
+			b.WriteByte(src[i])
+		}
+	}
+	return "", 0, &SyntaxError{start, "unterminated " + map[byte]string{'"': "string", '/': "regular expression"}[delim]}
+}
+
+type parser struct {
+	tokens []token
+	i      int
+}
+
+func (p *parser) peek() token { return p.tokens[p.i] }
+
+func (p *parser) next() token {
+	t := p.tokens[p.i]
+	if t.kind != tokEOF {
+		p.i++
+	}
+	return t
+}
+
+func (p *parser) keyword(word string) bool {
+	if t := p.peek(); t.kind == tokIdent && t.text == word {
+		p.i++
+		return true
+	}
+	return false
+}
+
+// Compile parses a condition.
+func Compile(src string) (Expr, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	if p.peek().kind == tokEOF {
+		return nil, &SyntaxError{0, "empty condition"}
+	}
+	e, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.kind != tokEOF {
+		return nil, &SyntaxError{t.pos, "expected and, or or the end of the condition"}
+	}
+	return e, nil
+}
+
+func (p *parser) or() (Expr, error) {
+	left, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("or") {
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) and() (Expr, error) {
+	left, err := p.not()
+	if err != nil {
+		return nil, err
+	}
+	for p.keyword("and") {
+		right, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left, right}
+	}
+	return left, nil
+}
+
+func (p *parser) not() (Expr, error) {
+	if p.keyword("not") {
+		e, err := p.not()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{e}, nil
+	}
+	return p.primary()
+}
+
+func (p *parser) primary() (Expr, error) {
+	t := p.next()
+	if t.kind == tokLParen {
+		e, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if closing := p.next(); closing.kind != tokRParen {
+			return nil, &SyntaxError{closing.pos, "expected )"}
+		}
+		return e, nil
+	}
+	if t.kind != tokIdent || !fields[t.text] {
+		return nil, &SyntaxError{t.pos, "expected a field such as title or content"}
+	}
+	field := t.text
+
+	op := p.next()
+	switch {
+	case op.kind == tokOp:
+	case op.kind == tokIdent && (op.text == "contains" || op.text == "matches" || op.text == "startswith" || op.text == "endswith"):
+	default:
+		return nil, &SyntaxError{op.pos, "expected an operator such as contains or matches"}
+	}
+
+	v := p.next()
+	e := cmpExpr{field: field, op: op.text, value: strings.ToLower(v.text)}
+	switch {
+	case v.kind == tokRegexp && op.text != "matches":
+		return nil, &SyntaxError{v.pos, "regular expressions require matches"}
+	case v.kind == tokRegexp || (v.kind == tokString && op.text == "matches"):
+		pattern := v.text
+		if v.flags == "i" {
+			pattern = "(?i)" + pattern
+		}
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, &SyntaxError{v.pos, "invalid regular expression: " + err.Error()}
+		}
+		e.re = re
+	case v.kind == tokString:
+	case v.kind == tokNumber && field == "feed_id":
+	default:
+		return nil, &SyntaxError{v.pos, "expected a string or a regular expression"}
+	}
+	if field == "feed_id" && (v.kind != tokNumber || (op.text != "==" && op.text != "!=")) {
+		return nil, &SyntaxError{v.pos, "feed_id compares with == or != and a number"}
+	}
+	return e, nil
+}
@@ -0,0 +1,184 @@
+package rules
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/swartzfoundation/feedr/model"
+)
+
+var env = &Env{
+	Title:   "Sponsored: the best VPN of 2024",
+	Content: "Patch for CVE-2024-1234 released",
+	Author:  "Brian Krebs",
+	URL:     "https://krebsonsecurity.com/2024/05/post/",
+	Feed:    "Krebs on Security",
+	FeedURL: "https://krebsonsecurity.com/feed/",
+	Folder:  "Security",
+	FeedID:  12,
+}
+
+func TestMatch(t *testing.T) {
+	var tests = []struct {
+		condition string
+		want      bool
+	}{
+		{`title matches /sponsored/i`, true},
+		{`title matches /sponsored/`, false},
+		{`title matches "^Sponsored:"`, true},
+		{`feed == "krebs on security" and author == "Brian Krebs"`, true},
+		{`feed == "Krebs" and author == "Brian Krebs"`, false},
+		{`content contains "CVE-"`, true},
+		{`text contains "vpn" and not folder == "News"`, true},
+		{`author != "brian krebs" or url startswith "https://krebsonsecurity.com/"`, true},
+		{`url endswith "/post/" and (feed_id == 3 or feed_id == 12)`, true},
+		{`feed_id != 12`, false},
+		{`not (title contains "vpn" or content contains "patch")`, false},
+		{`title contains "a \"quoted\" word"`, false},
+		{`url matches /krebsonsecurity\.com\/2024\//`, true},
+	}
+	for _, tt := range tests {
+		expr, err := Compile(tt.condition)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.condition, err)
+			continue
+		}
+		if got := expr.Match(env); got != tt.want {
+			t.Errorf("%s: got %v, want %v", tt.condition, got, tt.want)
+		}
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	var tests = []struct {
+		condition string
+		pos       int
+	}{
+		{``, 0},
+		{`title`, 5},
+		{`body contains "x"`, 0},
+		{`title is "x"`, 6},
+		{`title contains "x`, 15},
+		{`title contains /x/`, 15},
+		{`title matches /(/`, 14},
+		{`feed_id contains "1"`, 17},
+		{`title contains "x" and`, 22},
+		{`(title contains "x"`, 19},
+		{`title contains "x" feed == "y"`, 19},
+		{`title = "x"`, 6},
+		{`title contains 'x'`, 15},
+	}
+	for _, tt := range tests {
+		_, err := Compile(tt.condition)
+		var syntax *SyntaxError
+		if !errors.As(err, &syntax) {
+			t.Errorf("%s: expected a syntax error, got %v", tt.condition, err)
+			continue
+		}
+		if syntax.Pos != tt.pos {
+			t.Errorf("%s: expected error at %d, got %v", tt.condition, tt.pos, err)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	rules := compileRules([]model.Rule{
+		{ID: 1, Condition: `title contains "sponsored"`, Actions: []model.RuleAction{{Type: model.RuleActionRead}}},
+		{ID: 2, Condition: `folder == "security"`, Actions: []model.RuleAction{{Type: model.RuleActionTag, Tag: "security"}}, StopProcessing: true},
+		{ID: 3, Condition: `content contains "cve-"`, Actions: []model.RuleAction{{Type: model.RuleActionNotify}}},
+		{ID: 4, Condition: `title contains (`},
+	})
+	if len(rules) != 3 {
+		t.Fatalf("expected the invalid rule to be skipped, got %d rules", len(rules))
+	}
+	matches := evaluate(rules, env)
+	if len(matches) != 2 || matches[0].rule.ID != 1 || matches[1].action.Tag != "security" {
+		t.Errorf("expected rules 1 and 2 to apply, got %+v", matches)
+	}
+
+	rules = compileRules([]model.Rule{
+		{ID: 1, Condition: `title contains "vpn"`, Actions: []model.RuleAction{{Type: model.RuleActionDelete}}},
+		{ID: 2, Condition: `title contains "vpn"`, Actions: []model.RuleAction{{Type: model.RuleActionStar}}},
+	})
+	if matches := evaluate(rules, env); len(matches) != 1 || matches[0].action.Type != model.RuleActionDelete {
+		t.Errorf("expected evaluation to stop after deletion, got %+v", matches)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	r := &model.Rule{
+		Condition: `title contains "x"`,
+		Actions: []model.RuleAction{
+			{Type: model.RuleActionTag, Tag: "  Security   News "},
+			{Type: model.RuleActionWebhook, URL: "https://hooks.example.com/feedr"},
+		},
+	}
+	if err := Validate(r); err != nil {
+		t.Fatalf("unexpected error %v", err)
+	}
+	if r.Actions[0].Tag != "security news" {
+		t.Errorf("expected the tag to be normalized, got %q", r.Actions[0].Tag)
+	}
+
+	var tests = []struct {
+		action model.RuleAction
+		err    error
+	}{
+		{model.RuleAction{Type: "archive"}, ErrInvalidAction},
+		{model.RuleAction{Type: model.RuleActionTag, Tag: " "}, ErrInvalidTag},
+		{model.RuleAction{Type: model.RuleActionWebhook, URL: "ftp://example.com/"}, ErrInvalidURL},
+	}
+	for _, tt := range tests {
+		r := &model.Rule{Condition: `title contains "x"`, Actions: []model.RuleAction{tt.action}}
+		if err := Validate(r); !errors.Is(err, tt.err) {
+			t.Errorf("%+v: expected %v, got %v", tt.action, tt.err, err)
+		}
+	}
+	if err := Validate(&model.Rule{Condition: `title contains "x"`}); err == nil {
+		t.Errorf("expected a rule without actions to be rejected")
+	}
+}
+
+func TestWebhooks(t *testing.T) {
+	posted := make(chan webhookPayload)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var p webhookPayload
+		if err := json.NewDecoder(r.Body).Decode(&p); err != nil {
+			t.Error(err)
+		}
+		posted <- p
+	}))
+	defer srv.Close()
+
+	eng := NewEngine()
+	eng.Client = srv.Client()
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan struct{})
+	go func() {
+		eng.Run(ctx)
+		close(stopped)
+	}()
+
+	if !eng.enqueue(webhook{userID: "user-1", url: srv.URL, payload: webhookPayload{RuleID: 7, EntryID: 42}}) {
+		t.Fatal("expected the webhook to be queued")
+	}
+	if p := <-posted; p.RuleID != 7 || p.EntryID != 42 {
+		t.Errorf("posted %+v", p)
+	}
+	cancel()
+	<-stopped
+}
+
+func TestWebhookQueueFull(t *testing.T) {
+	eng := &Engine{webhooks: make(chan webhook, 1)}
+	if !eng.enqueue(webhook{url: "https://hooks.example.com/1"}) {
+		t.Fatal("expected the first webhook to be queued")
+	}
+	if eng.enqueue(webhook{url: "https://hooks.example.com/2"}) {
+		t.Error("expected a webhook matched while the queue is full to be dropped")
+	}
+}
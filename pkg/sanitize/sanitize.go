@@ -0,0 +1,424 @@
+// Package sanitize cleans untrusted HTML from feeds before it is stored and
+// rendered by the frontend. Only allowlisted tags and attributes survive;
+// links are resolved against the entry URL and hardened, embeds are limited
+// to known video players and tracking pixels are dropped.
+package sanitize
+
+import (
+	"net/url"
+	"strconv"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+// Version identifies the current rules. Bump it whenever the rules change so
+// stored entries get sanitized again.
+const Version = 1
+
+// allowedTags maps the allowed elements to their allowed attributes, on top
+// of globalAttributes.
+var allowedTags = map[atom.Atom][]string{
+	atom.A:          {"href"},
+	atom.Abbr:       nil,
+	atom.Acronym:    nil,
+	atom.Address:    nil,
+	atom.Article:    nil,
+	atom.Aside:      nil,
+	atom.Audio:      {"src", "controls"},
+	atom.B:          nil,
+	atom.Bdi:        nil,
+	atom.Bdo:        nil,
+	atom.Big:        nil,
+	atom.Blockquote: {"cite"},
+	atom.Br:         nil,
+	atom.Caption:    nil,
+	atom.Cite:       nil,
+	atom.Code:       nil,
+	atom.Col:        {"span"},
+	atom.Colgroup:   {"span"},
+	atom.Dd:         nil,
+	atom.Del:        {"cite", "datetime"},
+	atom.Details:    {"open"},
+	atom.Dfn:        nil,
+	atom.Div:        nil,
+	atom.Dl:         nil,
+	atom.Dt:         nil,
+	atom.Em:         nil,
+	atom.Figcaption: nil,
+	atom.Figure:     nil,
+	atom.H1:         nil,
+	atom.H2:         nil,
+	atom.H3:         nil,
+	atom.H4:         nil,
+	atom.H5:         nil,
+	atom.H6:         nil,
+	atom.Hr:         nil,
+	atom.I:          nil,
+	atom.Iframe:     {"src", "width", "height", "allowfullscreen"},
+	atom.Img:        {"src", "srcset", "sizes", "alt", "width", "height"},
+	atom.Ins:        {"cite", "datetime"},
+	atom.Kbd:        nil,
+	atom.Li:         {"value"},
+	atom.Mark:       nil,
+	atom.Ol:         {"start", "reversed", "type"},
+	atom.P:          nil,
+	atom.Picture:    nil,
+	atom.Pre:        nil,
+	atom.Q:          {"cite"},
+	atom.Rp:         nil,
+	atom.Rt:         nil,
+	atom.Ruby:       nil,
+	atom.S:          nil,
+	atom.Samp:       nil,
+	atom.Section:    nil,
+	atom.Small:      nil,
+	atom.Source:     {"src", "srcset", "sizes", "type", "media"},
+	atom.Span:       nil,
+	atom.Strike:     nil,
+	atom.Strong:     nil,
+	atom.Sub:        nil,
+	atom.Summary:    nil,
+	atom.Sup:        nil,
+	atom.Table:      nil,
+	atom.Tbody:      nil,
+	atom.Td:         {"colspan", "rowspan", "headers"},
+	atom.Tfoot:      nil,
+	atom.Th:         {"colspan", "rowspan", "headers", "scope"},
+	atom.Thead:      nil,
+	atom.Time:       {"datetime"},
+	atom.Tr:         nil,
+	atom.Tt:         nil,
+	atom.U:          nil,
+	atom.Ul:         nil,
+	atom.Var:        nil,
+	atom.Video:      {"src", "poster", "controls", "width", "height"},
+	atom.Wbr:        nil,
+}
+
+var globalAttributes = []string{"title", "lang", "dir"}
+
+// removedTags are dropped along with their content. Other elements that are
+// not allowed are replaced by their children.
+var removedTags = map[atom.Atom]bool{
+	atom.Script: true, atom.Style: true, atom.Noscript: true, atom.Template: true,
+	atom.Object: true, atom.Embed: true, atom.Applet: true, atom.Form: true,
+	atom.Input: true, atom.Button: true, atom.Select: true, atom.Textarea: true,
+	atom.Head: true, atom.Title: true, atom.Meta: true, atom.Link: true,
+	atom.Base: true, atom.Frame: true, atom.Frameset: true, atom.Svg: true,
+	atom.Math: true,
+}
+
+// urlAttributes hold a single URL.
+var urlAttributes = map[string]bool{"href": true, "src": true, "poster": true, "cite": true}
+
+// iframeHosts are the video players allowed to be embedded, with the path
+// prefix of their embed URLs.
+var iframeHosts = map[string]string{
+	"www.youtube.com":          "/embed/",
+	"youtube.com":              "/embed/",
+	"www.youtube-nocookie.com": "/embed/",
+	"youtube-nocookie.com":     "/embed/",
+	"player.vimeo.com":         "/video/",
+}
+
+// trackerHosts serve invisible images counting views.
+var trackerHosts = []string{
+	"feeds.feedburner.com/~r/",
+	"feedproxy.google.com/~r/",
+	"pixel.wp.com",
+	"stats.wordpress.com",
+	"www.google-analytics.com",
+	"ad.doubleclick.net",
+	"pixel.quantserve.com",
+	"rss.feedsportal.com",
+	"pi.feedsportal.com",
+	"ssl.feedsportal.com",
+	"feeds.wordpress.com",
+	"www.facebook.com/tr",
+	"api.follow.it/track",
+}
+
+// HTML sanitizes the fragment s. Relative URLs are resolved against baseURL.
+func HTML(s, baseURL string) string {
+	if strings.TrimSpace(s) == "" {
+		return ""
+	}
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(s), context)
+	if err != nil {
+		return html.EscapeString(s)
+	}
+	base, _ := url.Parse(baseURL)
+	root := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	for _, n := range nodes {
+		root.AppendChild(n)
+	}
+	sanitizeChildren(root, base)
+
+	var b strings.Builder
+	for c := root.FirstChild; c != nil; c = c.NextSibling {
+		if err := html.Render(&b, c); err != nil {
+			return ""
+		}
+	}
+	return strings.TrimSpace(b.String())
+}
+
+// Text returns s with every tag removed, for fields such as titles that are
+// rendered as plain text.
+func Text(s string) string {
+	if !strings.ContainsAny(s, "<&") {
+		return strings.TrimSpace(s)
+	}
+	context := &html.Node{Type: html.ElementNode, Data: "div", DataAtom: atom.Div}
+	nodes, err := html.ParseFragment(strings.NewReader(s), context)
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+	var b strings.Builder
+	var collect func(*html.Node)
+	collect = func(n *html.Node) {
+		switch {
+		case n.Type == html.TextNode:
+			b.WriteString(n.Data)
+		case n.Type == html.ElementNode && removedTags[n.DataAtom]:
+			return
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			collect(c)
+		}
+	}
+	for _, n := range nodes {
+		collect(n)
+	}
+	return strings.Join(strings.Fields(b.String()), " ")
+}
+
+// URL resolves ref against baseURL and returns it when it is an http or
+// https URL, or "" otherwise.
+func URL(ref, baseURL string) string {
+	base, _ := url.Parse(baseURL)
+	u := resolve(base, ref)
+	if u == nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return ""
+	}
+	return u.String()
+}
+
+func sanitizeChildren(n *html.Node, base *url.URL) {
+	for c := n.FirstChild; c != nil; {
+		next := c.NextSibling
+		switch c.Type {
+		case html.TextNode:
+		case html.ElementNode:
+			sanitizeElement(c, base)
+		default:
+			n.RemoveChild(c)
+		}
+		c = next
+	}
+}
+
+func sanitizeElement(n *html.Node, base *url.URL) {
+	parent := n.Parent
+	if removedTags[n.DataAtom] {
+		parent.RemoveChild(n)
+		return
+	}
+	attrs, allowed := allowedTags[n.DataAtom]
+	if !allowed {
+		unwrap(n, base)
+		return
+	}
+
+	n.Attr = filterAttributes(n, attrs, base)
+	switch n.DataAtom {
+	case atom.A:
+		if attr(n, "href") == "" {
+			unwrap(n, base)
+			return
+		}
+		setAttr(n, "rel", "noopener noreferrer")
+		setAttr(n, "target", "_blank")
+	case atom.Img:
+		if attr(n, "src") == "" && attr(n, "srcset") == "" || isTrackingPixel(n) {
+			parent.RemoveChild(n)
+			return
+		}
+		setAttr(n, "loading", "lazy")
+	case atom.Iframe:
+		src, ok := iframeSrc(attr(n, "src"))
+		if !ok {
+			parent.RemoveChild(n)
+			return
+		}
+		setAttr(n, "src", src)
+		setAttr(n, "sandbox", "allow-scripts allow-same-origin allow-popups allow-presentation")
+		setAttr(n, "referrerpolicy", "strict-origin-when-cross-origin")
+		setAttr(n, "loading", "lazy")
+	case atom.Video, atom.Audio:
+		setAttr(n, "controls", "")
+	}
+	sanitizeChildren(n, base)
+}
+
+// unwrap replaces n by its sanitized children.
+func unwrap(n *html.Node, base *url.URL) {
+	sanitizeChildren(n, base)
+	parent := n.Parent
+	for c := n.FirstChild; c != nil; c = n.FirstChild {
+		n.RemoveChild(c)
+		parent.InsertBefore(c, n)
+	}
+	parent.RemoveChild(n)
+}
+
+func filterAttributes(n *html.Node, allowed []string, base *url.URL) []html.Attribute {
+	var out []html.Attribute
+	for _, a := range n.Attr {
+		if a.Namespace != "" || !contains(allowed, a.Key) && !contains(globalAttributes, a.Key) {
+			continue
+		}
+		switch {
+		case urlAttributes[a.Key]:
+			a.Val = safeURL(base, a.Val, a.Key == "href")
+			if a.Val == "" {
+				continue
+			}
+		case a.Key == "srcset":
+			a.Val = resolveSrcset(base, a.Val)
+			if a.Val == "" {
+				continue
+			}
+		}
+		out = append(out, a)
+	}
+	return out
+}
+
+// safeURL resolves ref against base, returning "" for schemes that could run
+// code. mailto links are allowed for href, inline images for media.
+func safeURL(base *url.URL, ref string, isHref bool) string {
+	ref = strings.TrimSpace(ref)
+	if strings.HasPrefix(ref, "#") {
+		return ref
+	}
+	if !isHref && strings.HasPrefix(strings.ToLower(ref), "data:image/") && !strings.HasPrefix(strings.ToLower(ref), "data:image/svg") {
+		return ref
+	}
+	u := resolve(base, ref)
+	if u == nil {
+		return ""
+	}
+	switch u.Scheme {
+	case "http", "https":
+		return u.String()
+	case "mailto":
+		if isHref {
+			return u.String()
+		}
+	}
+	return ""
+}
+
+func resolve(base *url.URL, ref string) *url.URL {
+	ref = strings.TrimSpace(ref)
+	if ref == "" {
+		return nil
+	}
+	u, err := url.Parse(ref)
+	if err != nil {
+		return nil
+	}
+	if base != nil && !u.IsAbs() {
+		u = base.ResolveReference(u)
+	}
+	if !u.IsAbs() {
+		return nil
+	}
+	return u
+}
+
+// resolveSrcset resolves every candidate of a srcset attribute, dropping
+// unsafe ones.
+func resolveSrcset(base *url.URL, srcset string) string {
+	var out []string
+	for _, candidate := range strings.Split(srcset, ",") {
+		fields := strings.Fields(candidate)
+		if len(fields) == 0 {
+			continue
+		}
+		src := safeURL(base, fields[0], false)
+		if src == "" || strings.HasPrefix(src, "data:") {
+			continue
+		}
+		fields[0] = src
+		out = append(out, strings.Join(fields, " "))
+	}
+	return strings.Join(out, ", ")
+}
+
+// iframeSrc returns the https URL of an allowed video player embed.
+func iframeSrc(src string) (string, bool) {
+	u, err := url.Parse(src)
+	if err != nil || u.Scheme != "https" && u.Scheme != "http" {
+		return "", false
+	}
+	prefix, ok := iframeHosts[strings.ToLower(u.Host)]
+	if !ok || !strings.HasPrefix(u.Path, prefix) {
+		return "", false
+	}
+	u.Scheme = "https"
+	return u.String(), true
+}
+
+// isTrackingPixel reports whether img is invisible or served by a known
+// tracker.
+func isTrackingPixel(img *html.Node) bool {
+	if tiny(attr(img, "width")) && tiny(attr(img, "height")) {
+		return true
+	}
+	src := attr(img, "src")
+	src = strings.TrimPrefix(strings.TrimPrefix(src, "https://"), "http://")
+	for _, t := range trackerHosts {
+		if strings.HasPrefix(src, t) {
+			return true
+		}
+	}
+	return false
+}
+
+func tiny(dimension string) bool {
+	n, err := strconv.Atoi(strings.TrimSuffix(strings.TrimSpace(dimension), "px"))
+	return err == nil && n <= 1
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func setAttr(n *html.Node, key, val string) {
+	for i, a := range n.Attr {
+		if a.Key == key {
+			n.Attr[i].Val = val
+			return
+		}
+	}
+	n.Attr = append(n.Attr, html.Attribute{Key: key, Val: val})
+}
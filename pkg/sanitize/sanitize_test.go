@@ -0,0 +1,62 @@
+package sanitize
+
+import "testing"
+
+func TestHTML(t *testing.T) {
+	const base = "https://example.com/posts/1"
+	var tests = []struct {
+		name  string
+		input string
+		want  string
+	}{
+		{"plain text", "hello & bye", "hello &amp; bye"},
+		{"allowed tags", "<p>Hi <strong>there</strong></p>", "<p>Hi <strong>there</strong></p>"},
+		{"script removed", `<p>a</p><script>alert(1)</script><style>p{}</style>`, "<p>a</p>"},
+		{"unknown tag unwrapped", "<font color=red><b>bold</b></font>", "<b>bold</b>"},
+		{"event handlers dropped", `<p onclick="x()" style="color:red" class="c">a</p>`, "<p>a</p>"},
+		{"link hardened", `<a href="/about" onclick="x()">about</a>`, `<a href="https://example.com/about" rel="noopener noreferrer" target="_blank">about</a>`},
+		{"javascript link unwrapped", `<a href="javascript:alert(1)">click</a>`, "click"},
+		{"mailto link", `<a href="mailto:a@example.com">mail</a>`, `<a href="mailto:a@example.com" rel="noopener noreferrer" target="_blank">mail</a>`},
+		{"relative image", `<img src="img/a.png" alt="a">`, `<img src="https://example.com/posts/img/a.png" alt="a" loading="lazy"/>`},
+		{"srcset resolved", `<img src="a.png" srcset="a.png 1x, /b.png 2x, javascript:x 3x">`, `<img src="https://example.com/posts/a.png" srcset="https://example.com/posts/a.png 1x, https://example.com/b.png 2x" loading="lazy"/>`},
+		{"tracking pixel", `<p>a<img src="https://example.com/p.gif" width="1" height="1"></p>`, "<p>a</p>"},
+		{"tracker host", `<img src="http://feeds.feedburner.com/~r/example/~4/abc">`, ""},
+		{"youtube iframe", `<iframe src="//www.youtube.com/embed/xyz" width="560" onload="x()"></iframe>`, `<iframe src="https://www.youtube.com/embed/xyz" width="560" sandbox="allow-scripts allow-same-origin allow-popups allow-presentation" referrerpolicy="strict-origin-when-cross-origin" loading="lazy"></iframe>`},
+		{"other iframe", `<iframe src="https://evil.example.net/embed/xyz"></iframe>`, ""},
+		{"svg removed", `<svg><script>alert(1)</script></svg>ok`, "ok"},
+		{"comments removed", "a<!-- secret -->b", "ab"},
+		{"data image", `<img src="data:image/png;base64,AAAA">`, `<img src="data:image/png;base64,AAAA" loading="lazy"/>`},
+		{"svg data image", `<img src="data:image/svg+xml;base64,AAAA">`, ""},
+		{"video controls", `<video src="v.mp4" autoplay></video>`, `<video src="https://example.com/posts/v.mp4" controls=""></video>`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTML(tt.input, base); got != tt.want {
+				t.Errorf("got %q expected %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLIdempotent(t *testing.T) {
+	input := `<p>Hi <a href="/x">x</a><img src="a.png" srcset="a.png 1x"><iframe src="https://player.vimeo.com/video/1"></iframe></p>`
+	once := HTML(input, "https://example.com/")
+	if twice := HTML(once, "https://example.com/"); twice != once {
+		t.Errorf("sanitizing twice changed the output:\n%s\n%s", once, twice)
+	}
+}
+
+func TestText(t *testing.T) {
+	if got := Text("A <em>title</em> &amp; <script>x</script>more"); got != "A title & more" {
+		t.Errorf("got %q", got)
+	}
+}
+
+func TestURL(t *testing.T) {
+	if got := URL("/a", "https://example.com/b"); got != "https://example.com/a" {
+		t.Errorf("got %q", got)
+	}
+	if got := URL("javascript:alert(1)", "https://example.com/"); got != "" {
+		t.Errorf("expected javascript URL to be rejected, got %q", got)
+	}
+}
@@ -0,0 +1,215 @@
+// Package scraper holds the per-site rules that adjust how entry links are
+// rewritten, fetched and extracted. Rules are keyed by domain; feedr ships a
+// built-in rule set which admins can extend or override.
+package scraper
+
+import (
+	"context"
+	_ "embed"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/andybalholm/cascadia"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/readability"
+)
+
+//go:embed rules.json
+var builtinRules []byte
+
+// maxRewrites bounds how often a link is rewritten, as a rewrite may move
+// it to a domain with rules of its own.
+const maxRewrites = 3
+
+// Rule is a compiled scraper rule.
+type Rule struct {
+	model.ScraperRule
+	rewrites []*regexp.Regexp
+}
+
+// Compile validates the selectors and rewrite patterns of r.
+func Compile(r model.ScraperRule) (*Rule, error) {
+	r.Domain = NormalizeDomain(r.Domain)
+	if r.Domain == "" {
+		return nil, fmt.Errorf("scraper: domain is required")
+	}
+	for _, s := range append(append([]string(nil), r.Include...), r.Exclude...) {
+		if _, err := cascadia.ParseGroup(s); err != nil {
+			return nil, fmt.Errorf("scraper: invalid selector %q: %w", s, err)
+		}
+	}
+	rule := &Rule{ScraperRule: r}
+	for _, rw := range r.Rewrites {
+		re, err := regexp.Compile(rw.Pattern)
+		if err != nil {
+			return nil, fmt.Errorf("scraper: invalid rewrite pattern %q: %w", rw.Pattern, err)
+		}
+		rule.rewrites = append(rule.rewrites, re)
+	}
+	return rule, nil
+}
+
+// RewriteURL applies the first matching rewrite to rawURL.
+func (r *Rule) RewriteURL(rawURL string) string {
+	for i, re := range r.rewrites {
+		if re.MatchString(rawURL) {
+			return re.ReplaceAllString(rawURL, r.Rewrites[i].Replace)
+		}
+	}
+	return rawURL
+}
+
+// Header returns the request headers set by the rule.
+func (r *Rule) Header() http.Header {
+	h := http.Header{}
+	if r.UserAgent != "" {
+		h.Set("User-Agent", r.UserAgent)
+	}
+	if r.Cookie != "" {
+		h.Set("Cookie", r.Cookie)
+	}
+	return h
+}
+
+// Options returns the extraction options of the rule.
+func (r *Rule) Options() readability.Options {
+	return readability.Options{Include: r.Include, Exclude: r.Exclude}
+}
+
+// NormalizeDomain lowercases domain and strips any scheme, port, path and
+// leading "www.".
+func NormalizeDomain(domain string) string {
+	domain = strings.ToLower(strings.TrimSpace(domain))
+	if u, err := url.Parse(domain); err == nil && u.Host != "" {
+		domain = u.Host
+	}
+	domain, _, _ = strings.Cut(domain, "/")
+	if host, _, ok := strings.Cut(domain, ":"); ok {
+		domain = host
+	}
+	return strings.TrimPrefix(domain, "www.")
+}
+
+// Engine looks up the rule of a URL. Stored rules take precedence over
+// built-in rules of the same domain.
+type Engine struct {
+	mu      sync.RWMutex
+	builtin map[string]*Rule
+	custom  map[string]*Rule
+}
+
+// Default is the engine used by feed ingestion and extraction.
+var Default = NewEngine()
+
+// NewEngine returns an engine holding the built-in rules.
+func NewEngine() *Engine {
+	rules, err := parseRules(builtinRules)
+	if err != nil {
+		panic(err)
+	}
+	for _, r := range rules {
+		r.Builtin = true
+	}
+	return &Engine{builtin: rules, custom: map[string]*Rule{}}
+}
+
+func parseRules(data []byte) (map[string]*Rule, error) {
+	var raw []model.ScraperRule
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("scraper: decoding rules: %w", err)
+	}
+	rules := make(map[string]*Rule, len(raw))
+	for _, r := range raw {
+		rule, err := Compile(r)
+		if err != nil {
+			return nil, err
+		}
+		rules[rule.Domain] = rule
+	}
+	return rules, nil
+}
+
+// Load replaces the stored rules of the engine with those in the database.
+func (e *Engine) Load(ctx context.Context) error {
+	stored, err := model.ListScraperRules(ctx)
+	if err != nil {
+		return err
+	}
+	rules := make(map[string]*Rule, len(stored))
+	for _, r := range stored {
+		rule, err := Compile(r)
+		if err != nil {
+			return err
+		}
+		rules[rule.Domain] = rule
+	}
+	e.mu.Lock()
+	e.custom = rules
+	e.mu.Unlock()
+	return nil
+}
+
+// Rules returns the effective rules ordered by domain.
+func (e *Engine) Rules() []model.ScraperRule {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	var rules []model.ScraperRule
+	for domain, r := range e.builtin {
+		if _, ok := e.custom[domain]; !ok {
+			rules = append(rules, r.ScraperRule)
+		}
+	}
+	for _, r := range e.custom {
+		rules = append(rules, r.ScraperRule)
+	}
+	sort.Slice(rules, func(i, j int) bool { return rules[i].Domain < rules[j].Domain })
+	return rules
+}
+
+// Lookup returns the rule of the most specific domain of rawURL's host, or
+// nil when no rule applies.
+func (e *Engine) Lookup(rawURL string) *Rule {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Hostname() == "" {
+		return nil
+	}
+	host := NormalizeDomain(u.Hostname())
+
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	for {
+		if r, ok := e.custom[host]; ok {
+			return r
+		}
+		if r, ok := e.builtin[host]; ok {
+			return r
+		}
+		_, parent, ok := strings.Cut(host, ".")
+		if !ok || !strings.Contains(parent, ".") {
+			return nil
+		}
+		host = parent
+	}
+}
+
+// RewriteURL applies the rewrites of the rules matching rawURL.
+func (e *Engine) RewriteURL(rawURL string) string {
+	for range maxRewrites {
+		r := e.Lookup(rawURL)
+		if r == nil {
+			break
+		}
+		rewritten := r.RewriteURL(rawURL)
+		if rewritten == rawURL {
+			break
+		}
+		rawURL = rewritten
+	}
+	return rawURL
+}
@@ -0,0 +1,90 @@
+package scraper
+
+import (
+	"testing"
+
+	"github.com/swartzfoundation/feedr/model"
+)
+
+func TestBuiltinRules(t *testing.T) {
+	if _, err := parseRules(builtinRules); err != nil {
+		t.Fatalf("built-in rules are invalid: %v", err)
+	}
+}
+
+func TestNormalizeDomain(t *testing.T) {
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"Example.com", "example.com"},
+		{"www.example.com", "example.com"},
+		{"https://www.example.com:8443/path", "example.com"},
+		{"blog.example.com/", "blog.example.com"},
+	}
+	for _, tt := range tests {
+		if got := NormalizeDomain(tt.input); got != tt.want {
+			t.Errorf("NormalizeDomain(%q) = %q expected %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	e := NewEngine()
+	custom, err := Compile(model.ScraperRule{Domain: "www.Example.com", Include: []string{"main"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.custom = map[string]*Rule{custom.Domain: custom}
+
+	if r := e.Lookup("https://blog.example.com/post"); r != custom {
+		t.Errorf("expected subdomain to match parent rule, got %v", r)
+	}
+	if r := e.Lookup("https://example.org/post"); r != nil {
+		t.Errorf("expected no rule, got %v", r.Domain)
+	}
+	if r := e.Lookup("https://en.m.wikipedia.org/wiki/Go"); r == nil || r.Domain != "m.wikipedia.org" {
+		t.Errorf("expected most specific rule to win, got %v", r)
+	}
+
+	override, _ := Compile(model.ScraperRule{Domain: "wikipedia.org"})
+	e.custom[override.Domain] = override
+	if r := e.Lookup("https://en.wikipedia.org/wiki/Go"); r != override {
+		t.Errorf("expected stored rule to override built-in rule")
+	}
+	for _, r := range e.Rules() {
+		if r.Domain == "wikipedia.org" && r.Builtin {
+			t.Errorf("expected overridden built-in rule to be hidden")
+		}
+	}
+}
+
+func TestRewriteURL(t *testing.T) {
+	e := NewEngine()
+	var tests = []struct {
+		input string
+		want  string
+	}{
+		{"https://www-example-com.cdn.ampproject.org/c/s/www.example.com/news/1", "https://www.example.com/news/1"},
+		{"https://www.google.com/amp/s/amp.theguardian.com/world/2024/story", "https://www.theguardian.com/world/2024/story"},
+		{"https://en.m.wikipedia.org/wiki/Go_(programming_language)", "https://en.wikipedia.org/wiki/Go_(programming_language)"},
+		{"https://example.com/untouched", "https://example.com/untouched"},
+	}
+	for _, tt := range tests {
+		if got := e.RewriteURL(tt.input); got != tt.want {
+			t.Errorf("RewriteURL(%q) = %q expected %q", tt.input, got, tt.want)
+		}
+	}
+}
+
+func TestCompileInvalid(t *testing.T) {
+	if _, err := Compile(model.ScraperRule{Domain: "example.com", Include: []string{"div["}}); err == nil {
+		t.Errorf("expected error for invalid selector")
+	}
+	if _, err := Compile(model.ScraperRule{Domain: "example.com", Rewrites: []model.URLRewrite{{Pattern: "(", Replace: ""}}}); err == nil {
+		t.Errorf("expected error for invalid pattern")
+	}
+	if _, err := Compile(model.ScraperRule{}); err == nil {
+		t.Errorf("expected error for missing domain")
+	}
+}
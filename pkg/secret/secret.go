@@ -0,0 +1,79 @@
+// Package secret encrypts credentials stored in the database, such as the
+// passwords of IMAP accounts, with AES-256-GCM.
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+// prefix tags encrypted values with the scheme version so the key or
+// algorithm can be rotated later.
+const prefix = "v1:"
+
+var (
+	ErrNoKey   = errors.New("secret: ENCRYPTION_KEY is not set")
+	ErrInvalid = errors.New("secret: invalid ciphertext")
+)
+
+var aead cipher.AEAD
+
+// Configure derives the encryption key from key. An empty key disables
+// encryption, making Encrypt and Decrypt return ErrNoKey.
+func Configure(key string) error {
+	if key == "" {
+		aead = nil
+		return nil
+	}
+	sum := sha256.Sum256([]byte(key))
+	block, err := aes.NewCipher(sum[:])
+	if err != nil {
+		return err
+	}
+	aead, err = cipher.NewGCM(block)
+	return err
+}
+
+// Enabled reports whether a key is configured.
+func Enabled() bool {
+	return aead != nil
+}
+
+// Encrypt returns the encrypted and encoded plaintext.
+func Encrypt(plaintext string) (string, error) {
+	if aead == nil {
+		return "", ErrNoKey
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(plaintext), nil)
+	return prefix + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt reverses Encrypt. It fails with ErrInvalid when the value was
+// tampered with or encrypted with another key.
+func Decrypt(ciphertext string) (string, error) {
+	if aead == nil {
+		return "", ErrNoKey
+	}
+	encoded, ok := strings.CutPrefix(ciphertext, prefix)
+	if !ok {
+		return "", ErrInvalid
+	}
+	data, err := base64.RawStdEncoding.DecodeString(encoded)
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", ErrInvalid
+	}
+	plaintext, err := aead.Open(nil, data[:aead.NonceSize()], data[aead.NonceSize():], nil)
+	if err != nil {
+		return "", ErrInvalid
+	}
+	return string(plaintext), nil
+}
@@ -0,0 +1,35 @@
+package secret
+
+import "testing"
+
+func TestEncrypt(t *testing.T) {
+	if err := Configure(""); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Encrypt("hunter2"); err != ErrNoKey {
+		t.Errorf("expected ErrNoKey, got %v", err)
+	}
+
+	if err := Configure("first key"); err != nil {
+		t.Fatal(err)
+	}
+	a, err := Encrypt("hunter2")
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := Encrypt("hunter2")
+	if a == b {
+		t.Errorf("expected a random nonce per encryption")
+	}
+	if got, err := Decrypt(a); err != nil || got != "hunter2" {
+		t.Errorf("got %q %v expected hunter2", got, err)
+	}
+	if _, err := Decrypt(a[:len(a)-2] + "AA"); err != ErrInvalid {
+		t.Errorf("expected tampered value to be rejected, got %v", err)
+	}
+
+	Configure("second key")
+	if _, err := Decrypt(a); err != ErrInvalid {
+		t.Errorf("expected other key to be rejected, got %v", err)
+	}
+}
@@ -0,0 +1,125 @@
+package sentiment
+
+import (
+	"context"
+	"strings"
+	"unicode"
+)
+
+const (
+	// maxWeight is the weight of the strongest words of the lexicon.
+	maxWeight = 3
+	// negationWindow is the number of words after a negation whose tone is
+	// reversed.
+	negationWindow = 3
+	// titleWeight is the weight of the words of the title, which sums up
+	// the tone of the article.
+	titleWeight = 2
+)
+
+// Lexicon rates texts by the tone of their English words, from the
+// lexicon below, with the words after a negation reversed and those after
+// an intensifier strengthened.
+type Lexicon struct{}
+
+func (Lexicon) Analyze(_ context.Context, title, text string) (float64, error) {
+	var sum, hits float64
+	for _, t := range []struct {
+		text   string
+		weight float64
+	}{{title, titleWeight}, {text, 1}} {
+		s, n := rate(t.text)
+		sum += s * t.weight
+		hits += n * t.weight
+	}
+	// Each word weighs at most maxWeight; the extra word keeps a single
+	// mild word from making an entry very positive or negative.
+	return sum / (maxWeight * (hits + 1)), nil
+}
+
+// rate returns the sum of the weights of the words of text and the number
+// of words of the lexicon it has.
+func rate(text string) (sum, hits float64) {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && r != '\'' && r != '’'
+	})
+	negated, boost := 0, 1.0
+	for _, w := range words {
+		w = strings.ReplaceAll(w, "’", "'")
+		switch {
+		case negations[w] || strings.HasSuffix(w, "n't"):
+			negated = negationWindow
+			continue
+		case intensifiers[w]:
+			boost = 1.5
+			continue
+		}
+		if weight, ok := lexicon[w]; ok {
+			s := float64(weight) * boost
+			if negated > 0 {
+				// "not bad" is milder than "good".
+				s *= -0.5
+			}
+			sum += s
+			hits++
+		}
+		boost = 1
+		if negated > 0 {
+			negated--
+		}
+	}
+	return sum, hits
+}
+
+var negations = map[string]bool{}
+
+var intensifiers = map[string]bool{}
+
+// lexicon weighs words from -3, very negative, to 3, very positive.
+var lexicon = map[string]int{}
+
+func init() {
+	for _, w := range strings.Fields(`not no never none nobody nothing neither nor without cannot`) {
+		negations[w] = true
+	}
+	for _, w := range strings.Fields(`very extremely really highly deeply hugely incredibly too
+		most particularly especially totally utterly`) {
+		intensifiers[w] = true
+	}
+	for weight, words := range map[int]string{
+		3: `amazing awesome brilliant breakthrough celebrate celebrated celebrates excellent
+			exceptional extraordinary fantastic magnificent masterpiece outstanding
+			spectacular superb thrilled thrilling triumph triumphant wonderful`,
+		2: `achieve achieved achievement admire advance advanced beautiful benefit benefits
+			best better boost boosted cheer cheerful confident delight delighted easy
+			effective enjoy enjoyed excited exciting favorite gain gained gains generous
+			glad good great happy healthy helpful hope hopeful impressive improve improved
+			improvement innovative inspiring joy kind love loved lucky perfect pleased
+			popular praise praised progress prosper prosperity recover recovered recovery
+			relief rescue rescued reward safe save saved secure solve solved strong
+			succeed success successful support thank thanks win winner winning wins won`,
+		1: `agree agreed allow approve approved calm clean clear comfortable fair
+			fix fixed fresh fun grow growing growth interesting nice ok okay
+			peace peaceful positive ready reliable resolve resolved rise rising smooth
+			stable steady upgrade useful welcome`,
+		-1: `concern concerned concerns decline declined delay delayed difficult doubt
+			drop dropped fall fell limited miss missed negative problem problems risk
+			risks slow slowed struggle struggled struggling uncertain uncertainty unclear
+			warn warned warning weak worried worry`,
+		-2: `angry anger bad ban banned broke broken collapse collapsed conflict corrupt
+			corruption crash crashed crime criminal crisis damage damaged danger
+			dangerous debt defeat defeated deny denied fail failed failing failure fear
+			fired flaw fraud guilty harm hurt illegal injured injury lawsuit lose loses
+			losing loss losses lost poor protest recession sad scandal shortage shortages
+			sick steal stolen threat threaten threatened trouble unfair unhappy upset
+			victim violence violent vulnerability wrong`,
+		-3: `abuse attack attacked awful bankrupt bankruptcy catastrophe catastrophic
+			dead death deadly destroyed devastated devastating die died disaster
+			disastrous dying horrible horrific kill killed killing massacre murder
+			murdered terrible terror terrorist tragedy tragic war worst`,
+	} {
+		for _, w := range strings.Fields(words) {
+			lexicon[w] = weight
+		}
+	}
+}
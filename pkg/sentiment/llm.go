@@ -0,0 +1,53 @@
+package sentiment
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/swartzfoundation/feedr/pkg/llm"
+)
+
+// maxLLMText bounds the characters of an article sent to the model; the
+// tone is set in the beginning.
+const maxLLMText = 4000
+
+const sentimentPrompt = "You rate the tone of news articles for a feed reader. " +
+	"Reply with a single number from -1 (very negative) to 1 (very positive), 0 for neutral or factual. " +
+	"Reply with the number only."
+
+// LLM rates texts with a chat model.
+type LLM struct {
+	Client *llm.Client
+}
+
+func (a *LLM) Analyze(ctx context.Context, title, text string) (float64, error) {
+	if title == "" && text == "" {
+		return 0, nil
+	}
+	if r := []rune(text); len(r) > maxLLMText {
+		text = string(r[:maxLLMText])
+	}
+	reply, err := a.Client.Chat(ctx, []llm.Message{
+		{Role: "system", Content: sentimentPrompt},
+		{Role: "user", Content: "Title: " + title + "\n\n" + text},
+	})
+	if err != nil {
+		return 0, err
+	}
+	return parseScore(reply)
+}
+
+// parseScore reads the number the model replied with, clamped to [-1, 1].
+func parseScore(reply string) (float64, error) {
+	s := strings.Trim(strings.TrimSpace(reply), ".`\"'")
+	if fields := strings.Fields(s); len(fields) > 0 {
+		s = fields[0]
+	}
+	score, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, fmt.Errorf("sentiment: invalid reply %q", reply)
+	}
+	return max(-1, min(1, score)), nil
+}
@@ -0,0 +1,48 @@
+// Package sentiment rates the tone of entries from -1, negative, to 1,
+// positive. The built-in Lexicon analyzer works offline from a list of
+// English words; the LLM analyzer asks an OpenAI-compatible chat model and
+// is used when OPENAI_SENTIMENT is set.
+package sentiment
+
+import (
+	"context"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/llm"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+)
+
+// neutralBand is the distance from 0 within which scores are neutral.
+const neutralBand = 0.1
+
+// Analyzer rates the tone of a text.
+type Analyzer interface {
+	// Analyze returns the score of text, from -1 to 1.
+	Analyze(ctx context.Context, title, text string) (float64, error)
+}
+
+// New returns the analyzer of cfg: the LLM analyzer when cfg enables it and
+// configures an API, the lexicon otherwise.
+func New(cfg config.OpenAIConfig) Analyzer {
+	if c := llm.New(cfg); c != nil && cfg.Sentiment {
+		return &LLM{Client: c}
+	}
+	return Lexicon{}
+}
+
+// Label returns the sentiment of a score.
+func Label(score float64) string {
+	switch {
+	case score >= neutralBand:
+		return model.SentimentPositive
+	case score <= -neutralBand:
+		return model.SentimentNegative
+	}
+	return model.SentimentNeutral
+}
+
+// Text returns the title and the plain text of e.
+func Text(e *model.Entry) (title, text string) {
+	return sanitize.Text(e.Title), sanitize.Text(e.Body())
+}
@@ -0,0 +1,78 @@
+package sentiment
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+)
+
+func TestLexicon(t *testing.T) {
+	tests := []struct {
+		title, text string
+		want        string
+	}{
+		{"Team wins the championship", "An amazing season and a great victory for the city.", model.SentimentPositive},
+		{"Earthquake kills dozens", "The disaster destroyed hundreds of homes.", model.SentimentNegative},
+		{"Council meets on Tuesday", "The agenda lists the budget and the parking rules.", model.SentimentNeutral},
+		{"", "The results were not good.", model.SentimentNegative},
+		{"", "", model.SentimentNeutral},
+	}
+	for _, tt := range tests {
+		score, err := Lexicon{}.Analyze(t.Context(), tt.title, tt.text)
+		if err != nil || score < -1 || score > 1 || Label(score) != tt.want {
+			t.Errorf("Analyze(%q, %q) = %v, %v, want %s", tt.title, tt.text, score, err, tt.want)
+		}
+	}
+
+	good, _ := Lexicon{}.Analyze(t.Context(), "", "good")
+	veryGood, _ := Lexicon{}.Analyze(t.Context(), "", "very good")
+	if veryGood <= good {
+		t.Errorf("very good = %v, want more than good = %v", veryGood, good)
+	}
+}
+
+func TestParseScore(t *testing.T) {
+	tests := []struct {
+		reply string
+		want  float64
+		ok    bool
+	}{
+		{"0.6", 0.6, true},
+		{" -0.25.\n", -0.25, true},
+		{"2", 1, true},
+		{"`-3`", -1, true},
+		{"0.4 (mostly positive)", 0.4, true},
+		{"positive", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := parseScore(tt.reply)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("parseScore(%q) = %v, %v, want %v", tt.reply, got, err, tt.want)
+		}
+	}
+}
+
+func TestNew(t *testing.T) {
+	if _, ok := New(config.OpenAIConfig{Sentiment: true}).(Lexicon); !ok {
+		t.Error("New without an API did not return the lexicon")
+	}
+	if _, ok := New(config.OpenAIConfig{APIKey: "k"}).(Lexicon); !ok {
+		t.Error("New without OPENAI_SENTIMENT did not return the lexicon")
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(`{"choices":[{"message":{"role":"assistant","content":"-0.7"}}]}`))
+	}))
+	defer srv.Close()
+	a := New(config.OpenAIConfig{BaseURL: srv.URL, Sentiment: true, Timeout: time.Second})
+	if _, ok := a.(*LLM); !ok {
+		t.Fatalf("New = %T, want the LLM analyzer", a)
+	}
+	if score, err := a.Analyze(t.Context(), "Title", "Text"); err != nil || score != -0.7 {
+		t.Errorf("Analyze = %v, %v, want -0.7", score, err)
+	}
+}
@@ -0,0 +1,81 @@
+package sentiment
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/llm"
+)
+
+const (
+	// batchSize is the number of entries analyzed at once.
+	batchSize = 100
+	// window is the age of the oldest entries analyzed.
+	window = 30 * 24 * time.Hour
+)
+
+// Worker analyzes the new entries of subscribed feeds.
+type Worker struct {
+	Analyzer Analyzer
+	Interval time.Duration
+}
+
+// NewWorker returns a worker analyzing new entries with a, every minute.
+func NewWorker(a Analyzer) *Worker {
+	return &Worker{Analyzer: a, Interval: time.Minute}
+}
+
+// Run analyzes entries until ctx is cancelled.
+func (w *Worker) Run(ctx context.Context) {
+	ticker := time.NewTicker(w.Interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := w.analyze(ctx)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					slog.Error("sentiment: analyzing entries", "error", err)
+				}
+				break
+			}
+			if n < batchSize {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// analyze rates a batch of entries and returns its size. An entry the
+// analyzer fails to rate is rated by the lexicon instead, so it does not
+// hold up the others; the batch stops when the API is unavailable and is
+// retried later.
+func (w *Worker) analyze(ctx context.Context) (int, error) {
+	after := time.Now().Add(-window).Unix()
+	entries, err := model.ListEntriesWithoutSentiment(ctx, after, batchSize)
+	if err != nil {
+		return 0, err
+	}
+	for i := range entries {
+		title, text := Text(&entries[i])
+		score, err := w.Analyzer.Analyze(ctx, title, text)
+		if err != nil {
+			if ctx.Err() != nil || llm.Temporary(err) {
+				return 0, err
+			}
+			slog.Warn("sentiment: falling back to the lexicon", "entry", entries[i].ID, "error", err)
+			score, _ = Lexicon{}.Analyze(ctx, title, text)
+		}
+		if err := model.SaveEntrySentiment(ctx, entries[i].ID, Label(score), score); err != nil {
+			return 0, err
+		}
+	}
+	return len(entries), nil
+}
@@ -0,0 +1,62 @@
+package summary
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// maxSentence bounds the length of an extracted sentence.
+const maxSentence = 400
+
+// Extract returns a summary of text made of its n most representative
+// sentences, in their original order. Sentences are scored by the average
+// frequency of their words in the text, with a bonus for the first one,
+// which often sums up news articles. It needs no API and is deterministic.
+func Extract(text string, n int) string {
+	all := sentences(text)
+	if len(all) <= n {
+		return strings.Join(all, " ")
+	}
+	words := make([][]string, len(all))
+	freq := map[string]int{}
+	for i, s := range all {
+		words[i] = strings.FieldsFunc(strings.ToLower(s), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+		})
+		for _, w := range words[i] {
+			// Short words are mostly articles and prepositions.
+			if len([]rune(w)) > 3 {
+				freq[w]++
+			}
+		}
+	}
+	scores := make([]float64, len(all))
+	for i := range all {
+		if len(words[i]) == 0 {
+			continue
+		}
+		for _, w := range words[i] {
+			scores[i] += float64(freq[w])
+		}
+		scores[i] /= float64(len(words[i]))
+	}
+	scores[0] *= 1.5
+
+	order := make([]int, len(all))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(a, b int) bool { return scores[order[a]] > scores[order[b]] })
+	picked := order[:n]
+	sort.Ints(picked)
+
+	out := make([]string, n)
+	for i, idx := range picked {
+		out[i] = all[idx]
+		if len(out[i]) > maxSentence {
+			out[i] = strings.TrimSpace(out[i][:strings.LastIndexByte(out[i][:maxSentence], ' ')+1]) + "…"
+		}
+	}
+	return strings.Join(out, " ")
+}
@@ -0,0 +1,212 @@
+// Package summary writes summaries of entries with an OpenAI-compatible
+// chat model. Articles too long for one request are summarized in chunks
+// whose summaries are then combined. Summaries are cached per entry and
+// prompt version, and each user can generate a limited number per day.
+// Extract writes summaries locally, by picking sentences of the article.
+package summary
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/llm"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+)
+
+// PromptVersion identifies the prompts below. Changing them must increment
+// it, so that cached summaries are written again.
+const PromptVersion = 1
+
+const (
+	// ChunkSize is the number of characters of text summarized at once.
+	ChunkSize = 12000
+	// maxChunks bounds the text of an article summarized; the rest is
+	// ignored.
+	maxChunks = 8
+	// concurrency bounds the chunks summarized in parallel.
+	concurrency = 4
+)
+
+const (
+	summaryPrompt = "You summarize articles for the readers of a feed reader. " +
+		"Write a summary of three to five sentences in the language of the article. " +
+		"Only state what the article says, without commentary. Reply with the summary only."
+	chunkPrompt = "You summarize one part of a long article for the readers of a feed reader. " +
+		"Write a summary of at most five sentences in the language of the article. " +
+		"Only state what the text says, without commentary. Reply with the summary only."
+	combinePrompt = "You are given the summaries of consecutive parts of one article. " +
+		"Combine them into a single summary of three to five sentences in the language of the article. " +
+		"Reply with the summary only."
+)
+
+var (
+	ErrDisabled      = errors.New("summary: no OpenAI-compatible API is configured")
+	ErrQuotaExceeded = errors.New("summary: daily quota exceeded")
+	ErrNoText        = errors.New("summary: the entry has no text")
+)
+
+var (
+	client *llm.Client
+	quota  int
+)
+
+// Configure sets up the API summaries are written with.
+func Configure(cfg config.OpenAIConfig) {
+	client = llm.New(cfg)
+	quota = cfg.SummaryQuota
+}
+
+// Enabled reports whether an API is configured.
+func Enabled() bool {
+	return client != nil
+}
+
+// Summarize returns the summary of e, writing it when it is not cached.
+// Written summaries count towards the daily quota of the user, unless
+// userID is empty. cached reports whether the summary was cached.
+func Summarize(ctx context.Context, userID string, e *model.Entry) (s *model.Summary, cached bool, err error) {
+	if !Enabled() {
+		return nil, false, ErrDisabled
+	}
+	s, err = model.GetSummary(ctx, e.ID, PromptVersion)
+	if err == nil {
+		return s, true, nil
+	}
+	if !errors.Is(err, model.ErrNotFound) {
+		return nil, false, err
+	}
+
+	day := time.Now().UTC().Truncate(24 * time.Hour).Unix()
+	if userID != "" {
+		ok, err := model.ReserveSummaryUsage(ctx, userID, day, quota)
+		if err != nil {
+			return nil, false, err
+		}
+		if !ok {
+			return nil, false, ErrQuotaExceeded
+		}
+		defer func() {
+			if err == nil {
+				return
+			}
+			// Failed summaries do not count, even when ctx is cancelled.
+			if err := model.ReleaseSummaryUsage(context.WithoutCancel(ctx), userID, day); err != nil {
+				slog.Error("summary: releasing quota", "user", userID, "error", err)
+			}
+		}()
+	}
+
+	text, err := Text(ctx, client, sanitize.Text(e.Title), sanitize.Text(e.Body()))
+	if err != nil {
+		return nil, false, err
+	}
+	s = &model.Summary{EntryID: e.ID, PromptVersion: PromptVersion, Model: client.Model, Summary: text}
+	if err := model.SaveSummary(ctx, s); err != nil {
+		return nil, false, err
+	}
+	return s, false, nil
+}
+
+// Text summarizes the plain text of an article.
+func Text(ctx context.Context, c *llm.Client, title, text string) (string, error) {
+	chunks := Chunks(text, ChunkSize)
+	if len(chunks) == 0 {
+		return "", ErrNoText
+	}
+	if len(chunks) > maxChunks {
+		chunks = chunks[:maxChunks]
+	}
+	if len(chunks) == 1 {
+		return c.Chat(ctx, messages(summaryPrompt, title, chunks[0]))
+	}
+
+	summaries := make([]string, len(chunks))
+	errs := make([]error, len(chunks))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, chunk := range chunks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			part := fmt.Sprintf("Part %d of %d:\n\n%s", i+1, len(chunks), chunk)
+			summaries[i], errs[i] = c.Chat(ctx, messages(chunkPrompt, title, part))
+		}()
+	}
+	wg.Wait()
+	if err := errors.Join(errs...); err != nil {
+		return "", err
+	}
+	return c.Chat(ctx, messages(combinePrompt, title, strings.Join(summaries, "\n\n")))
+}
+
+func messages(prompt, title, text string) []llm.Message {
+	return []llm.Message{
+		{Role: "system", Content: prompt},
+		{Role: "user", Content: "Title: " + title + "\n\n" + text},
+	}
+}
+
+// Chunks splits text into chunks of at most size bytes, between sentences
+// when possible and otherwise between words.
+func Chunks(text string, size int) []string {
+	var (
+		chunks []string
+		b      strings.Builder
+	)
+	flush := func() {
+		if s := strings.TrimSpace(b.String()); s != "" {
+			chunks = append(chunks, s)
+		}
+		b.Reset()
+	}
+	for _, sentence := range sentences(text) {
+		if b.Len() > 0 && b.Len()+1+len(sentence) > size {
+			flush()
+		}
+		for len(sentence) > size {
+			// A sentence longer than a chunk is split between words.
+			cut := strings.LastIndexByte(sentence[:size], ' ')
+			if cut <= 0 {
+				cut = size
+				for cut > 0 && !utf8.RuneStart(sentence[cut]) {
+					cut--
+				}
+			}
+			b.WriteString(sentence[:cut])
+			flush()
+			sentence = strings.TrimSpace(sentence[cut:])
+		}
+		if b.Len() > 0 {
+			b.WriteByte(' ')
+		}
+		b.WriteString(sentence)
+	}
+	flush()
+	return chunks
+}
+
+// sentences splits text after the punctuation ending sentences.
+func sentences(text string) []string {
+	words := strings.Fields(text)
+	var (
+		out   []string
+		start int
+	)
+	for i, w := range words {
+		if strings.HasSuffix(w, ".") || strings.HasSuffix(w, "!") || strings.HasSuffix(w, "?") || i == len(words)-1 {
+			out = append(out, strings.Join(words[start:i+1], " "))
+			start = i + 1
+		}
+	}
+	return out
+}
@@ -0,0 +1,86 @@
+package summary
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/llm"
+)
+
+func TestChunks(t *testing.T) {
+	text := "One two. Three four five! Six seven? Eight."
+	got := Chunks(text, 20)
+	want := []string{"One two.", "Three four five!", "Six seven? Eight."}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Chunks = %q, want %q", got, want)
+	}
+
+	long := strings.Repeat("word ", 10)
+	for _, c := range Chunks(long, 12) {
+		if len(c) > 12 {
+			t.Errorf("chunk %q is longer than 12 bytes", c)
+		}
+	}
+	if got := Chunks("  ", 10); len(got) != 0 {
+		t.Errorf("Chunks of blank text = %q", got)
+	}
+}
+
+func TestText(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		var req struct {
+			Messages []llm.Message `json:"messages"`
+		}
+		json.NewDecoder(r.Body).Decode(&req)
+		reply := "partial"
+		if req.Messages[0].Content == combinePrompt {
+			reply = "combined"
+		}
+		json.NewEncoder(w).Encode(map[string]any{
+			"choices": []any{map[string]any{"message": llm.Message{Role: "assistant", Content: reply}}},
+		})
+	}))
+	defer srv.Close()
+	c := llm.New(config.OpenAIConfig{BaseURL: srv.URL, Timeout: time.Second})
+
+	got, err := Text(t.Context(), c, "Title", "A short article.")
+	if err != nil || got != "partial" || calls.Load() != 1 {
+		t.Errorf("Text of a short article = %q, %v after %d calls", got, err, calls.Load())
+	}
+
+	calls.Store(0)
+	long := strings.Repeat("A sentence of a long article. ", ChunkSize/10)
+	got, err = Text(t.Context(), c, "Title", long)
+	if err != nil || got != "combined" || calls.Load() != 4 {
+		t.Errorf("Text of a long article = %q, %v after %d calls, want 3 chunks and a combination", got, err, calls.Load())
+	}
+
+	if _, err := Text(t.Context(), c, "Title", ""); err != ErrNoText {
+		t.Errorf("Text of no text = %v, want ErrNoText", err)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	text := "The city council approved the new transit budget on Monday. " +
+		"Lunch was served. " +
+		"The transit budget funds new buses and longer transit hours across the city. " +
+		"Weather was mild. " +
+		"Critics of the budget say the council ignored cyclists."
+	want := "The city council approved the new transit budget on Monday. " +
+		"The transit budget funds new buses and longer transit hours across the city."
+	if got := Extract(text, 2); got != want {
+		t.Errorf("Extract = %q, want %q", got, want)
+	}
+	if got := Extract("Only one sentence.", 3); got != "Only one sentence." {
+		t.Errorf("Extract of a short text = %q", got)
+	}
+}
@@ -0,0 +1,186 @@
+package tagger
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/swartzfoundation/feedr/model"
+)
+
+const (
+	// trainBatch is the number of examples trained at once.
+	trainBatch = 500
+	// predictThreshold is the probability above which tags are predicted.
+	predictThreshold = 0.8
+	// maxPredictions bounds the predicted tags per entry.
+	maxPredictions = 5
+)
+
+// Trainer trains the users' classifiers with the examples queued when they
+// tag, read or skip entries.
+type Trainer struct {
+	Interval time.Duration
+}
+
+// NewTrainer returns a trainer checking the queue every minute.
+func NewTrainer() *Trainer {
+	return &Trainer{Interval: time.Minute}
+}
+
+// Run trains the classifiers until ctx is cancelled.
+func (t *Trainer) Run(ctx context.Context) {
+	ticker := time.NewTicker(t.Interval)
+	defer ticker.Stop()
+	for {
+		for {
+			n, err := t.train(ctx)
+			if err != nil {
+				if !errors.Is(err, context.Canceled) {
+					slog.Error("tagger: training classifiers", "error", err)
+				}
+				break
+			}
+			if n < trainBatch {
+				break
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// train trains a batch of queued examples and returns its size.
+func (t *Trainer) train(ctx context.Context) (int, error) {
+	examples, err := model.ListPendingTraining(ctx, trainBatch)
+	if err != nil {
+		return 0, err
+	}
+	// Examples are grouped by user.
+	for start := 0; start < len(examples); {
+		end := start + 1
+		for end < len(examples) && examples[end].UserID == examples[start].UserID {
+			end++
+		}
+		if err := trainUser(ctx, examples[start].UserID, examples[start:end]); err != nil {
+			return 0, err
+		}
+		start = end
+	}
+	return len(examples), nil
+}
+
+// trainUser replaces the labels the user's classifier was trained with for
+// the examples with their current ones.
+func trainUser(ctx context.Context, userID string, examples []model.TrainingExample) error {
+	c, err := model.GetClassifier(ctx, userID)
+	if err != nil {
+		return err
+	}
+	ids := make([]int64, len(examples))
+	for i, ex := range examples {
+		ids[i] = ex.EntryID
+	}
+	entries, err := model.ListTrainingEntries(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	tags, err := model.ListEntryTags(ctx, userID, ids)
+	if err != nil {
+		return err
+	}
+	for i := range examples {
+		ex := &examples[i]
+		retrain(c, ex, entries[ex.EntryID], tags[ex.EntryID])
+	}
+	return model.SaveTraining(ctx, c, examples)
+}
+
+// retrain replaces the counts of the example in the classifier with those
+// of the entry, nil when it was deleted, and its current tags. The example
+// is untrained with the terms it was trained with, as the text of the entry
+// may have changed since.
+func retrain(c *model.Classifier, ex *model.TrainingExample, e *model.TrainingEntry, tags []string) {
+	if ex.Trained {
+		terms := ex.Terms
+		if terms == nil {
+			// Examples trained before their terms were stored can only be
+			// untrained with the current text.
+			if e == nil {
+				return
+			}
+			terms = Terms(Text(&e.Entry))
+		}
+		c.Tags.Untrain(terms, ex.Tags)
+		if ex.Interest != 0 {
+			c.Interest.Untrain(terms, interestLabels(ex.Interest))
+		}
+	}
+
+	ex.Tags, ex.Terms, ex.Interest, ex.Trained = []string{}, nil, 0, false
+	if e == nil {
+		return
+	}
+	if tags != nil {
+		ex.Tags = tags
+	}
+	ex.Interest = Interest(e)
+	ex.Trained = len(ex.Tags) > 0 || ex.Interest != 0
+	if ex.Trained {
+		ex.Terms = slices.Compact(slices.Sorted(slices.Values(Terms(Text(&e.Entry)))))
+		c.Tags.Train(ex.Terms, ex.Tags)
+		if ex.Interest != 0 {
+			c.Interest.Train(ex.Terms, interestLabels(ex.Interest))
+		}
+	}
+}
+
+// Interest returns 1 when the user showed interest in the entry by starring
+// or reading it, -1 when they skipped or deleted it and 0 otherwise.
+func Interest(e *model.TrainingEntry) int {
+	switch {
+	case e.IsStarred:
+		return 1
+	case e.IsSkipped || e.IsDeleted:
+		return -1
+	case e.IsRead:
+		return 1
+	}
+	return 0
+}
+
+func interestLabels(interest int) []string {
+	if interest > 0 {
+		return []string{model.InterestLabel}
+	}
+	return nil
+}
+
+// predict returns the predictions of the classifier for an entry with the
+// terms, leaving out the tags it has.
+func predict(c *model.Classifier, terms []string, tags []string) (model.EntryPrediction, bool) {
+	var p model.EntryPrediction
+	for _, pred := range c.Tags.Predict(terms, predictThreshold) {
+		if len(p.Tags) == maxPredictions {
+			break
+		}
+		if !slices.Contains(tags, pred.Label) {
+			p.Tags = append(p.Tags, model.PredictedTag{Tag: pred.Label, Probability: pred.Probability})
+		}
+	}
+	if interest, ok := c.Interest.Probability(terms, model.InterestLabel); ok {
+		p.Interest = &interest
+	}
+	return p, len(p.Tags) > 0 || p.Interest != nil
+}
+
+// termList returns the terms of term frequencies, sorted.
+func termList(tf map[string]int) []string {
+	return slices.Sorted(maps.Keys(tf))
+}
@@ -0,0 +1,244 @@
+// Package tagger tags new entries automatically. Entries mentioning a
+// keyword of a user's dictionary get its tag; the feed's categories and the
+// entry's most distinctive terms, weighed with TF-IDF, are suggested to the
+// user, who accepts or rejects them. Each decision adjusts the score of
+// future suggestions of the same tag.
+//
+// Each user also has a local Naive Bayes classifier, trained in the
+// background from the entries they tag, read or skip, which predicts the
+// tags of new entries and how likely the user is to read them.
+package tagger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/sanitize"
+)
+
+const (
+	// MinScore is the score below which suggestions are dropped.
+	MinScore = 0.3
+	// maxSuggestions bounds the suggestions per entry.
+	maxSuggestions = 5
+	// topTerms is the number of distinctive terms considered per entry.
+	topTerms = 3
+	// categoryScore and termScore are the scores of suggestions from feed
+	// categories and from terms, before feedback. Categories are chosen by
+	// the publisher and are more reliable than terms.
+	categoryScore = 0.8
+	termScore     = 0.6
+)
+
+// Weight is the factor applied to the score of a tag's suggestions from the
+// user's decisions: 1 without feedback, up to 2 when they were all
+// accepted and down towards 0 when they were all rejected.
+func Weight(f model.TagFeedback) float64 {
+	return 2 * float64(f.Accepted+1) / float64(f.Accepted+f.Rejected+2)
+}
+
+// Profile holds a user's keyword dictionaries and feedback.
+type Profile struct {
+	keywords map[string]*regexp.Regexp
+	feedback map[string]model.TagFeedback
+}
+
+// NewProfile compiles the user's dictionaries.
+func NewProfile(dicts []model.TagKeywords, feedback map[string]model.TagFeedback) *Profile {
+	p := &Profile{keywords: map[string]*regexp.Regexp{}, feedback: feedback}
+	for _, d := range dicts {
+		var words []string
+		for _, k := range d.Keywords {
+			if k = strings.TrimSpace(k); k != "" {
+				words = append(words, keywordPattern(k))
+			}
+		}
+		if len(words) > 0 {
+			p.keywords[d.Tag] = regexp.MustCompile(`(?i)` + strings.Join(words, "|"))
+		}
+	}
+	return p
+}
+
+// keywordPattern matches k as a whole word: a letter or digit at either
+// end of k must not continue a longer word. Unlike \b this holds for
+// non-ASCII letters, and allows keywords such as "C++", ".NET" or "CVE-".
+func keywordPattern(k string) string {
+	pattern := regexp.QuoteMeta(k)
+	first, _ := utf8.DecodeRuneInString(k)
+	if unicode.IsLetter(first) || unicode.IsNumber(first) {
+		pattern = `(?:^|[^\p{L}\p{N}])` + pattern
+	}
+	last, _ := utf8.DecodeLastRuneInString(k)
+	if unicode.IsLetter(last) || unicode.IsNumber(last) {
+		pattern += `(?:$|[^\p{L}\p{N}])`
+	}
+	return `(?:` + pattern + `)`
+}
+
+// Suggestion is a tag proposed for an entry.
+type Suggestion struct {
+	Tag    string
+	Source string
+	Score  float64
+}
+
+// Suggest returns the tags of the user's dictionaries text mentions, and
+// the best suggestions derived from the categories and terms, excluding
+// those tags.
+func (p *Profile) Suggest(text string, categories []string, terms []ScoredTerm) ([]string, []Suggestion) {
+	var tags []string
+	tagged := map[string]bool{}
+	for tag, re := range p.keywords {
+		if re.MatchString(text) {
+			tags = append(tags, tag)
+			tagged[tag] = true
+		}
+	}
+	sort.Strings(tags)
+
+	best := map[string]Suggestion{}
+	add := func(tag, source string, score float64) {
+		tag = model.NormalizeTag(tag)
+		if tag == "" || len(tag) > model.MaxTagLength || tagged[tag] {
+			return
+		}
+		score = min(score*Weight(p.feedback[tag]), 1)
+		if score >= MinScore && score > best[tag].Score {
+			best[tag] = Suggestion{tag, source, score}
+		}
+	}
+	for _, c := range categories {
+		add(c, model.TagSourceCategory, categoryScore)
+	}
+	for _, t := range terms {
+		add(t.Term, model.TagSourceTerm, termScore*t.Score)
+	}
+
+	suggestions := make([]Suggestion, 0, len(best))
+	for _, s := range best {
+		suggestions = append(suggestions, s)
+	}
+	sort.Slice(suggestions, func(i, j int) bool {
+		if suggestions[i].Score != suggestions[j].Score {
+			return suggestions[i].Score > suggestions[j].Score
+		}
+		return suggestions[i].Tag < suggestions[j].Tag
+	})
+	if len(suggestions) > maxSuggestions {
+		suggestions = suggestions[:maxSuggestions]
+	}
+	return tags, suggestions
+}
+
+// Text returns the text of e terms and keywords are taken from.
+func Text(e *model.Entry) string {
+	return e.Title + "\n" + sanitize.Text(e.Body())
+}
+
+// Tagger is an ingest hook tagging new entries for each subscriber of their
+// feed.
+type Tagger struct{}
+
+// Stored counts the terms of the entries and tags them.
+func (Tagger) Stored(ctx context.Context, f *model.Feed, entries []*model.Entry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	texts := make([]string, len(entries))
+	tfs := make([]map[string]int, len(entries))
+	counts := map[string]int64{"": int64(len(entries))}
+	for i, e := range entries {
+		texts[i] = Text(e)
+		tfs[i] = Frequencies(Terms(texts[i]))
+		for term := range tfs[i] {
+			counts[term]++
+		}
+	}
+	if err := model.AddTermCounts(ctx, counts); err != nil {
+		return err
+	}
+	terms := make([]string, 0, len(counts))
+	for term := range counts {
+		terms = append(terms, term)
+	}
+	df, err := model.GetTermCounts(ctx, terms)
+	if err != nil {
+		return err
+	}
+
+	subs, err := model.ListFeedSubscriptions(ctx, f.ID)
+	if err != nil {
+		return err
+	}
+	userIDs := make([]string, len(subs))
+	for i, s := range subs {
+		userIDs[i] = s.UserID
+	}
+	dicts, err := model.ListTagKeywords(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	feedback, err := model.ListTagFeedback(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	classifiers, err := model.ListClassifiers(ctx, userIDs)
+	if err != nil {
+		return err
+	}
+	dictsByUser := map[string][]model.TagKeywords{}
+	for _, d := range dicts {
+		dictsByUser[d.UserID] = append(dictsByUser[d.UserID], d)
+	}
+
+	top := make([][]ScoredTerm, len(entries))
+	termLists := make([][]string, len(entries))
+	for i := range entries {
+		top[i] = TopTerms(tfs[i], df, df[""], topTerms)
+		termLists[i] = termList(tfs[i])
+	}
+	var errs []error
+	for _, sub := range subs {
+		p := NewProfile(dictsByUser[sub.UserID], feedback[sub.UserID])
+		var (
+			tags        []model.EntryTag
+			suggestions []model.TagSuggestion
+			predictions []model.EntryPrediction
+		)
+		c := classifiers[sub.UserID]
+		for i, e := range entries {
+			entryTags, entrySuggestions := p.Suggest(texts[i], e.Categories, top[i])
+			if c != nil {
+				if pred, ok := predict(c, termLists[i], entryTags); ok {
+					pred.UserID, pred.EntryID = sub.UserID, e.ID
+					predictions = append(predictions, pred)
+				}
+			}
+			for _, t := range entryTags {
+				tags = append(tags, model.EntryTag{UserID: sub.UserID, EntryID: e.ID, Tag: t})
+			}
+			for _, s := range entrySuggestions {
+				suggestions = append(suggestions, model.TagSuggestion{
+					UserID: sub.UserID, EntryID: e.ID, Tag: s.Tag, Source: s.Source, Score: s.Score,
+				})
+			}
+		}
+		err := errors.Join(
+			model.AddEntryTags(ctx, tags),
+			model.AddTagSuggestions(ctx, suggestions),
+			model.SaveEntryPredictions(ctx, predictions),
+		)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("tagging for user %s: %w", sub.UserID, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,150 @@
+package tagger
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/swartzfoundation/feedr/model"
+)
+
+func TestTerms(t *testing.T) {
+	got := Terms("The Go 1.24 release: generic type aliases, and Swiss-table maps! 2025")
+	want := []string{"release", "generic", "type", "aliases", "swiss", "table", "maps"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Terms = %q, want %q", got, want)
+	}
+}
+
+func TestTopTerms(t *testing.T) {
+	tf := Frequencies(Terms("kubernetes kubernetes operator cluster release"))
+	df := map[string]int64{"kubernetes": 3, "operator": 10, "cluster": 40, "release": 900}
+	if got := TopTerms(tf, df, minDocuments-1, 3); got != nil {
+		t.Errorf("TopTerms with few documents = %v, want nil", got)
+	}
+	got := TopTerms(tf, df, 1000, 3)
+	var terms []string
+	for _, s := range got {
+		terms = append(terms, s.Term)
+		if s.Score <= 0 || s.Score > 1 {
+			t.Errorf("score of %q = %v, want in (0, 1]", s.Term, s.Score)
+		}
+	}
+	if want := []string{"kubernetes", "operator", "cluster"}; !reflect.DeepEqual(terms, want) {
+		t.Errorf("TopTerms = %q, want %q", terms, want)
+	}
+}
+
+func TestWeight(t *testing.T) {
+	for _, tt := range []struct {
+		f    model.TagFeedback
+		want float64
+	}{
+		{model.TagFeedback{}, 1},
+		{model.TagFeedback{Accepted: 2}, 1.5},
+		{model.TagFeedback{Rejected: 2}, 0.5},
+		{model.TagFeedback{Accepted: 3, Rejected: 3}, 1},
+	} {
+		if got := Weight(tt.f); got != tt.want {
+			t.Errorf("Weight(%+v) = %v, want %v", tt.f, got, tt.want)
+		}
+	}
+}
+
+func TestSuggest(t *testing.T) {
+	p := NewProfile([]model.TagKeywords{
+		{Tag: "go", Keywords: []string{"golang", "go toolchain"}},
+		{Tag: "rust", Keywords: []string{"rustc"}},
+	}, map[string]model.TagFeedback{
+		"programming": {Rejected: 8},
+		"compilers":   {Accepted: 4},
+	})
+	text := "Faster builds with the Go toolchain; trustc is not rustc-like"
+	tags, suggestions := p.Suggest(text, []string{"Programming", " Release  Notes ", "Go"}, []ScoredTerm{
+		{"compilers", 0.5},
+		{"builds", 0.2},
+	})
+	if want := []string{"go", "rust"}; !reflect.DeepEqual(tags, want) {
+		t.Errorf("tags = %q, want %q", tags, want)
+	}
+	want := []Suggestion{
+		{"release notes", model.TagSourceCategory, 0.8},
+		{"compilers", model.TagSourceTerm, 0.6 * 0.5 * Weight(model.TagFeedback{Accepted: 4})},
+	}
+	if !reflect.DeepEqual(suggestions, want) {
+		t.Errorf("suggestions = %+v, want %+v", suggestions, want)
+	}
+}
+
+func TestKeywordBoundaries(t *testing.T) {
+	p := NewProfile([]model.TagKeywords{
+		{Tag: "cpp", Keywords: []string{"C++"}},
+		{Tag: "dotnet", Keywords: []string{".NET"}},
+		{Tag: "security", Keywords: []string{"CVE-"}},
+		{Tag: "food", Keywords: []string{"café", "Über"}},
+		{Tag: "go", Keywords: []string{"go"}},
+	}, nil)
+	for _, tt := range []struct {
+		text string
+		want []string
+	}{
+		{"Modern C++ in 2025", []string{"cpp"}},
+		{"What's new in C++?", []string{"cpp"}},
+		{"Porting to .NET 9", []string{"dotnet"}},
+		{"Patch CVE-2025-1234 now", []string{"security"}},
+		{"Der Café am Markt", []string{"food"}},
+		{"über alles", []string{"food"}},
+		{"Cafés and cafeterias", nil},
+		{"Überall", nil},
+		{"going, gopher, algo", nil},
+		{"go.", []string{"go"}},
+		{"Let's go-live", []string{"go"}},
+	} {
+		tags, _ := p.Suggest(tt.text, nil, nil)
+		if !reflect.DeepEqual(tags, tt.want) {
+			t.Errorf("%q: tags = %q, want %q", tt.text, tags, tt.want)
+		}
+	}
+}
+
+func TestInterest(t *testing.T) {
+	for _, tt := range []struct {
+		e    model.TrainingEntry
+		want int
+	}{
+		{model.TrainingEntry{}, 0},
+		{model.TrainingEntry{IsRead: true}, 1},
+		{model.TrainingEntry{IsRead: true, IsSkipped: true}, -1},
+		{model.TrainingEntry{IsDeleted: true}, -1},
+		{model.TrainingEntry{IsRead: true, IsSkipped: true, IsStarred: true}, 1},
+	} {
+		if got := Interest(&tt.e); got != tt.want {
+			t.Errorf("Interest(%+v) = %d, want %d", tt.e, got, tt.want)
+		}
+	}
+}
+
+func TestRetrain(t *testing.T) {
+	c := &model.Classifier{}
+	ex := &model.TrainingExample{}
+	e := &model.TrainingEntry{Entry: model.Entry{Title: "Kubernetes operators", Content: "<p>Scaling the cluster</p>"}, IsRead: true}
+	retrain(c, ex, e, []string{"devops"})
+	if !ex.Trained || ex.Interest != 1 || !reflect.DeepEqual(ex.Terms, []string{"cluster", "kubernetes", "operators", "scaling"}) {
+		t.Fatalf("unexpected example %+v", ex)
+	}
+
+	// The text changed since, such as when the article was extracted.
+	e.ExtractedContent = "<p>Bread flour and hydration</p>"
+	retrain(c, ex, e, []string{"cooking"})
+	var want model.Classifier
+	want.Tags.Train(ex.Terms, []string{"cooking"})
+	want.Interest.Train(ex.Terms, []string{model.InterestLabel})
+	if !reflect.DeepEqual(c.Tags, want.Tags) || !reflect.DeepEqual(c.Interest, want.Interest) {
+		t.Errorf("classifier kept counts of the old text: %+v", c.Tags)
+	}
+
+	// The entry was deleted.
+	retrain(c, ex, nil, nil)
+	if ex.Trained || c.Tags.Docs != 0 || len(c.Tags.Terms) != 0 || len(c.Tags.Labels) != 0 || c.Interest.Docs != 0 {
+		t.Errorf("classifier kept counts of a deleted entry: %+v %+v", c.Tags, ex)
+	}
+}
@@ -0,0 +1,95 @@
+package tagger
+
+import (
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// minDocuments is the number of entries seen below which term weights are
+// not meaningful yet.
+const minDocuments = 50
+
+// stopwords are frequent English words that never make good tags.
+var stopwords = map[string]bool{}
+
+func init() {
+	for _, w := range strings.Fields(`about above after again against also among another
+		any are aren because been before being below between both but can cannot could
+		did does doing don down during each even ever every few for from further get gets
+		had has have having her here hers herself him himself his how however into its
+		itself just like made make many may more most much must myself new next not now
+		off once one only other our ours ourselves out over own same said says she should
+		since some still such than that the their theirs them themselves then there these
+		they this those through too under until upon very via was way were what when where
+		whether which while who whom whose why will with within without would yet you your
+		yours yourself yourselves all and over use used using first last year years time
+		read more today week new news`) {
+		stopwords[w] = true
+	}
+}
+
+// Terms returns the lowercased words of text that may be tags: words of
+// three to thirty characters that are not numbers or stopwords.
+func Terms(text string) []string {
+	words := strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsNumber(r)
+	})
+	terms := words[:0]
+	for _, w := range words {
+		n := len([]rune(w))
+		if n < 3 || n > 30 || stopwords[w] || strings.IndexFunc(w, unicode.IsLetter) < 0 {
+			continue
+		}
+		terms = append(terms, w)
+	}
+	return terms
+}
+
+// Frequencies counts the occurrences of each term.
+func Frequencies(terms []string) map[string]int {
+	tf := make(map[string]int, len(terms))
+	for _, t := range terms {
+		tf[t]++
+	}
+	return tf
+}
+
+// ScoredTerm is a term with its TF-IDF weight, between 0 and 1.
+type ScoredTerm struct {
+	Term  string
+	Score float64
+}
+
+// TopTerms returns up to n terms of a document with the highest TF-IDF
+// weights, given the number of documents each term appears in and the
+// total number of documents. Weights are normalized by the largest
+// possible inverse document frequency. It returns nothing while too few
+// documents were seen.
+func TopTerms(tf map[string]int, df map[string]int64, docs int64, n int) []ScoredTerm {
+	if docs < minDocuments {
+		return nil
+	}
+	maxTF := 0
+	for _, c := range tf {
+		maxTF = max(maxTF, c)
+	}
+	maxIDF := math.Log(float64(docs + 1))
+	scored := make([]ScoredTerm, 0, len(tf))
+	for term, c := range tf {
+		idf := math.Log(float64(docs+1) / float64(df[term]+1))
+		weight := (0.5 + 0.5*float64(c)/float64(maxTF)) * idf / maxIDF
+		scored = append(scored, ScoredTerm{term, weight})
+	}
+	sort.Slice(scored, func(i, j int) bool {
+		if scored[i].Score != scored[j].Score {
+			return scored[i].Score > scored[j].Score
+		}
+		return scored[i].Term < scored[j].Term
+	})
+	if len(scored) > n {
+		scored = scored[:n]
+	}
+	return scored
+}
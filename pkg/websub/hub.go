@@ -0,0 +1,389 @@
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+)
+
+// HubPath is the path of feedr's own hub.
+const HubPath = "/websub/hub"
+
+const (
+	// maxLease bounds the lease granted to subscribers.
+	maxLease = 30 * 24 * time.Hour
+	// maxSecretSize is the longest hub.secret accepted, as per the
+	// specification.
+	maxSecretSize = 200
+	// maxAttempts is the number of times a delivery is tried before it
+	// is dropped.
+	maxAttempts = 8
+	// verifyTimeout bounds the verification of a subscriber's intent.
+	verifyTimeout = 30 * time.Second
+)
+
+var (
+	ErrUnknownTopic = errors.New("websub: topic is not published by this hub")
+	ErrChallenge    = errors.New("websub: subscriber did not echo the challenge")
+)
+
+// HubStore keeps the subscriptions of a hub and the content waiting to be
+// delivered to them.
+type HubStore interface {
+	SaveSubscription(ctx context.Context, s *model.HubSubscription) error
+	DeleteSubscription(ctx context.Context, topic, callback string) error
+	DeleteExpiredSubscriptions(ctx context.Context, now int64) error
+	ListSubscribers(ctx context.Context, topic string, now int64) ([]model.HubSubscription, error)
+	CreateDeliveries(ctx context.Context, deliveries []*model.HubDelivery) error
+	ListDueDeliveries(ctx context.Context, now int64, limit int) ([]model.HubDeliveryTarget, error)
+	UpdateDeliveryAttempt(ctx context.Context, d *model.HubDelivery) error
+	DeleteDelivery(ctx context.Context, id int64) error
+}
+
+// dbStore is the HubStore of the database.
+type dbStore struct{}
+
+func (dbStore) SaveSubscription(ctx context.Context, s *model.HubSubscription) error {
+	return model.SaveHubSubscription(ctx, s)
+}
+
+func (dbStore) DeleteSubscription(ctx context.Context, topic, callback string) error {
+	return model.DeleteHubSubscription(ctx, topic, callback)
+}
+
+func (dbStore) DeleteExpiredSubscriptions(ctx context.Context, now int64) error {
+	return model.DeleteExpiredHubSubscriptions(ctx, now)
+}
+
+func (dbStore) ListSubscribers(ctx context.Context, topic string, now int64) ([]model.HubSubscription, error) {
+	return model.ListHubSubscribers(ctx, topic, now)
+}
+
+func (dbStore) CreateDeliveries(ctx context.Context, deliveries []*model.HubDelivery) error {
+	return model.CreateHubDeliveries(ctx, deliveries)
+}
+
+func (dbStore) ListDueDeliveries(ctx context.Context, now int64, limit int) ([]model.HubDeliveryTarget, error) {
+	return model.ListDueHubDeliveries(ctx, now, limit)
+}
+
+func (dbStore) UpdateDeliveryAttempt(ctx context.Context, d *model.HubDelivery) error {
+	return model.UpdateHubDeliveryAttempt(ctx, d)
+}
+
+func (dbStore) DeleteDelivery(ctx context.Context, id int64) error {
+	return model.DeleteHubDelivery(ctx, id)
+}
+
+// TopicFunc renders the current content of a topic published by feedr.
+type TopicFunc func(ctx context.Context, topic string) (contentType string, body []byte, err error)
+
+// Hub is a WebSub hub for the feeds feedr publishes. Publishers register
+// the URL prefix of their feeds with Handle and call Publish when a feed
+// changes; subscriptions to any other topic are refused.
+type Hub struct {
+	// BaseURL is the public URL of feedr topics and the hub live under.
+	BaseURL      string
+	LeaseSeconds int
+	Client       *http.Client
+	Store        HubStore
+
+	mu     sync.RWMutex
+	topics map[string]TopicFunc
+	wake   chan struct{}
+}
+
+// NewHub returns a hub granting leases of cfg.LeaseSeconds by default.
+func NewHub(cfg config.WebSubConfig, baseURL string) *Hub {
+	return &Hub{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		LeaseSeconds: cfg.LeaseSeconds,
+		// Anyone can ask the hub to call back any URL.
+		Client: fetch.PublicClient,
+		Store:  dbStore{},
+		topics: map[string]TopicFunc{},
+		wake:   make(chan struct{}, 1),
+	}
+}
+
+// URL is the URL of the hub, for published feeds to link to with
+// rel="hub".
+func (h *Hub) URL() string {
+	return h.BaseURL + HubPath
+}
+
+// Handle publishes the topics under path, relative to BaseURL, rendering
+// their content with fn.
+func (h *Hub) Handle(path string, fn TopicFunc) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.topics[h.BaseURL+path] = fn
+}
+
+// topic returns the function rendering topic, matching the longest
+// registered prefix.
+func (h *Hub) topic(topic string) (TopicFunc, bool) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	var (
+		fn      TopicFunc
+		longest = -1
+	)
+	for prefix, f := range h.topics {
+		if strings.HasPrefix(topic, prefix) && len(prefix) > longest {
+			fn, longest = f, len(prefix)
+		}
+	}
+	return fn, fn != nil
+}
+
+// Mount registers the hub endpoint on r.
+func (h *Hub) Mount(r chi.Router) {
+	r.Post(HubPath, h.subscribe)
+}
+
+// subscribe accepts subscription and unsubscription requests. The intent is
+// verified asynchronously, as the specification allows.
+func (h *Hub) subscribe(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+	mode := r.PostForm.Get("hub.mode")
+	topic := r.PostForm.Get("hub.topic")
+	callback := r.PostForm.Get("hub.callback")
+	secret := r.PostForm.Get("hub.secret")
+
+	if mode != "subscribe" && mode != "unsubscribe" {
+		http.Error(w, "hub.mode must be subscribe or unsubscribe", http.StatusBadRequest)
+		return
+	}
+	if u, err := url.Parse(callback); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		http.Error(w, "hub.callback must be an http or https URL", http.StatusBadRequest)
+		return
+	}
+	if _, ok := h.topic(topic); !ok {
+		http.Error(w, ErrUnknownTopic.Error(), http.StatusNotFound)
+		return
+	}
+	if len(secret) >= maxSecretSize {
+		http.Error(w, "hub.secret is too long", http.StatusBadRequest)
+		return
+	}
+
+	lease := time.Duration(h.LeaseSeconds) * time.Second
+	if s, err := strconv.Atoi(r.PostForm.Get("hub.lease_seconds")); err == nil && s > 0 {
+		lease = time.Duration(s) * time.Second
+	}
+	lease = min(lease, maxLease)
+
+	w.WriteHeader(http.StatusAccepted)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), verifyTimeout)
+		defer cancel()
+		if err := h.verify(ctx, mode, topic, callback, secret, lease); err != nil {
+			slog.Info("websub: hub verification failed", "mode", mode, "topic", topic, "callback", callback, "error", err)
+		}
+	}()
+}
+
+// verify confirms the intent of the subscriber and applies the request.
+func (h *Hub) verify(ctx context.Context, mode, topic, callback, secret string, lease time.Duration) error {
+	if err := verifyIntent(ctx, h.Client, callback, mode, topic, lease); err != nil {
+		return err
+	}
+	if mode == "unsubscribe" {
+		return h.Store.DeleteSubscription(ctx, topic, callback)
+	}
+	return h.Store.SaveSubscription(ctx, &model.HubSubscription{
+		Topic:     topic,
+		Callback:  callback,
+		Secret:    secret,
+		ExpiresAt: time.Now().Add(lease).Unix(),
+	})
+}
+
+// verifyIntent sends the challenge to callback and checks that it is echoed.
+func verifyIntent(ctx context.Context, client *http.Client, callback, mode, topic string, lease time.Duration) error {
+	u, err := url.Parse(callback)
+	if err != nil {
+		return err
+	}
+	challenge := model.NewToken(16)
+	q := u.Query()
+	q.Set("hub.mode", mode)
+	q.Set("hub.topic", topic)
+	q.Set("hub.challenge", challenge)
+	if mode == "subscribe" {
+		q.Set("hub.lease_seconds", strconv.Itoa(int(lease.Seconds())))
+	}
+	u.RawQuery = q.Encode()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", fetch.UserAgent)
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 || strings.TrimSpace(string(body)) != challenge {
+		return ErrChallenge
+	}
+	return nil
+}
+
+// Publish queues the current content of topic for delivery to its
+// subscribers.
+func (h *Hub) Publish(ctx context.Context, topic string) error {
+	fn, ok := h.topic(topic)
+	if !ok {
+		return ErrUnknownTopic
+	}
+	now := time.Now().Unix()
+	subs, err := h.Store.ListSubscribers(ctx, topic, now)
+	if err != nil || len(subs) == 0 {
+		return err
+	}
+	contentType, body, err := fn(ctx, topic)
+	if err != nil {
+		return err
+	}
+	deliveries := make([]*model.HubDelivery, len(subs))
+	for i, s := range subs {
+		deliveries[i] = &model.HubDelivery{
+			SubscriptionID: s.ID,
+			ContentType:    contentType,
+			Body:           body,
+			NextAttemptAt:  now,
+		}
+	}
+	if err := h.Store.CreateDeliveries(ctx, deliveries); err != nil {
+		return err
+	}
+	select {
+	case h.wake <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Run delivers queued content, retrying failed deliveries with an
+// exponential backoff, and drops expired subscriptions until ctx is
+// cancelled.
+func (h *Hub) Run(ctx context.Context) {
+	ticker := time.NewTicker(time.Minute)
+	defer ticker.Stop()
+	for {
+		h.deliverDue(ctx)
+		if err := h.Store.DeleteExpiredSubscriptions(ctx, time.Now().Unix()); err != nil && !errors.Is(err, context.Canceled) {
+			slog.Error("websub: deleting expired hub subscriptions", "error", err)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-h.wake:
+		}
+	}
+}
+
+func (h *Hub) deliverDue(ctx context.Context) {
+	targets, err := h.Store.ListDueDeliveries(ctx, time.Now().Unix(), 100)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			slog.Error("websub: listing due hub deliveries", "error", err)
+		}
+		return
+	}
+	for i := range targets {
+		if ctx.Err() != nil {
+			return
+		}
+		t := &targets[i]
+		err := h.deliver(ctx, t)
+		switch {
+		case err == nil:
+			err = h.Store.DeleteDelivery(ctx, t.ID)
+		case errors.Is(err, errGone):
+			// The subscriber no longer wants the topic.
+			err = h.Store.DeleteSubscription(ctx, t.Topic, t.Callback)
+		case t.Attempts+1 >= maxAttempts:
+			slog.Warn("websub: dropping hub delivery", "callback", t.Callback, "error", err)
+			err = h.Store.DeleteDelivery(ctx, t.ID)
+		default:
+			t.Attempts++
+			t.LastError = err.Error()
+			t.NextAttemptAt = time.Now().Add(retryDelay(t.Attempts)).Unix()
+			err = h.Store.UpdateDeliveryAttempt(ctx, &t.HubDelivery)
+		}
+		if err != nil {
+			slog.Error("websub: updating hub delivery", "delivery", t.ID, "error", err)
+		}
+	}
+}
+
+var errGone = errors.New("websub: subscriber is gone")
+
+// deliver pushes the content to the subscriber, signed with its secret.
+func (h *Hub) deliver(ctx context.Context, t *model.HubDeliveryTarget) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, t.Callback, strings.NewReader(string(t.Body)))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", t.ContentType)
+	req.Header.Set("User-Agent", fetch.UserAgent)
+	req.Header.Add("Link", fmt.Sprintf(`<%s>; rel="hub"`, h.URL()))
+	req.Header.Add("Link", fmt.Sprintf(`<%s>; rel="self"`, t.Topic))
+	if t.Secret != "" {
+		req.Header.Set("X-Hub-Signature", Sign(t.Secret, t.Body))
+	}
+	resp, err := h.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	switch {
+	case resp.StatusCode == http.StatusGone:
+		return errGone
+	case resp.StatusCode < 200 || resp.StatusCode > 299:
+		return fmt.Errorf("websub: subscriber returned %s", resp.Status)
+	}
+	return nil
+}
+
+// retryDelay is the delay before the next attempt after n failures, from
+// one minute doubling up to about two hours.
+func retryDelay(n int) time.Duration {
+	return time.Minute << min(n-1, 7)
+}
+
+// Sign returns the X-Hub-Signature header of body for secret.
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,35 @@
+package websub
+
+import (
+	"regexp"
+	"strings"
+)
+
+var (
+	linkValue = regexp.MustCompile(`<([^>]*)>((?:\s*;\s*(?:[^;,"]|"[^"]*")+)*)`)
+	linkParam = regexp.MustCompile(`([a-zA-Z*]+)\s*=\s*(?:"([^"]*)"|([^;,\s]*))`)
+)
+
+// Links returns the hub and self URLs of Link header values, which take
+// precedence over the links of the feed document.
+func Links(values []string) (hub, self string) {
+	for _, v := range values {
+		for _, m := range linkValue.FindAllStringSubmatch(v, -1) {
+			target := strings.TrimSpace(m[1])
+			for _, p := range linkParam.FindAllStringSubmatch(m[2], -1) {
+				if !strings.EqualFold(p[1], "rel") {
+					continue
+				}
+				for _, rel := range strings.Fields(strings.ToLower(p[2] + p[3])) {
+					switch {
+					case rel == "hub" && hub == "":
+						hub = target
+					case rel == "self" && self == "":
+						self = target
+					}
+				}
+			}
+		}
+	}
+	return hub, self
+}
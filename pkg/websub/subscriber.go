@@ -0,0 +1,346 @@
+// Package websub implements WebSub. The subscriber subscribes feeds that
+// advertise a hub to it, and ingests the content the hub pushes to the
+// callback immediately; polling continues at a slower pace as a fallback.
+// The hub pushes the feeds feedr publishes itself to their subscribers.
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+	"github.com/swartzfoundation/feedr/pkg/feed"
+	"github.com/swartzfoundation/feedr/pkg/fetch"
+	"github.com/swartzfoundation/feedr/pkg/ingest"
+)
+
+// CallbackPath is the path hubs verify subscriptions and push content on.
+const CallbackPath = "/websub/callback/"
+
+const (
+	// renewBefore is how long before the lease ends it gets renewed.
+	renewBefore = 24 * time.Hour
+	// retryAfter is the delay before a failed or denied subscription is
+	// requested again.
+	retryAfter = 6 * time.Hour
+)
+
+// Subscriber subscribes feeds to their hubs and receives their pushes.
+type Subscriber struct {
+	// BaseURL is the public URL of feedr the callback is built from.
+	BaseURL      string
+	LeaseSeconds int
+	Pipeline     *ingest.Pipeline
+	Client       *http.Client
+}
+
+// New returns a subscriber ingesting pushed content through p.
+func New(cfg config.WebSubConfig, baseURL string, p *ingest.Pipeline) *Subscriber {
+	return &Subscriber{
+		BaseURL:      strings.TrimRight(baseURL, "/"),
+		LeaseSeconds: cfg.LeaseSeconds,
+		Pipeline:     p,
+		Client:       fetch.PublicClient,
+	}
+}
+
+// Mount registers the callback routes on r.
+func (s *Subscriber) Mount(r chi.Router) {
+	r.Get(CallbackPath+"{feedID}", s.verify)
+	r.Post(CallbackPath+"{feedID}", s.receive)
+}
+
+func (s *Subscriber) callbackURL(feedID int64) string {
+	return s.BaseURL + CallbackPath + strconv.FormatInt(feedID, 10)
+}
+
+// Discover subscribes f to the hub advertised by its Link headers or its
+// document, unless it is already subscribed to it.
+func (s *Subscriber) Discover(ctx context.Context, f *model.Feed, links []string, parsed *feed.Feed) error {
+	hub, topic := Links(links)
+	if hub == "" {
+		hub, topic = parsed.HubURL, parsed.SelfURL
+	}
+	if hub == "" {
+		return nil
+	}
+	if topic == "" {
+		topic = f.URL
+	}
+	existing, err := model.GetWebSubSubscription(ctx, f.ID)
+	if err != nil && !errors.Is(err, model.ErrNotFound) {
+		return err
+	}
+	if existing != nil && existing.HubURL == hub && existing.TopicURL == topic {
+		return nil
+	}
+	return s.Subscribe(ctx, f.ID, hub, topic)
+}
+
+// Subscribe requests a subscription to topic from hub. The hub confirms it
+// asynchronously by verifying the intent on the callback.
+func (s *Subscriber) Subscribe(ctx context.Context, feedID int64, hub, topic string) error {
+	sub := &model.WebSubSubscription{
+		FeedID:   feedID,
+		HubURL:   hub,
+		TopicURL: topic,
+		State:    model.WebSubPending,
+	}
+	if existing, err := model.GetWebSubSubscription(ctx, feedID); err == nil {
+		sub.CreatedAt = existing.CreatedAt
+		if existing.Active(time.Now().Unix()) && existing.HubURL == hub && existing.TopicURL == topic {
+			// Keep receiving pushes with the current secret until the
+			// renewal is verified.
+			sub.State, sub.ExpiresAt, sub.Secret = existing.State, existing.ExpiresAt, existing.Secret
+		}
+	}
+	form := url.Values{
+		"hub.mode":          {"subscribe"},
+		"hub.topic":         {topic},
+		"hub.callback":      {s.callbackURL(feedID)},
+		"hub.lease_seconds": {strconv.Itoa(s.LeaseSeconds)},
+	}
+	// Secrets must not travel in clear text; pushes from plain HTTP hubs
+	// only trigger a fetch of the feed.
+	if strings.HasPrefix(hub, "https://") {
+		if sub.Secret == "" {
+			sub.Secret = model.NewToken(32)
+		}
+		form.Set("hub.secret", sub.Secret)
+	} else {
+		sub.Secret = ""
+	}
+	// The hub may verify the intent before answering, so the subscription
+	// is stored first.
+	if err := model.SaveWebSubSubscription(ctx, sub); err != nil {
+		return err
+	}
+
+	err := s.post(ctx, hub, form)
+	if err != nil {
+		// A failed renewal leaves the current lease running.
+		if sub.State != model.WebSubSubscribed {
+			sub.State = model.WebSubFailed
+		}
+		sub.Reason = err.Error()
+		if serr := model.SaveWebSubSubscription(ctx, sub); serr != nil {
+			slog.Error("websub: saving failed subscription", "feed", feedID, "error", serr)
+		}
+	}
+	return err
+}
+
+func (s *Subscriber) post(ctx context.Context, hub string, form url.Values) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hub, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("User-Agent", fetch.UserAgent)
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("websub: hub returned %s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+// Active reports whether the hub currently pushes the feed's updates.
+func (s *Subscriber) Active(ctx context.Context, feedID int64) bool {
+	sub, err := model.GetWebSubSubscription(ctx, feedID)
+	return err == nil && sub.Active(time.Now().Unix())
+}
+
+// Run renews leases before they expire and retries failed subscriptions
+// until ctx is cancelled. Requests that go unanswered are repeated after
+// retryAfter.
+func (s *Subscriber) Run(ctx context.Context) {
+	ticker := time.NewTicker(10 * time.Minute)
+	defer ticker.Stop()
+	for {
+		s.renew(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Subscriber) renew(ctx context.Context) {
+	now := time.Now()
+	subs, err := model.ListWebSubToRenew(ctx, now.Add(renewBefore).Unix(), now.Add(-retryAfter).Unix(), 100)
+	if err != nil {
+		if !errors.Is(err, context.Canceled) {
+			slog.Error("websub: listing subscriptions to renew", "error", err)
+		}
+		return
+	}
+	for _, sub := range subs {
+		if err := s.Subscribe(ctx, sub.FeedID, sub.HubURL, sub.TopicURL); err != nil {
+			slog.Warn("websub: renewing subscription", "feed", sub.FeedID, "hub", sub.HubURL, "error", err)
+		}
+	}
+}
+
+// verify answers the hub's verification of intent, echoing the challenge
+// when the request matches a subscription feedr asked for.
+func (s *Subscriber) verify(w http.ResponseWriter, r *http.Request) {
+	sub, ok := loadSubscription(w, r)
+	if !ok {
+		return
+	}
+	q := r.URL.Query()
+	if q.Get("hub.topic") != sub.TopicURL {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch q.Get("hub.mode") {
+	case "subscribe":
+		lease, err := strconv.ParseInt(q.Get("hub.lease_seconds"), 10, 64)
+		if err != nil || lease <= 0 || q.Get("hub.challenge") == "" {
+			http.Error(w, "invalid verification", http.StatusBadRequest)
+			return
+		}
+		sub.State = model.WebSubSubscribed
+		sub.Reason = ""
+		sub.ExpiresAt = time.Now().Unix() + lease
+	case "denied":
+		sub.State = model.WebSubDenied
+		sub.Reason = q.Get("hub.reason")
+		sub.ExpiresAt = 0
+	default:
+		// feedr never unsubscribes; subscriptions lapse with their lease.
+		http.NotFound(w, r)
+		return
+	}
+	if err := model.SaveWebSubSubscription(r.Context(), sub); err != nil {
+		slog.Error("websub: saving verified subscription", "feed", sub.FeedID, "error", err)
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	slog.Info("websub: subscription "+sub.State, "feed", sub.FeedID, "hub", sub.HubURL)
+	w.Header().Set("Content-Type", "text/plain")
+	io.WriteString(w, q.Get("hub.challenge"))
+}
+
+// receive ingests content pushed by the hub. Content with an invalid
+// signature is acknowledged but ignored, as the specification requires.
+func (s *Subscriber) receive(w http.ResponseWriter, r *http.Request) {
+	sub, ok := loadSubscription(w, r)
+	if !ok {
+		return
+	}
+	if sub.State != model.WebSubSubscribed {
+		http.Error(w, "not subscribed", http.StatusGone)
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, fetch.MaxBodySize+1))
+	if err != nil || len(body) > fetch.MaxBodySize {
+		http.Error(w, "invalid body", http.StatusRequestEntityTooLarge)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+
+	ctx := r.Context()
+	if sub.Secret == "" {
+		// Unsigned content cannot be trusted, fetch the feed instead.
+		if err := model.ScheduleFeedFetch(ctx, sub.FeedID); err != nil {
+			slog.Error("websub: scheduling fetch", "feed", sub.FeedID, "error", err)
+		}
+		return
+	}
+	if !ValidSignature(sub.Secret, r.Header.Get("X-Hub-Signature"), body) {
+		slog.Warn("websub: ignoring push with invalid signature", "feed", sub.FeedID)
+		return
+	}
+
+	f, err := model.GetFeedByID(ctx, sub.FeedID)
+	if err != nil {
+		slog.Error("websub: loading feed", "feed", sub.FeedID, "error", err)
+		return
+	}
+	parsed, err := feed.Parse(body, sub.TopicURL)
+	if err != nil {
+		slog.Warn("websub: parsing pushed content", "feed", sub.FeedID, "error", err)
+		return
+	}
+	entries, err := s.Pipeline.Ingest(ctx, f, parsed.Items)
+	if err != nil {
+		slog.Error("websub: ingesting pushed content", "feed", sub.FeedID, "error", err)
+		return
+	}
+	if err := model.UpdateWebSubPush(ctx, sub.FeedID, time.Now().Unix()); err != nil {
+		slog.Error("websub: saving subscription", "feed", sub.FeedID, "error", err)
+	}
+	slog.Info("websub: received push", "feed", sub.FeedID, "entries", len(entries))
+}
+
+func loadSubscription(w http.ResponseWriter, r *http.Request) (*model.WebSubSubscription, bool) {
+	feedID, err := strconv.ParseInt(chi.URLParam(r, "feedID"), 10, 64)
+	if err != nil {
+		http.NotFound(w, r)
+		return nil, false
+	}
+	sub, err := model.GetWebSubSubscription(r.Context(), feedID)
+	if err != nil {
+		if !errors.Is(err, model.ErrNotFound) {
+			slog.Error("websub: loading subscription", "feed", feedID, "error", err)
+			http.Error(w, "internal error", http.StatusInternalServerError)
+			return nil, false
+		}
+		http.NotFound(w, r)
+		return nil, false
+	}
+	return sub, true
+}
+
+// ValidSignature checks an X-Hub-Signature header, "method=hexdigest",
+// against the HMAC of body keyed with secret.
+func ValidSignature(secret, header string, body []byte) bool {
+	method, digest, ok := strings.Cut(header, "=")
+	if !ok {
+		return false
+	}
+	var h func() hash.Hash
+	switch strings.ToLower(method) {
+	case "sha1":
+		h = sha1.New
+	case "sha256":
+		h = sha256.New
+	case "sha384":
+		h = sha512.New384
+	case "sha512":
+		h = sha512.New
+	default:
+		return false
+	}
+	got, err := hex.DecodeString(digest)
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(h, []byte(secret))
+	mac.Write(body)
+	return hmac.Equal(got, mac.Sum(nil))
+}
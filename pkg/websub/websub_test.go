@@ -0,0 +1,333 @@
+package websub
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/swartzfoundation/feedr/model"
+	"github.com/swartzfoundation/feedr/pkg/config"
+)
+
+func TestLinks(t *testing.T) {
+	hub, self := Links([]string{
+		`<https://example.com/feed.xml>; rel="self", <https://hub.example.com/>; rel=hub`,
+		`<https://other.example.com/>; rel="hub"`,
+	})
+	if hub != "https://hub.example.com/" || self != "https://example.com/feed.xml" {
+		t.Errorf("unexpected links %q %q", hub, self)
+	}
+
+	hub, self = Links([]string{`<https://hub.example.com/>; title="a, b"; rel="self hub"`})
+	if hub != "https://hub.example.com/" || self != hub {
+		t.Errorf("expected both relations, got %q %q", hub, self)
+	}
+
+	if hub, self := Links([]string{`<https://example.com/>; rel="alternate"`}); hub != "" || self != "" {
+		t.Errorf("expected no links, got %q %q", hub, self)
+	}
+}
+
+func TestValidSignature(t *testing.T) {
+	body := []byte(`<feed xmlns="http://www.w3.org/2005/Atom"></feed>`)
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write(body)
+	sig := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+
+	if !ValidSignature("secret", sig, body) {
+		t.Errorf("expected signature to be valid")
+	}
+	var tests = []struct {
+		name, secret, header string
+		body                 []byte
+	}{
+		{"wrong secret", "other", sig, body},
+		{"tampered body", "secret", sig, append(body, ' ')},
+		{"unknown method", "secret", "md5=" + sig[7:], body},
+		{"missing method", "secret", sig[7:], body},
+		{"invalid hex", "secret", "sha256=zz", body},
+	}
+	for _, tt := range tests {
+		if ValidSignature(tt.secret, tt.header, tt.body) {
+			t.Errorf("%s: expected signature to be rejected", tt.name)
+		}
+	}
+}
+
+func TestSign(t *testing.T) {
+	body := []byte("content")
+	if !ValidSignature("secret", Sign("secret", body), body) {
+		t.Errorf("expected own signature to be valid")
+	}
+}
+
+func TestVerifyIntent(t *testing.T) {
+	var lease string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		lease = q.Get("hub.lease_seconds")
+		if q.Get("id") != "7" || q.Get("hub.topic") != "https://feedr.example.com/feeds/1" {
+			http.NotFound(w, r)
+			return
+		}
+		if q.Get("hub.mode") == "unsubscribe" {
+			io.WriteString(w, "wrong")
+			return
+		}
+		io.WriteString(w, q.Get("hub.challenge"))
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	err := verifyIntent(ctx, srv.Client(), srv.URL+"?id=7", "subscribe", "https://feedr.example.com/feeds/1", time.Hour)
+	if err != nil {
+		t.Fatalf("expected intent to be verified, got %v", err)
+	}
+	if lease != "3600" {
+		t.Errorf("expected lease of 3600 seconds, got %q", lease)
+	}
+	err = verifyIntent(ctx, srv.Client(), srv.URL+"?id=7", "unsubscribe", "https://feedr.example.com/feeds/1", 0)
+	if !errors.Is(err, ErrChallenge) {
+		t.Errorf("expected ErrChallenge for a wrong echo, got %v", err)
+	}
+	err = verifyIntent(ctx, srv.Client(), srv.URL, "subscribe", "https://feedr.example.com/feeds/1", time.Hour)
+	if !errors.Is(err, ErrChallenge) {
+		t.Errorf("expected ErrChallenge for a 404, got %v", err)
+	}
+}
+
+func TestHubTopic(t *testing.T) {
+	h := NewHub(config.WebSubConfig{LeaseSeconds: 3600}, "https://feedr.example.com/")
+	if h.URL() != "https://feedr.example.com/websub/hub" {
+		t.Errorf("unexpected hub URL %q", h.URL())
+	}
+	render := func(name string) TopicFunc {
+		return func(context.Context, string) (string, []byte, error) {
+			return "text/plain", []byte(name), nil
+		}
+	}
+	h.Handle("/public/", render("public"))
+	h.Handle("/public/folders/", render("folders"))
+
+	var tests = []struct {
+		topic, want string
+	}{
+		{"https://feedr.example.com/public/lists/1", "public"},
+		{"https://feedr.example.com/public/folders/1", "folders"},
+		{"https://feedr.example.com/api/v1/me", ""},
+		{"https://other.example.com/public/lists/1", ""},
+	}
+	for _, tt := range tests {
+		fn, ok := h.topic(tt.topic)
+		if !ok {
+			if tt.want != "" {
+				t.Errorf("%s: expected topic to be published", tt.topic)
+			}
+			continue
+		}
+		_, body, _ := fn(context.Background(), tt.topic)
+		if string(body) != tt.want {
+			t.Errorf("%s: expected %q, got %q", tt.topic, tt.want, body)
+		}
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	if d := retryDelay(1); d != time.Minute {
+		t.Errorf("expected one minute, got %v", d)
+	}
+	if d := retryDelay(3); d != 4*time.Minute {
+		t.Errorf("expected four minutes, got %v", d)
+	}
+	if d := retryDelay(20); d != 128*time.Minute {
+		t.Errorf("expected the delay to be capped, got %v", d)
+	}
+}
+
+// memoryStore is a HubStore keeping everything in memory.
+type memoryStore struct {
+	mu         sync.Mutex
+	subs       []model.HubSubscription
+	deliveries []model.HubDelivery
+}
+
+func (m *memoryStore) SaveSubscription(ctx context.Context, s *model.HubSubscription) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.subs {
+		if m.subs[i].Topic == s.Topic && m.subs[i].Callback == s.Callback {
+			m.subs[i].Secret, m.subs[i].ExpiresAt = s.Secret, s.ExpiresAt
+			return nil
+		}
+	}
+	s.ID = model.NewID()
+	m.subs = append(m.subs, *s)
+	return nil
+}
+
+func (m *memoryStore) DeleteSubscription(ctx context.Context, topic, callback string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subs = slices.DeleteFunc(m.subs, func(s model.HubSubscription) bool {
+		return s.Topic == topic && s.Callback == callback
+	})
+	return nil
+}
+
+func (m *memoryStore) DeleteExpiredSubscriptions(ctx context.Context, now int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.subs = slices.DeleteFunc(m.subs, func(s model.HubSubscription) bool { return s.ExpiresAt < now })
+	return nil
+}
+
+func (m *memoryStore) ListSubscribers(ctx context.Context, topic string, now int64) ([]model.HubSubscription, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var subs []model.HubSubscription
+	for _, s := range m.subs {
+		if s.Topic == topic && s.ExpiresAt >= now {
+			subs = append(subs, s)
+		}
+	}
+	return subs, nil
+}
+
+func (m *memoryStore) CreateDeliveries(ctx context.Context, deliveries []*model.HubDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, d := range deliveries {
+		d.ID = int64(len(m.deliveries) + 1)
+		m.deliveries = append(m.deliveries, *d)
+	}
+	return nil
+}
+
+func (m *memoryStore) ListDueDeliveries(ctx context.Context, now int64, limit int) ([]model.HubDeliveryTarget, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var targets []model.HubDeliveryTarget
+	for _, d := range m.deliveries {
+		if d.NextAttemptAt > now || len(targets) == limit {
+			continue
+		}
+		for _, s := range m.subs {
+			if s.ID == d.SubscriptionID {
+				targets = append(targets, model.HubDeliveryTarget{HubDelivery: d, Topic: s.Topic, Callback: s.Callback, Secret: s.Secret})
+			}
+		}
+	}
+	return targets, nil
+}
+
+func (m *memoryStore) UpdateDeliveryAttempt(ctx context.Context, d *model.HubDelivery) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for i := range m.deliveries {
+		if m.deliveries[i].ID == d.ID {
+			m.deliveries[i] = *d
+		}
+	}
+	return nil
+}
+
+func (m *memoryStore) DeleteDelivery(ctx context.Context, id int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.deliveries = slices.DeleteFunc(m.deliveries, func(d model.HubDelivery) bool { return d.ID == id })
+	return nil
+}
+
+func TestHubDelivers(t *testing.T) {
+	const topic = "https://feedr.example.com/published/abc"
+	pushed := make(chan *http.Request, 1)
+	var pushedBody []byte
+	subscriber := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet {
+			q := r.URL.Query()
+			if q.Get("hub.mode") != "subscribe" || q.Get("hub.topic") != topic {
+				http.NotFound(w, r)
+				return
+			}
+			io.WriteString(w, q.Get("hub.challenge"))
+			return
+		}
+		pushedBody, _ = io.ReadAll(r.Body)
+		pushed <- r
+	}))
+	defer subscriber.Close()
+
+	store := &memoryStore{}
+	h := NewHub(config.WebSubConfig{LeaseSeconds: 3600}, "https://feedr.example.com")
+	h.Client = subscriber.Client()
+	h.Store = store
+	h.Handle("/published/", func(ctx context.Context, topic string) (string, []byte, error) {
+		return "application/atom+xml", []byte("<feed>" + topic + "</feed>"), nil
+	})
+	r := chi.NewRouter()
+	h.Mount(r)
+
+	ctx := context.Background()
+	if err := h.Publish(ctx, "https://feedr.example.com/api/v1/me"); !errors.Is(err, ErrUnknownTopic) {
+		t.Errorf("expected ErrUnknownTopic, got %v", err)
+	}
+
+	form := url.Values{
+		"hub.mode":     {"subscribe"},
+		"hub.topic":    {topic},
+		"hub.callback": {subscriber.URL + "/push"},
+		"hub.secret":   {"secret"},
+	}
+	req := httptest.NewRequest(http.MethodPost, HubPath, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("subscribe returned %d", w.Code)
+	}
+	// The intent is verified in the background.
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if subs, _ := store.ListSubscribers(ctx, topic, time.Now().Unix()); len(subs) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("subscription was not verified")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if err := h.Publish(ctx, topic); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	h.deliverDue(ctx)
+	select {
+	case got := <-pushed:
+		if string(pushedBody) != "<feed>"+topic+"</feed>" || got.Header.Get("Content-Type") != "application/atom+xml" {
+			t.Errorf("unexpected push %q of type %q", pushedBody, got.Header.Get("Content-Type"))
+		}
+		if !ValidSignature("secret", got.Header.Get("X-Hub-Signature"), pushedBody) {
+			t.Error("push is not signed with the subscriber's secret")
+		}
+		if hub, self := Links(got.Header.Values("Link")); hub != h.URL() || self != topic {
+			t.Errorf("unexpected links %q %q", hub, self)
+		}
+	default:
+		t.Fatal("nothing was pushed")
+	}
+	if len(store.deliveries) != 0 {
+		t.Errorf("expected the delivery to be removed, got %+v", store.deliveries)
+	}
+}